@@ -0,0 +1,430 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v29.3.0
+// source: pikachu/v1/change_event.proto
+
+// pikachu.v1 定义 pikachu 通过 gRPC 输出端推送变更事件的协议。
+// 客户端（pikachu）打开一个双向流，逐条发送 ChangeEvent；
+// 服务端对每条事件回复一个 EventAck，id 与事件的 id 对应。
+
+package pikachuv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// EventType 变更事件类型
+type EventType int32
+
+const (
+	EventType_EVENT_TYPE_UNSPECIFIED EventType = 0
+	EventType_EVENT_TYPE_INSERT      EventType = 1
+	EventType_EVENT_TYPE_UPDATE      EventType = 2
+	EventType_EVENT_TYPE_DELETE      EventType = 3
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "EVENT_TYPE_UNSPECIFIED",
+		1: "EVENT_TYPE_INSERT",
+		2: "EVENT_TYPE_UPDATE",
+		3: "EVENT_TYPE_DELETE",
+	}
+	EventType_value = map[string]int32{
+		"EVENT_TYPE_UNSPECIFIED": 0,
+		"EVENT_TYPE_INSERT":      1,
+		"EVENT_TYPE_UPDATE":      2,
+		"EVENT_TYPE_DELETE":      3,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_pikachu_v1_change_event_proto_enumTypes[0].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_pikachu_v1_change_event_proto_enumTypes[0]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_pikachu_v1_change_event_proto_rawDescGZIP(), []int{0}
+}
+
+// AckStatus 事件处理结果
+type AckStatus int32
+
+const (
+	AckStatus_ACK_STATUS_UNSPECIFIED AckStatus = 0
+	// 处理成功
+	AckStatus_ACK_STATUS_OK AckStatus = 1
+	// 暂时失败，pikachu 会按重试策略重发
+	AckStatus_ACK_STATUS_RETRY AckStatus = 2
+	// 永久失败，pikachu 不再重试
+	AckStatus_ACK_STATUS_REJECT AckStatus = 3
+)
+
+// Enum value maps for AckStatus.
+var (
+	AckStatus_name = map[int32]string{
+		0: "ACK_STATUS_UNSPECIFIED",
+		1: "ACK_STATUS_OK",
+		2: "ACK_STATUS_RETRY",
+		3: "ACK_STATUS_REJECT",
+	}
+	AckStatus_value = map[string]int32{
+		"ACK_STATUS_UNSPECIFIED": 0,
+		"ACK_STATUS_OK":          1,
+		"ACK_STATUS_RETRY":       2,
+		"ACK_STATUS_REJECT":      3,
+	}
+)
+
+func (x AckStatus) Enum() *AckStatus {
+	p := new(AckStatus)
+	*p = x
+	return p
+}
+
+func (x AckStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AckStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_pikachu_v1_change_event_proto_enumTypes[1].Descriptor()
+}
+
+func (AckStatus) Type() protoreflect.EnumType {
+	return &file_pikachu_v1_change_event_proto_enumTypes[1]
+}
+
+func (x AckStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AckStatus.Descriptor instead.
+func (AckStatus) EnumDescriptor() ([]byte, []int) {
+	return file_pikachu_v1_change_event_proto_rawDescGZIP(), []int{1}
+}
+
+// ChangeEvent 一行数据的变更
+//
+// 主键和行数据中的 64 位整数（BIGINT、BIGINT UNSIGNED）为十进制字符串，
+// 避免 google.protobuf.Value 的 double 丢失精度；时间为 RFC3339 字符串，其它整数和浮点数为数字
+type ChangeEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 事件ID，同一事件重试时保持不变，可用于去重
+	Id       string    `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	TaskId   string    `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	Database string    `protobuf:"bytes,3,opt,name=database,proto3" json:"database,omitempty"`
+	Table    string    `protobuf:"bytes,4,opt,name=table,proto3" json:"table,omitempty"`
+	Event    EventType `protobuf:"varint,5,opt,name=event,proto3,enum=pikachu.v1.EventType" json:"event,omitempty"`
+	// 主键值，复合主键为结构体
+	PrimaryId *structpb.Value `protobuf:"bytes,6,opt,name=primary_id,json=primaryId,proto3" json:"primary_id,omitempty"`
+	// 变更前的数据，仅 UPDATE 事件
+	OldData *structpb.Struct `protobuf:"bytes,7,opt,name=old_data,json=oldData,proto3" json:"old_data,omitempty"`
+	// 变更后的数据；DELETE 事件为被删除的数据
+	NewData   *structpb.Struct       `protobuf:"bytes,8,opt,name=new_data,json=newData,proto3" json:"new_data,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// 附加的元数据
+	Headers       map[string]string `protobuf:"bytes,10,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeEvent) Reset() {
+	*x = ChangeEvent{}
+	mi := &file_pikachu_v1_change_event_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeEvent) ProtoMessage() {}
+
+func (x *ChangeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pikachu_v1_change_event_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeEvent.ProtoReflect.Descriptor instead.
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return file_pikachu_v1_change_event_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ChangeEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetDatabase() string {
+	if x != nil {
+		return x.Database
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *ChangeEvent) GetEvent() EventType {
+	if x != nil {
+		return x.Event
+	}
+	return EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+func (x *ChangeEvent) GetPrimaryId() *structpb.Value {
+	if x != nil {
+		return x.PrimaryId
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetOldData() *structpb.Struct {
+	if x != nil {
+		return x.OldData
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetNewData() *structpb.Struct {
+	if x != nil {
+		return x.NewData
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ChangeEvent) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+// EventAck 对单条事件的确认
+type EventAck struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 对应 ChangeEvent.id
+	Id     string    `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status AckStatus `protobuf:"varint,2,opt,name=status,proto3,enum=pikachu.v1.AckStatus" json:"status,omitempty"`
+	// 失败原因，可选
+	Message       string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventAck) Reset() {
+	*x = EventAck{}
+	mi := &file_pikachu_v1_change_event_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventAck) ProtoMessage() {}
+
+func (x *EventAck) ProtoReflect() protoreflect.Message {
+	mi := &file_pikachu_v1_change_event_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventAck.ProtoReflect.Descriptor instead.
+func (*EventAck) Descriptor() ([]byte, []int) {
+	return file_pikachu_v1_change_event_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EventAck) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *EventAck) GetStatus() AckStatus {
+	if x != nil {
+		return x.Status
+	}
+	return AckStatus_ACK_STATUS_UNSPECIFIED
+}
+
+func (x *EventAck) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_pikachu_v1_change_event_proto protoreflect.FileDescriptor
+
+const file_pikachu_v1_change_event_proto_rawDesc = "" +
+	"\n" +
+	"\x1dpikachu/v1/change_event.proto\x12\n" +
+	"pikachu.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xea\x03\n" +
+	"\vChangeEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\atask_id\x18\x02 \x01(\tR\x06taskId\x12\x1a\n" +
+	"\bdatabase\x18\x03 \x01(\tR\bdatabase\x12\x14\n" +
+	"\x05table\x18\x04 \x01(\tR\x05table\x12+\n" +
+	"\x05event\x18\x05 \x01(\x0e2\x15.pikachu.v1.EventTypeR\x05event\x125\n" +
+	"\n" +
+	"primary_id\x18\x06 \x01(\v2\x16.google.protobuf.ValueR\tprimaryId\x122\n" +
+	"\bold_data\x18\a \x01(\v2\x17.google.protobuf.StructR\aoldData\x122\n" +
+	"\bnew_data\x18\b \x01(\v2\x17.google.protobuf.StructR\anewData\x128\n" +
+	"\ttimestamp\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12>\n" +
+	"\aheaders\x18\n" +
+	" \x03(\v2$.pikachu.v1.ChangeEvent.HeadersEntryR\aheaders\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"c\n" +
+	"\bEventAck\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12-\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x15.pikachu.v1.AckStatusR\x06status\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage*l\n" +
+	"\tEventType\x12\x1a\n" +
+	"\x16EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11EVENT_TYPE_INSERT\x10\x01\x12\x15\n" +
+	"\x11EVENT_TYPE_UPDATE\x10\x02\x12\x15\n" +
+	"\x11EVENT_TYPE_DELETE\x10\x03*g\n" +
+	"\tAckStatus\x12\x1a\n" +
+	"\x16ACK_STATUS_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rACK_STATUS_OK\x10\x01\x12\x14\n" +
+	"\x10ACK_STATUS_RETRY\x10\x02\x12\x15\n" +
+	"\x11ACK_STATUS_REJECT\x10\x032W\n" +
+	"\x12ChangeEventService\x12A\n" +
+	"\fStreamEvents\x12\x17.pikachu.v1.ChangeEvent\x1a\x14.pikachu.v1.EventAck(\x010\x01B\"Z pikachu/api/pikachu/v1;pikachuv1b\x06proto3"
+
+var (
+	file_pikachu_v1_change_event_proto_rawDescOnce sync.Once
+	file_pikachu_v1_change_event_proto_rawDescData []byte
+)
+
+func file_pikachu_v1_change_event_proto_rawDescGZIP() []byte {
+	file_pikachu_v1_change_event_proto_rawDescOnce.Do(func() {
+		file_pikachu_v1_change_event_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pikachu_v1_change_event_proto_rawDesc), len(file_pikachu_v1_change_event_proto_rawDesc)))
+	})
+	return file_pikachu_v1_change_event_proto_rawDescData
+}
+
+var file_pikachu_v1_change_event_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_pikachu_v1_change_event_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_pikachu_v1_change_event_proto_goTypes = []any{
+	(EventType)(0),                // 0: pikachu.v1.EventType
+	(AckStatus)(0),                // 1: pikachu.v1.AckStatus
+	(*ChangeEvent)(nil),           // 2: pikachu.v1.ChangeEvent
+	(*EventAck)(nil),              // 3: pikachu.v1.EventAck
+	nil,                           // 4: pikachu.v1.ChangeEvent.HeadersEntry
+	(*structpb.Value)(nil),        // 5: google.protobuf.Value
+	(*structpb.Struct)(nil),       // 6: google.protobuf.Struct
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+}
+var file_pikachu_v1_change_event_proto_depIdxs = []int32{
+	0, // 0: pikachu.v1.ChangeEvent.event:type_name -> pikachu.v1.EventType
+	5, // 1: pikachu.v1.ChangeEvent.primary_id:type_name -> google.protobuf.Value
+	6, // 2: pikachu.v1.ChangeEvent.old_data:type_name -> google.protobuf.Struct
+	6, // 3: pikachu.v1.ChangeEvent.new_data:type_name -> google.protobuf.Struct
+	7, // 4: pikachu.v1.ChangeEvent.timestamp:type_name -> google.protobuf.Timestamp
+	4, // 5: pikachu.v1.ChangeEvent.headers:type_name -> pikachu.v1.ChangeEvent.HeadersEntry
+	1, // 6: pikachu.v1.EventAck.status:type_name -> pikachu.v1.AckStatus
+	2, // 7: pikachu.v1.ChangeEventService.StreamEvents:input_type -> pikachu.v1.ChangeEvent
+	3, // 8: pikachu.v1.ChangeEventService.StreamEvents:output_type -> pikachu.v1.EventAck
+	8, // [8:9] is the sub-list for method output_type
+	7, // [7:8] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_pikachu_v1_change_event_proto_init() }
+func file_pikachu_v1_change_event_proto_init() {
+	if File_pikachu_v1_change_event_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pikachu_v1_change_event_proto_rawDesc), len(file_pikachu_v1_change_event_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pikachu_v1_change_event_proto_goTypes,
+		DependencyIndexes: file_pikachu_v1_change_event_proto_depIdxs,
+		EnumInfos:         file_pikachu_v1_change_event_proto_enumTypes,
+		MessageInfos:      file_pikachu_v1_change_event_proto_msgTypes,
+	}.Build()
+	File_pikachu_v1_change_event_proto = out.File
+	file_pikachu_v1_change_event_proto_goTypes = nil
+	file_pikachu_v1_change_event_proto_depIdxs = nil
+}
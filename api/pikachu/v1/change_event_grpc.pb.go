@@ -0,0 +1,125 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v29.3.0
+// source: pikachu/v1/change_event.proto
+
+// pikachu.v1 定义 pikachu 通过 gRPC 输出端推送变更事件的协议。
+// 客户端（pikachu）打开一个双向流，逐条发送 ChangeEvent；
+// 服务端对每条事件回复一个 EventAck，id 与事件的 id 对应。
+
+package pikachuv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ChangeEventService_StreamEvents_FullMethodName = "/pikachu.v1.ChangeEventService/StreamEvents"
+)
+
+// ChangeEventServiceClient is the client API for ChangeEventService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ChangeEventService 接收变更事件的服务
+type ChangeEventServiceClient interface {
+	// StreamEvents 双向流：客户端发送事件，服务端逐条回复确认，确认顺序可以与发送顺序不同
+	StreamEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChangeEvent, EventAck], error)
+}
+
+type changeEventServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChangeEventServiceClient(cc grpc.ClientConnInterface) ChangeEventServiceClient {
+	return &changeEventServiceClient{cc}
+}
+
+func (c *changeEventServiceClient) StreamEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChangeEvent, EventAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ChangeEventService_ServiceDesc.Streams[0], ChangeEventService_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChangeEvent, EventAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ChangeEventService_StreamEventsClient = grpc.BidiStreamingClient[ChangeEvent, EventAck]
+
+// ChangeEventServiceServer is the server API for ChangeEventService service.
+// All implementations must embed UnimplementedChangeEventServiceServer
+// for forward compatibility.
+//
+// ChangeEventService 接收变更事件的服务
+type ChangeEventServiceServer interface {
+	// StreamEvents 双向流：客户端发送事件，服务端逐条回复确认，确认顺序可以与发送顺序不同
+	StreamEvents(grpc.BidiStreamingServer[ChangeEvent, EventAck]) error
+	mustEmbedUnimplementedChangeEventServiceServer()
+}
+
+// UnimplementedChangeEventServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChangeEventServiceServer struct{}
+
+func (UnimplementedChangeEventServiceServer) StreamEvents(grpc.BidiStreamingServer[ChangeEvent, EventAck]) error {
+	return status.Error(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedChangeEventServiceServer) mustEmbedUnimplementedChangeEventServiceServer() {}
+func (UnimplementedChangeEventServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeChangeEventServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChangeEventServiceServer will
+// result in compilation errors.
+type UnsafeChangeEventServiceServer interface {
+	mustEmbedUnimplementedChangeEventServiceServer()
+}
+
+func RegisterChangeEventServiceServer(s grpc.ServiceRegistrar, srv ChangeEventServiceServer) {
+	// If the following call panics, it indicates UnimplementedChangeEventServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChangeEventService_ServiceDesc, srv)
+}
+
+func _ChangeEventService_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ChangeEventServiceServer).StreamEvents(&grpc.GenericServerStream[ChangeEvent, EventAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ChangeEventService_StreamEventsServer = grpc.BidiStreamingServer[ChangeEvent, EventAck]
+
+// ChangeEventService_ServiceDesc is the grpc.ServiceDesc for ChangeEventService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChangeEventService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pikachu.v1.ChangeEventService",
+	HandlerType: (*ChangeEventServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _ChangeEventService_StreamEvents_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pikachu/v1/change_event.proto",
+}
@@ -0,0 +1,97 @@
+// Package eventserver 提供 ChangeEventService 的参考服务端实现，
+// 供使用 gRPC 输出端接收 pikachu 事件的服务直接嵌入。
+//
+// 使用示例：
+//
+//	gs := grpc.NewServer()
+//	eventserver.Register(gs, func(ctx context.Context, event *pikachuv1.ChangeEvent) error {
+//		row := event.GetNewData().AsMap()
+//		// 处理事件...
+//		return nil
+//	})
+//	gs.Serve(listener)
+package eventserver
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+
+	pikachuv1 "pikachu/api/pikachu/v1"
+)
+
+// Handler 处理单条事件
+// 返回 nil 表示成功；返回 Retry 包装的错误表示暂时失败，pikachu 会重发；
+// 返回其它错误表示永久失败，pikachu 不再重试。
+type Handler func(ctx context.Context, event *pikachuv1.ChangeEvent) error
+
+// retryError 标记可重试的错误
+type retryError struct {
+	err error
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+// Retry 将错误标记为可重试
+func Retry(err error) error {
+	return &retryError{err: err}
+}
+
+// Server ChangeEventService 服务端实现
+type Server struct {
+	pikachuv1.UnimplementedChangeEventServiceServer
+	handler Handler
+}
+
+// New 创建服务端
+func New(handler Handler) *Server {
+	return &Server{handler: handler}
+}
+
+// Register 创建服务端并注册到 gRPC 服务器
+func Register(gs *grpc.Server, handler Handler) *Server {
+	server := New(handler)
+	pikachuv1.RegisterChangeEventServiceServer(gs, server)
+	return server
+}
+
+// StreamEvents 按接收顺序逐条处理事件并回复确认
+func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[pikachuv1.ChangeEvent, pikachuv1.EventAck]) error {
+	ctx := stream.Context()
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			// 客户端关闭发送方向时 Recv 返回 io.EOF，正常结束
+			return ignoreEOF(err)
+		}
+
+		ack := &pikachuv1.EventAck{
+			Id:     event.GetId(),
+			Status: pikachuv1.AckStatus_ACK_STATUS_OK,
+		}
+		if err := s.handler(ctx, event); err != nil {
+			ack.Message = err.Error()
+			var retry *retryError
+			if errors.As(err, &retry) {
+				ack.Status = pikachuv1.AckStatus_ACK_STATUS_RETRY
+			} else {
+				ack.Status = pikachuv1.AckStatus_ACK_STATUS_REJECT
+			}
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// ignoreEOF 将 io.EOF 视为正常结束
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,583 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// errDuplicateEntry MySQL 唯一键冲突的错误码
+const errDuplicateEntry = 1062
+
+// Coordinator 集群协调器
+//
+// 每个实例在成员表中占一行，按 heartbeat_interval 更新心跳；超过 member_timeout 没有心跳的实例被移出。
+// 所有实例用相同的成员列表构建一致性哈希环，各自计算分到的任务。成员表中的 slot 在存活实例间唯一，
+// 实例的 server_id 为 database.server_id + slot。任务位点按任务保存在 <table>_checkpoints 表中，
+// 任务迁移到其他实例后从该位点继续。位点表的 instance_id 记录任务的所有者：实例先取得任务再开始投递，
+// 只能更新自己拥有的任务的位点，停止后释放；新的所有者等待原所有者释放任务或其心跳过期后才能取得
+type Coordinator struct {
+	db                *sql.DB
+	id                string
+	table             string
+	checkpointTable   string
+	baseServerID      uint32
+	taskIDs           []string
+	heartbeatInterval time.Duration
+	memberTimeout     time.Duration
+	virtualNodes      int
+	maxInstances      int
+
+	mu         sync.Mutex
+	slot       int
+	members    []string
+	assignment *Assignment
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Assignment 本实例分到的任务，成员变化导致分到的任务或 server_id 改变时被新的分配取代
+type Assignment struct {
+	ServerID uint32
+	Tasks    []string      // 分到的任务ID，按配置中的顺序
+	changed  chan struct{} // 被取代时关闭
+}
+
+// Changed 返回分配被取代时关闭的通道
+func (a *Assignment) Changed() <-chan struct{} {
+	return a.changed
+}
+
+// Config 返回只包含分到的任务、并使用本实例 server_id 的配置副本
+func (a *Assignment) Config(cfg *types.Config) *types.Config {
+	shard := *cfg
+	shard.Database.ServerID = a.ServerID
+	shard.Tasks = make([]types.Task, 0, len(a.Tasks))
+	for _, task := range cfg.Tasks {
+		if slices.Contains(a.Tasks, task.TaskID) {
+			shard.Tasks = append(shard.Tasks, task)
+		}
+	}
+	return &shard
+}
+
+// Status 集群状态，用于健康检查
+type Status struct {
+	InstanceID string   `json:"instance_id"`
+	ServerID   uint32   `json:"server_id"`
+	Members    []string `json:"members"`
+	Tasks      []string `json:"tasks"`
+}
+
+// Join 创建协调表、登记本实例并计算首次分配，之后在后台维持心跳、跟踪成员变化
+func Join(ctx context.Context, cfg *types.Config) (*Coordinator, error) {
+	// clientFoundRows 使影响行数包括值没有变化的匹配行，用于判断心跳和位点是否写入了本实例的记录
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&clientFoundRows=true",
+		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port,
+		cfg.Database.Database, cfg.Database.Charset)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+
+	c := &Coordinator{
+		db:                db,
+		id:                cfg.Cluster.ID,
+		table:             cfg.Cluster.Table,
+		checkpointTable:   cfg.Cluster.Table + "_checkpoints",
+		baseServerID:      cfg.Database.ServerID,
+		heartbeatInterval: cfg.Cluster.HeartbeatInterval,
+		memberTimeout:     cfg.Cluster.MemberTimeout,
+		virtualNodes:      cfg.Cluster.VirtualNodes,
+		maxInstances:      cfg.Cluster.MaxInstances,
+		slot:              -1,
+		done:              make(chan struct{}),
+	}
+	for _, task := range cfg.Tasks {
+		c.taskIDs = append(c.taskIDs, task.TaskID)
+	}
+
+	if err := c.createTables(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := c.register(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := c.refresh(ctx); err != nil {
+		c.leave()
+		db.Close()
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(runCtx)
+	return c, nil
+}
+
+// createTables 创建成员表和任务位点表
+func (c *Coordinator) createTables(ctx context.Context) error {
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS `" + c.table + "` (" +
+			"`instance_id` VARCHAR(255) NOT NULL," +
+			"`slot` INT UNSIGNED NOT NULL," +
+			"`heartbeat_at` DATETIME(3) NOT NULL," +
+			"`joined_at` DATETIME(3) NOT NULL," +
+			"PRIMARY KEY (`instance_id`)," +
+			"UNIQUE KEY `uk_slot` (`slot`)" +
+			") ENGINE=InnoDB",
+		"CREATE TABLE IF NOT EXISTS `" + c.checkpointTable + "` (" +
+			"`task_id` VARCHAR(255) NOT NULL," +
+			"`log_name` VARCHAR(255) NOT NULL," +
+			"`log_pos` INT UNSIGNED NOT NULL," +
+			"`gtid_set` TEXT NULL," +
+			"`instance_id` VARCHAR(255) NOT NULL," + // 任务的所有者，为空表示没有实例持有
+			"`updated_at` DATETIME(3) NOT NULL," +
+			"PRIMARY KEY (`task_id`)" +
+			") ENGINE=InnoDB",
+	}
+	for _, stmt := range statements {
+		if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create coordination table: %w", err)
+		}
+	}
+	return nil
+}
+
+// register 登记本实例并占用一个空闲的 slot；同一实例标识的记录仍存活时沿用原来的 slot
+func (c *Coordinator) register(ctx context.Context) error {
+	if err := c.expireMembers(ctx); err != nil {
+		return err
+	}
+
+	var slot int
+	err := c.db.QueryRowContext(ctx,
+		"SELECT `slot` FROM `"+c.table+"` WHERE `instance_id` = ?", c.id).Scan(&slot)
+	if err == nil {
+		_, err = c.db.ExecContext(ctx,
+			"UPDATE `"+c.table+"` SET `heartbeat_at` = NOW(3) WHERE `instance_id` = ?", c.id)
+		if err != nil {
+			return fmt.Errorf("failed to update cluster member: %w", err)
+		}
+		c.setSlot(slot)
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to query cluster member: %w", err)
+	}
+
+	// 其他实例同时加入时可能抢到同一个 slot，唯一键冲突后重新选择
+	for attempt := 0; attempt < c.maxInstances; attempt++ {
+		slot, err := c.freeSlot(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = c.db.ExecContext(ctx,
+			"INSERT INTO `"+c.table+"` (`instance_id`, `slot`, `heartbeat_at`, `joined_at`) VALUES (?, ?, NOW(3), NOW(3))",
+			c.id, slot)
+		var mysqlErr *mysqldriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to register cluster member: %w", err)
+		}
+		c.setSlot(slot)
+		log.Info("Joined cluster", log.String("id", c.id), log.Int("slot", slot),
+			log.Uint32("server_id", c.baseServerID+uint32(slot)))
+		return nil
+	}
+	return fmt.Errorf("failed to register cluster member: too many concurrent joins")
+}
+
+// freeSlot 返回最小的未被占用的 slot
+func (c *Coordinator) freeSlot(ctx context.Context) (int, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT `slot` FROM `"+c.table+"`")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query cluster slots: %w", err)
+	}
+	defer rows.Close()
+
+	used := make(map[int]bool)
+	for rows.Next() {
+		var slot int
+		if err := rows.Scan(&slot); err != nil {
+			return 0, fmt.Errorf("failed to query cluster slots: %w", err)
+		}
+		used[slot] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query cluster slots: %w", err)
+	}
+
+	for slot := 0; slot < c.maxInstances; slot++ {
+		if !used[slot] {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("cluster is full: all %d slots are in use, increase cluster.max_instances", c.maxInstances)
+}
+
+// setSlot 记录本实例的 slot
+func (c *Coordinator) setSlot(slot int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slot = slot
+}
+
+// expireMembers 移出超过 member_timeout 没有心跳的实例，时间以数据库为准，不受各实例时钟偏差影响
+func (c *Coordinator) expireMembers(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx,
+		"DELETE FROM `"+c.table+"` WHERE `heartbeat_at` < NOW(3) - INTERVAL ? MICROSECOND",
+		c.memberTimeout.Microseconds())
+	if err != nil {
+		return fmt.Errorf("failed to expire cluster members: %w", err)
+	}
+	return nil
+}
+
+// run 定期心跳并重新计算分配，Leave 时退出
+func (c *Coordinator) run(ctx context.Context) {
+	defer close(c.done)
+
+	lastHeartbeat := time.Now()
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := c.heartbeat(ctx)
+		if err == nil {
+			err = c.refresh(ctx)
+		}
+		if err == nil {
+			lastHeartbeat = time.Now()
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 心跳中断太久时其他实例会移出本实例并接管任务，在此之前留出一个心跳间隔主动停止
+		if time.Since(lastHeartbeat) >= c.memberTimeout-c.heartbeatInterval {
+			log.Error("Cluster heartbeat failed for too long, releasing all tasks", zap.Error(err))
+			c.assign(nil, c.members, -1)
+		} else {
+			log.Warn("Cluster heartbeat failed", zap.Error(err))
+		}
+	}
+}
+
+// heartbeat 更新心跳；本实例已被其他实例移出时重新登记
+func (c *Coordinator) heartbeat(ctx context.Context) error {
+	result, err := c.db.ExecContext(ctx,
+		"UPDATE `"+c.table+"` SET `heartbeat_at` = NOW(3) WHERE `instance_id` = ?", c.id)
+	if err != nil {
+		return fmt.Errorf("failed to update heartbeat: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		log.Warn("This instance was removed from the cluster, registering again", log.String("id", c.id))
+		return c.register(ctx)
+	}
+	return nil
+}
+
+// refresh 移出失效的实例，按当前成员重新计算本实例分到的任务
+func (c *Coordinator) refresh(ctx context.Context) error {
+	if err := c.expireMembers(ctx); err != nil {
+		return err
+	}
+
+	rows, err := c.db.QueryContext(ctx, "SELECT `instance_id` FROM `"+c.table+"` ORDER BY `instance_id`")
+	if err != nil {
+		return fmt.Errorf("failed to query cluster members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to query cluster members: %w", err)
+		}
+		members = append(members, id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query cluster members: %w", err)
+	}
+
+	r := newRing(members, c.virtualNodes)
+	var tasks []string
+	for _, taskID := range c.taskIDs {
+		if r.owner(taskID) == c.id {
+			tasks = append(tasks, taskID)
+		}
+	}
+
+	c.mu.Lock()
+	slot := c.slot
+	c.mu.Unlock()
+	c.assign(tasks, members, slot)
+	return nil
+}
+
+// assign 更新成员列表和本实例的分配，分到的任务或 server_id 改变时取代原来的分配；slot 为-1表示不分配任务
+func (c *Coordinator) assign(tasks, members []string, slot int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !slices.Equal(c.members, members) {
+		log.Info("Cluster membership changed", log.Any("members", members))
+	}
+	c.members = members
+
+	var serverID uint32
+	if slot >= 0 {
+		serverID = c.baseServerID + uint32(slot)
+	} else {
+		tasks = nil
+	}
+	current := c.assignment
+	if current != nil && current.ServerID == serverID && slices.Equal(current.Tasks, tasks) {
+		return
+	}
+
+	c.assignment = &Assignment{ServerID: serverID, Tasks: tasks, changed: make(chan struct{})}
+	if current != nil {
+		close(current.changed)
+	}
+	log.Info("Cluster tasks assigned",
+		log.String("id", c.id),
+		log.Uint32("server_id", serverID),
+		log.Int("members", len(members)),
+		log.String("tasks", strings.Join(tasks, ",")))
+}
+
+// Assignment 返回本实例当前的分配
+func (c *Coordinator) Assignment() *Assignment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.assignment
+}
+
+// Status 返回集群状态
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{
+		InstanceID: c.id,
+		ServerID:   c.assignment.ServerID,
+		Members:    c.members,
+		Tasks:      c.assignment.Tasks,
+	}
+}
+
+// LoadCheckpoints 读取任务已保存的位点，没有保存过位点的任务不在结果中
+func (c *Coordinator) LoadCheckpoints(taskIDs []string) (map[string]mysql.Position, error) {
+	positions := make(map[string]mysql.Position, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return positions, nil
+	}
+
+	query := "SELECT `task_id`, `log_name`, `log_pos` FROM `" + c.checkpointTable +
+		"` WHERE `task_id` IN (" + placeholders(len(taskIDs)) + ") AND `log_name` <> ''"
+	rows, err := c.db.Query(query, taskArgs(taskIDs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID string
+		var pos mysql.Position
+		if err := rows.Scan(&taskID, &pos.Name, &pos.Pos); err != nil {
+			return nil, fmt.Errorf("failed to load task checkpoints: %w", err)
+		}
+		positions[taskID] = pos
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load task checkpoints: %w", err)
+	}
+	return positions, nil
+}
+
+// SaveCheckpoint 将位点保存为各任务的位点，只更新本实例拥有的任务；
+// 有任务已被其他实例取得时返回错误，这些任务的位点由新的所有者维护
+func (c *Coordinator) SaveCheckpoint(taskIDs []string, pos mysql.Position, gtidSet string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	var gtid interface{}
+	if gtidSet != "" {
+		gtid = gtidSet
+	}
+	args := append([]interface{}{pos.Name, pos.Pos, gtid, c.id}, taskArgs(taskIDs)...)
+	result, err := c.db.Exec("UPDATE `"+c.checkpointTable+"` "+
+		"SET `log_name` = ?, `log_pos` = ?, `gtid_set` = ?, `updated_at` = NOW(3) "+
+		"WHERE `instance_id` = ? AND `task_id` IN ("+placeholders(len(taskIDs))+")",
+		args...)
+	if err != nil {
+		return fmt.Errorf("failed to save task checkpoints: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected < int64(len(taskIDs)) {
+		return fmt.Errorf("%d of %d tasks are no longer owned by this instance, their checkpoints were not saved",
+			int64(len(taskIDs))-affected, len(taskIDs))
+	}
+	return nil
+}
+
+// Claim 取得分配中各任务的所有权，取得全部任务后返回true
+//
+// 任务没有所有者、所有者是本实例或所有者的心跳已超过 member_timeout 时立即取得，否则等待原所有者保存位点后释放；
+// 分配被取代或 ctx 结束时返回false，已取得的任务需调用 Release 释放
+func (c *Coordinator) Claim(ctx context.Context, assignment *Assignment) bool {
+	pending := assignment.Tasks
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		claimed, err := c.claim(ctx, pending)
+		if err != nil {
+			log.Warn("Failed to claim tasks", zap.Error(err))
+		} else {
+			pending = slices.DeleteFunc(slices.Clone(pending), func(taskID string) bool {
+				return slices.Contains(claimed, taskID)
+			})
+		}
+		if len(pending) == 0 {
+			return true
+		}
+		log.Info("Waiting for previous owners to release tasks", log.String("tasks", strings.Join(pending, ",")))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-assignment.Changed():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim 尝试取得任务，返回其中本实例已拥有的任务
+func (c *Coordinator) claim(ctx context.Context, taskIDs []string) ([]string, error) {
+	// 没有保存过位点的任务先插入空位点的记录，作为所有权的载体
+	values := make([]string, len(taskIDs))
+	for i := range taskIDs {
+		values[i] = "(?, '', 0, NULL, '', NOW(3))"
+	}
+	_, err := c.db.ExecContext(ctx, "INSERT INTO `"+c.checkpointTable+"` "+
+		"(`task_id`, `log_name`, `log_pos`, `gtid_set`, `instance_id`, `updated_at`) VALUES "+
+		strings.Join(values, ", ")+" ON DUPLICATE KEY UPDATE `task_id` = `task_id`",
+		taskArgs(taskIDs)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task records: %w", err)
+	}
+
+	args := append([]interface{}{c.id, c.id, c.memberTimeout.Microseconds()}, taskArgs(taskIDs)...)
+	_, err = c.db.ExecContext(ctx, "UPDATE `"+c.checkpointTable+"` AS `cp` SET `cp`.`instance_id` = ? "+
+		"WHERE (`cp`.`instance_id` IN ('', ?) OR NOT EXISTS (SELECT 1 FROM `"+c.table+"` AS `m` "+
+		"WHERE `m`.`instance_id` = `cp`.`instance_id` AND `m`.`heartbeat_at` >= NOW(3) - INTERVAL ? MICROSECOND)) "+
+		"AND `cp`.`task_id` IN ("+placeholders(len(taskIDs))+")",
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim tasks: %w", err)
+	}
+
+	rows, err := c.db.QueryContext(ctx, "SELECT `task_id` FROM `"+c.checkpointTable+"` "+
+		"WHERE `instance_id` = ? AND `task_id` IN ("+placeholders(len(taskIDs))+")",
+		append([]interface{}{c.id}, taskArgs(taskIDs)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task owners: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []string
+	for rows.Next() {
+		var taskID string
+		if err := rows.Scan(&taskID); err != nil {
+			return nil, fmt.Errorf("failed to query task owners: %w", err)
+		}
+		claimed = append(claimed, taskID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query task owners: %w", err)
+	}
+	return claimed, nil
+}
+
+// Release 释放本实例拥有的任务，等待中的新所有者随即取得；应在任务停止并保存位点之后调用
+// 失败时按心跳间隔重试，直到接近 member_timeout，此后其他实例在本实例心跳过期后取得任务
+func (c *Coordinator) Release(taskIDs []string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(c.memberTimeout - c.heartbeatInterval)
+	for {
+		_, err := c.db.Exec("UPDATE `"+c.checkpointTable+"` SET `instance_id` = '' "+
+			"WHERE `instance_id` = ? AND `task_id` IN ("+placeholders(len(taskIDs))+")",
+			append([]interface{}{c.id}, taskArgs(taskIDs)...)...)
+		if err == nil {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("failed to release tasks: %w", err)
+		}
+		log.Warn("Failed to release tasks, retrying", zap.Error(err))
+		time.Sleep(c.heartbeatInterval)
+	}
+}
+
+// placeholders 返回 n 个以逗号分隔的占位符
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// taskArgs 将任务ID转换为查询参数
+func taskArgs(taskIDs []string) []interface{} {
+	args := make([]interface{}, len(taskIDs))
+	for i, taskID := range taskIDs {
+		args[i] = taskID
+	}
+	return args
+}
+
+// Leave 停止心跳并从成员表中删除本实例，其他实例随即重新分配任务
+// 应在本实例的任务都已停止并保存位点之后调用
+func (c *Coordinator) Leave() {
+	c.cancel()
+	<-c.done
+	c.leave()
+	c.db.Close()
+}
+
+// leave 删除本实例的成员记录
+func (c *Coordinator) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.heartbeatInterval)
+	defer cancel()
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM `"+c.table+"` WHERE `instance_id` = ?", c.id); err != nil {
+		log.Warn("Failed to leave cluster", zap.Error(err))
+		return
+	}
+	log.Info("Left cluster", log.String("id", c.id))
+}
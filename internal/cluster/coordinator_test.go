@@ -0,0 +1,458 @@
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.Init(&types.LogConfig{Level: types.LogLevelError, Format: "text"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeMember 成员表中的一行
+type fakeMember struct {
+	slot      int
+	heartbeat time.Time
+}
+
+// fakeClusterDB 用内存中的成员表和位点表模拟协调器执行的 SQL，按语句前缀识别
+type fakeClusterDB struct {
+	mu           sync.Mutex
+	members      map[string]*fakeMember
+	owners       map[string]string // 任务ID -> 所有者，没有所有者时为空
+	positions    map[string]mysql.Position
+	heartbeatErr error  // 不为nil时心跳更新返回该错误
+	beforeJoin   func() // 插入成员记录之前调用，模拟其他实例同时加入
+}
+
+func newFakeClusterDB() *fakeClusterDB {
+	return &fakeClusterDB{
+		members:   make(map[string]*fakeMember),
+		owners:    make(map[string]string),
+		positions: make(map[string]mysql.Position),
+	}
+}
+
+// newTestCoordinator 创建使用模拟数据库的协调器，不登记成员也不启动心跳
+func newTestCoordinator(t *testing.T, db *fakeClusterDB, id string, taskIDs ...string) *Coordinator {
+	t.Helper()
+	sqlDB := sql.OpenDB(db)
+	t.Cleanup(func() { sqlDB.Close() })
+	return &Coordinator{
+		db:                sqlDB,
+		id:                id,
+		table:             "cluster",
+		checkpointTable:   "cluster_checkpoints",
+		baseServerID:      100,
+		taskIDs:           taskIDs,
+		heartbeatInterval: 10 * time.Millisecond,
+		memberTimeout:     60 * time.Millisecond,
+		virtualNodes:      16,
+		maxInstances:      4,
+		slot:              -1,
+		done:              make(chan struct{}),
+	}
+}
+
+// addMember 直接写入成员记录，heartbeat 为最近一次心跳的时间
+func (f *fakeClusterDB) addMember(id string, slot int, heartbeat time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.members[id] = &fakeMember{slot: slot, heartbeat: heartbeat}
+}
+
+func (f *fakeClusterDB) setOwner(taskID, owner string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.owners[taskID] = owner
+}
+
+func (f *fakeClusterDB) ownerOf(taskID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.owners[taskID]
+}
+
+func (f *fakeClusterDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeClusterConn{db: f}, nil
+}
+func (f *fakeClusterDB) Driver() driver.Driver { return nil }
+
+// exec 执行写语句，返回影响的行数
+func (f *fakeClusterDB) exec(query string, args []driver.Value) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+
+	switch {
+	case strings.HasPrefix(query, "DELETE FROM `cluster` WHERE `heartbeat_at` <"):
+		timeout := time.Duration(args[0].(int64)) * time.Microsecond
+		var n int64
+		for id, member := range f.members {
+			if member.heartbeat.Before(now.Add(-timeout)) {
+				delete(f.members, id)
+				n++
+			}
+		}
+		return n, nil
+
+	case strings.HasPrefix(query, "DELETE FROM `cluster` WHERE `instance_id` = ?"):
+		delete(f.members, args[0].(string))
+		return 1, nil
+
+	case strings.HasPrefix(query, "UPDATE `cluster` SET `heartbeat_at`"):
+		if f.heartbeatErr != nil {
+			return 0, f.heartbeatErr
+		}
+		member, ok := f.members[args[0].(string)]
+		if !ok {
+			return 0, nil
+		}
+		member.heartbeat = now
+		return 1, nil
+
+	case strings.HasPrefix(query, "INSERT INTO `cluster` "):
+		if f.beforeJoin != nil {
+			join := f.beforeJoin
+			f.beforeJoin = nil
+			f.mu.Unlock()
+			join()
+			f.mu.Lock()
+		}
+		id, slot := args[0].(string), int(args[1].(int64))
+		for _, member := range f.members {
+			if member.slot == slot {
+				return 0, &mysqldriver.MySQLError{Number: errDuplicateEntry, Message: "Duplicate entry for key 'uk_slot'"}
+			}
+		}
+		f.members[id] = &fakeMember{slot: slot, heartbeat: now}
+		return 1, nil
+
+	case strings.HasPrefix(query, "INSERT INTO `cluster_checkpoints` "):
+		for _, arg := range args {
+			if _, ok := f.owners[arg.(string)]; !ok {
+				f.owners[arg.(string)] = ""
+			}
+		}
+		return int64(len(args)), nil
+
+	case strings.HasPrefix(query, "UPDATE `cluster_checkpoints` AS `cp` SET `cp`.`instance_id` = ?"):
+		// 没有所有者、所有者是自己或所有者心跳过期时取得
+		id, timeout := args[0].(string), time.Duration(args[2].(int64))*time.Microsecond
+		var n int64
+		for _, arg := range args[3:] {
+			taskID := arg.(string)
+			owner, ok := f.owners[taskID]
+			if !ok {
+				continue
+			}
+			member, live := f.members[owner]
+			if owner == "" || owner == id || !live || member.heartbeat.Before(now.Add(-timeout)) {
+				f.owners[taskID] = id
+				n++
+			}
+		}
+		return n, nil
+
+	case strings.HasPrefix(query, "UPDATE `cluster_checkpoints` SET `log_name` = ?"):
+		pos := mysql.Position{Name: args[0].(string), Pos: uint32(args[1].(int64))}
+		id := args[3].(string)
+		var n int64
+		for _, arg := range args[4:] {
+			if taskID := arg.(string); f.owners[taskID] == id {
+				f.positions[taskID] = pos
+				n++
+			}
+		}
+		return n, nil
+
+	case strings.HasPrefix(query, "UPDATE `cluster_checkpoints` SET `instance_id` = ''"):
+		id := args[0].(string)
+		var n int64
+		for _, arg := range args[1:] {
+			if taskID := arg.(string); f.owners[taskID] == id {
+				f.owners[taskID] = ""
+				n++
+			}
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("unexpected statement: %s", query)
+}
+
+// query 执行查询语句
+func (f *fakeClusterDB) query(query string, args []driver.Value) (*fakeClusterRows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := &fakeClusterRows{}
+	switch {
+	case strings.HasPrefix(query, "SELECT `slot` FROM `cluster` WHERE `instance_id` = ?"):
+		rows.columns = []string{"slot"}
+		if member, ok := f.members[args[0].(string)]; ok {
+			rows.values = append(rows.values, []driver.Value{int64(member.slot)})
+		}
+
+	case strings.HasPrefix(query, "SELECT `slot` FROM `cluster`"):
+		rows.columns = []string{"slot"}
+		for _, member := range f.members {
+			rows.values = append(rows.values, []driver.Value{int64(member.slot)})
+		}
+
+	case strings.HasPrefix(query, "SELECT `instance_id` FROM `cluster` ORDER BY `instance_id`"):
+		rows.columns = []string{"instance_id"}
+		ids := make([]string, 0, len(f.members))
+		for id := range f.members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			rows.values = append(rows.values, []driver.Value{id})
+		}
+
+	case strings.HasPrefix(query, "SELECT `task_id` FROM `cluster_checkpoints` WHERE `instance_id` = ?"):
+		rows.columns = []string{"task_id"}
+		for _, arg := range args[1:] {
+			if taskID := arg.(string); f.owners[taskID] == args[0].(string) {
+				rows.values = append(rows.values, []driver.Value{taskID})
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return rows, nil
+}
+
+type fakeClusterConn struct {
+	db *fakeClusterDB
+}
+
+func (c *fakeClusterConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeClusterConn) Close() error              { return nil }
+func (c *fakeClusterConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+func (c *fakeClusterConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	n, err := c.db.exec(query, values(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+func (c *fakeClusterConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, values(args))
+}
+
+// values 取出参数值
+func values(args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Value
+	}
+	return vals
+}
+
+type fakeClusterRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeClusterRows) Columns() []string { return r.columns }
+func (r *fakeClusterRows) Close() error      { return nil }
+func (r *fakeClusterRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSaveCheckpointRequiresOwnership(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a")
+	db.setOwner("users", "a")
+	db.setOwner("orders", "b")
+	pos := mysql.Position{Name: "mysql-bin.000003", Pos: 1540}
+
+	if err := c.SaveCheckpoint([]string{"users"}, pos, ""); err != nil {
+		t.Fatalf("SaveCheckpoint() on an owned task error = %v", err)
+	}
+
+	// orders 已被 b 取得，a 的位点不能覆盖它
+	err := c.SaveCheckpoint([]string{"users", "orders"}, mysql.Position{Name: "mysql-bin.000003", Pos: 2210}, "")
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 tasks") {
+		t.Fatalf("SaveCheckpoint() error = %v, want 1 of 2 tasks not saved", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.positions["orders"]; ok {
+		t.Fatal("checkpoint written for a task owned by another instance")
+	}
+	if got := db.positions["users"].Pos; got != 2210 {
+		t.Fatalf("users position = %d, want 2210", got)
+	}
+}
+
+func TestClaimTakesTasksFromExpiredOwner(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a")
+	db.addMember("a", 0, time.Now())
+	db.addMember("b", 1, time.Now().Add(-time.Minute))
+	db.setOwner("users", "b")
+
+	// b 的心跳已过期，任务立即转给 a；没有记录的任务同时取得
+	assignment := &Assignment{Tasks: []string{"users", "orders"}, changed: make(chan struct{})}
+	if !c.Claim(context.Background(), assignment) {
+		t.Fatal("Claim() = false, want the tasks of an expired owner")
+	}
+	for _, taskID := range assignment.Tasks {
+		if owner := db.ownerOf(taskID); owner != "a" {
+			t.Fatalf("owner of %s = %q, want a", taskID, owner)
+		}
+	}
+}
+
+func TestClaimWaitsForLiveOwner(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a")
+	// b 的心跳在测试期间不会过期
+	db.addMember("a", 0, time.Now())
+	db.addMember("b", 1, time.Now().Add(time.Hour))
+	db.setOwner("users", "b")
+	b := newTestCoordinator(t, db, "b")
+
+	// b 仍有心跳时 a 一直等待，直到分配被取代
+	assignment := &Assignment{Tasks: []string{"users"}, changed: make(chan struct{})}
+	time.AfterFunc(50*time.Millisecond, func() { close(assignment.changed) })
+	if c.Claim(context.Background(), assignment) {
+		t.Fatal("Claim() took a task from a live owner")
+	}
+	if owner := db.ownerOf("users"); owner != "b" {
+		t.Fatalf("owner = %q, want b", owner)
+	}
+
+	// b 释放任务后 a 取得
+	assignment = &Assignment{Tasks: []string{"users"}, changed: make(chan struct{})}
+	claimed := make(chan bool, 1)
+	go func() { claimed <- c.Claim(context.Background(), assignment) }()
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-claimed:
+		t.Fatal("Claim() returned before the owner released the task")
+	default:
+	}
+	if err := b.Release([]string{"users"}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	select {
+	case ok := <-claimed:
+		if !ok {
+			t.Fatal("Claim() = false after the owner released the task")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Claim() did not take the released task")
+	}
+	if owner := db.ownerOf("users"); owner != "a" {
+		t.Fatalf("owner = %q, want a", owner)
+	}
+}
+
+func TestRegisterRetriesOnDuplicateSlot(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a")
+	// 查询空闲 slot 之后、插入之前，b 抢先占用了 slot 0
+	db.beforeJoin = func() { db.addMember("b", 0, time.Now()) }
+
+	if err := c.register(context.Background()); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	if c.slot != 1 {
+		t.Fatalf("slot = %d, want 1 after the conflict on slot 0", c.slot)
+	}
+}
+
+func TestHeartbeatRegistersAgainAfterRemoval(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a")
+	if err := c.register(context.Background()); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+
+	// 其他实例把 a 当作失效实例移出，并占用了它原来的 slot
+	db.mu.Lock()
+	delete(db.members, "a")
+	db.mu.Unlock()
+	db.addMember("b", 0, time.Now())
+
+	if err := c.heartbeat(context.Background()); err != nil {
+		t.Fatalf("heartbeat() error = %v", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	member, ok := db.members["a"]
+	if !ok || member.slot != 1 || c.slot != 1 {
+		t.Fatalf("member = %+v, slot = %d; want a registered again on slot 1", member, c.slot)
+	}
+}
+
+func TestRunReleasesTasksWhenHeartbeatFails(t *testing.T) {
+	db := newFakeClusterDB()
+	c := newTestCoordinator(t, db, "a", "users", "orders")
+	if err := c.register(context.Background()); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	if err := c.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+	assignment := c.Assignment()
+	if !slices.Equal(assignment.Tasks, []string{"users", "orders"}) || assignment.ServerID != 100 {
+		t.Fatalf("assignment = %+v, want both tasks on server_id 100", assignment)
+	}
+
+	db.mu.Lock()
+	db.heartbeatErr = errors.New("connection refused")
+	db.mu.Unlock()
+	failedAt := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.run(ctx)
+	defer func() {
+		cancel()
+		<-c.done
+	}()
+
+	// 心跳失败接近 member_timeout 时放弃所有任务，早于其他实例接管
+	select {
+	case <-assignment.Changed():
+	case <-time.After(time.Second):
+		t.Fatal("assignment was not released while heartbeats failed")
+	}
+	if elapsed := time.Since(failedAt); elapsed < c.memberTimeout-2*c.heartbeatInterval {
+		t.Fatalf("tasks released after %v, want close to member_timeout %v", elapsed, c.memberTimeout)
+	}
+	released := c.Assignment()
+	if len(released.Tasks) != 0 || released.ServerID != 0 {
+		t.Fatalf("assignment after heartbeat failures = %+v, want no tasks", released)
+	}
+}
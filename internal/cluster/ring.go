@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// ring 一致性哈希环
+// 每个实例在环上有多个虚拟节点，任务分配给顺时针方向第一个虚拟节点所属的实例；
+// 实例加入或离开时只有相邻区间的任务改变归属
+type ring struct {
+	points []uint64          // 已排序的虚拟节点哈希值
+	owners map[uint64]string // 虚拟节点所属的实例
+}
+
+// newRing 为实例列表创建哈希环，每个实例 vnodes 个虚拟节点
+func newRing(members []string, vnodes int) *ring {
+	r := &ring{owners: make(map[uint64]string, len(members)*vnodes)}
+	for _, member := range members {
+		for i := 0; i < vnodes; i++ {
+			point := hashKey(member + "#" + strconv.Itoa(i))
+			// 哈希冲突时保留字典序较小的实例，保证所有实例计算出相同的归属
+			owner, ok := r.owners[point]
+			if !ok {
+				r.points = append(r.points, point)
+			} else if owner < member {
+				continue
+			}
+			r.owners[point] = member
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner 返回任务所属的实例，环为空时返回空字符串
+func (r *ring) owner(taskID string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(taskID)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// hashKey 计算虚拟节点和任务在环上的位置，测试中替换以构造哈希冲突
+var hashKey = sha1Key
+
+// sha1Key 取 SHA-1 的前8字节作为哈希值，相近的键也能均匀分布在环上
+func sha1Key(key string) uint64 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ringTasks 测试用的任务ID
+func ringTasks() []string {
+	tasks := make([]string, 500)
+	for i := range tasks {
+		tasks[i] = fmt.Sprintf("task_%d", i)
+	}
+	return tasks
+}
+
+// ownersOf 返回每个任务在环上的归属
+func ownersOf(r *ring, tasks []string) map[string]string {
+	owners := make(map[string]string, len(tasks))
+	for _, taskID := range tasks {
+		owners[taskID] = r.owner(taskID)
+	}
+	return owners
+}
+
+func TestRingDeterministic(t *testing.T) {
+	tasks := ringTasks()
+	want := ownersOf(newRing([]string{"a", "b", "c"}, 64), tasks)
+	// 成员顺序不同、重复构建时归属相同，所有实例各自计算的结果一致
+	for _, members := range [][]string{{"a", "b", "c"}, {"c", "a", "b"}, {"b", "c", "a"}} {
+		got := ownersOf(newRing(members, 64), tasks)
+		for taskID, owner := range want {
+			if got[taskID] != owner {
+				t.Fatalf("members %v: owner(%s) = %q, want %q", members, taskID, got[taskID], owner)
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, owner := range want {
+		used[owner] = true
+	}
+	if len(used) != 3 {
+		t.Fatalf("tasks are assigned to %d members, want all 3", len(used))
+	}
+}
+
+func TestRingMembershipChangeMovesOnlyNeighbours(t *testing.T) {
+	tasks := ringTasks()
+	before := ownersOf(newRing([]string{"a", "b", "c"}, 64), tasks)
+
+	// 加入的实例只从其他实例接过任务，其余任务不变
+	joined := ownersOf(newRing([]string{"a", "b", "c", "d"}, 64), tasks)
+	moved := 0
+	for _, taskID := range tasks {
+		if joined[taskID] != before[taskID] {
+			if joined[taskID] != "d" {
+				t.Fatalf("task %s moved from %s to %s, want only moves to the new member", taskID, before[taskID], joined[taskID])
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > len(tasks)/2 {
+		t.Fatalf("%d of %d tasks moved to the new member, want about a quarter", moved, len(tasks))
+	}
+
+	// 离开的实例的任务分给其他实例，其余任务不变
+	left := ownersOf(newRing([]string{"a", "b"}, 64), tasks)
+	for _, taskID := range tasks {
+		if left[taskID] != before[taskID] && before[taskID] != "c" {
+			t.Fatalf("task %s moved from %s to %s although its owner stayed", taskID, before[taskID], left[taskID])
+		}
+	}
+}
+
+func TestRingHashCollisionKeepsSmallerMember(t *testing.T) {
+	// 只按虚拟节点序号计算位置，不同实例的同序号虚拟节点必然冲突
+	hashKey = func(key string) uint64 {
+		_, index, _ := strings.Cut(key, "#")
+		return sha1Key(index)
+	}
+	t.Cleanup(func() { hashKey = sha1Key })
+
+	for _, members := range [][]string{{"b", "a", "c"}, {"c", "b", "a"}} {
+		r := newRing(members, 8)
+		if len(r.points) != 8 {
+			t.Fatalf("ring has %d points, want 8 after collisions", len(r.points))
+		}
+		for _, point := range r.points {
+			if owner := r.owners[point]; owner != "a" {
+				t.Fatalf("members %v: colliding point owned by %q, want the lexically smallest member", members, owner)
+			}
+		}
+	}
+}
+
+func TestRingEmpty(t *testing.T) {
+	if owner := newRing(nil, 64).owner("users"); owner != "" {
+		t.Fatalf("owner() on an empty ring = %q, want empty", owner)
+	}
+}
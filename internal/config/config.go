@@ -2,14 +2,22 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"pikachu/internal/election"
+	"pikachu/internal/payload"
+	"pikachu/internal/response"
+	"pikachu/internal/transform"
 	"pikachu/internal/types"
+	"pikachu/internal/utils"
 )
 
 // LoadConfig 加载YAML配置文件
@@ -73,6 +81,10 @@ func ValidateConfig(config *types.Config) error {
 		return fmt.Errorf("database config validation failed: %w", err)
 	}
 
+	if err := validateCallbackHost(config.CallbackHost); err != nil {
+		return err
+	}
+
 	// 验证任务配置
 	for i, task := range config.Tasks {
 		if err := validateTaskConfig(&task, i); err != nil {
@@ -88,9 +100,106 @@ func ValidateConfig(config *types.Config) error {
 		return err
 	}
 
+	if config.Dispatcher.TLS != nil {
+		if err := validateTLSConfig(config.Dispatcher.TLS); err != nil {
+			return fmt.Errorf("dispatcher.tls: %w", err)
+		}
+	}
+	if config.Dispatcher.Proxy != nil {
+		if err := validateProxyConfig(config.Dispatcher.Proxy); err != nil {
+			return fmt.Errorf("dispatcher.proxy: %w", err)
+		}
+	}
+
+	switch config.Log.Output {
+	case "stdout", "stderr":
+	default:
+		return fmt.Errorf("log.output must be stdout or stderr, got: %s", config.Log.Output)
+	}
+	if config.Log.Format == "text" && config.Log.Output == "stdout" && usesStdoutSink(config.Tasks) {
+		return fmt.Errorf("log.output cannot be stdout when a task uses the stdout sink, logs would be mixed into the event stream")
+	}
+
+	switch config.Monitor.Backpressure {
+	case types.BackpressureDrop, types.BackpressureBlock:
+	default:
+		return fmt.Errorf("monitor.backpressure must be drop or block, got: %s", config.Monitor.Backpressure)
+	}
+	if config.Monitor.CheckpointInterval < 0 {
+		return fmt.Errorf("monitor.checkpoint_interval cannot be negative")
+	}
+
+	if config.Election.Enabled {
+		if err := validateElectionConfig(config); err != nil {
+			return fmt.Errorf("election: %w", err)
+		}
+	}
+	if config.Cluster.Enabled {
+		if err := validateClusterConfig(config); err != nil {
+			return fmt.Errorf("cluster: %w", err)
+		}
+	}
+
+	// 验证任务级投递策略与全局配置合并后的约束
+	for i := range config.Tasks {
+		task := &config.Tasks[i]
+		if err := validateTaskDelivery(&config.Dispatcher, task.Delivery); err != nil {
+			return fmt.Errorf("task[%d]: delivery: %w", i, err)
+		}
+		for j := range task.Destinations {
+			delivery := task.Destinations[j].Delivery
+			if err := validateTaskDelivery(&config.Dispatcher, delivery); err != nil {
+				return fmt.Errorf("task[%d]: destinations[%d]: delivery: %w", i, j, err)
+			}
+			if err := validateTaskDelivery(&config.Dispatcher, task.Delivery.Merge(delivery)); err != nil {
+				return fmt.Errorf("task[%d]: destinations[%d]: delivery: %w", i, j, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// validateTaskDelivery 验证任务级或目标级投递策略，覆盖项合并到全局配置后复用分发器的约束检查
+func validateTaskDelivery(global *types.DispatcherConfig, delivery *types.DeliveryConfig) error {
+	if delivery == nil {
+		return nil
+	}
+
+	if delivery.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	if delivery.MaxRetries != nil && *delivery.MaxRetries < 0 {
+		return fmt.Errorf("max_retries cannot be negative")
+	}
+	if delivery.RetryBaseDelay < 0 || delivery.RetryMaxDelay < 0 {
+		return fmt.Errorf("retry delays cannot be negative")
+	}
+	if delivery.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight cannot be negative")
+	}
+	if delivery.RateLimit != nil {
+		if err := validateRateLimit(delivery.RateLimit); err != nil {
+			return fmt.Errorf("rate_limit: %w", err)
+		}
+	}
+
+	effective := *global
+	if delivery.Timeout > 0 {
+		effective.Timeout = delivery.Timeout
+	}
+	if delivery.MaxRetries != nil {
+		effective.MaxRetries = *delivery.MaxRetries
+	}
+	if delivery.RetryBaseDelay > 0 {
+		effective.RetryBaseDelay = delivery.RetryBaseDelay
+	}
+	if delivery.RetryMaxDelay > 0 {
+		effective.RetryMaxDelay = delivery.RetryMaxDelay
+	}
+	return validateDispatcherConstraints(&effective)
+}
+
 // validateDatabaseConfig 验证数据库配置
 func validateDatabaseConfig(config *types.DatabaseConfig) error {
 	if config.Host == "" {
@@ -119,9 +228,6 @@ func validateTaskConfig(task *types.Task, index int) error {
 	if task.TableName == "" {
 		return fmt.Errorf("task[%d]: table_name cannot be empty", index)
 	}
-	if task.CallbackURL == "" {
-		return fmt.Errorf("task[%d]: callback_url cannot be empty", index)
-	}
 	if len(task.Events) == 0 {
 		return fmt.Errorf("task[%d]: events cannot be empty", index)
 	}
@@ -133,11 +239,484 @@ func validateTaskConfig(task *types.Task, index int) error {
 		}
 	}
 
-	// 验证回调URL格式 - 支持相对路径和绝对路径
-	if err := validateCallbackURL(task.CallbackURL); err != nil {
-		return fmt.Errorf("task[%d]: invalid callback_url: %w", index, err)
+	// 验证输出端配置
+	if len(task.Destinations) > 0 {
+		if err := validateDestinations(task); err != nil {
+			return fmt.Errorf("task[%d]: %w", index, err)
+		}
+	} else if err := validateSinkConfig(&task.Sink, task.CallbackURL); err != nil {
+		return fmt.Errorf("task[%d]: %w", index, err)
+	}
+
+	// 验证HTTP请求配置，有多个投递目标时作为HTTP目标的默认值
+	httpSink := len(task.Destinations) > 0 || isHTTPSink(&task.Sink)
+	if err := validateHTTPClientConfig(task.TLS, task.Proxy, httpSink); err != nil {
+		return fmt.Errorf("task[%d]: %w", index, err)
+	}
+	if err := validateHTTPRequestConfig(task.Method, task.Compression, task.ResponseValidation, httpSink); err != nil {
+		return fmt.Errorf("task[%d]: %w", index, err)
+	}
+
+	// 验证载荷格式配置
+	if err := validateFormatConfig(task); err != nil {
+		return fmt.Errorf("task[%d]: %w", index, err)
+	}
+
+	// 验证变更合并配置
+	if task.Coalesce != nil {
+		if task.Coalesce.Window <= 0 {
+			return fmt.Errorf("task[%d]: coalesce.window must be greater than 0", index)
+		}
+		if task.Coalesce.MaxKeys < 0 {
+			return fmt.Errorf("task[%d]: coalesce.max_keys cannot be negative", index)
+		}
+	}
+
+	// 验证转换脚本配置
+	if task.Transform != nil {
+		if err := validateTransformConfig(task); err != nil {
+			return fmt.Errorf("task[%d]: invalid transform: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTransformConfig 验证转换脚本配置并编译脚本
+func validateTransformConfig(task *types.Task) error {
+	cfg := task.Transform
+	if (cfg.Script == "") == (cfg.File == "") {
+		return fmt.Errorf("exactly one of script and file must be set")
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	switch cfg.OnError {
+	case "", types.TransformOnErrorPass, types.TransformOnErrorDrop:
+	default:
+		return fmt.Errorf("on_error must be pass or drop, got: %s", cfg.OnError)
+	}
+
+	_, err := transform.Compile(task.TaskID, cfg)
+	return err
+}
+
+// validateDestinations 验证任务的多个投递目标
+func validateDestinations(task *types.Task) error {
+	if task.CallbackURL != "" || task.Sink.Type != "" {
+		return fmt.Errorf("callback_url and sink cannot be set together with destinations")
+	}
+
+	names := make(map[string]bool)
+	for i := range task.Destinations {
+		dest := &task.Destinations[i]
+		if dest.Name == "" {
+			return fmt.Errorf("destinations[%d]: name cannot be empty", i)
+		}
+		if strings.Contains(dest.Name, "/") {
+			return fmt.Errorf("destinations[%d]: name cannot contain '/'", i)
+		}
+		if names[dest.Name] {
+			return fmt.Errorf("destinations[%d]: duplicate name '%s'", i, dest.Name)
+		}
+		names[dest.Name] = true
+
+		if err := validateSinkConfig(&dest.Sink, dest.CallbackURL); err != nil {
+			return fmt.Errorf("destinations[%d]: %w", i, err)
+		}
+		if err := validateHTTPClientConfig(dest.TLS, dest.Proxy, isHTTPSink(&dest.Sink)); err != nil {
+			return fmt.Errorf("destinations[%d]: %w", i, err)
+		}
+		if err := validateHTTPRequestConfig(dest.Method, dest.Compression, dest.ResponseValidation, isHTTPSink(&dest.Sink)); err != nil {
+			return fmt.Errorf("destinations[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// usesStdoutSink 判断是否有任务或投递目标使用标准输出输出端
+func usesStdoutSink(tasks []types.Task) bool {
+	for i := range tasks {
+		if tasks[i].Sink.Type == types.SinkStdout {
+			return true
+		}
+		for j := range tasks[i].Destinations {
+			if tasks[i].Destinations[j].Sink.Type == types.SinkStdout {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isHTTPSink 判断输出端是否为HTTP回调
+func isHTTPSink(sink *types.SinkConfig) bool {
+	return sink.Type == "" || sink.Type == types.SinkHTTP
+}
+
+// validateHTTPClientConfig 验证任务级或目标级的TLS和代理配置，两者只对HTTP输出端有效
+func validateHTTPClientConfig(tls *types.TLSConfig, proxy *types.ProxyConfig, httpSink bool) error {
+	if tls != nil {
+		if !httpSink {
+			return fmt.Errorf("tls is only supported for http sink")
+		}
+		if err := validateTLSConfig(tls); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
 	}
+	if proxy != nil {
+		if !httpSink {
+			return fmt.Errorf("proxy is only supported for http sink")
+		}
+		if err := validateProxyConfig(proxy); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+	}
+	return nil
+}
 
+// validateHTTPRequestConfig 验证任务级或目标级的请求方法、请求体压缩和响应校验配置，只对HTTP输出端有效
+func validateHTTPRequestConfig(method string, compression *types.CompressionConfig, validation *types.ResponseValidationConfig, httpSink bool) error {
+	if method != "" {
+		if !httpSink {
+			return fmt.Errorf("method is only supported for http sink")
+		}
+		switch strings.ToUpper(method) {
+		case "POST", "PUT", "PATCH":
+		default:
+			return fmt.Errorf("method must be POST, PUT or PATCH, got: %s", method)
+		}
+	}
+	if compression != nil {
+		if !httpSink {
+			return fmt.Errorf("compression is only supported for http sink")
+		}
+		switch compression.Algorithm {
+		case types.CompressionGzip, types.CompressionZstd:
+		default:
+			return fmt.Errorf("compression.algorithm must be gzip or zstd, got: %s", compression.Algorithm)
+		}
+		if compression.MinSize < 0 {
+			return fmt.Errorf("compression.min_size cannot be negative")
+		}
+	}
+	if validation != nil {
+		if !httpSink {
+			return fmt.Errorf("response_validation is only supported for http sink")
+		}
+		if _, err := response.Compile(validation); err != nil {
+			return fmt.Errorf("response_validation: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateElectionConfig 验证主备选举配置
+func validateElectionConfig(config *types.Config) error {
+	cfg := &config.Election
+	if !election.Registered(cfg.Type) {
+		return fmt.Errorf("type must be one of %s, got: %s", strings.Join(election.Names(), ", "), cfg.Type)
+	}
+	// 备节点接管时从主节点保存的位点继续，没有位点文件会从当前主库位点开始而跳过切换期间的事件
+	if config.Monitor.CheckpointPath == "" {
+		return fmt.Errorf("monitor.checkpoint_path is required and must be shared by all instances")
+	}
+	if cfg.RenewInterval < time.Second {
+		return fmt.Errorf("renew_interval must be at least 1s")
+	}
+	switch cfg.Type {
+	case types.ElectionMySQL:
+		// MySQL 5.7 起锁名称最长64个字符
+		if len(cfg.LockName) > 64 {
+			return fmt.Errorf("lock_name cannot be longer than 64 characters")
+		}
+	case types.ElectionFile:
+		if cfg.LeasePath == "" {
+			return fmt.Errorf("lease_path is required for file election")
+		}
+		if cfg.LeaseDuration < 2*cfg.RenewInterval {
+			return fmt.Errorf("lease_duration must be at least twice renew_interval")
+		}
+	}
+	return nil
+}
+
+// clusterTablePattern 协调表名称只允许字母、数字和下划线，直接拼接到SQL中
+var clusterTablePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// validateClusterConfig 验证集群模式配置
+func validateClusterConfig(config *types.Config) error {
+	cfg := &config.Cluster
+	if config.Election.Enabled {
+		return fmt.Errorf("cluster mode and election cannot be enabled together")
+	}
+	// 位点表名称为 <table>_checkpoints，MySQL 表名最长64个字符
+	if !clusterTablePattern.MatchString(cfg.Table) || len(cfg.Table) > 64-len("_checkpoints") {
+		return fmt.Errorf("table must contain only letters, digits and underscores and be at most %d characters, got: %s",
+			64-len("_checkpoints"), cfg.Table)
+	}
+	for i, task := range config.Tasks {
+		if task.TableName == cfg.Table || task.TableName == cfg.Table+"_checkpoints" {
+			return fmt.Errorf("task[%d]: cannot monitor the cluster coordination table %s", i, task.TableName)
+		}
+	}
+	if cfg.HeartbeatInterval < time.Second {
+		return fmt.Errorf("heartbeat_interval must be at least 1s")
+	}
+	if cfg.MemberTimeout < 2*cfg.HeartbeatInterval {
+		return fmt.Errorf("member_timeout must be at least twice heartbeat_interval")
+	}
+	if cfg.VirtualNodes < 1 {
+		return fmt.Errorf("virtual_nodes must be greater than 0")
+	}
+	if cfg.MaxInstances < 1 {
+		return fmt.Errorf("max_instances must be greater than 0")
+	}
+	if uint64(config.Database.ServerID)+uint64(cfg.MaxInstances)-1 > math.MaxUint32 {
+		return fmt.Errorf("database.server_id + max_instances - 1 exceeds the server_id range")
+	}
+	return nil
+}
+
+// validateProxyConfig 验证出站代理配置，url 为空表示直连
+func validateProxyConfig(cfg *types.ProxyConfig) error {
+	if cfg.URL == "" {
+		return nil
+	}
+	parsedURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	switch parsedURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("url scheme must be http, https, socks5 or socks5h, got: %s", parsedURL.Scheme)
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("url host cannot be empty")
+	}
+	return nil
+}
+
+// validateTLSConfig 验证HTTP客户端TLS配置，证书文件在创建分发器时加载
+func validateTLSConfig(cfg *types.TLSConfig) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	switch cfg.MinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return fmt.Errorf("min_version must be one of 1.0, 1.1, 1.2, 1.3, got: %s", cfg.MinVersion)
+	}
+	if cfg.ReloadInterval < 0 {
+		return fmt.Errorf("reload_interval cannot be negative")
+	}
+	return nil
+}
+
+// validateSinkConfig 验证输出端配置，callbackURL 为HTTP输出端的回调地址
+func validateSinkConfig(sink *types.SinkConfig, callbackURL string) error {
+	switch sink.Type {
+	case "", types.SinkHTTP:
+		if callbackURL == "" {
+			return fmt.Errorf("callback_url cannot be empty")
+		}
+		// 验证回调URL格式 - 支持相对路径和绝对路径
+		if err := validateCallbackURL(callbackURL); err != nil {
+			return fmt.Errorf("invalid callback_url: %w", err)
+		}
+	case types.SinkKafka:
+		kafka := sink.Kafka
+		if kafka == nil {
+			return fmt.Errorf("sink.kafka must be configured for kafka sink")
+		}
+		if len(kafka.Brokers) == 0 {
+			return fmt.Errorf("sink.kafka.brokers cannot be empty")
+		}
+		if kafka.Topic == "" {
+			return fmt.Errorf("sink.kafka.topic cannot be empty")
+		}
+		switch kafka.Acks {
+		case "", "all", "leader", "none":
+		default:
+			return fmt.Errorf("sink.kafka.acks must be one of all, leader, none, got: %s", kafka.Acks)
+		}
+	case types.SinkNATS:
+		nats := sink.NATS
+		if nats == nil {
+			return fmt.Errorf("sink.nats must be configured for nats sink")
+		}
+		if nats.URL == "" {
+			return fmt.Errorf("sink.nats.url cannot be empty")
+		}
+		if nats.Subject == "" {
+			return fmt.Errorf("sink.nats.subject cannot be empty")
+		}
+		if nats.Stream != "" && !nats.JetStream {
+			return fmt.Errorf("sink.nats.stream requires jetstream to be enabled")
+		}
+	case types.SinkRedis:
+		redis := sink.Redis
+		if redis == nil {
+			return fmt.Errorf("sink.redis must be configured for redis sink")
+		}
+		if redis.Addr == "" {
+			return fmt.Errorf("sink.redis.addr cannot be empty")
+		}
+		if redis.Stream == "" {
+			return fmt.Errorf("sink.redis.stream cannot be empty")
+		}
+		if redis.MaxLen < 0 {
+			return fmt.Errorf("sink.redis.max_len cannot be negative")
+		}
+		switch redis.FieldLayout {
+		case "", "json", "columns":
+		default:
+			return fmt.Errorf("sink.redis.field_layout must be json or columns, got: %s", redis.FieldLayout)
+		}
+	case types.SinkFile:
+		file := sink.File
+		if file == nil {
+			return fmt.Errorf("sink.file must be configured for file sink")
+		}
+		if file.Path == "" {
+			return fmt.Errorf("sink.file.path cannot be empty")
+		}
+		if file.MaxSizeMB < 0 || file.RotateInterval < 0 || file.MaxBackups < 0 {
+			return fmt.Errorf("sink.file rotation settings cannot be negative")
+		}
+	case types.SinkStdout:
+	case types.SinkGRPC:
+		grpc := sink.GRPC
+		if grpc == nil {
+			return fmt.Errorf("sink.grpc must be configured for grpc sink")
+		}
+		if grpc.Target == "" {
+			return fmt.Errorf("sink.grpc.target cannot be empty")
+		}
+		if grpc.MaxInFlight < 0 {
+			return fmt.Errorf("sink.grpc.max_in_flight cannot be negative")
+		}
+	default:
+		return fmt.Errorf("unsupported sink type '%s'", sink.Type)
+	}
+
+	return nil
+}
+
+// validateFormatConfig 验证任务载荷格式配置
+func validateFormatConfig(task *types.Task) error {
+	switch task.Format {
+	case "", types.FormatWebhook:
+	case types.FormatDebezium, types.FormatMaxwell, types.FormatCanal:
+		if err := validateFormattedSink(task); err != nil {
+			return err
+		}
+	case types.FormatCloudEvents:
+		if err := validateFormattedSink(task); err != nil {
+			return err
+		}
+		if task.CloudEvents != nil {
+			switch task.CloudEvents.Mode {
+			case "", types.CloudEventsStructured, types.CloudEventsBinary:
+			default:
+				return fmt.Errorf("cloudevents.mode must be structured or binary, got: %s", task.CloudEvents.Mode)
+			}
+		}
+	case types.FormatAvro, types.FormatProtobuf:
+		if err := validateSchemaRegistryConfig(task.SchemaRegistry); err != nil {
+			return fmt.Errorf("invalid schema_registry: %w", err)
+		}
+		if sinkType := lineSinkOf(task); sinkType != "" {
+			return fmt.Errorf("format '%s' cannot be used with %s sink: binary payloads break its newline-delimited output", task.Format, sinkType)
+		}
+		// 否则每个新的表结构都要访问注册中心并编码，结果却被丢弃
+		if err := validateFormattedSink(task); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported format '%s'", task.Format)
+	}
+
+	if task.PayloadTemplate != "" {
+		if sinkOf(task, types.SinkGRPC) != "" {
+			return fmt.Errorf("payload_template cannot be used with grpc sink: it sends typed ChangeEvent messages instead of the rendered body")
+		}
+		if err := validatePayloadTemplate(task); err != nil {
+			return fmt.Errorf("invalid payload_template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateFormattedSink 检查任务的输出端是否使用格式化后的消息体
+// gRPC 输出端按 protobuf 协议发送类型化的 ChangeEvent，不使用 format 生成的消息体
+func validateFormattedSink(task *types.Task) error {
+	if sinkOf(task, types.SinkGRPC) != "" {
+		return fmt.Errorf("format '%s' cannot be used with grpc sink: it sends typed ChangeEvent messages instead of the formatted body", task.Format)
+	}
+	return nil
+}
+
+// lineSinkOf 返回任务使用的按行输出的输出端类型（file、stdout），没有时返回空
+// 这类输出端以换行分隔消息，无法承载二进制消息体
+func lineSinkOf(task *types.Task) types.SinkType {
+	return sinkOf(task, types.SinkFile, types.SinkStdout)
+}
+
+// sinkOf 返回任务（配置了投递目标时为各投递目标）使用的第一个属于 sinkTypes 的输出端类型，没有时返回空
+func sinkOf(task *types.Task, sinkTypes ...types.SinkType) types.SinkType {
+	sinks := []*types.SinkConfig{&task.Sink}
+	if len(task.Destinations) > 0 {
+		sinks = sinks[:0]
+		for i := range task.Destinations {
+			sinks = append(sinks, &task.Destinations[i].Sink)
+		}
+	}
+	for _, sink := range sinks {
+		if slices.Contains(sinkTypes, sink.Type) {
+			return sink.Type
+		}
+	}
+	return ""
+}
+
+// validateSchemaRegistryConfig 验证 Schema Registry 配置
+func validateSchemaRegistryConfig(cfg *types.SchemaRegistryConfig) error {
+	if cfg == nil {
+		return fmt.Errorf("schema_registry is required for avro and protobuf formats")
+	}
+	if cfg.URL == "" {
+		return fmt.Errorf("url cannot be empty")
+	}
+	if err := validateURL(cfg.URL); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	return nil
+}
+
+// validatePayloadTemplate 解析自定义载荷模板，按表结构试渲染在监控器加载表结构时进行
+func validatePayloadTemplate(task *types.Task) error {
+	switch task.Format {
+	case "", types.FormatWebhook, types.FormatCloudEvents:
+	default:
+		return fmt.Errorf("cannot be combined with format '%s'", task.Format)
+	}
+
+	tpl, err := payload.Parse(task.TaskID, task.PayloadTemplate, task.PayloadContentType)
+	if err != nil {
+		return err
+	}
+
+	// 结构化模式下模板输出直接嵌入 data 字段，必须是JSON
+	if task.Format == types.FormatCloudEvents && tpl.ContentType() != payload.DefaultContentType &&
+		(task.CloudEvents == nil || task.CloudEvents.Mode != types.CloudEventsBinary) {
+		return fmt.Errorf("structured cloudevents requires payload_content_type %s", payload.DefaultContentType)
+	}
 	return nil
 }
 
@@ -159,8 +738,36 @@ func validateURL(urlStr string) error {
 	return nil
 }
 
-// validateCallbackURL 验证回调URL格式 - 支持相对路径和绝对路径
+// validateCallbackHost 验证回调主机地址，unix域套接字地址以第一个 : 分隔请求路径，套接字路径不能包含 :
+func validateCallbackHost(callbackHost string) error {
+	if !strings.HasPrefix(callbackHost, utils.UnixSocketURLPrefix) {
+		return nil
+	}
+	socketPath := strings.TrimSuffix(strings.TrimPrefix(callbackHost, utils.UnixSocketURLPrefix), ":")
+	if strings.Contains(socketPath, ":") {
+		return fmt.Errorf("callback_host unix socket path cannot contain ':', got: %s", callbackHost)
+	}
+	if !strings.HasPrefix(socketPath, "/") {
+		return fmt.Errorf("callback_host unix socket path must be absolute, expected unix:///path/to/receiver.sock, got: %s", callbackHost)
+	}
+	return nil
+}
+
+// validateCallbackURL 验证回调URL格式 - 支持相对路径、绝对路径和unix域套接字地址
 func validateCallbackURL(urlStr string) error {
+	if socketPath, requestPath, ok := utils.ParseUnixSocketURL(urlStr); ok {
+		if !strings.HasPrefix(socketPath, "/") {
+			return fmt.Errorf("unix socket path must be absolute, expected unix:///path/to/app.sock:/webhook, got: %s", urlStr)
+		}
+		if !strings.HasPrefix(requestPath, "/") {
+			return fmt.Errorf("unix socket request path must start with '/' and the socket path cannot contain ':', got: %s", urlStr)
+		}
+		if _, err := url.ParseRequestURI(requestPath); err != nil {
+			return fmt.Errorf("invalid unix socket request path: %w", err)
+		}
+		return validateURLTemplate(requestPath)
+	}
+
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
 		return fmt.Errorf("invalid callback URL format: %w", err)
@@ -180,8 +787,32 @@ func validateCallbackURL(urlStr string) error {
 			return fmt.Errorf("relative callback URL must start with '/', got: %s", urlStr)
 		}
 	}
+	if strings.Contains(parsedURL.Host, "{") {
+		return fmt.Errorf("callback URL host cannot contain placeholders")
+	}
 
-	return nil
+	return validateURLTemplate(urlStr)
+}
+
+// validateURLTemplate 验证回调URL中的占位符，如 /users/{id}，每个 { 都需要有对应的 } 且名称不能为空
+func validateURLTemplate(urlStr string) error {
+	for rest := urlStr; ; {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			return nil
+		}
+		if rest[start] == '}' {
+			return fmt.Errorf("unexpected '}' in callback URL: %s", urlStr)
+		}
+		end := strings.IndexAny(rest[start+1:], "{}")
+		if end < 0 || rest[start+1+end] != '}' {
+			return fmt.Errorf("unclosed placeholder in callback URL: %s", urlStr)
+		}
+		if end == 0 {
+			return fmt.Errorf("empty placeholder in callback URL: %s", urlStr)
+		}
+		rest = rest[start+1+end+1:]
+	}
 }
 
 // setDefaultValues 设置默认值
@@ -220,6 +851,45 @@ func setDefaultValues(config *types.Config) {
 	if config.Dispatcher.BatchTimeout <= 0 {
 		config.Dispatcher.BatchTimeout = 100 * time.Millisecond // 批处理超时
 	}
+	if config.Dispatcher.DrainTimeout <= 0 {
+		config.Dispatcher.DrainTimeout = 30 * time.Second
+	}
+	if config.Dispatcher.MaxRetryAfter <= 0 {
+		config.Dispatcher.MaxRetryAfter = 10 * time.Minute
+	}
+	if config.Dispatcher.CircuitBreaker.Scope == "" {
+		config.Dispatcher.CircuitBreaker.Scope = types.CircuitBreakerScopeHost
+	}
+	if config.Dispatcher.CircuitBreaker.FailureThreshold <= 0 {
+		config.Dispatcher.CircuitBreaker.FailureThreshold = 5
+	}
+	if config.Dispatcher.CircuitBreaker.OpenTimeout <= 0 {
+		config.Dispatcher.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	if config.Dispatcher.CircuitBreaker.HalfOpenRequests <= 0 {
+		config.Dispatcher.CircuitBreaker.HalfOpenRequests = 1
+	}
+	if config.Dispatcher.CircuitBreaker.MaxParked <= 0 {
+		config.Dispatcher.CircuitBreaker.MaxParked = 10000
+	}
+	if config.Dispatcher.AdaptiveConcurrency.MinLimit <= 0 {
+		config.Dispatcher.AdaptiveConcurrency.MinLimit = 1
+	}
+	if config.Dispatcher.AdaptiveConcurrency.MaxLimit <= 0 {
+		config.Dispatcher.AdaptiveConcurrency.MaxLimit = config.Dispatcher.WorkerCount
+	}
+	if config.Dispatcher.AdaptiveConcurrency.LatencyThreshold <= 0 {
+		config.Dispatcher.AdaptiveConcurrency.LatencyThreshold = 1 * time.Second
+	}
+	if config.Dispatcher.AdaptiveConcurrency.DecreaseFactor <= 0 {
+		config.Dispatcher.AdaptiveConcurrency.DecreaseFactor = 0.5
+	}
+	if config.Dispatcher.Overflow.MaxPending <= 0 {
+		config.Dispatcher.Overflow.MaxPending = 100000
+	}
+	if config.Dispatcher.Overflow.SpillMaxSizeMB <= 0 {
+		config.Dispatcher.Overflow.SpillMaxSizeMB = 1024
+	}
 
 	// 设置监控器默认值
 	if config.Monitor.EventQueueSize <= 0 {
@@ -238,6 +908,59 @@ func setDefaultValues(config *types.Config) {
 		config.Monitor.FlushInterval = 1 * time.Second // 刷新间隔
 	}
 
+	if config.Monitor.Backpressure == "" {
+		config.Monitor.Backpressure = types.BackpressureDrop
+	}
+
+	// 设置主备选举默认值
+	if config.Election.Enabled {
+		if config.Election.Type == "" {
+			config.Election.Type = types.ElectionMySQL
+		}
+		if config.Election.ID == "" {
+			config.Election.ID = utils.DefaultInstanceID()
+		}
+		if config.Election.LockName == "" {
+			config.Election.LockName = "pikachu-leader"
+		}
+		if config.Election.LeaseDuration <= 0 {
+			config.Election.LeaseDuration = 15 * time.Second
+		}
+		if config.Election.RenewInterval <= 0 {
+			config.Election.RenewInterval = 5 * time.Second
+		}
+		// 限制主节点异常退出后备节点接管时需要重放的事件数
+		if config.Monitor.CheckpointInterval == 0 {
+			config.Monitor.CheckpointInterval = 10 * time.Second
+		}
+	}
+
+	// 设置集群模式默认值
+	if config.Cluster.Enabled {
+		if config.Cluster.ID == "" {
+			config.Cluster.ID = utils.DefaultInstanceID()
+		}
+		if config.Cluster.Table == "" {
+			config.Cluster.Table = "pikachu_cluster"
+		}
+		if config.Cluster.HeartbeatInterval <= 0 {
+			config.Cluster.HeartbeatInterval = 5 * time.Second
+		}
+		if config.Cluster.MemberTimeout <= 0 {
+			config.Cluster.MemberTimeout = 30 * time.Second
+		}
+		if config.Cluster.VirtualNodes <= 0 {
+			config.Cluster.VirtualNodes = 64
+		}
+		if config.Cluster.MaxInstances <= 0 {
+			config.Cluster.MaxInstances = 16
+		}
+		// 实例异常退出后，接管其任务的实例从任务位点继续
+		if config.Monitor.CheckpointInterval == 0 {
+			config.Monitor.CheckpointInterval = 10 * time.Second
+		}
+	}
+
 	// 设置日志默认值
 	if config.Log.Level == "" {
 		config.Log.Level = types.LogLevelInfo
@@ -245,6 +968,13 @@ func setDefaultValues(config *types.Config) {
 	if config.Log.Format == "" {
 		config.Log.Format = "text"
 	}
+	if config.Log.Output == "" {
+		// 标准输出留给事件数据，日志改写到标准错误
+		config.Log.Output = "stdout"
+		if usesStdoutSink(config.Tasks) {
+			config.Log.Output = "stderr"
+		}
+	}
 
 	// 设置数据库默认charset
 	if config.Database.Charset == "" {
@@ -252,6 +982,17 @@ func setDefaultValues(config *types.Config) {
 	}
 }
 
+// validateRateLimit 验证令牌桶限流配置
+func validateRateLimit(limit *types.RateLimitConfig) error {
+	if limit.Rate <= 0 {
+		return fmt.Errorf("rate must be greater than 0")
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("burst cannot be negative")
+	}
+	return nil
+}
+
 // validateDispatcherConstraints 验证分发器配置的逻辑约束
 func validateDispatcherConstraints(config *types.DispatcherConfig) error {
 	// 如果设置了重试次数，基础重试延迟不能低于1秒
@@ -288,5 +1029,38 @@ func validateDispatcherConstraints(config *types.DispatcherConfig) error {
 		return fmt.Errorf("batch_size (%d) is too large, maximum recommended is 1000", config.BatchSize)
 	}
 
+	// 可重试状态码验证
+	for _, code := range config.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("retryable_status_codes contains invalid HTTP status code: %d", code)
+		}
+		if code >= 200 && code < 300 {
+			return fmt.Errorf("retryable_status_codes cannot contain success status code: %d", code)
+		}
+	}
+
+	// 熔断器配置验证
+	switch config.CircuitBreaker.Scope {
+	case types.CircuitBreakerScopeHost, types.CircuitBreakerScopeTask:
+	default:
+		return fmt.Errorf("circuit_breaker.scope must be host or task, got: %s", config.CircuitBreaker.Scope)
+	}
+
+	// 限流配置验证
+	for host, limit := range config.HostRateLimits {
+		if err := validateRateLimit(&limit); err != nil {
+			return fmt.Errorf("host_rate_limits[%s]: %w", host, err)
+		}
+	}
+
+	// 自适应并发配置验证
+	adaptive := &config.AdaptiveConcurrency
+	if adaptive.MinLimit > adaptive.MaxLimit {
+		return fmt.Errorf("adaptive_concurrency.min_limit (%d) cannot be greater than max_limit (%d)", adaptive.MinLimit, adaptive.MaxLimit)
+	}
+	if adaptive.DecreaseFactor >= 1 {
+		return fmt.Errorf("adaptive_concurrency.decrease_factor must be between 0 and 1, got: %v", adaptive.DecreaseFactor)
+	}
+
 	return nil
 }
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"pikachu/internal/types"
+)
+
+// testConfig 返回只有一个任务的最小有效配置
+func testConfig(task types.Task) *types.Config {
+	if task.TaskID == "" {
+		task.TaskID = "users"
+	}
+	if task.TableName == "" {
+		task.TableName = "users"
+	}
+	if len(task.Events) == 0 {
+		task.Events = []types.EventType{types.EventInsert, types.EventUpdate, types.EventDelete}
+	}
+	return &types.Config{
+		Database: types.DatabaseConfig{Host: "127.0.0.1", Port: 3306, User: "root", Database: "app", ServerID: 1},
+		Tasks:    []types.Task{task},
+	}
+}
+
+func TestStdoutSinkMovesTextLogsToStderr(t *testing.T) {
+	cfg := testConfig(types.Task{Sink: types.SinkConfig{Type: types.SinkStdout}})
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	if cfg.Log.Output != "stderr" {
+		t.Fatalf("log.output = %q, want stderr", cfg.Log.Output)
+	}
+
+	cfg = testConfig(types.Task{CallbackURL: "http://example.com/webhook"})
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	if cfg.Log.Output != "stdout" {
+		t.Fatalf("log.output = %q, want stdout", cfg.Log.Output)
+	}
+}
+
+func TestStdoutSinkRejectsTextLogsOnStdout(t *testing.T) {
+	cfg := testConfig(types.Task{Destinations: []types.DestinationConfig{
+		{Name: "hook", CallbackURL: "http://example.com/webhook"},
+		{Name: "pipe", Sink: types.SinkConfig{Type: types.SinkStdout}},
+	}})
+	cfg.Log.Output = "stdout"
+	err := ValidateConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "log.output") {
+		t.Fatalf("ValidateConfig error = %v, want log.output error", err)
+	}
+
+	// json 格式的日志写入文件，不与事件数据混在一起
+	cfg = testConfig(types.Task{Sink: types.SinkConfig{Type: types.SinkStdout}})
+	cfg.Log.Format = "json"
+	cfg.Log.Output = "stdout"
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig with json logs: %v", err)
+	}
+}
+
+func TestBinaryFormatRejectsLineSinks(t *testing.T) {
+	registry := &types.SchemaRegistryConfig{URL: "http://localhost:8081"}
+	for _, format := range []types.PayloadFormat{types.FormatAvro, types.FormatProtobuf} {
+		cfg := testConfig(types.Task{
+			Format:         format,
+			SchemaRegistry: registry,
+			Sink:           types.SinkConfig{Type: types.SinkFile, File: &types.FileSinkConfig{Path: "/tmp/events.ndjson"}},
+		})
+		err := ValidateConfig(cfg)
+		if err == nil || !strings.Contains(err.Error(), "file sink") {
+			t.Fatalf("%s with file sink: error = %v, want file sink error", format, err)
+		}
+
+		cfg = testConfig(types.Task{
+			Format:         format,
+			SchemaRegistry: registry,
+			Destinations: []types.DestinationConfig{
+				{Name: "kafka", Sink: types.SinkConfig{Type: types.SinkKafka, Kafka: &types.KafkaSinkConfig{Brokers: []string{"localhost:9092"}, Topic: "cdc"}}},
+				{Name: "pipe", Sink: types.SinkConfig{Type: types.SinkStdout}},
+			},
+		})
+		err = ValidateConfig(cfg)
+		if err == nil || !strings.Contains(err.Error(), "stdout sink") {
+			t.Fatalf("%s with stdout destination: error = %v, want stdout sink error", format, err)
+		}
+	}
+
+	// gRPC 输出端不使用编码后的消息体
+	for _, format := range []types.PayloadFormat{types.FormatAvro, types.FormatProtobuf} {
+		cfg := testConfig(types.Task{
+			Format:         format,
+			SchemaRegistry: registry,
+			Sink:           types.SinkConfig{Type: types.SinkGRPC, GRPC: &types.GRPCSinkConfig{Target: "localhost:9090"}},
+		})
+		err := ValidateConfig(cfg)
+		if err == nil || !strings.Contains(err.Error(), "grpc sink") {
+			t.Fatalf("%s with grpc sink: error = %v, want grpc sink error", format, err)
+		}
+	}
+
+	cfg := testConfig(types.Task{
+		Format:         types.FormatAvro,
+		SchemaRegistry: registry,
+		Sink:           types.SinkConfig{Type: types.SinkKafka, Kafka: &types.KafkaSinkConfig{Brokers: []string{"localhost:9092"}, Topic: "cdc"}},
+	})
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("avro with kafka sink: %v", err)
+	}
+}
+
+func TestGRPCSinkRejectsFormattedPayloads(t *testing.T) {
+	grpcSink := types.SinkConfig{Type: types.SinkGRPC, GRPC: &types.GRPCSinkConfig{Target: "localhost:9090"}}
+	for _, format := range []types.PayloadFormat{types.FormatDebezium, types.FormatMaxwell, types.FormatCanal, types.FormatCloudEvents} {
+		err := ValidateConfig(testConfig(types.Task{Format: format, Sink: grpcSink}))
+		if err == nil || !strings.Contains(err.Error(), "grpc sink") {
+			t.Fatalf("%s with grpc sink: error = %v, want grpc sink error", format, err)
+		}
+	}
+
+	// 投递目标中有 gRPC 输出端时同样拒绝
+	err := ValidateConfig(testConfig(types.Task{
+		PayloadTemplate: `{"id": {{ json .PrimaryID }}}`,
+		Destinations: []types.DestinationConfig{
+			{Name: "webhook", CallbackURL: "http://localhost:8080/webhook"},
+			{Name: "stream", Sink: grpcSink},
+		},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "payload_template cannot be used with grpc sink") {
+		t.Fatalf("payload_template with grpc destination: error = %v, want grpc sink error", err)
+	}
+
+	if err := ValidateConfig(testConfig(types.Task{Sink: grpcSink})); err != nil {
+		t.Fatalf("default format with grpc sink: %v", err)
+	}
+}
+
+func TestUnixSocketPathCannotContainColon(t *testing.T) {
+	for _, callbackURL := range []string{
+		"unix:///var/run/app.sock:/webhook",
+		"unix:///var/run/app.sock",
+	} {
+		if err := ValidateConfig(testConfig(types.Task{CallbackURL: callbackURL})); err != nil {
+			t.Fatalf("callback_url %s: %v", callbackURL, err)
+		}
+	}
+	for _, callbackURL := range []string{
+		"unix:///var/run/app:1.sock:/webhook",
+		"unix:///var/run/app:1.sock",
+		"unix://var/run/app.sock:/webhook",
+	} {
+		if err := ValidateConfig(testConfig(types.Task{CallbackURL: callbackURL})); err == nil {
+			t.Fatalf("callback_url %s was accepted", callbackURL)
+		}
+	}
+
+	for host, valid := range map[string]bool{
+		"unix:///var/run/receiver.sock":   true,
+		"unix:///var/run/receiver.sock:":  true,
+		"unix:///var/run/receiver:1.sock": false,
+		"unix://var/run/receiver.sock":    false,
+		"http://127.0.0.1:8080":           true,
+	} {
+		cfg := testConfig(types.Task{CallbackURL: "/webhook"})
+		cfg.CallbackHost = host
+		if err := ValidateConfig(cfg); (err == nil) != valid {
+			t.Fatalf("callback_host %s: error = %v, want valid %v", host, err, valid)
+		}
+	}
+}
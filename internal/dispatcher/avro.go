@@ -0,0 +1,144 @@
+package dispatcher
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"pikachu/internal/types"
+)
+
+// avroCodec Avro 二进制编码
+//
+// 事件编码为如下记录，行数据的每一列都是可空的联合类型：
+//
+//	Envelope { event: string, database: string, table: string,
+//	           timestamp: long(timestamp-millis), before: [null, Row], after: [null, Row] }
+type avroCodec struct{}
+
+func (avroCodec) schemaType() string  { return "AVRO" }
+func (avroCodec) contentType() string { return "avro/binary" }
+
+// avroTypeNames 编码类型对应的 Avro 基本类型
+var avroTypeNames = map[columnKind]string{
+	kindInt32:  "int",
+	kindInt64:  "long",
+	kindUint64: "string", // Avro 没有无符号整数，超出 long 范围的值按字符串保存
+	kindFloat:  "float",
+	kindDouble: "double",
+	kindString: "string",
+	kindBytes:  "bytes",
+}
+
+// define 生成 Avro schema 的JSON定义
+func (avroCodec) define(event *types.ChangeEvent, columns []binaryColumn) (string, error) {
+	fields := make([]map[string]interface{}, 0, len(columns))
+	for _, column := range columns {
+		fields = append(fields, map[string]interface{}{
+			"name":    column.field,
+			"type":    []string{"null", avroTypeNames[column.kind]},
+			"default": nil,
+		})
+	}
+
+	row := map[string]interface{}{
+		"type":   "record",
+		"name":   "Row",
+		"fields": fields,
+	}
+
+	schema := map[string]interface{}{
+		"type":      "record",
+		"name":      "Envelope",
+		"namespace": schemaNamespace(event),
+		"fields": []interface{}{
+			map[string]interface{}{"name": "event", "type": "string"},
+			map[string]interface{}{"name": "database", "type": "string"},
+			map[string]interface{}{"name": "table", "type": "string"},
+			map[string]interface{}{"name": "timestamp", "type": map[string]string{"type": "long", "logicalType": "timestamp-millis"}},
+			map[string]interface{}{"name": "before", "type": []interface{}{"null", row}, "default": nil},
+			map[string]interface{}{"name": "after", "type": []interface{}{"null", "Row"}, "default": nil},
+		},
+	}
+
+	definition, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(definition), nil
+}
+
+// encode 按 schema 定义的字段顺序编码事件
+func (avroCodec) encode(buf []byte, event *types.ChangeEvent, columns []binaryColumn) ([]byte, error) {
+	before, after := rowImages(event)
+
+	buf = avroAppendString(buf, string(event.Event))
+	buf = avroAppendString(buf, event.Database)
+	buf = avroAppendString(buf, event.Table)
+	buf = binary.AppendVarint(buf, eventTimeOf(event).UnixMilli())
+
+	var err error
+	for _, row := range []map[string]interface{}{before, after} {
+		if row == nil {
+			buf = binary.AppendVarint(buf, 0)
+			continue
+		}
+		buf = binary.AppendVarint(buf, 1)
+		if buf, err = avroAppendRow(buf, row, columns); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// avroAppendRow 编码一行数据，NULL 和缺失的列取联合类型的第一个分支
+func avroAppendRow(buf []byte, row map[string]interface{}, columns []binaryColumn) ([]byte, error) {
+	for _, column := range columns {
+		value := row[column.name]
+		if value == nil {
+			buf = binary.AppendVarint(buf, 0)
+			continue
+		}
+		buf = binary.AppendVarint(buf, 1)
+
+		switch column.kind {
+		case kindInt32, kindInt64:
+			// Avro 的 int 和 long 使用相同的 zigzag 变长编码
+			n, err := columnInt64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = binary.AppendVarint(buf, n)
+		case kindFloat:
+			f, err := columnFloat64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f)))
+		case kindDouble:
+			f, err := columnFloat64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+		case kindUint64:
+			n, err := columnUint64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = avroAppendString(buf, fmt.Sprint(n))
+		default:
+			b := columnBytes(value)
+			buf = binary.AppendVarint(buf, int64(len(b)))
+			buf = append(buf, b...)
+		}
+	}
+	return buf, nil
+}
+
+// avroAppendString 编码字符串：长度 + UTF-8 字节
+func avroAppendString(buf []byte, s string) []byte {
+	buf = binary.AppendVarint(buf, int64(len(s)))
+	return append(buf, s...)
+}
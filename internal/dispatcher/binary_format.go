@@ -0,0 +1,303 @@
+package dispatcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// columnKind 列在二进制编码中的类型
+type columnKind int
+
+const (
+	kindInt32 columnKind = iota
+	kindInt64
+	kindUint64
+	kindFloat
+	kindDouble
+	kindString
+	kindBytes
+)
+
+// binaryColumn 参与二进制编码的列
+type binaryColumn struct {
+	name  string // 表中的列名
+	field string // 在 schema 中的字段名，非法字符被替换
+	kind  columnKind
+}
+
+// binarySchema 由表结构推导出的 schema 及其在注册中心的ID
+type binarySchema struct {
+	source     *types.TableSchema // 推导所用的表结构，指针变化表示表结构已变更
+	id         int
+	definition string
+	columns    []binaryColumn
+}
+
+// binaryCodec 二进制编码方式
+type binaryCodec interface {
+	// schemaType 注册中心中的 schema 类型
+	schemaType() string
+	// contentType 消息体类型
+	contentType() string
+	// define 生成 schema 定义
+	define(event *types.ChangeEvent, columns []binaryColumn) (string, error)
+	// encode 在 Confluent 线格式头之后追加编码后的事件
+	encode(buf []byte, event *types.ChangeEvent, columns []binaryColumn) ([]byte, error)
+}
+
+// binaryFormatter 使用 Schema Registry 的二进制格式化器
+// 表结构在 OnTableChanged 后重新加载，检测到新的表结构时重新推导并注册 schema
+type binaryFormatter struct {
+	codec    binaryCodec
+	registry *SchemaRegistry
+	subject  string
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	schemas map[string]*binarySchema // 按 数据库.表 索引
+}
+
+// newBinaryFormatter 创建二进制格式化器
+func newBinaryFormatter(task *types.Task, codec binaryCodec) (*binaryFormatter, error) {
+	cfg := task.SchemaRegistry
+	if cfg == nil {
+		return nil, fmt.Errorf("schema_registry must be configured for %s format", task.Format)
+	}
+
+	subject := cfg.Subject
+	if subject == "" {
+		subject = "{database}.{table}-value"
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &binaryFormatter{
+		codec:    codec,
+		registry: NewSchemaRegistry(cfg),
+		subject:  subject,
+		timeout:  timeout,
+		schemas:  make(map[string]*binarySchema),
+	}, nil
+}
+
+// Format 编码为 Confluent 线格式：魔数0 + 4字节大端 schema ID + 编码后的数据
+func (f *binaryFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	schema, err := f.resolveSchema(event)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 5, 256)
+	binary.BigEndian.PutUint32(buf[1:], uint32(schema.id))
+
+	body, err := f.codec.encode(buf, event, schema.columns)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{Body: body, ContentType: f.codec.contentType()}, nil
+}
+
+// resolveSchema 返回事件对应的 schema，表结构变更后重新推导并注册
+func (f *binaryFormatter) resolveSchema(event *types.ChangeEvent) (*binarySchema, error) {
+	if event.Schema == nil {
+		return nil, fmt.Errorf("table schema for %s is not available", event.Table)
+	}
+
+	key := event.Database + "." + event.Table
+	f.mu.Lock()
+	schema, ok := f.schemas[key]
+	f.mu.Unlock()
+	if ok && schema.source == event.Schema {
+		return schema, nil
+	}
+
+	columns := binaryColumns(event.Schema)
+	definition, err := f.codec.define(event, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	// 请求注册中心时不持有锁，避免注册中心缓慢时阻塞其它表的编码；
+	// 同一表结构被并发解析时，重复的请求由注册的幂等性吸收
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	id, err := f.registry.SchemaID(ctx, expandTemplate(f.subject, event), f.codec.schemaType(), definition)
+	if err != nil {
+		return nil, err
+	}
+
+	schema = &binarySchema{
+		source:     event.Schema,
+		id:         id,
+		definition: definition,
+		columns:    columns,
+	}
+	f.mu.Lock()
+	f.schemas[key] = schema
+	f.mu.Unlock()
+	return schema, nil
+}
+
+// binaryColumns 按表中的列顺序推导各列的编码类型
+func binaryColumns(schema *types.TableSchema) []binaryColumn {
+	columns := make([]binaryColumn, 0, len(schema.ColumnNames))
+	for _, name := range schema.ColumnNames {
+		columns = append(columns, binaryColumn{
+			name:  name,
+			field: schemaFieldName(name),
+			kind:  columnKindOf(schema.Columns[name]),
+		})
+	}
+	return columns
+}
+
+// columnKindOf 根据MySQL列类型选择编码类型
+// DECIMAL 和时间类型按字符串编码，保证精度和格式不丢失
+func columnKindOf(columnType *sql.ColumnType) columnKind {
+	name := columnType.DatabaseTypeName()
+	unsigned := strings.HasPrefix(name, "UNSIGNED ")
+	name = strings.TrimPrefix(name, "UNSIGNED ")
+
+	switch name {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "YEAR":
+		return kindInt32
+	case "INT":
+		if unsigned {
+			return kindInt64
+		}
+		return kindInt32
+	case "BIGINT":
+		if unsigned {
+			return kindUint64
+		}
+		return kindInt64
+	case "BIT":
+		return kindUint64
+	case "FLOAT":
+		return kindFloat
+	case "DOUBLE":
+		return kindDouble
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return kindBytes
+	default:
+		return kindString
+	}
+}
+
+// schemaFieldName 将列名转换为 Avro 和 Protobuf 都接受的标识符
+func schemaFieldName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// schemaNamespace 生成 schema 的命名空间，如 pikachu.shop.users
+func schemaNamespace(event *types.ChangeEvent) string {
+	return "pikachu." + schemaFieldName(event.Database) + "." + schemaFieldName(event.Table)
+}
+
+// columnInt64 将列值转换为整数
+func columnInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to integer", value)
+	}
+}
+
+// columnUint64 将列值转换为无符号整数
+func columnUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case string:
+		return strconv.ParseUint(v, 10, 64)
+	case []byte:
+		return strconv.ParseUint(string(v), 10, 64)
+	default:
+		n, err := columnInt64(value)
+		return uint64(n), err
+	}
+}
+
+// columnFloat64 将列值转换为浮点数
+func columnFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	default:
+		n, err := columnInt64(value)
+		return float64(n), err
+	}
+}
+
+// columnBytes 将列值转换为字节
+func columnBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	case time.Time:
+		return []byte(v.Format(time.RFC3339Nano))
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
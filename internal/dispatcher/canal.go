@@ -0,0 +1,160 @@
+package dispatcher
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// canalFlatMessage Canal 的 FlatMessage 格式（canal.serverMode=kafka/rocketmq 且 flatMessage=true 时的输出）
+type canalFlatMessage struct {
+	ID        int64                `json:"id"`
+	Database  string               `json:"database"`
+	Table     string               `json:"table"`
+	PkNames   []string             `json:"pkNames"`
+	IsDdl     bool                 `json:"isDdl"`
+	Type      string               `json:"type"`
+	Es        int64                `json:"es"`
+	Ts        int64                `json:"ts"`
+	SQL       string               `json:"sql"`
+	SQLType   map[string]int       `json:"sqlType"`
+	MysqlType map[string]string    `json:"mysqlType"`
+	Data      []map[string]*string `json:"data"`
+	Old       []map[string]*string `json:"old"`
+}
+
+// canalFormatter 输出 Canal FlatMessage 兼容的JSON
+type canalFormatter struct{}
+
+// Format 编码为 Canal FlatMessage
+// Canal 的列值统一为字符串，NULL 为 null；每条消息只包含一行数据
+func (f *canalFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	before, after := rowImages(event)
+
+	message := &canalFlatMessage{
+		// Canal 的 id 是批次号，这里用 binlog 位置代替，同一个行事件中的多行共享同一个 id
+		ID:       int64(event.LogPos),
+		Database: event.Database,
+		Table:    event.Table,
+		PkNames:  event.PrimaryKeys,
+		Type:     strings.ToUpper(string(event.Event)),
+		Es:       eventTimeOf(event).UnixMilli(),
+		Ts:       event.Timestamp.UnixMilli(),
+	}
+
+	switch event.Event {
+	case types.EventDelete:
+		message.Data = []map[string]*string{canalColumns(before)}
+	case types.EventUpdate:
+		message.Data = []map[string]*string{canalColumns(after)}
+		message.Old = []map[string]*string{canalColumns(changedColumns(before, after))}
+	default:
+		message.Data = []map[string]*string{canalColumns(after)}
+	}
+
+	if event.Schema != nil {
+		message.SQLType = make(map[string]int, len(event.Schema.Columns))
+		message.MysqlType = make(map[string]string, len(event.Schema.Columns))
+		for column, columnType := range event.Schema.Columns {
+			message.SQLType[column] = canalSQLType(columnType)
+			message.MysqlType[column] = canalMysqlType(columnType)
+		}
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{Body: body, ContentType: "application/json"}, nil
+}
+
+// canalColumns 将行数据转换为字符串形式
+func canalColumns(data map[string]interface{}) map[string]*string {
+	columns := make(map[string]*string, len(data))
+	for column, value := range data {
+		if value == nil {
+			columns[column] = nil
+			continue
+		}
+		var s string
+		switch v := value.(type) {
+		case []byte:
+			s = string(v)
+		case time.Time:
+			s = v.Format("2006-01-02 15:04:05")
+		default:
+			s = fmt.Sprint(v)
+		}
+		columns[column] = &s
+	}
+	return columns
+}
+
+// canalJDBCTypes MySQL 类型到 java.sql.Types 的映射，与 Canal 的取值一致
+var canalJDBCTypes = map[string]int{
+	"BIT":        -7,
+	"TINYINT":    -6,
+	"SMALLINT":   5,
+	"MEDIUMINT":  4,
+	"INT":        4,
+	"BIGINT":     -5,
+	"FLOAT":      7,
+	"DOUBLE":     8,
+	"DECIMAL":    3,
+	"DATE":       91,
+	"TIME":       92,
+	"YEAR":       12,
+	"DATETIME":   93,
+	"TIMESTAMP":  93,
+	"CHAR":       1,
+	"VARCHAR":    12,
+	"BINARY":     2004,
+	"VARBINARY":  2004,
+	"TINYBLOB":   2004,
+	"BLOB":       2004,
+	"MEDIUMBLOB": 2004,
+	"LONGBLOB":   2004,
+	"TINYTEXT":   2005,
+	"TEXT":       2005,
+	"MEDIUMTEXT": 2005,
+	"LONGTEXT":   2005,
+	"ENUM":       4,
+	"SET":        -7,
+	"JSON":       12,
+	"GEOMETRY":   2004,
+}
+
+// canalSQLType 返回列的 java.sql.Types 取值，未知类型按 VARCHAR 处理
+func canalSQLType(columnType *sql.ColumnType) int {
+	name := strings.TrimPrefix(columnType.DatabaseTypeName(), "UNSIGNED ")
+	if sqlType, ok := canalJDBCTypes[name]; ok {
+		return sqlType
+	}
+	return 12
+}
+
+// canalMysqlType 返回列的MySQL类型声明，例如 varchar(255)、bigint unsigned
+func canalMysqlType(columnType *sql.ColumnType) string {
+	name := columnType.DatabaseTypeName()
+	unsigned := strings.HasPrefix(name, "UNSIGNED ")
+	name = strings.ToLower(strings.TrimPrefix(name, "UNSIGNED "))
+
+	switch name {
+	case "char", "varchar", "binary", "varbinary":
+		if length, ok := columnType.Length(); ok && length > 0 {
+			name = fmt.Sprintf("%s(%d)", name, length)
+		}
+	case "decimal":
+		if precision, scale, ok := columnType.DecimalSize(); ok {
+			name = fmt.Sprintf("%s(%d,%d)", name, precision, scale)
+		}
+	}
+	if unsigned {
+		name += " unsigned"
+	}
+	return name
+}
@@ -0,0 +1,293 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// circuitState 熔断器状态
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // 正常放行
+	circuitOpen                         // 熔断，投递被暂存
+	circuitHalfOpen                     // 冷却结束，放行少量探测请求
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// admission 熔断器对一次投递的处理结果
+type admission int
+
+const (
+	admitted admission = iota // 放行
+	parked                    // 已暂存，恢复后重新入队
+	rejected                  // 暂存已满，丢弃
+)
+
+// circuitBreaker 单个回调端点的熔断器
+//
+// 连续失败达到阈值后熔断，熔断期间的投递被暂存而不是消耗重试次数；
+// 冷却时间结束后进入半开状态，放行探测请求，探测成功则恢复并重新投递暂存的任务，失败则再次熔断
+type circuitBreaker struct {
+	key string
+	cfg *types.CircuitBreakerConfig
+	d   *Dispatcher
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int                   // 连续失败次数
+	probes   int                   // 半开状态下正在进行的探测数
+	parked   []*types.CallbackTask // 熔断期间暂存的投递
+	timer    *time.Timer
+}
+
+// breakerFor 返回回调任务对应的熔断器，未启用熔断器时返回nil
+func (d *Dispatcher) breakerFor(callbackTask *types.CallbackTask) *circuitBreaker {
+	cfg := &d.config.Dispatcher.CircuitBreaker
+	if !cfg.Enabled {
+		return nil
+	}
+
+	key := d.breakerKey(callbackTask)
+	if breaker, ok := d.breakers.Load(key); ok {
+		return breaker.(*circuitBreaker)
+	}
+
+	breaker, loaded := d.breakers.LoadOrStore(key, &circuitBreaker{key: key, cfg: cfg, d: d})
+	if !loaded {
+		d.metrics.SetCircuitState(key, circuitClosed.String())
+	}
+	return breaker.(*circuitBreaker)
+}
+
+// breakerKey 计算熔断器键：HTTP输出端按主机隔离，其他输出端和 task 范围按投递目标隔离
+func (d *Dispatcher) breakerKey(callbackTask *types.CallbackTask) string {
+	key := destinationKeyOf(callbackTask)
+	if d.config.Dispatcher.CircuitBreaker.Scope == types.CircuitBreakerScopeTask {
+		return "task:" + key
+	}
+
+	if _, ok := d.sinks[key].(*HTTPSink); ok {
+		if u, err := url.Parse(callbackTask.CallbackURL); err == nil && u.Host != "" {
+			return "host:" + u.Host
+		}
+	}
+	return "task:" + key
+}
+
+// admit 经过熔断器判断是否立即投递，暂存或丢弃时返回false
+func (d *Dispatcher) admit(breaker *circuitBreaker, callbackTask *types.CallbackTask) bool {
+	switch breaker.admit(callbackTask) {
+	case admitted:
+		return true
+	case parked:
+		log.Debug("Delivery parked by open circuit",
+			log.String("task_id", callbackTask.Event.TaskID),
+			log.String("breaker", breaker.key))
+		return false
+	default:
+		log.Warn("Circuit breaker parking full, dropping task",
+			log.String("task_id", callbackTask.Event.TaskID),
+			log.String("breaker", breaker.key),
+			log.Int("max_parked", breaker.cfg.MaxParked))
+		d.metrics.RecordError("circuit_parking_full", "dispatcher")
+		d.metrics.IncrementEventsDropped()
+		d.releaseCallbackTask(callbackTask)
+		return false
+	}
+}
+
+// admit 判断是否放行投递，熔断期间暂存任务
+func (b *circuitBreaker) admit(callbackTask *types.CallbackTask) admission {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitClosed:
+		return admitted
+	case circuitHalfOpen:
+		if b.probes < b.cfg.HalfOpenRequests {
+			b.probes++
+			return admitted
+		}
+	}
+
+	if len(b.parked) >= b.cfg.MaxParked {
+		return rejected
+	}
+	b.parked = append(b.parked, callbackTask)
+	return parked
+}
+
+// record 记录投递结果并推进状态
+func (b *circuitBreaker) record(err error) {
+	// 分发器停止导致的取消不代表端点故障
+	if err != nil && errors.Is(err, context.Canceled) {
+		return
+	}
+	// 永久失败说明端点可达，只是拒绝了这条消息
+	if isPermanent(err) {
+		err = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	if err == nil {
+		switch b.state {
+		case circuitOpen:
+			// 熔断前已经发出的请求晚到的成功不代表端点已恢复，只有半开状态的探测请求成功才关闭熔断器
+			return
+		case circuitHalfOpen:
+			b.setState(circuitClosed)
+			b.releaseParked(len(b.parked))
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	switch b.state {
+	case circuitClosed:
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open()
+		}
+	case circuitHalfOpen:
+		b.open()
+	}
+}
+
+// open 进入熔断状态，冷却时间后转为半开
+func (b *circuitBreaker) open() {
+	b.setState(circuitOpen)
+	b.d.metrics.IncrementCircuitOpens()
+
+	log.Warn("Circuit breaker opened",
+		log.String("breaker", b.key),
+		log.Int("consecutive_failures", b.failures),
+		log.Duration("open_timeout", b.cfg.OpenTimeout))
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(b.cfg.OpenTimeout, b.halfOpen)
+}
+
+// halfOpen 冷却结束，放出暂存的任务作为探测请求
+func (b *circuitBreaker) halfOpen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitOpen {
+		return
+	}
+	b.setState(circuitHalfOpen)
+	b.probes = 0
+	b.releaseParked(b.cfg.HalfOpenRequests)
+}
+
+// setState 更新状态和指标，调用方需持有锁
+func (b *circuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	log.Info("Circuit breaker state changed",
+		log.String("breaker", b.key),
+		log.String("from", b.state.String()),
+		log.String("to", state.String()),
+		log.Int("parked", len(b.parked)))
+	b.state = state
+	b.d.metrics.SetCircuitState(b.key, state.String())
+}
+
+// releaseParked 将最早暂存的 n 个任务重新入队，调用方需持有锁
+func (b *circuitBreaker) releaseParked(n int) {
+	if n > len(b.parked) {
+		n = len(b.parked)
+	}
+	if n == 0 {
+		return
+	}
+
+	released := make([]*types.CallbackTask, n)
+	copy(released, b.parked[:n])
+	b.parked = append(b.parked[:0], b.parked[n:]...)
+	b.d.requeueAsync(released)
+}
+
+// requeueAsync 在单独的协程中按顺序将任务放回工作队列，不阻塞调用方
+// 调用返回前计入处理中，排空时不会把正在送回的任务误判为已完成
+func (d *Dispatcher) requeueAsync(tasks []*types.CallbackTask) {
+	atomic.AddInt32(&d.busy, 1)
+	go func() {
+		defer atomic.AddInt32(&d.busy, -1)
+		for _, callbackTask := range tasks {
+			d.requeue(callbackTask)
+		}
+	}()
+}
+
+// requeue 将任务重新放回工作队列，队列满时等待直到分发器停止
+func (d *Dispatcher) requeue(callbackTask *types.CallbackTask) {
+	d.workersMux.RLock()
+	queueCount := len(d.taskQueues)
+	d.workersMux.RUnlock()
+	if queueCount == 0 {
+		log.Warn("No workers available for requeue, dropping task",
+			log.String("task_id", callbackTask.Event.TaskID))
+		d.releaseCallbackTask(callbackTask)
+		return
+	}
+
+	d.workersMux.RLock()
+	index := atomic.AddInt32(&workerIndex, 1) % int32(queueCount)
+	targetQueue := d.taskQueues[index]
+	d.workersMux.RUnlock()
+
+	select {
+	case targetQueue <- callbackTask:
+	case <-d.ctx.Done():
+		d.abandon(callbackTask)
+	}
+}
+
+// takeParked 取出全部暂存的任务并停止冷却计时，分发器停止时调用
+func (b *circuitBreaker) takeParked() []*types.CallbackTask {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	parked := b.parked
+	b.parked = nil
+	return parked
+}
+
+// parkedCount 返回暂存的任务数
+func (b *circuitBreaker) parkedCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.parked)
+}
@@ -0,0 +1,65 @@
+package dispatcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// newTestBreaker 创建不依赖工作协程的熔断器
+func newTestBreaker(threshold int) *circuitBreaker {
+	d := &Dispatcher{metrics: metrics.NewMetrics()}
+	return &circuitBreaker{
+		key: "host:example.com",
+		cfg: &types.CircuitBreakerConfig{
+			Enabled:          true,
+			FailureThreshold: threshold,
+			OpenTimeout:      time.Hour,
+			HalfOpenRequests: 1,
+			MaxParked:        10,
+		},
+		d: d,
+	}
+}
+
+func TestCircuitBreakerIgnoresLateSuccessWhileOpen(t *testing.T) {
+	b := newTestBreaker(2)
+	defer b.takeParked()
+
+	failure := errors.New("connection refused")
+	b.record(failure)
+	b.record(failure)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s after reaching the failure threshold, want open", b.state)
+	}
+
+	// 熔断前发出的请求晚到的成功
+	b.record(nil)
+	if b.state != circuitOpen {
+		t.Fatalf("state = %s after a late success, want open", b.state)
+	}
+	if got := b.admit(&types.CallbackTask{}); got != parked {
+		t.Fatalf("admit while open = %v, want parked", got)
+	}
+}
+
+func TestCircuitBreakerClosesAfterHalfOpenProbe(t *testing.T) {
+	b := newTestBreaker(1)
+	defer b.takeParked()
+
+	b.record(errors.New("timeout"))
+	b.mu.Lock()
+	b.setState(circuitHalfOpen)
+	b.mu.Unlock()
+
+	if got := b.admit(&types.CallbackTask{}); got != admitted {
+		t.Fatalf("admit in half-open = %v, want admitted", got)
+	}
+	b.record(nil)
+	if b.state != circuitClosed {
+		t.Fatalf("state = %s after a successful probe, want closed", b.state)
+	}
+}
@@ -0,0 +1,137 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// CloudEvents 1.0 规范版本
+const cloudEventsSpecVersion = "1.0"
+
+// cloudEvent CloudEvents 1.0 结构化模式的JSON表示
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// cloudEventsFormatter 将webhook载荷包装为CloudEvents 1.0事件
+// 结构化模式下事件属性和数据一起编码为 application/cloudevents+json；
+// 二进制模式下消息体为原始webhook载荷，事件属性通过 ce- 头传递
+type cloudEventsFormatter struct {
+	mode    string
+	source  string
+	webhook *webhookFormatter
+}
+
+// newCloudEventsFormatter 创建CloudEvents格式化器
+func newCloudEventsFormatter(cfg *types.CloudEventsConfig, db *types.DatabaseConfig, webhook *webhookFormatter) (*cloudEventsFormatter, error) {
+	formatter := &cloudEventsFormatter{
+		mode:    types.CloudEventsStructured,
+		source:  fmt.Sprintf("mysql://%s:%d/%s", db.Host, db.Port, db.Database),
+		webhook: webhook,
+	}
+
+	if cfg != nil {
+		if cfg.Mode != "" {
+			formatter.mode = cfg.Mode
+		}
+		if cfg.Source != "" {
+			formatter.source = cfg.Source
+		}
+	}
+
+	if formatter.mode != types.CloudEventsStructured && formatter.mode != types.CloudEventsBinary {
+		return nil, fmt.Errorf("invalid cloudevents mode: %s", formatter.mode)
+	}
+
+	return formatter, nil
+}
+
+// Format 编码为CloudEvents事件
+func (f *cloudEventsFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	data, err := f.webhook.Format(event)
+	if err != nil {
+		return nil, err
+	}
+
+	id := event.ID()
+	eventType := fmt.Sprintf("pikachu.%s.%s", event.Table, event.Event)
+	subject := formatPrimaryKey(event.PrimaryID)
+	timeStr := eventTimeOf(event).UTC().Format(time.RFC3339Nano)
+
+	if f.mode == types.CloudEventsBinary {
+		headers := map[string]string{
+			"ce-specversion": cloudEventsSpecVersion,
+			"ce-id":          id,
+			"ce-source":      f.source,
+			"ce-type":        eventType,
+			"ce-time":        timeStr,
+		}
+		if subject != "" {
+			headers["ce-subject"] = subject
+		}
+		for key, value := range headers {
+			headers[key] = encodeHeaderValue(value)
+		}
+		return &Encoded{Body: data.Body, ContentType: data.ContentType, Headers: headers}, nil
+	}
+
+	body, err := json.Marshal(&cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          f.source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            timeStr,
+		DataContentType: data.ContentType,
+		Data:            bytes.TrimRight(data.Body, "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encoded{Body: body, ContentType: "application/cloudevents+json"}, nil
+}
+
+// encodeHeaderValue 按 CloudEvents HTTP 协议绑定对 ce- 头的值做百分号编码：
+// 空格、双引号、百分号和 U+0021-U+007E 以外的字符按 UTF-8 字节编码为 %XX，
+// 复合主键的JSON和非ASCII的主键值因此可以安全地放入请求头
+func encodeHeaderValue(value string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x21 || c > 0x7E || c == '"' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0F])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// decodeHeaderValue 还原百分号编码的 ce- 头的值，格式错误时原样返回
+func decodeHeaderValue(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,69 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"pikachu/internal/types"
+)
+
+func TestCloudEventsBinaryHeadersPercentEncoded(t *testing.T) {
+	webhook := &webhookFormatter{
+		encode:      func(*types.ChangeEvent) ([]byte, error) { return []byte(`{}`), nil },
+		contentType: "application/json",
+	}
+	formatter, err := newCloudEventsFormatter(
+		&types.CloudEventsConfig{Mode: types.CloudEventsBinary, Source: "urn:pikachu:测试"},
+		&types.DatabaseConfig{Host: "db", Port: 3306, Database: "app"},
+		webhook)
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+
+	event := testEvent("users", 1)
+	event.PrimaryID = map[string]interface{}{"name": "Zoë 50%", "id": int64(1)}
+	encoded, err := formatter.Format(event)
+	if err != nil {
+		t.Fatalf("failed to format event: %v", err)
+	}
+
+	subject := formatPrimaryKey(event.PrimaryID)
+	want := map[string]string{
+		"ce-subject": encodeHeaderValue(subject),
+		"ce-source":  "urn:pikachu:%E6%B5%8B%E8%AF%95",
+		"ce-type":    "pikachu.users.insert",
+	}
+	for key, value := range want {
+		if got := encoded.Headers[key]; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	for key, value := range encoded.Headers {
+		for i := 0; i < len(value); i++ {
+			if c := value[i]; c < 0x21 || c > 0x7E || c == '"' {
+				t.Errorf("%s contains unencoded byte %q: %q", key, c, value)
+			}
+		}
+	}
+	if got := decodeHeaderValue(encoded.Headers["ce-subject"]); got != subject {
+		t.Errorf("decoded ce-subject = %q, want %q", got, subject)
+	}
+}
+
+func TestEncodeHeaderValue(t *testing.T) {
+	tests := map[string]string{
+		"42":              "42",
+		`{"id":1}`:        "{%22id%22:1}",
+		"a b":             "a%20b",
+		"100%":            "100%25",
+		"é":               "%C3%A9",
+		"line\nbreak\x7f": "line%0Abreak%7F",
+	}
+	for in, want := range tests {
+		if got := encodeHeaderValue(in); got != want {
+			t.Errorf("encodeHeaderValue(%q) = %q, want %q", in, got, want)
+		}
+		if got := decodeHeaderValue(want); got != in {
+			t.Errorf("decodeHeaderValue(%q) = %q, want %q", want, got, in)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// defaultCoalesceMaxKeys 默认最多同时合并的主键数
+const defaultCoalesceMaxKeys = 10000
+
+// coalescer 任务的变更合并器，只在事件循环协程中使用
+//
+// 主键的第一个事件到达时开始计时，窗口结束时发送合并后的事件，事件最多延迟一个窗口；
+// 窗口按到达顺序结束，不同主键之间保持第一个事件的先后顺序
+type coalescer struct {
+	cfg     *types.CoalesceConfig
+	maxKeys int
+	entries map[string]*coalesceEntry
+	order   []*coalesceEntry // 按到达顺序排列，已提前发送或抵消的条目留待出队时跳过
+}
+
+// coalesceEntry 一个主键正在合并的事件
+type coalesceEntry struct {
+	key      string
+	event    *types.ChangeEvent
+	deadline time.Time
+	done     bool // 已提前发送或已抵消
+}
+
+// newCoalescer 创建变更合并器
+func newCoalescer(cfg *types.CoalesceConfig) *coalescer {
+	maxKeys := cfg.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultCoalesceMaxKeys
+	}
+	return &coalescer{
+		cfg:     cfg,
+		maxKeys: maxKeys,
+		entries: make(map[string]*coalesceEntry),
+	}
+}
+
+// mergeResult 两个事件的合并结果
+type mergeResult int
+
+const (
+	mergeNone    mergeResult = iota // 无法合并，先发送之前的事件
+	mergeReplace                    // 合并为新事件
+	mergeCancel                     // 相互抵消
+)
+
+// merge 将同一主键的后一个事件合并到前一个事件上，合并结果写入 next
+func (c *coalescer) merge(prev, next *types.ChangeEvent) mergeResult {
+	switch {
+	case prev.Event == types.EventUpdate && next.Event == types.EventUpdate:
+		// 第一次的旧数据，最后一次的新数据
+		next.OldData = prev.OldData
+		return mergeReplace
+	case prev.Event == types.EventInsert && next.Event == types.EventUpdate:
+		// 接收方还没见过这一行，仍按插入发送最新数据
+		next.Event = types.EventInsert
+		next.OldData = nil
+		return mergeReplace
+	case prev.Event == types.EventUpdate && next.Event == types.EventDelete:
+		return mergeReplace
+	case prev.Event == types.EventInsert && next.Event == types.EventDelete && c.cfg.CancelInsertDelete:
+		return mergeCancel
+	default:
+		return mergeNone
+	}
+}
+
+// coalesceKey 计算合并键，没有主键的事件不参与合并
+// 合并键包含库名，不同库中同名表的同一主键不会互相合并
+func coalesceKey(event *types.ChangeEvent) (string, bool) {
+	if event.PrimaryID == nil {
+		return "", false
+	}
+	return event.Database + "\x00" + event.Table + "\x00" + formatPrimaryKey(event.PrimaryID), true
+}
+
+// coalesce 将事件交给任务的合并器，未配置合并的任务直接处理
+func (d *Dispatcher) coalesce(event *types.ChangeEvent) {
+	c, ok := d.coalescers[event.TaskID]
+	if !ok {
+		d.handleEvent(event)
+		return
+	}
+	key, ok := coalesceKey(event)
+	if !ok {
+		d.handleEvent(event)
+		return
+	}
+
+	if entry, ok := c.entries[key]; ok {
+		switch c.merge(entry.event, event) {
+		case mergeReplace:
+			entry.event = event
+			d.metrics.IncrementEventsCoalesced()
+			return
+		case mergeCancel:
+			log.Debug("Insert and delete cancelled out",
+				log.String("task_id", event.TaskID),
+				log.Any("primary_id", event.PrimaryID))
+			// 插入和删除两个事件都不再发送
+			d.finishCoalesced(c, entry)
+			d.metrics.IncrementEventsCoalesced()
+			d.metrics.IncrementEventsCoalesced()
+			return
+		default:
+			d.finishCoalesced(c, entry)
+			d.handleEvent(entry.event)
+		}
+	}
+
+	// 合并的主键数达到上限时提前发送最早的事件
+	for len(c.entries) >= c.maxKeys {
+		entry := c.order[0]
+		c.order[0] = nil
+		c.order = c.order[1:]
+		if !entry.done {
+			d.finishCoalesced(c, entry)
+			d.handleEvent(entry.event)
+		}
+	}
+
+	entry := &coalesceEntry{key: key, event: event, deadline: time.Now().Add(c.cfg.Window)}
+	c.entries[key] = entry
+	c.order = append(c.order, entry)
+	atomic.AddInt32(&d.coalescing, 1)
+}
+
+// finishCoalesced 将条目移出合并器
+func (d *Dispatcher) finishCoalesced(c *coalescer, entry *coalesceEntry) {
+	entry.done = true
+	delete(c.entries, entry.key)
+	atomic.AddInt32(&d.coalescing, -1)
+}
+
+// flushCoalesced 发送窗口已结束的合并事件，force 为true时发送全部
+func (d *Dispatcher) flushCoalesced(now time.Time, force bool) {
+	for _, c := range d.coalescers {
+		for len(c.order) > 0 {
+			entry := c.order[0]
+			if !entry.done && !force && entry.deadline.After(now) {
+				break
+			}
+			c.order[0] = nil
+			c.order = c.order[1:]
+			if !entry.done {
+				d.finishCoalesced(c, entry)
+				d.handleEvent(entry.event)
+			}
+		}
+	}
+}
+
+// nextCoalesceDeadline 返回最早结束的合并窗口，同时移除队首已提前发送或抵消的条目
+func (d *Dispatcher) nextCoalesceDeadline() (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, c := range d.coalescers {
+		for len(c.order) > 0 && c.order[0].done {
+			c.order[0] = nil
+			c.order = c.order[1:]
+		}
+		if len(c.order) == 0 {
+			continue
+		}
+		if deadline := c.order[0].deadline; !found || deadline.Before(next) {
+			next = deadline
+			found = true
+		}
+	}
+	return next, found
+}
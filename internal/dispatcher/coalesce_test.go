@@ -0,0 +1,184 @@
+package dispatcher
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+func TestCoalesceKeyIncludesDatabase(t *testing.T) {
+	a := &types.ChangeEvent{Database: "shard_1", Table: "users", PrimaryID: int64(1)}
+	b := &types.ChangeEvent{Database: "shard_2", Table: "users", PrimaryID: int64(1)}
+
+	keyA, ok := coalesceKey(a)
+	if !ok {
+		t.Fatal("event with primary key should be coalesced")
+	}
+	keyB, _ := coalesceKey(b)
+	if keyA == keyB {
+		t.Fatalf("rows from different databases share coalesce key %q", keyA)
+	}
+
+	if _, ok := coalesceKey(&types.ChangeEvent{Database: "app", Table: "logs"}); ok {
+		t.Fatal("event without primary key should not be coalesced")
+	}
+}
+
+// newCoalesceDispatcher 创建启用合并的分发器，合并后发送的事件进入返回的工作队列
+func newCoalesceDispatcher(t *testing.T, coalesce *types.CoalesceConfig) (*Dispatcher, chan *types.CallbackTask) {
+	t.Helper()
+	return newInlineDispatcher(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert, types.EventUpdate, types.EventDelete},
+		CallbackURL: "http://127.0.0.1:1/webhook",
+		Coalesce:    coalesce,
+	})
+}
+
+// rowEvent 构造主键为 id 的行变更事件
+func rowEvent(eventType types.EventType, id int64, oldName, newName string) *types.ChangeEvent {
+	event := testEvent("users", id)
+	event.Event = eventType
+	event.OldData, event.NewData = nil, nil
+	if oldName != "" {
+		event.OldData = map[string]interface{}{"id": id, "name": oldName}
+	}
+	if newName != "" {
+		event.NewData = map[string]interface{}{"id": id, "name": newName}
+	}
+	return event
+}
+
+// nameOf 返回行数据中的 name，行数据为nil时返回空字符串
+func nameOf(row map[string]interface{}) string {
+	if row == nil {
+		return ""
+	}
+	return row["name"].(string)
+}
+
+func TestCoalesceMerge(t *testing.T) {
+	type result struct {
+		event   types.EventType
+		oldName string
+		newName string
+	}
+	for _, tc := range []struct {
+		name   string
+		cancel bool
+		events []*types.ChangeEvent
+		want   []result
+	}{
+		{
+			name: "update+update keeps first old and last new data",
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventUpdate, 1, "a", "b"),
+				rowEvent(types.EventUpdate, 1, "b", "c"),
+			},
+			want: []result{{types.EventUpdate, "a", "c"}},
+		},
+		{
+			name: "insert+update stays an insert",
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventInsert, 1, "", "a"),
+				rowEvent(types.EventUpdate, 1, "a", "b"),
+			},
+			want: []result{{types.EventInsert, "", "b"}},
+		},
+		{
+			name: "update+delete becomes the delete",
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventUpdate, 1, "a", "b"),
+				rowEvent(types.EventDelete, 1, "", "b"),
+			},
+			want: []result{{types.EventDelete, "", "b"}},
+		},
+		{
+			name:   "insert+delete cancels out when enabled",
+			cancel: true,
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventInsert, 1, "", "a"),
+				rowEvent(types.EventDelete, 1, "", "a"),
+			},
+		},
+		{
+			name: "insert+delete emits both by default",
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventInsert, 1, "", "a"),
+				rowEvent(types.EventDelete, 1, "", "a"),
+			},
+			want: []result{{types.EventInsert, "", "a"}, {types.EventDelete, "", "a"}},
+		},
+		{
+			name: "delete+insert is not merged",
+			events: []*types.ChangeEvent{
+				rowEvent(types.EventDelete, 1, "", "a"),
+				rowEvent(types.EventInsert, 1, "", "b"),
+			},
+			want: []result{{types.EventDelete, "", "a"}, {types.EventInsert, "", "b"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, queue := newCoalesceDispatcher(t, &types.CoalesceConfig{Window: time.Hour, CancelInsertDelete: tc.cancel})
+			for _, event := range tc.events {
+				d.coalesce(event)
+			}
+
+			// 窗口未结束时不发送合并中的事件
+			d.flushCoalesced(time.Now(), false)
+			early := emitted(queue)
+			d.flushCoalesced(time.Time{}, true)
+
+			var got []result
+			for _, event := range append(early, emitted(queue)...) {
+				got = append(got, result{event.Event, nameOf(event.OldData), nameOf(event.NewData)})
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("emitted %v, want %v", got, tc.want)
+			}
+			if n := atomic.LoadInt32(&d.coalescing); n != 0 {
+				t.Fatalf("coalescing = %d after flush, want 0", n)
+			}
+			if !d.idle() {
+				t.Fatal("dispatcher is not idle after all coalesced events were sent")
+			}
+		})
+	}
+}
+
+func TestCoalesceEvictsOldestAtMaxKeys(t *testing.T) {
+	d, queue := newCoalesceDispatcher(t, &types.CoalesceConfig{Window: time.Hour, MaxKeys: 2})
+
+	for id := int64(1); id <= 3; id++ {
+		d.coalesce(rowEvent(types.EventInsert, id, "", "a"))
+	}
+	// 第三个主键到达时最早的主键提前发送
+	early := emitted(queue)
+	if len(early) != 1 || early[0].PrimaryID != int64(1) {
+		t.Fatalf("evicted %v, want only primary id 1", early)
+	}
+	if n := atomic.LoadInt32(&d.coalescing); n != 2 {
+		t.Fatalf("coalescing = %d, want 2", n)
+	}
+
+	// 提前发送的主键再次变更时重新开始合并，之后按到达顺序发送
+	d.coalesce(rowEvent(types.EventUpdate, 1, "a", "b"))
+	if evicted := emitted(queue); len(evicted) != 1 || evicted[0].PrimaryID != int64(2) {
+		t.Fatalf("evicted %v, want primary id 2", evicted)
+	}
+	d.flushCoalesced(time.Time{}, true)
+	var order []interface{}
+	for _, event := range emitted(queue) {
+		order = append(order, event.PrimaryID)
+	}
+	if !slices.Equal(order, []interface{}{int64(3), int64(1)}) {
+		t.Fatalf("flushed primary ids %v, want [3 1] in arrival order", order)
+	}
+	if n := atomic.LoadInt32(&d.coalescing); n != 0 {
+		t.Fatalf("coalescing = %d after flush, want 0", n)
+	}
+}
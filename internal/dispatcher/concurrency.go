@@ -0,0 +1,201 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// concurrencyLimiter 任务的并发限制器
+//
+// 固定模式下上限为任务的 max_in_flight；自适应模式下按 AIMD 调整上限：
+// 投递成功且延迟低于阈值时每完成约一轮（limit 次）投递上限加1，
+// 失败或延迟超过阈值时上限乘以缩减比例，每个延迟阈值周期内最多缩减一次，避免同一批失败反复缩减
+//
+// 达到上限时任务暂存在限制器中，不占用工作协程；有名额释放时按暂存顺序唤醒并重新入队
+type concurrencyLimiter struct {
+	taskID    string
+	adaptive  *types.AdaptiveConcurrencyConfig // 为nil时为固定上限
+	metrics   *metrics.Metrics
+	ready     func([]*types.CallbackTask) // 重新入队被唤醒的任务，在持有锁时调用，不能阻塞
+	wakeBatch int                         // 每个名额唤醒的任务数，批量投递时一批共用一个名额
+
+	mu           sync.Mutex
+	limit        float64
+	minLimit     float64
+	maxLimit     float64
+	inFlight     int
+	waking       int                   // 已唤醒、尚未重新占用名额的任务数
+	parked       []*types.CallbackTask // 等待名额的任务，按到达顺序排列
+	lastDecrease time.Time
+}
+
+// newConcurrencyLimiter 创建并发限制器，既未设置 max_in_flight 也未启用自适应时返回nil
+// ready 用于将被唤醒的任务重新入队，wakeBatch 为每个名额唤醒的任务数
+func newConcurrencyLimiter(taskID string, maxInFlight int, adaptive *types.AdaptiveConcurrencyConfig, m *metrics.Metrics, ready func([]*types.CallbackTask), wakeBatch int) *concurrencyLimiter {
+	if wakeBatch < 1 {
+		wakeBatch = 1
+	}
+	if !adaptive.Enabled {
+		if maxInFlight <= 0 {
+			return nil
+		}
+		limit := float64(maxInFlight)
+		return &concurrencyLimiter{
+			taskID:    taskID,
+			ready:     ready,
+			wakeBatch: wakeBatch,
+			limit:     limit,
+			minLimit:  limit,
+			maxLimit:  limit,
+		}
+	}
+
+	maxLimit := float64(adaptive.MaxLimit)
+	if maxInFlight > 0 && float64(maxInFlight) < maxLimit {
+		maxLimit = float64(maxInFlight)
+	}
+	minLimit := math.Min(float64(adaptive.MinLimit), maxLimit)
+
+	// 从上限开始，接收方出现过载迹象后再缩减，避免启动阶段吞吐不足
+	l := &concurrencyLimiter{
+		taskID:    taskID,
+		adaptive:  adaptive,
+		metrics:   m,
+		ready:     ready,
+		wakeBatch: wakeBatch,
+		limit:     maxLimit,
+		minLimit:  minLimit,
+		maxLimit:  maxLimit,
+	}
+	m.SetConcurrencyLimit(taskID, int(maxLimit))
+	return l
+}
+
+// admit 为一组同一投递目标的任务占用一个并发名额
+// 达到上限，或已有任务在排队而这组任务不是刚被唤醒的，则暂存这组任务并返回false
+func (l *concurrencyLimiter) admit(tasks []*types.CallbackTask) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unparked := 0
+	for _, callbackTask := range tasks {
+		if callbackTask.Unparked {
+			unparked++
+			callbackTask.Unparked = false
+		}
+	}
+	if unparked > 0 {
+		l.waking -= unparked
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			return true
+		}
+		// 唤醒后上限被调低，回到队首等待下一个名额
+		l.parked = append(append(make([]*types.CallbackTask, 0, len(tasks)+len(l.parked)), tasks...), l.parked...)
+		return false
+	}
+
+	if len(l.parked) == 0 && l.inFlight+l.wakingSlots() < int(l.limit) {
+		l.inFlight++
+		return true
+	}
+	l.parked = append(l.parked, tasks...)
+	l.wake()
+	return false
+}
+
+// release 归还名额，自适应模式下根据本次投递的耗时和结果调整上限，然后唤醒等待的任务
+func (l *concurrencyLimiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if l.adaptive != nil {
+		l.adjust(latency, err)
+	}
+	l.wake()
+}
+
+// cancel 归还未用于投递的名额（如占用名额后被熔断暂存），不参与并发调整
+func (l *concurrencyLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.wake()
+}
+
+// wake 按空闲名额唤醒暂存的任务，每个名额唤醒 wakeBatch 个，调用方需持有锁
+func (l *concurrencyLimiter) wake() {
+	for len(l.parked) > 0 && l.inFlight+l.wakingSlots() < int(l.limit) {
+		n := min(l.wakeBatch, len(l.parked))
+		woken := make([]*types.CallbackTask, n)
+		copy(woken, l.parked[:n])
+		l.parked = append(l.parked[:0], l.parked[n:]...)
+		for _, callbackTask := range woken {
+			callbackTask.Unparked = true
+		}
+		l.waking += n
+		l.ready(woken)
+	}
+}
+
+// wakingSlots 返回已唤醒的任务预计占用的名额数，调用方需持有锁
+func (l *concurrencyLimiter) wakingSlots() int {
+	return (l.waking + l.wakeBatch - 1) / l.wakeBatch
+}
+
+// takeParked 取出全部暂存的任务，分发器停止时调用
+func (l *concurrencyLimiter) takeParked() []*types.CallbackTask {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	parked := l.parked
+	l.parked = nil
+	return parked
+}
+
+// parkedCount 返回暂存的任务数
+func (l *concurrencyLimiter) parkedCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.parked)
+}
+
+// adjust 按 AIMD 调整并发上限，调用方需持有锁
+func (l *concurrencyLimiter) adjust(latency time.Duration, err error) {
+	// 分发器停止导致的取消不反映接收方状态，接收方明确拒绝说明没有过载
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if isPermanent(err) {
+		err = nil
+	}
+
+	previous := int(l.limit)
+	if err == nil && latency < l.adaptive.LatencyThreshold {
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	} else {
+		now := time.Now()
+		if now.Sub(l.lastDecrease) < l.adaptive.LatencyThreshold {
+			return
+		}
+		l.lastDecrease = now
+		l.limit = math.Max(l.minLimit, l.limit*l.adaptive.DecreaseFactor)
+	}
+
+	if current := int(l.limit); current != previous {
+		l.metrics.SetConcurrencyLimit(l.taskID, current)
+		log.Debug("Adaptive concurrency limit changed",
+			log.String("task_id", l.taskID),
+			log.Int("from", previous),
+			log.Int("to", current),
+			log.Duration("latency", latency))
+	}
+}
@@ -0,0 +1,97 @@
+package dispatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestConcurrencyLimiterParksInOrder(t *testing.T) {
+	var woken []*types.CallbackTask
+	limiter := newConcurrencyLimiter("users", 1, &types.AdaptiveConcurrencyConfig{}, metrics.NewMetrics(),
+		func(tasks []*types.CallbackTask) { woken = append(woken, tasks...) }, 1)
+
+	first, second, third := &types.CallbackTask{}, &types.CallbackTask{}, &types.CallbackTask{}
+	if !limiter.admit([]*types.CallbackTask{first}) {
+		t.Fatal("first task should be admitted")
+	}
+	if limiter.admit([]*types.CallbackTask{second}) || limiter.admit([]*types.CallbackTask{third}) {
+		t.Fatal("tasks over the limit should be parked")
+	}
+	if n := limiter.parkedCount(); n != 2 {
+		t.Fatalf("parkedCount = %d, want 2", n)
+	}
+
+	// 释放名额后唤醒最早暂存的任务，名额留给它，新到的任务继续排队
+	limiter.release(0, nil)
+	if len(woken) != 1 || woken[0] != second || !second.Unparked {
+		t.Fatalf("woken = %v, want the second task marked as unparked", woken)
+	}
+	late := &types.CallbackTask{}
+	if limiter.admit([]*types.CallbackTask{late}) {
+		t.Fatal("a new task took the slot reserved for the woken task")
+	}
+	if !limiter.admit([]*types.CallbackTask{second}) {
+		t.Fatal("the woken task should take the released slot")
+	}
+
+	// 占用名额后被熔断暂存的任务归还名额，队列中的下一个任务被唤醒
+	limiter.cancel()
+	if len(woken) != 2 || woken[1] != third {
+		t.Fatalf("woken = %v, want the third task next", woken)
+	}
+}
+
+func TestConcurrencyLimitDoesNotBlockWorkers(t *testing.T) {
+	for _, batchSize := range []int{1, 5} {
+		t.Run(fmt.Sprintf("batch_size=%d", batchSize), func(t *testing.T) {
+			testConcurrencyLimitDoesNotBlockWorkers(t, batchSize)
+		})
+	}
+}
+
+func testConcurrencyLimitDoesNotBlockWorkers(t *testing.T, batchSize int) {
+	receiver := newRecordingReceiver(t, nil)
+	cfg := newTestConfig(t,
+		types.Task{
+			TaskID:      "limited",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: receiver.URL + "/limited",
+			Delivery:    &types.DeliveryConfig{MaxInFlight: 1},
+		},
+		types.Task{
+			TaskID:      "open",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: receiver.URL + "/open",
+		},
+	)
+	cfg.Dispatcher.WorkerCount = 1
+	cfg.Dispatcher.BatchSize = batchSize
+	cfg.Dispatcher.BatchTimeout = 10 * time.Millisecond
+	d, events := startTestDispatcher(t, cfg)
+
+	// 占住 limited 唯一的名额，相当于另一条投递正在进行
+	policy := d.policies[destinationKey("limited", "")]
+	if !policy.admit(&types.CallbackTask{}) {
+		t.Fatal("failed to occupy the slot")
+	}
+
+	// limited 的投递被暂存，唯一的工作协程继续处理 open 的投递
+	for i := int64(1); i <= 3; i++ {
+		events <- testEvent("limited", i)
+	}
+	events <- testEvent("open", 4)
+	waitFor(t, "the unlimited delivery", func() bool { return receiver.count("open") == 1 })
+	if n := receiver.count("limited"); n != 0 {
+		t.Fatalf("limited deliveries = %d while the slot is taken, want 0", n)
+	}
+
+	// 名额释放后暂存的投递依次完成
+	policy.release(0, nil)
+	waitFor(t, "the parked deliveries", func() bool { return receiver.count("limited") == 3 })
+}
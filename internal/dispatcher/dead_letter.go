@@ -0,0 +1,150 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// 进入死信的原因
+const (
+	deadLetterPermanent   = "permanent_failure"    // 接收方明确拒绝，重试无意义
+	deadLetterMaxRetries  = "max_retries_exceeded" // 重试次数耗尽
+	deadLetterEncodeError = "encode_failed"        // 载荷编码失败
+)
+
+// DeadLetterQueue 死信队列，将无法投递的事件以NDJSON格式写入本地文件，便于排查和重放
+type DeadLetterQueue struct {
+	file    *FileSink
+	metrics *metrics.Metrics
+}
+
+// deadLetterEntry 死信记录
+type deadLetterEntry struct {
+	TaskID        string            `json:"task_id"`
+	Destination   string            `json:"destination,omitempty"`
+	EventID       string            `json:"event_id"`
+	Database      string            `json:"database"`
+	Table         string            `json:"table"`
+	Event         types.EventType   `json:"event"`
+	PrimaryID     interface{}       `json:"primary_id"`
+	URL           string            `json:"url,omitempty"`
+	Reason        string            `json:"reason"`
+	Error         string            `json:"error"`
+	StatusCode    int               `json:"status_code,omitempty"`
+	Response      string            `json:"response,omitempty"` // 接收方响应体片段
+	RetryCount    int               `json:"retry_count"`
+	FailedAt      time.Time         `json:"failed_at"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`        // JSON载荷原样保存
+	PayloadBase64 []byte            `json:"payload_base64,omitempty"` // 二进制载荷以base64保存
+}
+
+// NewDeadLetterQueue 创建死信队列，未配置路径时返回nil
+func NewDeadLetterQueue(cfg *types.DeadLetterConfig, m *metrics.Metrics) (*DeadLetterQueue, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	file, err := NewFileSink(&types.FileSinkConfig{
+		Path:       cfg.Path,
+		MaxSizeMB:  cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+
+	return &DeadLetterQueue{file: file, metrics: m}, nil
+}
+
+// Write 写入一条死信，msg 为nil表示载荷未能编码
+func (q *DeadLetterQueue) Write(callbackTask *types.CallbackTask, msg *Message, reason string, cause error) error {
+	event := callbackTask.Event
+	entry := &deadLetterEntry{
+		TaskID:      event.TaskID,
+		Destination: callbackTask.Destination,
+		EventID:     event.ID(),
+		Database:    event.Database,
+		Table:       event.Table,
+		Event:       event.Event,
+		PrimaryID:   event.PrimaryID,
+		URL:         callbackTask.CallbackURL,
+		Reason:      reason,
+		Error:       cause.Error(),
+		StatusCode:  statusCodeOf(cause),
+		Response:    responseOf(cause),
+		RetryCount:  callbackTask.RetryCount,
+		FailedAt:    time.Now(),
+	}
+
+	if msg != nil {
+		entry.ContentType = msg.ContentType
+		entry.Headers = msg.Headers
+		if isJSONContentType(msg.ContentType) && json.Valid(msg.Body) {
+			entry.Payload = msg.Body
+		} else {
+			entry.PayloadBase64 = msg.Body
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := q.file.Deliver(context.Background(), &Message{Body: line}); err != nil {
+		return err
+	}
+
+	q.metrics.IncrementDeadLettered()
+	return nil
+}
+
+// Close 关闭死信文件
+func (q *DeadLetterQueue) Close() error {
+	return q.file.Close()
+}
+
+// deadLetter 将无法投递的任务写入死信并释放，未配置死信时只记录日志
+func (d *Dispatcher) deadLetter(callbackTask *types.CallbackTask, msg *Message, reason string, cause error) {
+	defer d.releaseCallbackTask(callbackTask)
+
+	fields := []zap.Field{
+		log.String("task_id", callbackTask.Event.TaskID),
+		log.String("reason", reason),
+		log.Int("retry_count", callbackTask.RetryCount),
+		zap.Error(cause),
+	}
+
+	if d.deadLetters == nil {
+		log.Error("Delivery failed permanently, event discarded", fields...)
+		return
+	}
+
+	if err := d.deadLetters.Write(callbackTask, msg, reason, cause); err != nil {
+		d.metrics.RecordError("dead_letter_write", "dispatcher")
+		log.Error("Failed to write dead letter, event discarded", append(fields, log.Any("write_error", err.Error()))...)
+		return
+	}
+	log.Warn("Delivery moved to dead letter", fields...)
+}
+
+// isJSONContentType 判断消息体类型是否为JSON
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestDeadLetterPayloadEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter.ndjson")
+	queue, err := NewDeadLetterQueue(&types.DeadLetterConfig{Path: path}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create dead letter queue: %v", err)
+	}
+	t.Cleanup(func() { queue.Close() })
+
+	binary := []byte{0x00, 0x01, 0xfe, 0xff}
+	messages := []*Message{
+		{ContentType: "application/json", Body: []byte(`{"id":1}`)},
+		{ContentType: "application/cloudevents+json; charset=utf-8", Body: []byte(`{"id":2}`)},
+		{ContentType: "application/json", Body: []byte(`{"id":`)},
+		{ContentType: "application/vnd.kafka.avro.v2+binary", Body: binary},
+		nil,
+	}
+	for i, msg := range messages {
+		callbackTask := &types.CallbackTask{Event: testEvent("users", int64(i+1)), RetryCount: 3}
+		if err := queue.Write(callbackTask, msg, deadLetterMaxRetries, errors.New("failed")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	entries := readDeadLetters(t, path)
+	if len(entries) != len(messages) {
+		t.Fatalf("read %d dead letters, want %d", len(entries), len(messages))
+	}
+	// 合法的JSON载荷原样保存，不合法的JSON和二进制载荷以base64保存
+	for i, want := range []string{`{"id":1}`, `{"id":2}`} {
+		if string(entries[i].Payload) != want || entries[i].PayloadBase64 != nil {
+			t.Fatalf("entry %d: payload = %s, payload_base64 = %v, want JSON payload %s", i, entries[i].Payload, entries[i].PayloadBase64, want)
+		}
+	}
+	for i, want := range [][]byte{[]byte(`{"id":`), binary} {
+		entry := entries[i+2]
+		if entry.Payload != nil || !bytes.Equal(entry.PayloadBase64, want) {
+			t.Fatalf("entry %d: payload = %s, payload_base64 = %v, want base64 payload %v", i+2, entry.Payload, entry.PayloadBase64, want)
+		}
+	}
+	if last := entries[4]; last.Payload != nil || last.PayloadBase64 != nil || last.ContentType != "" {
+		t.Fatalf("entry without message has payload %s / %v", last.Payload, last.PayloadBase64)
+	}
+	if entries[0].Reason != deadLetterMaxRetries || entries[0].RetryCount != 3 || entries[0].EventID != testEvent("users", 1).ID() {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+}
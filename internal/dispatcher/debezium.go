@@ -0,0 +1,82 @@
+package dispatcher
+
+import (
+	"encoding/json"
+
+	"pikachu/internal/types"
+	"pikachu/internal/utils"
+)
+
+// debeziumSource Debezium MySQL 连接器的 source 块
+type debeziumSource struct {
+	Version   string `json:"version"`
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+	DB        string `json:"db"`
+	Table     string `json:"table"`
+	File      string `json:"file"`
+	Pos       uint32 `json:"pos"`
+	Row       int    `json:"row"`
+	GTID      string `json:"gtid,omitempty"`
+}
+
+// debeziumEnvelope Debezium 变更事件信封（等同于 JsonConverter 关闭 schemas.enable 时的输出）
+type debeziumEnvelope struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+	Source debeziumSource         `json:"source"`
+	Op     string                 `json:"op"`
+	TsMs   int64                  `json:"ts_ms"`
+}
+
+// debeziumFormatter 输出 Debezium 兼容的变更事件
+type debeziumFormatter struct {
+	serverName string // 对应 Debezium 的逻辑服务器名
+}
+
+// Format 编码为 Debezium 信封
+func (f *debeziumFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	before, after := rowImages(event)
+
+	envelope := &debeziumEnvelope{
+		Before: before,
+		After:  after,
+		Source: debeziumSource{
+			Version:   utils.GetUserAgent(),
+			Connector: "mysql",
+			Name:      f.serverName,
+			TsMs:      eventTimeOf(event).UnixMilli(),
+			Snapshot:  "false",
+			DB:        event.Database,
+			Table:     event.Table,
+			File:      event.LogName,
+			Pos:       event.LogPos,
+			Row:       event.RowIndex,
+			GTID:      event.GTID,
+		},
+		Op:   debeziumOp(event.Event),
+		TsMs: event.Timestamp.UnixMilli(),
+	}
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{Body: body, ContentType: "application/json"}, nil
+}
+
+// debeziumOp 转换为 Debezium 的操作类型：c 创建, u 更新, d 删除
+func debeziumOp(eventType types.EventType) string {
+	switch eventType {
+	case types.EventInsert:
+		return "c"
+	case types.EventUpdate:
+		return "u"
+	case types.EventDelete:
+		return "d"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeliveryError 投递失败的详细信息，用于区分可重试和永久失败
+type DeliveryError struct {
+	Err        error
+	StatusCode int           // HTTP状态码，非HTTP输出端为0
+	Permanent  bool          // 永久失败，重试无意义，直接进入死信
+	RetryAfter time.Duration // 接收方要求的最短重试间隔
+	Response   string        // 响应体片段，用于死信排查
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// permanentError 将错误标记为永久失败
+func permanentError(err error) error {
+	return &DeliveryError{Err: err, Permanent: true}
+}
+
+// isPermanent 判断错误是否为永久失败
+func isPermanent(err error) bool {
+	var deliveryErr *DeliveryError
+	return errors.As(err, &deliveryErr) && deliveryErr.Permanent
+}
+
+// retryAfterOf 返回错误中携带的重试间隔
+func retryAfterOf(err error) time.Duration {
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return deliveryErr.RetryAfter
+	}
+	return 0
+}
+
+// statusCodeOf 返回错误中携带的HTTP状态码
+func statusCodeOf(err error) int {
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return deliveryErr.StatusCode
+	}
+	return 0
+}
+
+// responseOf 返回错误中携带的响应体片段
+func responseOf(err error) string {
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return deliveryErr.Response
+	}
+	return ""
+}
+
+// statusClassifier 根据HTTP状态码判断是否可重试
+type statusClassifier struct {
+	retryable map[int]bool // 为nil时使用默认规则
+}
+
+// newStatusClassifier 创建状态码分类器，codes 为空时使用默认规则
+func newStatusClassifier(codes []int) *statusClassifier {
+	if len(codes) == 0 {
+		return &statusClassifier{}
+	}
+	retryable := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryable[code] = true
+	}
+	return &statusClassifier{retryable: retryable}
+}
+
+// isRetryable 判断状态码是否可重试
+// 默认规则：请求超时、限流和服务端临时故障可重试，其他客户端错误（如载荷不合法）重试也不会成功
+func (c *statusClassifier) isRetryable(statusCode int) bool {
+	if c.retryable != nil {
+		return c.retryable[statusCode]
+	}
+
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return statusCode >= 500
+}
+
+// responseError 根据HTTP响应构造投递错误
+func (c *statusClassifier) responseError(resp *http.Response) *DeliveryError {
+	return &DeliveryError{
+		Err:        fmt.Errorf("webhook returned status code: %d", resp.StatusCode),
+		StatusCode: resp.StatusCode,
+		Permanent:  !c.isRetryable(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if delay := t.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+func TestStatusClassifier(t *testing.T) {
+	defaults := newStatusClassifier(nil)
+	custom := newStatusClassifier([]int{http.StatusConflict, http.StatusServiceUnavailable})
+
+	for _, tc := range []struct {
+		status     int
+		defaults   bool
+		customized bool
+	}{
+		{http.StatusBadRequest, false, false},
+		{http.StatusUnauthorized, false, false},
+		{http.StatusNotFound, false, false},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusConflict, false, true},
+		{http.StatusTooEarly, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusInternalServerError, true, false},
+		{http.StatusNotImplemented, false, false},
+		{http.StatusBadGateway, true, false},
+		{http.StatusServiceUnavailable, true, true},
+		{http.StatusHTTPVersionNotSupported, false, false},
+		{599, true, false},
+	} {
+		if got := defaults.isRetryable(tc.status); got != tc.defaults {
+			t.Errorf("default isRetryable(%d) = %v, want %v", tc.status, got, tc.defaults)
+		}
+		if got := custom.isRetryable(tc.status); got != tc.customized {
+			t.Errorf("custom isRetryable(%d) = %v, want %v", tc.status, got, tc.customized)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	classifier := newStatusClassifier(nil)
+	for _, tc := range []struct {
+		status     int
+		retryAfter string
+		permanent  bool
+		delay      time.Duration
+	}{
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusTooManyRequests, retryAfter: "30", delay: 30 * time.Second},
+		{status: http.StatusServiceUnavailable, retryAfter: "soon"},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+		if tc.retryAfter != "" {
+			resp.Header.Set("Retry-After", tc.retryAfter)
+		}
+		err := fmt.Errorf("deliver: %w", classifier.responseError(resp))
+		if isPermanent(err) != tc.permanent {
+			t.Errorf("status %d: isPermanent = %v, want %v", tc.status, isPermanent(err), tc.permanent)
+		}
+		if retryAfterOf(err) != tc.delay {
+			t.Errorf("status %d: retryAfterOf = %v, want %v", tc.status, retryAfterOf(err), tc.delay)
+		}
+		if statusCodeOf(err) != tc.status {
+			t.Errorf("statusCodeOf = %d, want %d", statusCodeOf(err), tc.status)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-10", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		{"Fri, 02 Jan 2026 15:05:00 GMT", 55 * time.Second},
+		{"tomorrow", 0},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := &Dispatcher{config: &types.Config{}}
+	d.config.Dispatcher.MaxRetryAfter = time.Minute
+	policy := &deliveryPolicy{retryBaseDelay: 100 * time.Millisecond, retryMaxDelay: time.Second}
+
+	retryAfter := func(delay time.Duration) error {
+		return &DeliveryError{Err: errors.New("busy"), RetryAfter: delay}
+	}
+	if got := d.retryDelay(policy, 0, retryAfter(30*time.Second)); got != 30*time.Second {
+		t.Fatalf("retryDelay with Retry-After 30s = %v, want 30s", got)
+	}
+	if got := d.retryDelay(policy, 0, retryAfter(time.Hour)); got != time.Minute {
+		t.Fatalf("retryDelay with Retry-After 1h = %v, want max_retry_after 1m", got)
+	}
+	// 没有 Retry-After 时按投递策略退避
+	for _, err := range []error{errors.New("connection refused"), retryAfter(0)} {
+		if got := d.retryDelay(policy, 3, err); got < 400*time.Millisecond || got > 800*time.Millisecond {
+			t.Fatalf("retryDelay(%v) = %v, want backoff between 400ms and 800ms", err, got)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := 100*time.Millisecond, 5*time.Second
+	for _, tc := range []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{4, 1600 * time.Millisecond},
+		{6, max},
+		{31, max},
+		{64, max},
+	} {
+		for i := 0; i < 200; i++ {
+			delay := backoffDelay(base, max, tc.attempt)
+			if delay < tc.ceiling/2 || delay > tc.ceiling {
+				t.Fatalf("backoffDelay(attempt %d) = %v, want between %v and %v", tc.attempt, delay, tc.ceiling/2, tc.ceiling)
+			}
+		}
+	}
+}
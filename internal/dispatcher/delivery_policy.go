@@ -0,0 +1,88 @@
+package dispatcher
+
+import (
+	"time"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// deliveryPolicy 投递目标生效的投递策略，由全局配置、任务级和目标级覆盖合并而成
+type deliveryPolicy struct {
+	timeout        time.Duration // HTTP请求超时，为0时使用输出端默认值
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	rateLimit      *tokenBucket        // 任务级限流，为nil时不限流
+	concurrency    *concurrencyLimiter // 并发限制，为nil时不限制
+}
+
+// newDeliveryPolicy 合并全局配置和任务级覆盖，未覆盖的字段沿用全局配置
+// key 为投递目标键，见 destinationKey；ready 用于将限流或并发限制放行的任务重新入队
+func newDeliveryPolicy(key string, cfg *types.DispatcherConfig, override *types.DeliveryConfig, m *metrics.Metrics, ready func([]*types.CallbackTask)) *deliveryPolicy {
+	policy := &deliveryPolicy{
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		retryMaxDelay:  cfg.RetryMaxDelay,
+	}
+	if override == nil {
+		policy.concurrency = newConcurrencyLimiter(key, 0, &cfg.AdaptiveConcurrency, m, ready, cfg.BatchSize)
+		return policy
+	}
+
+	policy.timeout = override.Timeout
+	if override.MaxRetries != nil {
+		policy.maxRetries = *override.MaxRetries
+	}
+	if override.RetryBaseDelay > 0 {
+		policy.retryBaseDelay = override.RetryBaseDelay
+	}
+	if override.RetryMaxDelay > 0 {
+		policy.retryMaxDelay = override.RetryMaxDelay
+	}
+	if override.RateLimit != nil {
+		policy.rateLimit = newTokenBucket(override.RateLimit, ready)
+	}
+	policy.concurrency = newConcurrencyLimiter(key, override.MaxInFlight, &cfg.AdaptiveConcurrency, m, ready, cfg.BatchSize)
+	return policy
+}
+
+// admit 为一组同一投递目标的任务占用一个投递名额，达到并发上限时任务被暂存并返回false
+// 取得名额后任务已通过全部限流，之后的重试需要重新获取令牌
+func (p *deliveryPolicy) admit(tasks ...*types.CallbackTask) bool {
+	if p.concurrency != nil && !p.concurrency.admit(tasks) {
+		return false
+	}
+	for _, callbackTask := range tasks {
+		callbackTask.RateGates = 0
+	}
+	return true
+}
+
+// release 归还投递名额，latency 和 err 用于自适应并发调整
+func (p *deliveryPolicy) release(latency time.Duration, err error) {
+	if p.concurrency != nil {
+		p.concurrency.release(latency, err)
+	}
+}
+
+// cancel 归还未用于投递的名额
+func (p *deliveryPolicy) cancel() {
+	if p.concurrency != nil {
+		p.concurrency.cancel()
+	}
+}
+
+// releasePolicies 归还批量投递占用的名额，以整批的耗时和第一个非永久失败的错误作为调整依据
+func releasePolicies(policies []*deliveryPolicy, latency time.Duration, errs []error) {
+	var batchErr error
+	for _, err := range errs {
+		if err != nil && !isPermanent(err) {
+			batchErr = err
+			break
+		}
+	}
+	for _, policy := range policies {
+		policy.release(latency, batchErr)
+	}
+}
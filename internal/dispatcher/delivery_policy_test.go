@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+func TestDeliveryPolicyOverrides(t *testing.T) {
+	retries := func(n int) *int { return &n }
+	d, _ := newInlineDispatcher(t, types.Task{
+		TaskID:    "users",
+		TableName: "users",
+		Events:    []types.EventType{types.EventInsert},
+		Delivery: &types.DeliveryConfig{
+			Timeout:        3 * time.Second,
+			MaxRetries:     retries(5),
+			RetryBaseDelay: 2 * time.Second,
+			MaxInFlight:    4,
+		},
+		Destinations: []types.DestinationConfig{
+			{Name: "inherited", CallbackURL: "http://127.0.0.1:1/inherited"},
+			{Name: "no_retries", CallbackURL: "http://127.0.0.1:1/no_retries", Delivery: &types.DeliveryConfig{MaxRetries: retries(0)}},
+			{Name: "delays", CallbackURL: "http://127.0.0.1:1/delays", Delivery: &types.DeliveryConfig{RetryMaxDelay: time.Minute, Timeout: time.Second}},
+			{Name: "narrow", CallbackURL: "http://127.0.0.1:1/narrow", Delivery: &types.DeliveryConfig{MaxInFlight: 2}},
+		},
+	})
+	global := d.config.Dispatcher
+
+	for _, tc := range []struct {
+		key         string
+		timeout     time.Duration
+		maxRetries  int
+		baseDelay   time.Duration
+		maxDelay    time.Duration
+		maxInFlight int
+	}{
+		// 未覆盖的字段沿用任务级配置，任务级也未设置时使用全局配置
+		{key: "users/inherited", timeout: 3 * time.Second, maxRetries: 5, baseDelay: 2 * time.Second, maxDelay: global.RetryMaxDelay, maxInFlight: 4},
+		// max_retries 为0表示不重试，不能被当作未设置
+		{key: "users/no_retries", timeout: 3 * time.Second, maxRetries: 0, baseDelay: 2 * time.Second, maxDelay: global.RetryMaxDelay, maxInFlight: 4},
+		{key: "users/delays", timeout: time.Second, maxRetries: 5, baseDelay: 2 * time.Second, maxDelay: time.Minute, maxInFlight: 4},
+		{key: "users/narrow", timeout: 3 * time.Second, maxRetries: 5, baseDelay: 2 * time.Second, maxDelay: global.RetryMaxDelay, maxInFlight: 2},
+	} {
+		policy := d.policies[tc.key]
+		if policy == nil {
+			t.Fatalf("no delivery policy for %s", tc.key)
+		}
+		if policy.timeout != tc.timeout || policy.maxRetries != tc.maxRetries ||
+			policy.retryBaseDelay != tc.baseDelay || policy.retryMaxDelay != tc.maxDelay {
+			t.Fatalf("%s: timeout = %v, max_retries = %d, delays = %v/%v, want %v, %d, %v/%v", tc.key,
+				policy.timeout, policy.maxRetries, policy.retryBaseDelay, policy.retryMaxDelay,
+				tc.timeout, tc.maxRetries, tc.baseDelay, tc.maxDelay)
+		}
+		if policy.concurrency == nil || policy.concurrency.limit != float64(tc.maxInFlight) || policy.concurrency.taskID != tc.key {
+			t.Fatalf("%s: concurrency limiter = %+v, want max_in_flight %d", tc.key, policy.concurrency, tc.maxInFlight)
+		}
+	}
+}
+
+func TestDeliveryPolicyDefaults(t *testing.T) {
+	d, _ := newInlineDispatcher(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: "http://127.0.0.1:1/webhook",
+	})
+	global := d.config.Dispatcher
+
+	policy := d.policies["users"]
+	if policy.timeout != 0 || policy.maxRetries != global.MaxRetries ||
+		policy.retryBaseDelay != global.RetryBaseDelay || policy.retryMaxDelay != global.RetryMaxDelay {
+		t.Fatalf("policy without overrides = %+v, want the dispatcher config", policy)
+	}
+	if policy.concurrency != nil || policy.rateLimit != nil {
+		t.Fatal("policy without overrides should not limit deliveries")
+	}
+}
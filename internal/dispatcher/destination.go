@@ -0,0 +1,114 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strings"
+
+	"pikachu/internal/response"
+	"pikachu/internal/types"
+	"pikachu/internal/utils"
+)
+
+// destination 任务的一个投递目标
+// 每个目标有独立的输出端和投递策略，同一事件对每个目标生成各自的回调任务，重试和死信互不影响
+type destination struct {
+	key         string                   // 投递目标键，见 destinationKey
+	name        string                   // 目标名称，单目标任务为空
+	url         string                   // 预构建的回调URL，可能包含占位符
+	method      string                   // HTTP请求方法
+	compression *types.CompressionConfig // 请求体压缩配置
+	validator   *response.Validator      // 响应校验器
+}
+
+// destinationKey 计算投递目标键：单目标任务为任务ID，多目标任务为 任务ID/目标名称
+func destinationKey(taskID, name string) string {
+	if name == "" {
+		return taskID
+	}
+	return taskID + "/" + name
+}
+
+// destinationKeyOf 返回回调任务所属投递目标的键
+func destinationKeyOf(callbackTask *types.CallbackTask) string {
+	return destinationKey(callbackTask.Event.TaskID, callbackTask.Destination)
+}
+
+// destinationOf 返回回调任务所属的投递目标，目标已不存在时返回nil
+func (d *Dispatcher) destinationOf(callbackTask *types.CallbackTask) *destination {
+	for _, dest := range d.destinations[callbackTask.Event.TaskID] {
+		if dest.name == callbackTask.Destination {
+			return dest
+		}
+	}
+	return nil
+}
+
+// addDestinations 为任务创建投递目标，未配置 destinations 的任务使用任务自身的 callback_url 和 sink 作为唯一目标
+// 目标未设置的TLS、代理、请求方法、压缩和响应校验配置使用任务级配置
+func (d *Dispatcher) addDestinations(task *types.Task) error {
+	configs := task.Destinations
+	if len(configs) == 0 {
+		configs = []types.DestinationConfig{{
+			CallbackURL:         task.CallbackURL,
+			Sink:                task.Sink,
+			PrebuiltCallbackURL: task.PrebuiltCallbackURL,
+		}}
+	}
+
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.PrebuiltCallbackURL == "" && cfg.CallbackURL != "" {
+			cfg.PrebuiltCallbackURL = utils.BuildCallbackURL(d.config.CallbackHost, cfg.CallbackURL)
+		}
+
+		key := destinationKey(task.TaskID, cfg.Name)
+		dest := &destination{
+			key:         key,
+			name:        cfg.Name,
+			url:         cfg.PrebuiltCallbackURL,
+			method:      strings.ToUpper(cfg.Method),
+			compression: cfg.Compression,
+		}
+		if dest.method == "" {
+			dest.method = strings.ToUpper(task.Method)
+		}
+		if dest.compression == nil {
+			dest.compression = task.Compression
+		}
+		validation := cfg.ResponseValidation
+		if validation == nil {
+			validation = task.ResponseValidation
+		}
+		if validation != nil {
+			validator, err := response.Compile(validation)
+			if err != nil {
+				return destinationError(cfg.Name, fmt.Errorf("invalid response_validation: %w", err))
+			}
+			dest.validator = validator
+		}
+
+		tlsCfg, proxyCfg := cfg.TLS, cfg.Proxy
+		if tlsCfg == nil {
+			tlsCfg = task.TLS
+		}
+		if proxyCfg == nil {
+			proxyCfg = task.Proxy
+		}
+		sink, err := d.newSink(&cfg.Sink, tlsCfg, proxyCfg)
+		if err != nil {
+			return destinationError(cfg.Name, fmt.Errorf("failed to create sink: %w", err))
+		}
+		d.sinks[key] = sink
+		d.policies[key] = newDeliveryPolicy(key, &d.config.Dispatcher, task.Delivery.Merge(cfg.Delivery), d.metrics, d.requeueAsync)
+		d.destinations[task.TaskID] = append(d.destinations[task.TaskID], dest)
+	}
+	return nil
+}
+
+// destinationError 为多目标任务的错误加上目标名称
+func destinationError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("destination %s: %w", name, err)
+}
@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+func TestDestinationsRetryIndependently(t *testing.T) {
+	receiver := newRecordingReceiver(t, nil)
+	var failures atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:    "users",
+		TableName: "users",
+		Events:    []types.EventType{types.EventInsert},
+		Destinations: []types.DestinationConfig{
+			{Name: "search", CallbackURL: receiver.URL + "/users"},
+			{Name: "billing", CallbackURL: failing.URL + "/users"},
+		},
+	})
+	cfg.Dispatcher.MaxRetries = 2
+	cfg.Dispatcher.DeadLetter.Path = filepath.Join(t.TempDir(), "dead_letter.ndjson")
+	_, events := startTestDispatcher(t, cfg)
+	events <- testEvent("users", 1)
+
+	var entries []deadLetterEntry
+	waitFor(t, "dead letter of the failing destination", func() bool {
+		entries = readDeadLetters(t, cfg.Dispatcher.DeadLetter.Path)
+		return len(entries) > 0
+	})
+	// 等待可能的多余投递到达
+	time.Sleep(100 * time.Millisecond)
+
+	// 失败目标的重试不会让成功的目标重复收到事件
+	if n := receiver.count("users"); n != 1 {
+		t.Fatalf("healthy destination received %d requests, want 1", n)
+	}
+	if n := int(failures.Load()); n != cfg.Dispatcher.MaxRetries+1 {
+		t.Fatalf("failing destination received %d requests, want %d", n, cfg.Dispatcher.MaxRetries+1)
+	}
+	entries = readDeadLetters(t, cfg.Dispatcher.DeadLetter.Path)
+	if len(entries) != 1 {
+		t.Fatalf("got %d dead letters, want only the failing destination", len(entries))
+	}
+	entry := entries[0]
+	if entry.Destination != "billing" || entry.Reason != deadLetterMaxRetries || entry.RetryCount != cfg.Dispatcher.MaxRetries {
+		t.Fatalf("dead letter destination = %q, reason = %s, retries = %d, want billing after %d retries",
+			entry.Destination, entry.Reason, entry.RetryCount, cfg.Dispatcher.MaxRetries)
+	}
+	if entry.URL != failing.URL+"/users" || entry.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dead letter url = %s, status = %d", entry.URL, entry.StatusCode)
+	}
+}
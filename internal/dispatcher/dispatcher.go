@@ -6,9 +6,9 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"net/http"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,13 +17,14 @@ import (
 
 	"pikachu/internal/log"
 	"pikachu/internal/metrics"
+	"pikachu/internal/transform"
 	"pikachu/internal/types"
 	"pikachu/internal/utils"
 )
 
-// jsonCacheEntry JSON 缓存条目
+// jsonCacheEntry 编码结果缓存条目
 type jsonCacheEntry struct {
-	data      []byte
+	encoded   *Encoded
 	timestamp time.Time
 }
 
@@ -31,7 +32,21 @@ type jsonCacheEntry struct {
 type Dispatcher struct {
 	config       *types.Config
 	eventQueue   chan *types.ChangeEvent
-	httpClient   *http.Client
+	httpSink     *HTTPSink
+	stdoutSink   *StdoutSink
+	fileSinks    map[string]*FileSink         // 按文件路径索引的文件输出端
+	httpSinks    map[httpClientKey]*HTTPSink  // 按客户端配置索引的HTTP输出端，用于任务级和目标级的TLS和代理配置
+	sinks        map[string]Sink              // 按投递目标键索引的输出端
+	destinations map[string][]*destination    // 按任务ID索引的投递目标
+	formatters   map[string]Formatter         // 按任务ID索引的载荷格式化器
+	transforms   map[string]*transform.Script // 按任务ID索引的转换脚本
+	coalescers   map[string]*coalescer        // 按任务ID索引的变更合并器，仅在事件循环中使用
+	policies     map[string]*deliveryPolicy   // 按投递目标键索引的投递策略
+	breakers     sync.Map                     // 按端点索引的熔断器
+	deadLetters  *DeadLetterQueue             // 死信队列，未配置时为nil
+	overflow     *overflowQueue               // 工作队列满时的溢出队列
+	hostLimits   map[string]*tokenBucket      // 按回调主机索引的限流器
+	schemas      sync.Map                     // 按 database.table 索引的最新表结构
 	taskMap      map[string]*types.Task
 	taskQueues   []chan *types.CallbackTask
 	workersMux   sync.RWMutex
@@ -39,6 +54,15 @@ type Dispatcher struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 
+	// 停止时排空和保存未完成投递所需的状态
+	wg         sync.WaitGroup                      // 工作协程、事件循环和溢出送回协程
+	busy       int32                               // 正在处理投递的协程数，使用原子操作
+	coalescing int32                               // 合并器中等待发送的事件数，使用原子操作
+	retryMu    sync.Mutex                          // 保护 retries
+	retries    map[*types.CallbackTask]*time.Timer // 等待重试的任务
+	abandonMu  sync.Mutex                          // 保护 abandoned
+	abandoned  []*types.CallbackTask               // 因分发器停止而中断的任务，停止时写入溢出文件
+
 	// 对象池优化内存分配
 	payloadPool      sync.Pool // WebhookPayload 对象池
 	bufferPool       sync.Pool // bytes.Buffer 对象池
@@ -52,34 +76,29 @@ type Dispatcher struct {
 	metrics *metrics.Metrics
 }
 
-// New 创建新的分发器
-func New(cfg *types.Config, eventQueue chan *types.ChangeEvent) *Dispatcher {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// 创建优化的HTTP传输配置
-	transport := &http.Transport{
-		MaxIdleConns:        cfg.Dispatcher.MaxIdleConns,
-		MaxIdleConnsPerHost: cfg.Dispatcher.MaxIdleConns / 2, // 分配一半给单个主机
-		IdleConnTimeout:     cfg.Dispatcher.IdleConnTimeout,
-		DisableCompression:  false, // 启用压缩
-		MaxConnsPerHost:     cfg.Dispatcher.MaxConnections,
-		// 移除 ForceAttemptHTTP2: true，保持协议兼容性
-		// 让Go自动协商协议版本，确保与各种回调服务端兼容
-	}
-
-	// 创建HTTP客户端，设置超时和传输配置
-	httpClient := &http.Client{
-		Timeout:   cfg.Dispatcher.Timeout,
-		Transport: transport,
+// New 创建新的分发器，m 为 nil 时使用独立的指标收集器
+func New(cfg *types.Config, eventQueue chan *types.ChangeEvent, m *metrics.Metrics) (*Dispatcher, error) {
+	if m == nil {
+		m = metrics.NewMetrics()
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 
 	dispatcher := &Dispatcher{
-		config:     cfg,
-		eventQueue: eventQueue,
-		httpClient: httpClient,
-		taskMap:    make(map[string]*types.Task),
-		ctx:        ctx,
-		cancel:     cancel,
+		config:       cfg,
+		eventQueue:   eventQueue,
+		fileSinks:    make(map[string]*FileSink),
+		httpSinks:    make(map[httpClientKey]*HTTPSink),
+		sinks:        make(map[string]Sink),
+		destinations: make(map[string][]*destination),
+		formatters:   make(map[string]Formatter),
+		transforms:   make(map[string]*transform.Script),
+		coalescers:   make(map[string]*coalescer),
+		policies:     make(map[string]*deliveryPolicy),
+		hostLimits:   make(map[string]*tokenBucket),
+		taskMap:      make(map[string]*types.Task),
+		retries:      make(map[*types.CallbackTask]*time.Timer),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 
 	// 初始化对象池
@@ -102,7 +121,25 @@ func New(cfg *types.Config, eventQueue chan *types.ChangeEvent) *Dispatcher {
 	}
 
 	dispatcher.jsonCacheTTL = 5 * time.Minute // 默认5分钟TTL
-	dispatcher.metrics = metrics.NewMetrics() // 初始化指标收集器
+	dispatcher.metrics = m
+	httpSink, err := NewHTTPSink(&cfg.Dispatcher, cfg.Dispatcher.TLS, cfg.Dispatcher.Proxy, dispatcher.metrics)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	dispatcher.httpSink = httpSink
+	dispatcher.stdoutSink = NewStdoutSink(dispatcher.metrics)
+
+	deadLetters, err := NewDeadLetterQueue(&cfg.Dispatcher.DeadLetter, dispatcher.metrics)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	dispatcher.deadLetters = deadLetters
+
+	for host, limit := range cfg.Dispatcher.HostRateLimits {
+		dispatcher.hostLimits[host] = newTokenBucket(&limit, dispatcher.requeueAsync)
+	}
 
 	// 建立任务映射并预构建回调URL
 	for i := range cfg.Tasks {
@@ -110,9 +147,46 @@ func New(cfg *types.Config, eventQueue chan *types.ChangeEvent) *Dispatcher {
 		// 预构建完整的回调URL，避免运行时重复计算
 		task.PrebuiltCallbackURL = utils.BuildCallbackURL(cfg.CallbackHost, task.CallbackURL)
 		dispatcher.taskMap[task.TaskID] = task
+
+		if err := dispatcher.addDestinations(task); err != nil {
+			dispatcher.closeSinks()
+			cancel()
+			return nil, fmt.Errorf("task %s: %w", task.TaskID, err)
+		}
+
+		formatter, err := dispatcher.newFormatter(task)
+		if err != nil {
+			dispatcher.closeSinks()
+			cancel()
+			return nil, fmt.Errorf("task %s: failed to create formatter: %w", task.TaskID, err)
+		}
+		dispatcher.formatters[task.TaskID] = formatter
+
+		if task.Transform != nil {
+			script, err := transform.Compile(task.TaskID, task.Transform)
+			if err != nil {
+				dispatcher.closeSinks()
+				cancel()
+				return nil, fmt.Errorf("task %s: %w", task.TaskID, err)
+			}
+			dispatcher.transforms[task.TaskID] = script
+		}
+
+		if task.Coalesce != nil {
+			dispatcher.coalescers[task.TaskID] = newCoalescer(task.Coalesce)
+		}
+	}
+
+	// 溢出队列在任务策略建立后创建，恢复上次残留的溢出事件时需要用到
+	overflow, err := newOverflowQueue(&cfg.Dispatcher.Overflow, dispatcher.metrics, dispatcher.restoreSpilled)
+	if err != nil {
+		dispatcher.closeSinks()
+		cancel()
+		return nil, err
 	}
+	dispatcher.overflow = overflow
 
-	return dispatcher
+	return dispatcher, nil
 }
 
 // Start 启动分发器
@@ -120,6 +194,7 @@ func (d *Dispatcher) Start() {
 	log.Info("Starting webhook dispatcher")
 
 	// 启动多个工作协程处理回调
+	d.wg.Add(d.config.Dispatcher.WorkerCount + 2)
 	for i := 0; i < d.config.Dispatcher.WorkerCount; i++ {
 		go d.worker(i)
 	}
@@ -134,27 +209,60 @@ func (d *Dispatcher) Start() {
 
 	// 监听事件队列
 	go d.eventLoop()
+	go d.drainOverflow()
 }
 
-// Stop 停止分发器
+// Stop 立即停止分发器，等同于不等待排空的 Drain
 func (d *Dispatcher) Stop() {
-	log.Info("Stopping webhook dispatcher")
-	d.cancel()
+	if err := d.Drain(0); err != nil {
+		log.Error("Failed to persist unfinished deliveries", zap.Error(err))
+	}
+}
 
-	// 清理JSON缓存
-	d.jsonCache.Range(func(key, value interface{}) bool {
-		d.jsonCache.Delete(key)
-		return true
-	})
+// closeSinks 关闭所有输出端和死信文件，共享的输出端只关闭一次
+func (d *Dispatcher) closeSinks() {
+	if d.deadLetters != nil {
+		d.deadLetters.Close()
+	}
+	d.httpSink.Close()
+	closed := map[Sink]bool{d.httpSink: true}
+	for key, sink := range d.sinks {
+		if closed[sink] {
+			continue
+		}
+		closed[sink] = true
+		if err := sink.Close(); err != nil {
+			log.Warn("Failed to close sink", log.String("destination", key), zap.Error(err))
+		}
+	}
 }
 
 // eventLoop 事件循环
+// 配置了变更合并的任务，事件先进入合并器，合并窗口结束时再处理
 func (d *Dispatcher) eventLoop() {
+	defer d.wg.Done()
+
+	flushTimer := time.NewTimer(time.Hour)
+	flushTimer.Stop()
+	defer flushTimer.Stop()
+
 	for {
+		var flushC <-chan time.Time
+		if deadline, ok := d.nextCoalesceDeadline(); ok {
+			flushTimer.Reset(time.Until(deadline))
+			flushC = flushTimer.C
+		}
+
 		select {
 		case event := <-d.eventQueue:
-			d.processEvent(event)
+			atomic.AddInt32(&d.busy, 1)
+			d.coalesce(event)
+			atomic.AddInt32(&d.busy, -1)
+		case now := <-flushC:
+			d.flushCoalesced(now, false)
 		case <-d.ctx.Done():
+			// 合并中的事件在停止时写入溢出文件
+			d.flushCoalesced(time.Time{}, true)
 			return
 		}
 	}
@@ -177,6 +285,7 @@ func (d *Dispatcher) worker(id int) {
 		// 工作协程退出时减少准备就绪计数
 		atomic.AddInt32(&d.workersReady, -1)
 		log.Info("Webhook worker stopped", log.Int("worker_id", id))
+		d.wg.Done()
 	}()
 
 	for {
@@ -184,22 +293,34 @@ func (d *Dispatcher) worker(id int) {
 		case <-d.ctx.Done():
 			return
 		case task := <-taskQueue:
-			// 确保在使用完后归还对象到池中
-			defer func() {
-				// 重置对象状态后归还到池中
-				task.Event = nil
-				task.CallbackURL = ""
-				task.RetryCount = 0
-				task.MaxRetries = 0
-				d.callbackTaskPool.Put(task)
-			}()
-
-			// 构建webhook载荷
-			payload := d.buildWebhookPayload(task.Event)
-			// 执行回调
-			d.executeCallback(task, payload)
+			atomic.AddInt32(&d.busy, 1)
+			if d.config.Dispatcher.BatchSize <= 1 {
+				d.deliver(task)
+			} else {
+				d.deliverBatch(d.collectBatch(task, taskQueue))
+			}
+			atomic.AddInt32(&d.busy, -1)
+		}
+	}
+}
+
+// collectBatch 从工作队列中收集一批回调任务，达到批大小或批处理超时即返回
+func (d *Dispatcher) collectBatch(first *types.CallbackTask, taskQueue chan *types.CallbackTask) []*types.CallbackTask {
+	batch := []*types.CallbackTask{first}
+	timer := time.NewTimer(d.config.Dispatcher.BatchTimeout)
+	defer timer.Stop()
+
+	for len(batch) < d.config.Dispatcher.BatchSize {
+		select {
+		case task := <-taskQueue:
+			batch = append(batch, task)
+		case <-timer.C:
+			return batch
+		case <-d.ctx.Done():
+			return batch
 		}
 	}
+	return batch
 }
 
 // 工作协程索引，用于轮询分配任务
@@ -213,14 +334,40 @@ func (d *Dispatcher) processEvent(event *types.ChangeEvent) {
 		d.metrics.RecordEventProcessingDuration(event.TaskID, string(event.Event), duration)
 	}()
 
-	task, exists := d.taskMap[event.TaskID]
-	if !exists {
+	if _, exists := d.taskMap[event.TaskID]; !exists {
 		log.Error("Task not found for event", log.String("task_id", event.TaskID))
 		d.metrics.RecordError("task_not_found", "dispatcher")
 		d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "failed")
 		return
 	}
 
+	d.rememberSchema(event)
+
+	// 每个投递目标各自生成回调任务，独立投递和重试
+	for _, dest := range d.destinations[event.TaskID] {
+		// 从对象池获取回调任务，使用预构建的回调URL提高性能
+		callbackTask := d.callbackTaskPool.Get().(*types.CallbackTask)
+		*callbackTask = types.CallbackTask{
+			Event:       event,
+			Destination: dest.name,
+			CallbackURL: dest.url,
+			RetryCount:  0,
+			MaxRetries:  d.policies[dest.key].maxRetries,
+		}
+		d.dispatchTask(callbackTask)
+	}
+}
+
+// dispatchTask 将回调任务分配给工作协程
+func (d *Dispatcher) dispatchTask(callbackTask *types.CallbackTask) {
+	event := callbackTask.Event
+
+	// 分发器正在停止，事件留待停止时写入溢出文件
+	if d.ctx.Err() != nil {
+		d.abandon(callbackTask)
+		return
+	}
+
 	// 检查是否有可用的工作协程
 	d.workersMux.RLock()
 	readyWorkers := atomic.LoadInt32(&d.workersReady)
@@ -235,18 +382,10 @@ func (d *Dispatcher) processEvent(event *types.ChangeEvent) {
 		d.metrics.RecordError("no_workers", "dispatcher")
 		d.metrics.IncrementEventsDropped()
 		d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "dropped")
+		d.releaseCallbackTask(callbackTask)
 		return
 	}
 
-	// 从对象池获取回调任务，使用预构建的回调URL提高性能
-	callbackTask := d.callbackTaskPool.Get().(*types.CallbackTask)
-	*callbackTask = types.CallbackTask{
-		Event:       event,
-		CallbackURL: task.PrebuiltCallbackURL,
-		RetryCount:  0,
-		MaxRetries:  d.config.Dispatcher.MaxRetries,
-	}
-
 	// 使用轮询算法选择工作协程
 	d.workersMux.RLock()
 	index := atomic.AddInt32(&workerIndex, 1) % int32(queueCount)
@@ -258,20 +397,27 @@ func (d *Dispatcher) processEvent(event *types.ChangeEvent) {
 	// 更新队列大小指标
 	d.metrics.UpdateQueueSize("task_queue", workerID, float64(queueLen))
 
-	// 将任务发送到选定的工作协程队列，使用非阻塞方式
-	select {
-	case targetQueue <- callbackTask:
-		// 任务成功发送
+	// 将任务发送到选定的工作协程队列，队列满时进入溢出队列
+	if d.enqueue(callbackTask, targetQueue) {
 		d.metrics.IncrementEventsQueued()
 		d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "queued")
-	default:
-		log.Warn("Worker queue full, dropping event",
-			log.String("task_id", event.TaskID),
-			log.Int32("worker_index", index))
-		d.metrics.RecordError("queue_full", "dispatcher")
-		d.metrics.IncrementEventsDropped()
-		d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "dropped")
+		return
+	}
+
+	if d.ctx.Err() != nil {
+		// 分发器已停止
+		d.abandon(callbackTask)
+		return
 	}
+
+	log.Warn("Worker queue and overflow queue full, dropping event",
+		log.String("task_id", event.TaskID),
+		log.String("destination", callbackTask.Destination),
+		log.Int32("worker_index", index))
+	d.metrics.RecordError("queue_full", "dispatcher")
+	d.metrics.IncrementEventsDropped()
+	d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "dropped")
+	d.releaseCallbackTask(callbackTask)
 }
 
 // buildWebhookPayload 构建webhook载荷，使用对象池优化
@@ -281,6 +427,7 @@ func (d *Dispatcher) buildWebhookPayload(event *types.ChangeEvent) *types.Webhoo
 
 	// 重置对象状态
 	*payload = types.WebhookPayload{
+		EventID:   event.ID(),
 		PrimaryID: event.PrimaryID,
 		Event:     event.Event,
 		Table:     event.Table,
@@ -300,26 +447,160 @@ func (d *Dispatcher) buildWebhookPayload(event *types.ChangeEvent) *types.Webhoo
 	return payload
 }
 
-// executeCallback 执行回调
-func (d *Dispatcher) executeCallback(callbackTask *types.CallbackTask, payload *types.WebhookPayload) {
+// deliver 投递单个回调任务
+// 投递目标的限流或并发达到上限时任务暂存在对应的限制器中，工作协程继续处理其它任务
+func (d *Dispatcher) deliver(callbackTask *types.CallbackTask) {
+	if !d.admitRateLimit(callbackTask) {
+		return
+	}
+	key := destinationKeyOf(callbackTask)
+	policy := d.policies[key]
+	if !policy.admit(callbackTask) {
+		return
+	}
+
+	msg, cacheKey, err := d.buildMessage(callbackTask)
+	if err != nil {
+		policy.cancel()
+		d.handleBuildError(callbackTask, err)
+		return
+	}
+
+	breaker := d.breakerFor(callbackTask)
+	if breaker != nil && !d.admit(breaker, callbackTask) {
+		policy.cancel()
+		return
+	}
+
 	startTime := time.Now()
-	taskID := callbackTask.Event.TaskID
+	err = d.sinks[key].Deliver(d.ctx, msg)
+	policy.release(time.Since(startTime), err)
+	if breaker != nil {
+		breaker.record(err)
+	}
+	d.finishDelivery(callbackTask, msg, cacheKey, err)
+}
 
-	// 确保在使用完后归还对象到池中
-	defer d.payloadPool.Put(payload)
+// deliverBatch 批量投递回调任务，按输出端分组后调用批量接口
+// 每个投递目标为这一批占用一个并发名额，受限的投递目标的任务被暂存，不影响同批的其它目标
+func (d *Dispatcher) deliverBatch(batch []*types.CallbackTask) {
+	type group struct {
+		tasks     []*types.CallbackTask
+		msgs      []*Message
+		cacheKeys []string
+		breakers  []*circuitBreaker
+		policies  []*deliveryPolicy
+	}
+
+	// 按投递目标归类通过限流的任务
+	byKey := make(map[string][]*types.CallbackTask)
+	var keys []string
+	for _, callbackTask := range batch {
+		if !d.admitRateLimit(callbackTask) {
+			continue
+		}
+		key := destinationKeyOf(callbackTask)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], callbackTask)
+	}
+
+	groups := make(map[Sink]*group)
+	var order []Sink
+	for _, key := range keys {
+		policy := d.policies[key]
+		if !policy.admit(byKey[key]...) {
+			continue
+		}
+
+		sink := d.sinks[key]
+		g, ok := groups[sink]
+		if !ok {
+			g = &group{}
+		}
+		delivering := 0
+		for _, callbackTask := range byKey[key] {
+			msg, cacheKey, err := d.buildMessage(callbackTask)
+			if err != nil {
+				d.handleBuildError(callbackTask, err)
+				continue
+			}
+
+			breaker := d.breakerFor(callbackTask)
+			if breaker != nil && !d.admit(breaker, callbackTask) {
+				continue
+			}
+
+			g.tasks = append(g.tasks, callbackTask)
+			g.msgs = append(g.msgs, msg)
+			g.cacheKeys = append(g.cacheKeys, cacheKey)
+			g.breakers = append(g.breakers, breaker)
+			delivering++
+		}
+		if delivering == 0 {
+			policy.cancel()
+			continue
+		}
+		g.policies = append(g.policies, policy)
+		if !ok {
+			groups[sink] = g
+			order = append(order, sink)
+		}
+	}
+
+	for _, sink := range order {
+		g := groups[sink]
+		startTime := time.Now()
+		errs := sink.DeliverBatch(d.ctx, g.msgs)
+		releasePolicies(g.policies, time.Since(startTime), errs)
+		for i, callbackTask := range g.tasks {
+			if g.breakers[i] != nil {
+				g.breakers[i].record(errs[i])
+			}
+			d.finishDelivery(callbackTask, g.msgs[i], g.cacheKeys[i], errs[i])
+		}
+	}
+}
+
+// finishDelivery 根据投递结果清理缓存、安排重试或写入死信
+func (d *Dispatcher) finishDelivery(callbackTask *types.CallbackTask, msg *Message, cacheKey string, err error) {
+	if err != nil {
+		d.handleCallbackError(callbackTask, msg, cacheKey, err)
+		return
+	}
+
+	// 投递成功后清除缓存（避免缓存过多）
+	d.jsonCache.Delete(cacheKey)
+	d.releaseCallbackTask(callbackTask)
+}
+
+// handleBuildError 处理构建消息失败：Schema Registry 等外部依赖返回的 DeliveryError 按投递失败重试，
+// 其它编码错误重试也不会成功，直接进入死信
+func (d *Dispatcher) handleBuildError(callbackTask *types.CallbackTask, err error) {
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		d.handleCallbackError(callbackTask, nil, "", err)
+		return
+	}
+	d.deadLetter(callbackTask, nil, deadLetterEncodeError, err)
+}
+
+// buildMessage 构建待投递消息，重试时复用缓存的编码结果
+func (d *Dispatcher) buildMessage(callbackTask *types.CallbackTask) (*Message, string, error) {
+	taskID := callbackTask.Event.TaskID
 
 	// 生成缓存键
-	cacheKey := d.generateCacheKey(callbackTask, payload)
+	cacheKey := d.generateCacheKey(callbackTask)
 
-	// 尝试从缓存获取 JSON 数据
-	var jsonData []byte
-	var err error
+	// 尝试从缓存获取编码结果
+	var encoded *Encoded
 
 	if cachedEntry, ok := d.jsonCache.Load(cacheKey); ok {
 		entry := cachedEntry.(*jsonCacheEntry)
 		// 检查缓存是否过期
 		if time.Since(entry.timestamp) < d.jsonCacheTTL {
-			jsonData = entry.data
+			encoded = entry.encoded
 			log.Debug("Using cached JSON data", log.String("task_id", taskID))
 			d.metrics.RecordCacheHit()
 		} else {
@@ -331,94 +612,108 @@ func (d *Dispatcher) executeCallback(callbackTask *types.CallbackTask, payload *
 		d.metrics.RecordCacheMiss()
 	}
 
-	if jsonData == nil {
-		// 缓存未命中或过期，重新序列化
-		buffer := d.bufferPool.Get().(*bytes.Buffer)
-		buffer.Reset()
-		err := json.NewEncoder(buffer).Encode(payload)
+	if encoded == nil {
+		// 缓存未命中或过期，重新编码
+		var err error
+		encoded, err = d.formatters[taskID].Format(callbackTask.Event)
+		var deliveryErr *DeliveryError
+		if errors.As(err, &deliveryErr) {
+			// Schema Registry 等外部依赖的失败由 handleBuildError 按投递失败记录和重试
+			return nil, "", err
+		}
 		if err != nil {
-			log.Error("Failed to marshal webhook payload",
+			log.Error("Failed to format webhook payload",
 				log.String("task_id", taskID),
 				zap.Error(err))
 			d.metrics.RecordError("json_marshal", "dispatcher")
-			d.bufferPool.Put(buffer)
-			return
+			return nil, "", err
 		}
 
-		jsonData = make([]byte, buffer.Len())
-		copy(jsonData, buffer.Bytes())
-		d.bufferPool.Put(buffer)
-
-		// 缓存 JSON 数据（仅在第一次尝试时缓存）
+		// 缓存编码结果（仅在第一次尝试时缓存）
 		if callbackTask.RetryCount == 0 {
 			d.jsonCache.Store(cacheKey, &jsonCacheEntry{
-				data:      jsonData,
+				encoded:   encoded,
 				timestamp: time.Now(),
 			})
 		}
 	}
 
-	// 创建HTTP请求
-	req, err := http.NewRequestWithContext(d.ctx, "POST", callbackTask.CallbackURL, bytes.NewReader(jsonData))
+	msg := &Message{
+		Task:        d.taskMap[taskID],
+		Event:       callbackTask.Event,
+		Destination: callbackTask.Destination,
+		Body:        encoded.Body,
+		ContentType: encoded.ContentType,
+		Headers:     encoded.Headers,
+		Timeout:     d.policies[destinationKeyOf(callbackTask)].timeout,
+	}
+	if dest := d.destinationOf(callbackTask); dest != nil {
+		msg.Method = dest.method
+		msg.Compression = dest.compression
+		msg.Validator = dest.validator
+	}
+
+	// 展开回调URL中的列占位符，如 /users/{id}
+	callbackURL, err := expandURLTemplate(callbackTask.CallbackURL, callbackTask.Event)
 	if err != nil {
-		log.Error("Failed to create webhook request",
+		log.Error("Failed to build callback URL",
 			log.String("task_id", taskID),
+			log.String("url", callbackTask.CallbackURL),
 			zap.Error(err))
-		d.metrics.RecordError("request_creation", "dispatcher")
-		return
+		return nil, "", err
 	}
+	msg.URL = callbackURL
+	return msg, cacheKey, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", utils.GetUserAgent())
-
-	// 发送请求
-	resp, err := d.httpClient.Do(req)
-	if err != nil {
-		d.handleCallbackError(callbackTask, payload, err)
-		return
-	}
-	defer resp.Body.Close()
+// encodeWebhookPayload 将事件编码为默认的webhook JSON载荷，使用对象池减少分配
+func (d *Dispatcher) encodeWebhookPayload(event *types.ChangeEvent) ([]byte, error) {
+	// 构建webhook载荷，使用完后归还对象池
+	payload := d.buildWebhookPayload(event)
+	defer d.payloadPool.Put(payload)
 
-	duration := time.Since(startTime).Seconds()
-	statusCode := fmt.Sprintf("%d", resp.StatusCode)
+	buffer := d.bufferPool.Get().(*bytes.Buffer)
+	defer d.bufferPool.Put(buffer)
+	buffer.Reset()
 
-	// 记录请求日志
-	log.Info("Webhook request sent",
-		log.String("task_id", taskID),
-		log.String("url", callbackTask.CallbackURL),
-		log.Int("status_code", resp.StatusCode),
-		log.Any("payload", payload))
-
-	// 记录请求指标
-	d.metrics.RecordWebhookRequest(taskID, statusCode)
-	d.metrics.RecordWebhookRequestDuration(taskID, statusCode, duration)
-
-	// 检查响应状态
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		err := fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
-		d.handleCallbackError(callbackTask, payload, err)
-		d.metrics.RecordError("http_error", "dispatcher")
-		return
+	if err := json.NewEncoder(buffer).Encode(payload); err != nil {
+		return nil, err
 	}
 
-	log.Info("Webhook callback successful", log.String("task_id", taskID))
+	jsonData := make([]byte, buffer.Len())
+	copy(jsonData, buffer.Bytes())
+	return jsonData, nil
+}
 
-	// 请求成功后清除缓存（避免缓存过多）
-	d.jsonCache.Delete(cacheKey)
+// releaseCallbackTask 重置回调任务并归还对象池
+func (d *Dispatcher) releaseCallbackTask(task *types.CallbackTask) {
+	task.Event = nil
+	task.Destination = ""
+	task.CallbackURL = ""
+	task.RetryCount = 0
+	task.MaxRetries = 0
+	task.Carried = false
+	task.RateGates = 0
+	task.Unparked = false
+	d.callbackTaskPool.Put(task)
 }
 
-// handleCallbackError 处理回调错误
-func (d *Dispatcher) handleCallbackError(callbackTask *types.CallbackTask, payload *types.WebhookPayload, err error) {
+// handleCallbackError 处理回调错误：永久失败和重试耗尽的任务进入死信，其余按退避策略重试
+func (d *Dispatcher) handleCallbackError(callbackTask *types.CallbackTask, msg *Message, cacheKey string, err error) {
 	taskID := callbackTask.Event.TaskID
 
-	log.Info("Webhook retry attempt",
-		log.String("task_id", taskID),
-		log.String("url", callbackTask.CallbackURL),
-		log.Int("retry_count", callbackTask.RetryCount),
-		zap.Error(err))
+	// 分发器停止导致的中断不计入重试次数，留待停止时写入溢出文件
+	if errors.Is(err, context.Canceled) && d.ctx.Err() != nil {
+		d.abandon(callbackTask)
+		return
+	}
 
-	// 记录重试指标
-	d.metrics.RecordWebhookRetry(taskID)
+	if isPermanent(err) {
+		d.metrics.RecordError("permanent_failure", "dispatcher")
+		d.jsonCache.Delete(cacheKey)
+		d.deadLetter(callbackTask, msg, deadLetterPermanent, err)
+		return
+	}
 
 	// 检查是否需要重试
 	if callbackTask.RetryCount >= callbackTask.MaxRetries {
@@ -427,63 +722,133 @@ func (d *Dispatcher) handleCallbackError(callbackTask *types.CallbackTask, paylo
 			log.Int("max_retries", callbackTask.MaxRetries),
 			zap.Error(err))
 		d.metrics.RecordError("max_retries_exceeded", "dispatcher")
+		d.jsonCache.Delete(cacheKey)
+		d.deadLetter(callbackTask, msg, deadLetterMaxRetries, err)
 		return
 	}
 
-	// 延迟重试
+	// 记录重试指标
+	d.metrics.RecordWebhookRetry(taskID)
+
 	callbackTask.RetryCount++
-	go func(task *types.CallbackTask) {
-		// 指数退避重试策略，使用配置的基础延迟和最大延迟限制
-		retryDelay := time.Duration(math.Pow(2, float64(task.RetryCount))) * d.config.Dispatcher.RetryBaseDelay
-		// 限制重试延迟不超过最大值
-		if retryDelay > d.config.Dispatcher.RetryMaxDelay {
-			retryDelay = d.config.Dispatcher.RetryMaxDelay
-		}
-		time.Sleep(retryDelay)
-
-		// 检查是否有可用的工作协程
-		d.workersMux.RLock()
-		readyWorkers := atomic.LoadInt32(&d.workersReady)
-		queueCount := len(d.taskQueues)
-		d.workersMux.RUnlock()
-
-		if readyWorkers == 0 || queueCount == 0 {
-			log.Warn("No workers available for retry, dropping task",
-				log.String("task_id", task.Event.TaskID),
-				log.Int("retry_count", task.RetryCount))
+	retryDelay := d.retryDelay(d.policies[destinationKeyOf(callbackTask)], callbackTask.RetryCount, err)
+
+	log.Info("Webhook retry attempt",
+		log.String("task_id", taskID),
+		log.String("url", callbackTask.CallbackURL),
+		log.Int("retry_count", callbackTask.RetryCount),
+		log.Duration("retry_delay", retryDelay),
+		zap.Error(err))
+
+	// 延迟重试
+	d.scheduleRetry(callbackTask, retryDelay)
+}
+
+// scheduleRetry 延迟 delay 后将任务重新入队，等待中的任务在停止时写入溢出文件
+func (d *Dispatcher) scheduleRetry(callbackTask *types.CallbackTask, delay time.Duration) {
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	d.retries[callbackTask] = time.AfterFunc(delay, func() {
+		// 停止时已被取走的任务不再入队
+		if !d.takeRetry(callbackTask) {
 			return
 		}
+		defer atomic.AddInt32(&d.busy, -1)
+		d.retry(callbackTask)
+	})
+}
+
+// takeRetry 从等待重试的任务中移除并计入处理中，任务已被取走时返回false
+func (d *Dispatcher) takeRetry(callbackTask *types.CallbackTask) bool {
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	if _, ok := d.retries[callbackTask]; !ok {
+		return false
+	}
+	delete(d.retries, callbackTask)
+	atomic.AddInt32(&d.busy, 1)
+	return true
+}
 
-		// 使用轮询算法选择工作协程
-		d.workersMux.RLock()
-		index := atomic.AddInt32(&workerIndex, 1) % int32(queueCount)
-		targetQueue := d.taskQueues[index]
-		d.workersMux.RUnlock()
+// retry 将到期的重试任务放回工作队列
+func (d *Dispatcher) retry(task *types.CallbackTask) {
+	// 检查是否有可用的工作协程
+	d.workersMux.RLock()
+	readyWorkers := atomic.LoadInt32(&d.workersReady)
+	queueCount := len(d.taskQueues)
+	d.workersMux.RUnlock()
 
-		// 将重试任务发送到工作协程队列，使用非阻塞方式
-		select {
-		case targetQueue <- task:
-			log.Info("Retry task queued successfully",
-				log.String("task_id", task.Event.TaskID),
-				log.Int("retry_count", task.RetryCount),
-				log.Int32("worker_index", index))
-		default:
-			log.Warn("Worker queue full, dropping retry task",
-				log.String("task_id", task.Event.TaskID),
-				log.Int("retry_count", task.RetryCount),
-				log.Int32("worker_index", index))
+	if d.ctx.Err() != nil {
+		d.abandon(task)
+		return
+	}
+	if readyWorkers == 0 || queueCount == 0 {
+		log.Warn("No workers available for retry, dropping task",
+			log.String("task_id", task.Event.TaskID),
+			log.Int("retry_count", task.RetryCount))
+		d.releaseCallbackTask(task)
+		return
+	}
+
+	// 使用轮询算法选择工作协程
+	d.workersMux.RLock()
+	index := atomic.AddInt32(&workerIndex, 1) % int32(queueCount)
+	targetQueue := d.taskQueues[index]
+	d.workersMux.RUnlock()
+
+	// 将重试任务发送到工作协程队列，队列满时进入溢出队列
+	taskID, retryCount := task.Event.TaskID, task.RetryCount
+	if d.enqueue(task, targetQueue) {
+		log.Info("Retry task queued successfully",
+			log.String("task_id", taskID),
+			log.Int("retry_count", retryCount),
+			log.Int32("worker_index", index))
+		return
+	}
+	if d.ctx.Err() != nil {
+		d.abandon(task)
+		return
+	}
+	log.Warn("Worker queue and overflow queue full, dropping retry task",
+		log.String("task_id", taskID),
+		log.Int("retry_count", retryCount),
+		log.Int32("worker_index", index))
+	d.releaseCallbackTask(task)
+}
+
+// retryDelay 计算下次重试前的等待时间
+// 接收方通过 Retry-After 指定了间隔时遵从该值（不超过 max_retry_after），否则按任务的投递策略使用带抖动的指数退避
+func (d *Dispatcher) retryDelay(policy *deliveryPolicy, retryCount int, err error) time.Duration {
+	maxRetryAfter := d.config.Dispatcher.MaxRetryAfter
+	if retryAfter := retryAfterOf(err); retryAfter > 0 {
+		if maxRetryAfter > 0 && retryAfter > maxRetryAfter {
+			return maxRetryAfter
 		}
-	}(callbackTask)
+		return retryAfter
+	}
+	return backoffDelay(policy.retryBaseDelay, policy.retryMaxDelay, retryCount)
+}
+
+// backoffDelay 指数退避加抖动：上限为 base*2^attempt（不超过 max），实际等待在上限的一半到上限之间随机，
+// 避免大量同时失败的投递在同一时刻重试
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	ceiling := max
+	if attempt < 32 {
+		if delay := base << attempt; delay > 0 && delay < max {
+			ceiling = delay
+		}
+	}
+
+	half := ceiling / 2
+	return half + rand.N(ceiling-half+1)
 }
 
 // generateCacheKey 生成缓存键
-func (d *Dispatcher) generateCacheKey(callbackTask *types.CallbackTask, payload *types.WebhookPayload) string {
-	// 使用任务的唯一标识符和载荷的关键信息生成缓存键
-	keyData := fmt.Sprintf("%s:%s:%s:%v:%s",
-		callbackTask.Event.TaskID,
-		callbackTask.Event.Table,
-		callbackTask.Event.Event,
-		callbackTask.Event.PrimaryID,
+func (d *Dispatcher) generateCacheKey(callbackTask *types.CallbackTask) string {
+	// 使用事件ID、投递目标和回调地址生成缓存键，同一行的多次变更不会互相命中
+	keyData := fmt.Sprintf("%s:%s:%s",
+		callbackTask.Event.ID(),
+		callbackTask.Destination,
 		callbackTask.CallbackURL)
 
 	// 使用MD5哈希生成固定长度的缓存键
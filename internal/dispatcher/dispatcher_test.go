@@ -0,0 +1,447 @@
+package dispatcher
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pikachu/internal/config"
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.Init(&types.LogConfig{Level: types.LogLevelError, Format: "text"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestConfig 按正式配置的校验和默认值生成配置，重试延迟缩短到毫秒级
+func newTestConfig(t *testing.T, tasks ...types.Task) *types.Config {
+	t.Helper()
+	cfg := &types.Config{
+		Database: types.DatabaseConfig{Host: "127.0.0.1", Port: 3306, User: "root", Database: "app", ServerID: 1},
+		Tasks:    tasks,
+	}
+	cfg.Dispatcher.WorkerCount = 2
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatalf("invalid test config: %v", err)
+	}
+	cfg.Dispatcher.RetryBaseDelay = 10 * time.Millisecond
+	cfg.Dispatcher.RetryMaxDelay = 20 * time.Millisecond
+	return cfg
+}
+
+// startTestDispatcher 创建并启动分发器，测试结束时停止
+func startTestDispatcher(t *testing.T, cfg *types.Config) (*Dispatcher, chan *types.ChangeEvent) {
+	t.Helper()
+	events := make(chan *types.ChangeEvent, 16)
+	d, err := New(cfg, events, nil)
+	if err != nil {
+		t.Fatalf("failed to create dispatcher: %v", err)
+	}
+	d.Start()
+	t.Cleanup(d.Stop)
+	return d, events
+}
+
+// newInlineDispatcher 创建不启动协程的分发器，测试直接调用事件处理方法，
+// 发送的事件进入唯一的工作队列，由测试通过 emitted 读取
+func newInlineDispatcher(t *testing.T, task types.Task) (*Dispatcher, chan *types.CallbackTask) {
+	t.Helper()
+	d, err := New(newTestConfig(t, task), make(chan *types.ChangeEvent), nil)
+	if err != nil {
+		t.Fatalf("failed to create dispatcher: %v", err)
+	}
+	queue := make(chan *types.CallbackTask, 64)
+	d.taskQueues = []chan *types.CallbackTask{queue}
+	d.workersReady = 1
+	t.Cleanup(d.cancel)
+	return d, queue
+}
+
+// emitted 取出已发送到工作队列的事件
+func emitted(queue chan *types.CallbackTask) []*types.ChangeEvent {
+	var events []*types.ChangeEvent
+	for len(queue) > 0 {
+		events = append(events, (<-queue).Event)
+	}
+	return events
+}
+
+// readDeadLetters 读取死信文件中已写入的记录，文件不存在时返回nil
+func readDeadLetters(t *testing.T, path string) []deadLetterEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("failed to read dead letters: %v", err)
+	}
+	// 只解析已写完的行，最后一个换行之后的内容可能正在写入
+	lines := bytes.Split(data, []byte("\n"))
+	var entries []deadLetterEntry
+	for _, line := range lines[:len(lines)-1] {
+		var entry deadLetterEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("invalid dead letter %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// testEvent 构造一个带 binlog 位置的插入事件
+func testEvent(taskID string, id int64) *types.ChangeEvent {
+	return &types.ChangeEvent{
+		TaskID:      taskID,
+		Event:       types.EventInsert,
+		Database:    "app",
+		Table:       "users",
+		PrimaryID:   id,
+		NewData:     map[string]interface{}{"id": id, "name": "alice"},
+		Timestamp:   time.Now(),
+		EventTime:   time.Now(),
+		LogName:     "mysql-bin.000001",
+		LogPos:      uint32(1000 + id),
+		PrimaryKeys: []string{"id"},
+	}
+}
+
+// testTableSchema 构造表结构，列的格式为 "名称 类型"，如 "id UNSIGNED BIGINT"、"price DECIMAL(10,2)"
+// sql.ColumnType 无法直接构造，因此通过只返回列定义的 schemadriver 查询得到
+func testTableSchema(t *testing.T, columns ...string) *types.TableSchema {
+	t.Helper()
+	db, err := sql.Open("pikachu-schema", strings.Join(columns, ";"))
+	if err != nil {
+		t.Fatalf("failed to open schema driver: %v", err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT * FROM t LIMIT 0")
+	if err != nil {
+		t.Fatalf("failed to query schema: %v", err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("failed to get column types: %v", err)
+	}
+
+	schema := &types.TableSchema{Columns: make(map[string]*sql.ColumnType)}
+	for _, ct := range columnTypes {
+		schema.Columns[ct.Name()] = ct
+		schema.ColumnNames = append(schema.ColumnNames, ct.Name())
+	}
+	return schema
+}
+
+func init() {
+	sql.Register("pikachu-schema", schemaDriver{})
+}
+
+// schemaDriver 以数据源名称中的列定义作为任意查询的结果列，结果没有数据行
+type schemaDriver struct{}
+
+func (schemaDriver) Open(name string) (driver.Conn, error) {
+	var columns []schemaColumn
+	for _, spec := range strings.Split(name, ";") {
+		column, typeName, ok := strings.Cut(spec, " ")
+		if !ok {
+			return nil, errors.New("invalid column spec: " + spec)
+		}
+		c := schemaColumn{name: column, typeName: typeName}
+		if base, args, ok := strings.Cut(typeName, "("); ok {
+			c.typeName = base
+			size, scale, _ := strings.Cut(strings.TrimSuffix(args, ")"), ",")
+			c.size, _ = strconv.ParseInt(size, 10, 64)
+			c.scale, _ = strconv.ParseInt(scale, 10, 64)
+		}
+		columns = append(columns, c)
+	}
+	return &schemaConn{columns: columns}, nil
+}
+
+type schemaColumn struct {
+	name     string
+	typeName string
+	size     int64 // 字符串长度或 DECIMAL 精度
+	scale    int64
+}
+
+type schemaConn struct {
+	columns []schemaColumn
+}
+
+func (c *schemaConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *schemaConn) Close() error              { return nil }
+func (c *schemaConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+func (c *schemaConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	return &schemaRows{columns: c.columns}, nil
+}
+
+type schemaRows struct {
+	columns []schemaColumn
+}
+
+func (r *schemaRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.name
+	}
+	return names
+}
+func (r *schemaRows) Close() error                   { return nil }
+func (r *schemaRows) Next(dest []driver.Value) error { return io.EOF }
+func (r *schemaRows) ColumnTypeDatabaseTypeName(i int) string {
+	return r.columns[i].typeName
+}
+func (r *schemaRows) ColumnTypeLength(i int) (int64, bool) {
+	switch r.columns[i].typeName {
+	case "CHAR", "VARCHAR", "BINARY", "VARBINARY":
+		return r.columns[i].size, true
+	}
+	return 0, false
+}
+func (r *schemaRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+	if r.columns[i].typeName == "DECIMAL" {
+		return r.columns[i].size, r.columns[i].scale, true
+	}
+	return 0, 0, false
+}
+
+// waitFor 等待条件成立，超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIdempotencyKeyStableAcrossRetries(t *testing.T) {
+	var mu sync.Mutex
+	var keys, bodyIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload types.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get(idempotencyKeyHeader))
+		bodyIDs = append(bodyIDs, payload.EventID)
+		// 前两次返回503，第三次成功
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: server.URL + "/webhook",
+	})
+	_, events := startTestDispatcher(t, cfg)
+
+	event := testEvent("users", 1)
+	events <- event
+	waitFor(t, "three delivery attempts", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(keys) >= 3
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range keys {
+		if keys[i] != event.ID() {
+			t.Errorf("attempt %d: Idempotency-Key = %q, want %q", i, keys[i], event.ID())
+		}
+		if bodyIDs[i] != event.ID() {
+			t.Errorf("attempt %d: event_id = %q, want %q", i, bodyIDs[i], event.ID())
+		}
+	}
+}
+
+func TestEventIDSurvivesSpillFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow.ndjson")
+
+	event := testEvent("users", 7)
+	event.GTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"
+	event.TxnOffset = 310
+	event.RowIndex = 2
+	event.SubIndex = 1
+	event.PrimaryID = map[string]interface{}{"tenant_id": int64(3), "id": uint64(7)}
+
+	spill, err := openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to open spill file: %v", err)
+	}
+	if err := spill.write(&types.CallbackTask{Event: event, CallbackURL: "/webhook", RetryCount: 2}); err != nil {
+		t.Fatalf("failed to write spill record: %v", err)
+	}
+	if err := spill.close(nil); err != nil {
+		t.Fatalf("failed to close spill file: %v", err)
+	}
+
+	// 模拟重启后重新打开溢出文件
+	spill, err = openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to reopen spill file: %v", err)
+	}
+	defer spill.close(nil)
+	records, err := spill.read(10)
+	if err != nil {
+		t.Fatalf("failed to read spill file: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d spilled records, want 1", len(records))
+	}
+	if got := records[0].event().ID(); got != event.ID() {
+		t.Fatalf("ID after spill = %s, want %s", got, event.ID())
+	}
+}
+
+func TestSpillDiscardKeepsCarriedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow.ndjson")
+	spill, err := openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to open spill file: %v", err)
+	}
+	for i := int64(1); i <= 2; i++ {
+		if err := spill.write(&types.CallbackTask{Event: testEvent("users", i)}); err != nil {
+			t.Fatalf("failed to write spill record: %v", err)
+		}
+	}
+	if err := spill.close(nil); err != nil {
+		t.Fatalf("failed to close spill file: %v", err)
+	}
+
+	// 重启后读出一条残留记录，本次运行又写入一条新事件和一条再次溢出的残留事件
+	spill, err = openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to reopen spill file: %v", err)
+	}
+	records, err := spill.read(1)
+	if err != nil || len(records) != 1 || !records[0].Carried {
+		t.Fatalf("read() = %v, %v; want one carried record", records, err)
+	}
+	restored := &types.CallbackTask{Event: records[0].event(), Carried: true}
+	if err := spill.write(&types.CallbackTask{Event: testEvent("users", 3)}); err != nil {
+		t.Fatalf("failed to write spill record: %v", err)
+	}
+	if err := spill.write(&types.CallbackTask{Event: testEvent("users", 4), Carried: true}); err != nil {
+		t.Fatalf("failed to write spill record: %v", err)
+	}
+
+	dropped, err := spill.discard([]*types.CallbackTask{restored})
+	if err != nil {
+		t.Fatalf("discard() error = %v", err)
+	}
+	if dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+
+	spill, err = openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to reopen spill file: %v", err)
+	}
+	defer spill.close(nil)
+	records, err = spill.read(10)
+	if err != nil {
+		t.Fatalf("failed to read spill file: %v", err)
+	}
+	var ids []interface{}
+	for _, record := range records {
+		ids = append(ids, record.PrimaryID)
+	}
+	if fmt.Sprint(ids) != "[1 2 4]" {
+		t.Fatalf("kept primary ids = %v, want [1 2 4]", ids)
+	}
+}
+
+func TestAbortDiscardsDeliveriesReadThisRun(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "overflow.ndjson")
+	carried := testEvent("users", 1)
+	spill, err := openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to open spill file: %v", err)
+	}
+	if err := spill.write(&types.CallbackTask{Event: carried, CallbackURL: server.URL + "/webhook"}); err != nil {
+		t.Fatalf("failed to write spill record: %v", err)
+	}
+	if err := spill.close(nil); err != nil {
+		t.Fatalf("failed to close spill file: %v", err)
+	}
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: server.URL + "/webhook",
+	})
+	cfg.Dispatcher.Overflow.SpillPath = path
+	cfg.Dispatcher.RetryBaseDelay = time.Minute
+	cfg.Dispatcher.RetryMaxDelay = time.Minute
+	events := make(chan *types.ChangeEvent, 16)
+	d, err := New(cfg, events, nil)
+	if err != nil {
+		t.Fatalf("failed to create dispatcher: %v", err)
+	}
+	d.Start()
+
+	// 上次残留的事件和本次读取的事件都在等待重试
+	events <- testEvent("users", 2)
+	waitFor(t, "both deliveries to fail once", func() bool { return attempts.Load() == 2 })
+	if err := d.Abort(); err != nil {
+		t.Fatalf("Abort() error = %v", err)
+	}
+
+	// 本次读取的事件由接管者从位点重新读取，溢出文件中只保留上次残留的事件
+	spill, err = openSpillFile(path, 1)
+	if err != nil {
+		t.Fatalf("failed to reopen spill file: %v", err)
+	}
+	defer spill.close(nil)
+	records, err := spill.read(10)
+	if err != nil {
+		t.Fatalf("failed to read spill file: %v", err)
+	}
+	if len(records) != 1 || records[0].event().ID() != carried.ID() {
+		t.Fatalf("spilled records = %d, want only the carried event", len(records))
+	}
+	if records[0].RetryCount != 1 {
+		t.Fatalf("retry count = %d, want 1", records[0].RetryCount)
+	}
+}
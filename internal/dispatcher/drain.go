@@ -0,0 +1,229 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// drainPollInterval 排空期间检查是否空闲的间隔
+const drainPollInterval = 50 * time.Millisecond
+
+// Drain 排空并停止分发器
+//
+// 先在 timeout 内等待事件队列、合并器、工作队列、溢出队列、等待重试、等待限流和熔断暂存的投递全部完成，
+// 超时后中断正在进行的投递；仍未完成的投递写入溢出文件，下次启动时继续投递。
+// 返回nil表示所有事件都已投递或保存，此时可以安全地保存 binlog 位点
+func (d *Dispatcher) Drain(timeout time.Duration) error {
+	log.Info("Stopping webhook dispatcher", log.Duration("drain_timeout", timeout))
+
+	if timeout > 0 && !d.waitIdle(timeout) {
+		log.Warn("Drain deadline exceeded, interrupting in-flight deliveries",
+			log.Duration("drain_timeout", timeout))
+	}
+
+	unfinished, remaining := d.halt()
+	lost, err := d.overflow.close(unfinished, remaining)
+	d.closeSinks()
+	d.clearJSONCache()
+
+	if err != nil {
+		return fmt.Errorf("failed to persist unfinished deliveries: %w", err)
+	}
+	if lost > 0 {
+		for i := 0; i < lost; i++ {
+			d.metrics.IncrementEventsDropped()
+		}
+		return fmt.Errorf("%d unfinished deliveries lost: overflow spill_path is not configured", lost)
+	}
+	log.Info("Webhook dispatcher stopped", log.Int("persisted", len(unfinished)+len(remaining)))
+	return nil
+}
+
+// Abort 立即停止分发器，丢弃本次运行读取的事件尚未完成的投递，不写入溢出文件
+//
+// 用于不保存位点就停止的场景（失去主节点身份、任务交给其他实例）：这些事件晚于已保存的位点，
+// 接管者会从位点重新读取，写入溢出文件会在下次启动时重放过期的变更。
+// 启动时从溢出文件恢复的投递早于位点，不会被重新读取，仍然写回溢出文件
+func (d *Dispatcher) Abort() error {
+	log.Info("Aborting webhook dispatcher")
+
+	unfinished, remaining := d.halt()
+	discarded, err := d.overflow.discard(unfinished, remaining)
+	d.closeSinks()
+	d.clearJSONCache()
+
+	if err != nil {
+		return fmt.Errorf("failed to persist carried-over deliveries: %w", err)
+	}
+	log.Info("Webhook dispatcher aborted", log.Int("discarded", discarded))
+	return nil
+}
+
+// halt 中断所有投递并停止协程，返回尚未完成的投递和事件队列中剩余的事件
+func (d *Dispatcher) halt() (unfinished, remaining []*types.CallbackTask) {
+	// 停止所有协程，正在进行的投递被中断后记入 abandoned
+	d.cancel()
+	d.wg.Wait()
+	unfinished = d.takeUnfinished()
+	for atomic.LoadInt32(&d.busy) > 0 {
+		time.Sleep(drainPollInterval)
+	}
+	unfinished = append(unfinished, d.takeQueued()...)
+
+	// 事件队列中剩余的事件晚于溢出队列，排在最后
+	for len(d.eventQueue) > 0 {
+		d.handleEvent(<-d.eventQueue)
+	}
+	return unfinished, d.takeAbandoned()
+}
+
+// clearJSONCache 清理JSON缓存
+func (d *Dispatcher) clearJSONCache() {
+	d.jsonCache.Range(func(key, value interface{}) bool {
+		d.jsonCache.Delete(key)
+		return true
+	})
+}
+
+// waitIdle 等待所有投递完成，连续两次检查都空闲才视为排空，避免任务在队列间转移的瞬间被误判；超时返回false
+func (d *Dispatcher) waitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	idleChecks := 0
+	for {
+		if d.idle() {
+			idleChecks++
+			if idleChecks >= 2 {
+				return true
+			}
+		} else {
+			idleChecks = 0
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// Idle 判断此前收到的事件是否都已投递完成（包括重试、溢出和熔断暂存），用于运行期间保存位点
+func (d *Dispatcher) Idle() bool {
+	return d.waitIdle(drainPollInterval)
+}
+
+// WaitIdle 在 timeout 内等待此前收到的事件全部投递完成，超时返回false
+func (d *Dispatcher) WaitIdle(timeout time.Duration) bool {
+	return d.waitIdle(timeout)
+}
+
+// idle 检查是否没有任何待处理或正在处理的投递
+func (d *Dispatcher) idle() bool {
+	if len(d.eventQueue) > 0 || d.overflow.pending() > 0 ||
+		atomic.LoadInt32(&d.busy) > 0 || atomic.LoadInt32(&d.coalescing) > 0 {
+		return false
+	}
+
+	d.retryMu.Lock()
+	retries := len(d.retries)
+	d.retryMu.Unlock()
+	if retries > 0 {
+		return false
+	}
+
+	d.workersMux.RLock()
+	for _, taskQueue := range d.taskQueues {
+		if len(taskQueue) > 0 {
+			d.workersMux.RUnlock()
+			return false
+		}
+	}
+	d.workersMux.RUnlock()
+
+	for _, policy := range d.policies {
+		if policy.rateLimit != nil && policy.rateLimit.waitingCount() > 0 {
+			return false
+		}
+		if policy.concurrency != nil && policy.concurrency.parkedCount() > 0 {
+			return false
+		}
+	}
+	for _, bucket := range d.hostLimits {
+		if bucket.waitingCount() > 0 {
+			return false
+		}
+	}
+
+	idle := true
+	d.breakers.Range(func(key, value interface{}) bool {
+		if value.(*circuitBreaker).parkedCount() > 0 {
+			idle = false
+		}
+		return idle
+	})
+	return idle
+}
+
+// abandon 记录因分发器停止而中断的任务，停止时写入溢出文件
+func (d *Dispatcher) abandon(callbackTask *types.CallbackTask) {
+	d.abandonMu.Lock()
+	defer d.abandonMu.Unlock()
+	d.abandoned = append(d.abandoned, callbackTask)
+}
+
+// takeAbandoned 取出已记录的中断任务
+func (d *Dispatcher) takeAbandoned() []*types.CallbackTask {
+	d.abandonMu.Lock()
+	defer d.abandonMu.Unlock()
+	abandoned := d.abandoned
+	d.abandoned = nil
+	return abandoned
+}
+
+// takeUnfinished 依次取出中断的投递、熔断暂存的任务、等待限流和并发名额的任务和等待重试的任务，并停止计时
+func (d *Dispatcher) takeUnfinished() []*types.CallbackTask {
+	unfinished := d.takeAbandoned()
+
+	d.breakers.Range(func(key, value interface{}) bool {
+		unfinished = append(unfinished, value.(*circuitBreaker).takeParked()...)
+		return true
+	})
+
+	for _, policy := range d.policies {
+		if policy.rateLimit != nil {
+			unfinished = append(unfinished, policy.rateLimit.takeWaiting()...)
+		}
+		if policy.concurrency != nil {
+			unfinished = append(unfinished, policy.concurrency.takeParked()...)
+		}
+	}
+	for _, bucket := range d.hostLimits {
+		unfinished = append(unfinished, bucket.takeWaiting()...)
+	}
+
+	d.retryMu.Lock()
+	for callbackTask, timer := range d.retries {
+		timer.Stop()
+		unfinished = append(unfinished, callbackTask)
+	}
+	clear(d.retries)
+	d.retryMu.Unlock()
+
+	return unfinished
+}
+
+// takeQueued 取出工作协程退出后留在工作队列中的任务，以及退出过程中被中断的任务
+func (d *Dispatcher) takeQueued() []*types.CallbackTask {
+	queued := d.takeAbandoned()
+
+	d.workersMux.RLock()
+	defer d.workersMux.RUnlock()
+	for _, taskQueue := range d.taskQueues {
+		for len(taskQueue) > 0 {
+			queued = append(queued, <-taskQueue)
+		}
+	}
+	return queued
+}
@@ -0,0 +1,265 @@
+package dispatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// rotatedTimeFormat 轮转文件名中的时间戳格式
+const rotatedTimeFormat = "20060102T150405.000"
+
+// FileSink 将事件以NDJSON格式写入本地文件的输出端，支持按大小和时间轮转
+type FileSink struct {
+	mu             sync.Mutex
+	path           string
+	maxSize        int64
+	rotateInterval time.Duration
+	maxBackups     int
+	compress       bool
+
+	file     *os.File // 当前文件，轮转后重新打开失败时为nil，下次写入时重试
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	metrics *metrics.Metrics
+}
+
+// NewFileSink 创建本地文件输出端
+func NewFileSink(cfg *types.FileSinkConfig, m *metrics.Metrics) (*FileSink, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("file sink config is missing")
+	}
+
+	sink := &FileSink{
+		path:           cfg.Path,
+		maxSize:        int64(cfg.MaxSizeMB) * 1024 * 1024,
+		rotateInterval: cfg.RotateInterval,
+		maxBackups:     cfg.MaxBackups,
+		compress:       cfg.Compress,
+		metrics:        m,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", cfg.Path, err)
+	}
+	if err := sink.openFile(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// Deliver 追加写入单条事件
+func (s *FileSink) Deliver(ctx context.Context, msg *Message) error {
+	return s.write(appendNDJSON(nil, msg.Body))
+}
+
+// DeliverBatch 将整批事件合并为一次写入
+func (s *FileSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	var buf []byte
+	for _, msg := range msgs {
+		buf = appendNDJSON(buf, msg.Body)
+	}
+
+	errs := make([]error, len(msgs))
+	if err := s.write(buf); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// write 写入数据，写入前按需轮转文件
+func (s *FileSink) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("file sink %s is closed", s.path)
+	}
+	if s.file == nil {
+		if err := s.openFile(); err != nil {
+			s.metrics.RecordError("file_write", "dispatcher")
+			return err
+		}
+	}
+
+	if s.shouldRotate(int64(len(data))) {
+		if err := s.rotate(); err != nil {
+			s.metrics.RecordError("file_rotate", "dispatcher")
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		s.metrics.RecordError("file_write", "dispatcher")
+		return fmt.Errorf("failed to write to %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// shouldRotate 判断写入前是否需要轮转，空文件不会因大小而轮转
+func (s *FileSink) shouldRotate(incoming int64) bool {
+	if s.maxSize > 0 && s.size > 0 && s.size+incoming > s.maxSize {
+		return true
+	}
+	if s.rotateInterval > 0 && time.Since(s.openedAt) >= s.rotateInterval {
+		return true
+	}
+	return false
+}
+
+// openFile 以追加模式打开当前文件
+func (s *FileSink) openFile() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat %s: %w", s.path, err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+// rotate 关闭当前文件并重命名为带时间戳的历史文件，然后重新打开
+// 重命名失败时重新打开原文件继续写入，下次写入时再尝试轮转
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", s.path, err)
+	}
+	s.file = nil
+
+	rotated := s.rotatedName(time.Now())
+	if err := os.Rename(s.path, rotated); err != nil {
+		err = fmt.Errorf("failed to rotate %s: %w", s.path, err)
+		if reopenErr := s.openFile(); reopenErr != nil {
+			return errors.Join(err, reopenErr)
+		}
+		log.Error("Failed to rotate event file, continuing with the current file", log.String("path", s.path), zap.Error(err))
+		s.metrics.RecordError("file_rotate", "dispatcher")
+		return nil
+	}
+
+	log.Info("Event file rotated", log.String("path", s.path), log.String("rotated", rotated))
+
+	if err := s.openFile(); err != nil {
+		return err
+	}
+
+	// 压缩和清理在后台进行，不阻塞写入
+	go s.postRotate(rotated)
+	return nil
+}
+
+// rotatedName 生成历史文件名，例如 events.ndjson -> events-20240101T120000.000.ndjson
+func (s *FileSink) rotatedName(t time.Time) string {
+	ext := filepath.Ext(s.path)
+	base := strings.TrimSuffix(s.path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.Format(rotatedTimeFormat), ext)
+}
+
+// postRotate 压缩历史文件并清理超出数量的旧文件
+func (s *FileSink) postRotate(rotated string) {
+	if s.compress {
+		if err := gzipFile(rotated); err != nil {
+			log.Error("Failed to compress rotated event file", log.String("path", rotated), zap.Error(err))
+		}
+	}
+	if s.maxBackups > 0 {
+		s.removeOldBackups()
+	}
+}
+
+// removeOldBackups 删除超出保留数量的历史文件，时间戳格式保证按文件名排序即按时间排序
+func (s *FileSink) removeOldBackups() {
+	ext := filepath.Ext(s.path)
+	pattern := strings.TrimSuffix(s.path, ext) + "-*" + ext + "*"
+	backups, err := filepath.Glob(pattern)
+	if err != nil || len(backups) <= s.maxBackups {
+		return
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.maxBackups] {
+		if err := os.Remove(backup); err != nil {
+			log.Warn("Failed to remove old event file", log.String("path", backup), zap.Error(err))
+		}
+	}
+}
+
+// gzipFile 将文件压缩为 .gz 并删除原文件
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Close 同步并关闭当前文件
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	s.file.Sync()
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// appendNDJSON 追加一行NDJSON，确保每条记录以且仅以一个换行结尾
+func appendNDJSON(buf, body []byte) []byte {
+	buf = append(buf, bytes.TrimRight(body, "\n")...)
+	return append(buf, '\n')
+}
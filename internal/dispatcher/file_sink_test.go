@@ -0,0 +1,47 @@
+package dispatcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestFileSinkReopensWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink, err := NewFileSink(&types.FileSinkConfig{Path: path, MaxSizeMB: 1}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create file sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Deliver(context.Background(), &Message{Body: []byte(`{"n":1}`)}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+
+	// 删除当前文件并强制轮转，重命名因源文件不存在而失败
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	sink.maxSize = 1
+	sink.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Deliver(context.Background(), &Message{Body: []byte(`{"n":2}`)}); err != nil {
+			t.Fatalf("write after failed rotation: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("current file was not reopened: %v", err)
+	}
+	if got := strings.Count(string(data), `{"n":2}`); got < 1 {
+		t.Fatalf("reopened file contains %q, want the later records", data)
+	}
+}
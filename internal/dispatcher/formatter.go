@@ -0,0 +1,103 @@
+package dispatcher
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"pikachu/internal/payload"
+	"pikachu/internal/types"
+)
+
+// Encoded 编码后的载荷
+type Encoded struct {
+	Body        []byte            // 消息体
+	ContentType string            // 消息体类型
+	Headers     map[string]string // 需要随消息发送的附加头
+}
+
+// Formatter 载荷格式化器，将变更事件编码为消息体
+type Formatter interface {
+	Format(event *types.ChangeEvent) (*Encoded, error)
+}
+
+// newFormatter 根据任务的格式配置创建载荷格式化器
+func (d *Dispatcher) newFormatter(task *types.Task) (Formatter, error) {
+	webhook := &webhookFormatter{encode: d.encodeWebhookPayload, contentType: "application/json"}
+	if task.PayloadTemplate != "" {
+		// 自定义模板替代默认的webhook载荷，CloudEvents 格式同样使用模板输出作为 data
+		tpl, err := payload.Parse(task.TaskID, task.PayloadTemplate, task.PayloadContentType)
+		if err != nil {
+			return nil, err
+		}
+		webhook = &webhookFormatter{encode: tpl.Render, contentType: tpl.ContentType()}
+	}
+
+	switch task.Format {
+	case "", types.FormatWebhook:
+		return webhook, nil
+	case types.FormatCloudEvents:
+		return newCloudEventsFormatter(task.CloudEvents, &d.config.Database, webhook)
+	case types.FormatDebezium:
+		return &debeziumFormatter{serverName: d.config.Database.Host}, nil
+	case types.FormatMaxwell:
+		return &maxwellFormatter{}, nil
+	case types.FormatCanal:
+		return &canalFormatter{}, nil
+	case types.FormatAvro:
+		return newBinaryFormatter(task, avroCodec{})
+	case types.FormatProtobuf:
+		return newBinaryFormatter(task, protobufCodec{})
+	default:
+		return nil, fmt.Errorf("unsupported payload format: %s", task.Format)
+	}
+}
+
+// webhookFormatter 默认的webhook JSON格式或用户自定义模板
+type webhookFormatter struct {
+	encode      func(event *types.ChangeEvent) ([]byte, error)
+	contentType string
+}
+
+// Format 编码为webhook载荷
+func (f *webhookFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	body, err := f.encode(event)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{Body: body, ContentType: f.contentType}, nil
+}
+
+// rowImages 返回事件的变更前后镜像
+// INSERT 只有变更后镜像，DELETE 只有变更前镜像（被删除的数据保存在 NewData 中）
+func rowImages(event *types.ChangeEvent) (before, after map[string]interface{}) {
+	switch event.Event {
+	case types.EventInsert:
+		return nil, event.NewData
+	case types.EventUpdate:
+		return event.OldData, event.NewData
+	case types.EventDelete:
+		return event.NewData, nil
+	default:
+		return event.OldData, event.NewData
+	}
+}
+
+// changedColumns 返回UPDATE中发生变化的列的旧值
+func changedColumns(oldData, newData map[string]interface{}) map[string]interface{} {
+	changed := make(map[string]interface{})
+	for column, oldValue := range oldData {
+		if newValue, ok := newData[column]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changed[column] = oldValue
+		}
+	}
+	return changed
+}
+
+// eventTimeOf 返回binlog事件时间，缺失时使用检测时间
+func eventTimeOf(event *types.ChangeEvent) time.Time {
+	if event.EventTime.IsZero() {
+		return event.Timestamp
+	}
+	return event.EventTime
+}
@@ -0,0 +1,132 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+	"pikachu/internal/utils"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden with the current output")
+
+// envelopeEvents 信封格式的黄金文件用例：单主键的增删改和复合主键的更新
+func envelopeEvents(t *testing.T) map[string]*types.ChangeEvent {
+	eventTime := time.Date(2026, 3, 14, 9, 26, 53, 0, time.UTC)
+	detected := eventTime.Add(120 * time.Millisecond)
+	users := testTableSchema(t,
+		"id UNSIGNED BIGINT",
+		"name VARCHAR(64)",
+		"balance DECIMAL(10,2)",
+		"created_at DATETIME",
+		"note TEXT",
+	)
+	row := func(name, balance string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":         uint64(42),
+			"name":       name,
+			"balance":    balance,
+			"created_at": time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			"note":       nil,
+		}
+	}
+	event := func(eventType types.EventType, logPos uint32) *types.ChangeEvent {
+		return &types.ChangeEvent{
+			TaskID:      "users",
+			Event:       eventType,
+			Database:    "shop",
+			Table:       "users",
+			PrimaryID:   uint64(42),
+			PrimaryKeys: []string{"id"},
+			Schema:      users,
+			Timestamp:   detected,
+			EventTime:   eventTime,
+			LogName:     "mysql-bin.000003",
+			LogPos:      logPos,
+		}
+	}
+
+	insert := event(types.EventInsert, 1540)
+	insert.NewData = row("alice", "10.00")
+
+	update := event(types.EventUpdate, 2210)
+	update.OldData = row("alice", "10.00")
+	update.NewData = row("alice", "19.99")
+	update.GTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"
+
+	// DELETE 的被删除数据保存在 NewData 中
+	del := event(types.EventDelete, 3088)
+	del.NewData = row("alice", "19.99")
+
+	composite := &types.ChangeEvent{
+		TaskID:      "order_items",
+		Event:       types.EventUpdate,
+		Database:    "shop",
+		Table:       "order_items",
+		PrimaryID:   map[string]interface{}{"order_id": int64(1001), "line_no": int32(2)},
+		PrimaryKeys: []string{"order_id", "line_no"},
+		Schema:      testTableSchema(t, "order_id BIGINT", "line_no INT", "sku CHAR(12)", "quantity SMALLINT"),
+		OldData:     map[string]interface{}{"order_id": int64(1001), "line_no": int32(2), "sku": "SKU-0001", "quantity": int16(1)},
+		NewData:     map[string]interface{}{"order_id": int64(1001), "line_no": int32(2), "sku": "SKU-0001", "quantity": int16(3)},
+		Timestamp:   detected,
+		EventTime:   eventTime,
+		LogName:     "mysql-bin.000003",
+		LogPos:      4120,
+		RowIndex:    1,
+	}
+
+	return map[string]*types.ChangeEvent{
+		"insert":        insert,
+		"update":        update,
+		"delete":        del,
+		"composite_key": composite,
+	}
+}
+
+func TestEnvelopeGolden(t *testing.T) {
+	formatters := map[string]Formatter{
+		"debezium": &debeziumFormatter{serverName: "mysql-primary"},
+		"maxwell":  &maxwellFormatter{},
+		"canal":    &canalFormatter{},
+	}
+	for format, formatter := range formatters {
+		for name, event := range envelopeEvents(t) {
+			t.Run(format+"/"+name, func(t *testing.T) {
+				encoded, err := formatter.Format(event)
+				if err != nil {
+					t.Fatalf("Format() error = %v", err)
+				}
+				if encoded.ContentType != "application/json" {
+					t.Errorf("ContentType = %q, want application/json", encoded.ContentType)
+				}
+				// 版本号随发布变化，不写入黄金文件
+				body := bytes.ReplaceAll(encoded.Body, []byte(utils.GetUserAgent()), []byte("pikachu/VERSION"))
+				var got bytes.Buffer
+				if err := json.Indent(&got, body, "", "  "); err != nil {
+					t.Fatalf("output is not valid JSON: %v\n%s", err, body)
+				}
+				got.WriteByte('\n')
+
+				path := filepath.Join("testdata", format+"_"+name+".golden")
+				if *updateGolden {
+					if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+						t.Fatalf("failed to update golden file: %v", err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("failed to read golden file (run go test -update to create it): %v", err)
+				}
+				if !bytes.Equal(got.Bytes(), want) {
+					t.Errorf("%s mismatch (run go test -update after verifying the change)\ngot:\n%s\nwant:\n%s", path, got.Bytes(), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package dispatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pikachuv1 "pikachu/api/pikachu/v1"
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// grpcResult 单条事件的确认结果
+type grpcResult struct {
+	ack *pikachuv1.EventAck
+	err error
+}
+
+// GRPCSink 通过双向流推送事件的gRPC输出端
+// 每条事件等待服务端的确认，未确认事件的数量受 max_in_flight 限制
+type GRPCSink struct {
+	conn       *grpc.ClientConn
+	client     pikachuv1.ChangeEventServiceClient
+	ackTimeout time.Duration
+	inflight   chan struct{} // 流量控制信号量
+
+	mu           sync.Mutex // 保护 stream 和 pending
+	stream       grpc.BidiStreamingClient[pikachuv1.ChangeEvent, pikachuv1.EventAck]
+	streamCancel context.CancelFunc
+	pending      map[string]chan grpcResult
+	sendMu       sync.Mutex // gRPC 流的 Send 不能并发调用
+
+	metrics *metrics.Metrics
+}
+
+// NewGRPCSink 创建gRPC输出端，连接在首次投递时建立
+func NewGRPCSink(cfg *types.GRPCSinkConfig, m *metrics.Metrics) (*GRPCSink, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("grpc sink config is missing")
+	}
+
+	maxInFlight := cfg.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 100
+	}
+	ackTimeout := cfg.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = 10 * time.Second
+	}
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.NewClient(cfg.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+
+	return &GRPCSink{
+		conn:       conn,
+		client:     pikachuv1.NewChangeEventServiceClient(conn),
+		ackTimeout: ackTimeout,
+		inflight:   make(chan struct{}, maxInFlight),
+		pending:    make(map[string]chan grpcResult),
+		metrics:    m,
+	}, nil
+}
+
+// Deliver 发送单条事件并等待确认
+func (s *GRPCSink) Deliver(ctx context.Context, msg *Message) error {
+	// 流量控制：未确认事件达到上限时等待
+	select {
+	case s.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.inflight }()
+
+	event, err := toProtoEvent(msg)
+	if err != nil {
+		s.metrics.RecordError("grpc_encode", "dispatcher")
+		return err
+	}
+
+	result, err := s.send(ctx, event)
+	if err != nil {
+		s.metrics.RecordError("grpc_send", "dispatcher")
+		return err
+	}
+
+	switch result.GetStatus() {
+	case pikachuv1.AckStatus_ACK_STATUS_OK:
+		log.Info("gRPC event acknowledged",
+			log.String("task_id", msg.Event.TaskID),
+			log.String("event_id", event.Id))
+		return nil
+	case pikachuv1.AckStatus_ACK_STATUS_REJECT:
+		s.metrics.RecordError("grpc_rejected", "dispatcher")
+		return permanentError(fmt.Errorf("grpc receiver rejected event: %s", result.GetMessage()))
+	default:
+		s.metrics.RecordError("grpc_nack", "dispatcher")
+		return fmt.Errorf("grpc receiver requested retry: %s", result.GetMessage())
+	}
+}
+
+// DeliverBatch 并发发送整批事件，并发度同样受 max_in_flight 限制
+func (s *GRPCSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	errs := make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		go func(i int, msg *Message) {
+			defer wg.Done()
+			errs[i] = s.Deliver(ctx, msg)
+		}(i, msg)
+	}
+	wg.Wait()
+	return errs
+}
+
+// send 在当前流上发送事件并等待对应ID的确认
+func (s *GRPCSink) send(ctx context.Context, event *pikachuv1.ChangeEvent) (*pikachuv1.EventAck, error) {
+	stream, err := s.getStream()
+	if err != nil {
+		return nil, err
+	}
+
+	resultCh := make(chan grpcResult, 1)
+	s.mu.Lock()
+	s.pending[event.Id] = resultCh
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, event.Id)
+		s.mu.Unlock()
+	}()
+
+	s.sendMu.Lock()
+	err = stream.Send(event)
+	s.sendMu.Unlock()
+	if err != nil {
+		s.resetStream(stream, err)
+		return nil, fmt.Errorf("grpc stream send failed: %w", err)
+	}
+
+	timer := time.NewTimer(s.ackTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-resultCh:
+		return result.ack, result.err
+	case <-timer.C:
+		return nil, fmt.Errorf("grpc ack timeout after %v", s.ackTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getStream 返回当前流，不存在时新建并启动接收协程
+func (s *GRPCSink) getStream() (grpc.BidiStreamingClient[pikachuv1.ChangeEvent, pikachuv1.EventAck], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stream != nil {
+		return s.stream, nil
+	}
+
+	// 流的生命周期独立于单次投递，由 Close 或出错时取消
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := s.client.StreamEvents(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open grpc stream: %w", err)
+	}
+
+	s.stream = stream
+	s.streamCancel = cancel
+	go s.recvLoop(stream)
+
+	log.Info("gRPC event stream opened", log.String("target", s.conn.Target()))
+	return stream, nil
+}
+
+// recvLoop 接收确认并分发给等待中的投递，流出错时让所有等待中的投递失败
+func (s *GRPCSink) recvLoop(stream grpc.BidiStreamingClient[pikachuv1.ChangeEvent, pikachuv1.EventAck]) {
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			s.resetStream(stream, err)
+			return
+		}
+
+		s.mu.Lock()
+		resultCh, ok := s.pending[ack.GetId()]
+		s.mu.Unlock()
+		if !ok {
+			// 已超时的事件的迟到确认，忽略
+			log.Debug("Ignoring ack for unknown event", log.String("event_id", ack.GetId()))
+			continue
+		}
+		// 同一ID的重复确认在缓冲已满时丢弃，不能阻塞接收协程
+		select {
+		case resultCh <- grpcResult{ack: ack}:
+		default:
+			log.Debug("Ignoring duplicate ack", log.String("event_id", ack.GetId()))
+		}
+	}
+}
+
+// resetStream 丢弃出错的流，下次投递时重新建立
+func (s *GRPCSink) resetStream(stream grpc.BidiStreamingClient[pikachuv1.ChangeEvent, pikachuv1.EventAck], cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stream != stream {
+		return
+	}
+
+	log.Warn("gRPC event stream closed", log.String("target", s.conn.Target()), log.Any("error", cause))
+	s.streamCancel()
+	s.stream = nil
+	s.streamCancel = nil
+
+	for _, resultCh := range s.pending {
+		select {
+		case resultCh <- grpcResult{err: fmt.Errorf("grpc stream closed: %w", cause)}:
+		default:
+		}
+	}
+}
+
+// Close 关闭流和连接
+func (s *GRPCSink) Close() error {
+	s.mu.Lock()
+	if s.stream != nil {
+		s.sendMu.Lock()
+		s.stream.CloseSend()
+		s.sendMu.Unlock()
+		s.streamCancel()
+		s.stream = nil
+	}
+	s.mu.Unlock()
+
+	return s.conn.Close()
+}
+
+// toProtoEvent 将消息转换为protobuf事件
+func toProtoEvent(msg *Message) (*pikachuv1.ChangeEvent, error) {
+	event := msg.Event
+
+	primaryID, err := toProtoValue(event.PrimaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert primary id: %w", err)
+	}
+
+	pbEvent := &pikachuv1.ChangeEvent{
+		Id:        msg.Event.ID(),
+		TaskId:    event.TaskID,
+		Database:  event.Database,
+		Table:     event.Table,
+		Event:     toProtoEventType(event.Event),
+		PrimaryId: primaryID,
+		Timestamp: timestamppb.New(event.Timestamp),
+		Headers:   msg.Headers,
+	}
+
+	if event.OldData != nil {
+		if pbEvent.OldData, err = toProtoStruct(event.OldData); err != nil {
+			return nil, fmt.Errorf("failed to convert old data: %w", err)
+		}
+	}
+	if event.NewData != nil {
+		if pbEvent.NewData, err = toProtoStruct(event.NewData); err != nil {
+			return nil, fmt.Errorf("failed to convert new data: %w", err)
+		}
+	}
+
+	return pbEvent, nil
+}
+
+// toProtoEventType 转换事件类型
+func toProtoEventType(eventType types.EventType) pikachuv1.EventType {
+	switch eventType {
+	case types.EventInsert:
+		return pikachuv1.EventType_EVENT_TYPE_INSERT
+	case types.EventUpdate:
+		return pikachuv1.EventType_EVENT_TYPE_UPDATE
+	case types.EventDelete:
+		return pikachuv1.EventType_EVENT_TYPE_DELETE
+	default:
+		return pikachuv1.EventType_EVENT_TYPE_UNSPECIFIED
+	}
+}
+
+// toProtoStruct 将行数据转换为protobuf结构体
+func toProtoStruct(data map[string]interface{}) (*structpb.Struct, error) {
+	fields := make(map[string]*structpb.Value, len(data))
+	for column, value := range data {
+		pbValue, err := toProtoValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column, err)
+		}
+		fields[column] = pbValue
+	}
+	return &structpb.Struct{Fields: fields}, nil
+}
+
+// toProtoValue 将列值转换为protobuf值
+// 时间转换为RFC3339字符串；binlog 中的文本列常以 []byte 出现，按文本处理；
+// google.protobuf.Value 的数字为 double，超过 2^53 的整数会丢失精度，
+// 因此 64 位整数（BIGINT、BIGINT UNSIGNED）按 proto3 JSON 的惯例编码为十进制字符串
+func toProtoValue(value interface{}) (*structpb.Value, error) {
+	switch v := value.(type) {
+	case int64:
+		return structpb.NewStringValue(strconv.FormatInt(v, 10)), nil
+	case int:
+		return structpb.NewStringValue(strconv.FormatInt(int64(v), 10)), nil
+	case uint64:
+		return structpb.NewStringValue(strconv.FormatUint(v, 10)), nil
+	case uint:
+		return structpb.NewStringValue(strconv.FormatUint(uint64(v), 10)), nil
+	case time.Time:
+		return structpb.NewStringValue(v.Format(time.RFC3339Nano)), nil
+	case []byte:
+		return structpb.NewStringValue(string(v)), nil
+	case map[string]interface{}:
+		s, err := toProtoStruct(v)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewStructValue(s), nil
+	case int8, int16, uint8, uint16:
+		return structpb.NewNumberValue(toFloat64(v)), nil
+	default:
+		pbValue, err := structpb.NewValue(v)
+		if err != nil {
+			// 无法识别的类型退化为字符串
+			return structpb.NewStringValue(fmt.Sprint(v)), nil
+		}
+		return pbValue, nil
+	}
+}
+
+// toFloat64 转换 structpb 不直接支持的小整数类型
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	default:
+		return 0
+	}
+}
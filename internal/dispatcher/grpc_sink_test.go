@@ -0,0 +1,138 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pikachuv1 "pikachu/api/pikachu/v1"
+	"pikachu/api/pikachu/v1/eventserver"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// startEventServer 启动参考服务端，返回连接到它的 gRPC 输出端
+func startEventServer(t *testing.T, handler eventserver.Handler) *GRPCSink {
+	t.Helper()
+	return startGRPCServer(t, eventserver.New(handler))
+}
+
+// startGRPCServer 启动 ChangeEventService 服务端，返回连接到它的 gRPC 输出端
+func startGRPCServer(t *testing.T, server pikachuv1.ChangeEventServiceServer) *GRPCSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	gs := grpc.NewServer()
+	pikachuv1.RegisterChangeEventServiceServer(gs, server)
+	go gs.Serve(listener)
+	t.Cleanup(gs.Stop)
+
+	sink, err := NewGRPCSink(&types.GRPCSinkConfig{Target: listener.Addr().String()}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create grpc sink: %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+func TestGRPCSinkPreservesBigIntegers(t *testing.T) {
+	received := make(chan *pikachuv1.ChangeEvent, 1)
+	sink := startEventServer(t, func(ctx context.Context, event *pikachuv1.ChangeEvent) error {
+		received <- event
+		return nil
+	})
+
+	// 2^53+1 无法用 double 精确表示
+	event := testEvent("users", 1)
+	event.PrimaryID = uint64(math.MaxUint64)
+	event.NewData = map[string]interface{}{
+		"id":      uint64(math.MaxUint64),
+		"balance": int64(1<<53 + 1),
+		"debt":    int64(math.MinInt64),
+		"age":     int32(30),
+		"name":    "alice",
+	}
+	if err := sink.Deliver(context.Background(), &Message{Event: event}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	got := <-received
+	if id := got.GetPrimaryId().GetStringValue(); id != "18446744073709551615" {
+		t.Errorf("primary_id = %q, want %q", id, "18446744073709551615")
+	}
+	row := got.GetNewData().GetFields()
+	for column, want := range map[string]string{
+		"id":      "18446744073709551615",
+		"balance": "9007199254740993",
+		"debt":    "-9223372036854775808",
+		"name":    "alice",
+	} {
+		if value := row[column].GetStringValue(); value != want {
+			t.Errorf("%s = %q, want %q", column, value, want)
+		}
+	}
+	if age := row["age"].GetNumberValue(); age != 30 {
+		t.Errorf("age = %v, want 30", age)
+	}
+}
+
+func TestGRPCSinkAckStatus(t *testing.T) {
+	// 主键为 1 的事件请求重试，其它事件拒绝
+	sink := startEventServer(t, func(ctx context.Context, event *pikachuv1.ChangeEvent) error {
+		if event.GetPrimaryId().GetStringValue() == "1" {
+			return eventserver.Retry(errors.New("busy"))
+		}
+		return errors.New("bad payload")
+	})
+
+	err := sink.Deliver(context.Background(), &Message{Event: testEvent("users", 1)})
+	if err == nil || isPermanent(err) {
+		t.Fatalf("retry ack: error = %v, want a retryable error", err)
+	}
+
+	err = sink.Deliver(context.Background(), &Message{Event: testEvent("users", 2)})
+	if err == nil || !isPermanent(err) {
+		t.Fatalf("reject ack: error = %v, want a permanent error", err)
+	}
+}
+
+// duplicateAckServer 对每条事件重复回复多次确认
+type duplicateAckServer struct {
+	pikachuv1.UnimplementedChangeEventServiceServer
+}
+
+func (duplicateAckServer) StreamEvents(stream grpc.BidiStreamingServer[pikachuv1.ChangeEvent, pikachuv1.EventAck]) error {
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		for i := 0; i < 5; i++ {
+			ack := &pikachuv1.EventAck{Id: event.GetId(), Status: pikachuv1.AckStatus_ACK_STATUS_OK}
+			if err := stream.Send(ack); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestGRPCSinkIgnoresDuplicateAcks(t *testing.T) {
+	sink := startGRPCServer(t, duplicateAckServer{})
+
+	// 重复的确认不能阻塞接收协程，同一条流上之后的事件仍能收到确认
+	for i := int64(1); i <= 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := sink.Deliver(ctx, &Message{Event: testEvent("users", i)})
+		cancel()
+		if err != nil {
+			t.Fatalf("event %d: Deliver() error = %v", i, err)
+		}
+	}
+}
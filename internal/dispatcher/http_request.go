@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"pikachu/internal/types"
+)
+
+// defaultCompressionMinSize 请求体达到该字节数才压缩，过小的请求体压缩后反而可能变大
+const defaultCompressionMinSize = 1024
+
+// gzipWriterPool gzip压缩器对象池
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// zstdEncoder zstd压缩器，EncodeAll 可以并发调用
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil)
+})
+
+// expandURLTemplate 展开回调URL中的占位符，如 /users/{id}
+// 占位符优先取当前行（INSERT/UPDATE 为新数据，DELETE 为被删除的数据）中的同名列，
+// 没有同名列时支持 {database} {table} {event} {task_id} {primary_id}；
+// 值在路径中按路径段转义，在查询参数中按查询参数转义
+func expandURLTemplate(tpl string, event *types.ChangeEvent) (string, error) {
+	if !strings.Contains(tpl, "{") {
+		return tpl, nil
+	}
+
+	queryStart := strings.Index(tpl, "?")
+	var b strings.Builder
+	b.Grow(len(tpl) + 16)
+	for i := 0; i < len(tpl); {
+		if tpl[i] != '{' {
+			b.WriteByte(tpl[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(tpl[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed placeholder in callback URL: %s", tpl)
+		}
+		value, err := urlTemplateValue(tpl[i+1:i+end], event)
+		if err != nil {
+			return "", err
+		}
+		if queryStart >= 0 && i > queryStart {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		i += end + 1
+	}
+	return b.String(), nil
+}
+
+// urlTemplateValue 返回回调URL占位符对应的值，列不存在或为NULL时返回错误
+func urlTemplateValue(name string, event *types.ChangeEvent) (string, error) {
+	if value, ok := event.NewData[name]; ok {
+		if value == nil {
+			return "", fmt.Errorf("callback URL placeholder {%s}: column is NULL", name)
+		}
+		return formatPrimaryKey(value), nil
+	}
+
+	switch name {
+	case "database":
+		return event.Database, nil
+	case "table":
+		return event.Table, nil
+	case "event":
+		return string(event.Event), nil
+	case "task_id":
+		return event.TaskID, nil
+	case "primary_id":
+		if event.PrimaryID != nil {
+			return formatPrimaryKey(event.PrimaryID), nil
+		}
+	}
+	return "", fmt.Errorf("callback URL placeholder {%s}: column not found", name)
+}
+
+// compressBody 按配置压缩请求体，返回压缩后的数据和 Content-Encoding
+// 未配置压缩或请求体小于最小大小时原样返回，Content-Encoding 为空
+func compressBody(cfg *types.CompressionConfig, body []byte) ([]byte, string, error) {
+	if cfg == nil {
+		return body, "", nil
+	}
+	minSize := cfg.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if len(body) < minSize {
+		return body, "", nil
+	}
+
+	switch cfg.Algorithm {
+	case types.CompressionGzip:
+		var buf bytes.Buffer
+		w := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, "", fmt.Errorf("failed to gzip request body: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", fmt.Errorf("failed to gzip request body: %w", err)
+		}
+		return buf.Bytes(), "gzip", nil
+	case types.CompressionZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return encoder.EncodeAll(body, make([]byte, 0, len(body)/2)), "zstd", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported compression algorithm: %s", cfg.Algorithm)
+	}
+}
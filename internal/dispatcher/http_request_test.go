@@ -0,0 +1,272 @@
+package dispatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestExpandURLTemplate(t *testing.T) {
+	event := testEvent("users", 7)
+	event.NewData = map[string]interface{}{"id": int64(7), "name": "a b/c", "deleted_at": nil, "tag": []byte("x&y")}
+
+	for _, tc := range []struct {
+		tpl     string
+		want    string
+		wantErr bool
+	}{
+		{tpl: "http://example.com/hook", want: "http://example.com/hook"},
+		// 路径中按路径段转义，"/" 不能拆出新的路径段；查询参数中按查询参数转义
+		{tpl: "http://example.com/users/{name}?q={name}", want: "http://example.com/users/a%20b%2Fc?q=a+b%2Fc"},
+		{tpl: "http://example.com/tags?tag={tag}&id={id}", want: "http://example.com/tags?tag=x%26y&id=7"},
+		// 没有同名列时使用事件元数据
+		{tpl: "http://example.com/{database}/{table}/{primary_id}/{event}/{task_id}", want: "http://example.com/app/users/7/insert/users"},
+		{tpl: "http://example.com/users/{id", wantErr: true},
+		{tpl: "http://example.com/users/{deleted_at}", wantErr: true},
+		{tpl: "http://example.com/users/{missing}", wantErr: true},
+	} {
+		t.Run(tc.tpl, func(t *testing.T) {
+			got, err := expandURLTemplate(tc.tpl, event)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expandURLTemplate() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandURLTemplate() error = %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expandURLTemplate() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestURLTemplatePrefersColumns(t *testing.T) {
+	event := testEvent("users", 7)
+	event.NewData = map[string]interface{}{"table": "orders"}
+
+	if got, err := urlTemplateValue("table", event); err != nil || got != "orders" {
+		t.Fatalf("urlTemplateValue(table) = %q, %v, want the column value", got, err)
+	}
+
+	event.PrimaryID = nil
+	if _, err := urlTemplateValue("primary_id", event); err == nil {
+		t.Fatal("urlTemplateValue(primary_id) without a primary key succeeded, want an error")
+	}
+}
+
+// decompress 按 Content-Encoding 解压请求体
+func decompress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("invalid gzip data: %v", err)
+		}
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("invalid zstd data: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return data
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decompress %s data: %v", encoding, err)
+	}
+	return out
+}
+
+func TestCompressBody(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"id":1,"name":"alice"}`), 100)
+	small := []byte(`{"id":1}`)
+
+	for _, tc := range []struct {
+		name     string
+		cfg      *types.CompressionConfig
+		body     []byte
+		encoding string
+	}{
+		{name: "disabled", cfg: nil, body: large},
+		{name: "gzip", cfg: &types.CompressionConfig{Algorithm: types.CompressionGzip}, body: large, encoding: "gzip"},
+		{name: "zstd", cfg: &types.CompressionConfig{Algorithm: types.CompressionZstd}, body: large, encoding: "zstd"},
+		{name: "below default min size", cfg: &types.CompressionConfig{Algorithm: types.CompressionGzip}, body: small},
+		{name: "below custom min size", cfg: &types.CompressionConfig{Algorithm: types.CompressionZstd, MinSize: len(large) + 1}, body: large},
+		{name: "custom min size reached", cfg: &types.CompressionConfig{Algorithm: types.CompressionGzip, MinSize: 1}, body: small, encoding: "gzip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, encoding, err := compressBody(tc.cfg, tc.body)
+			if err != nil {
+				t.Fatalf("compressBody() error = %v", err)
+			}
+			if encoding != tc.encoding {
+				t.Fatalf("encoding = %q, want %q", encoding, tc.encoding)
+			}
+			if encoding == "" && !bytes.Equal(out, tc.body) {
+				t.Fatal("uncompressed body was modified")
+			}
+			if got := decompress(t, encoding, out); !bytes.Equal(got, tc.body) {
+				t.Fatalf("round trip = %q, want %q", got, tc.body)
+			}
+		})
+	}
+
+	if _, _, err := compressBody(&types.CompressionConfig{Algorithm: "br", MinSize: 1}, large); err == nil {
+		t.Fatal("compressBody() with an unknown algorithm succeeded, want an error")
+	}
+}
+
+func TestCompressBodyReusesGzipWriters(t *testing.T) {
+	cfg := &types.CompressionConfig{Algorithm: types.CompressionGzip, MinSize: 1}
+
+	// 对象池中的压缩器被并发复用，每个结果都只包含自己的请求体
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				body := bytes.Repeat([]byte(fmt.Sprintf("worker %d message %d;", i, j)), i*j+1)
+				out, _, err := compressBody(cfg, body)
+				if err != nil {
+					t.Errorf("compressBody() error = %v", err)
+					return
+				}
+				gr, err := gzip.NewReader(bytes.NewReader(out))
+				if err != nil {
+					t.Errorf("invalid gzip data: %v", err)
+					return
+				}
+				if got, err := io.ReadAll(gr); err != nil || !bytes.Equal(got, body) {
+					t.Errorf("round trip of worker %d message %d failed: %v", i, j, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHTTPSinkSendsCompressedBody(t *testing.T) {
+	type request struct {
+		encoding string
+		body     []byte
+	}
+	requests := make(chan request, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header.Get("Content-Encoding"), body}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: server.URL,
+	})
+	sink, err := NewHTTPSink(&cfg.Dispatcher, nil, nil, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	compression := &types.CompressionConfig{Algorithm: types.CompressionZstd, MinSize: 64}
+	for _, body := range [][]byte{[]byte(`{"id":1}`), bytes.Repeat([]byte("x"), 64)} {
+		msg := &Message{Event: testEvent("users", 1), URL: server.URL, Compression: compression, Body: body, ContentType: "application/json"}
+		if err := sink.Deliver(context.Background(), msg); err != nil {
+			t.Fatalf("Deliver() error = %v", err)
+		}
+		got := <-requests
+		wantEncoding := ""
+		if len(body) >= compression.MinSize {
+			wantEncoding = "zstd"
+		}
+		if got.encoding != wantEncoding {
+			t.Fatalf("Content-Encoding of a %d byte body = %q, want %q", len(body), got.encoding, wantEncoding)
+		}
+		if decoded := decompress(t, got.encoding, got.body); !bytes.Equal(decoded, body) {
+			t.Fatalf("server received %q, want %q", decoded, body)
+		}
+	}
+}
+
+func TestHTTPMethodReachesServer(t *testing.T) {
+	var mu sync.Mutex
+	methods := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods[strings.TrimPrefix(r.URL.Path, "/")] = r.Method
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := newTestConfig(t,
+		types.Task{
+			TaskID:      "default",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: server.URL + "/default",
+		},
+		types.Task{
+			TaskID:      "put",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: server.URL + "/put",
+			Method:      "put",
+		},
+		types.Task{
+			TaskID:    "destinations",
+			TableName: "users",
+			Events:    []types.EventType{types.EventInsert},
+			Method:    "PUT",
+			Destinations: []types.DestinationConfig{
+				{Name: "inherited", CallbackURL: server.URL + "/inherited"},
+				{Name: "patch", CallbackURL: server.URL + "/patch", Method: "PATCH"},
+			},
+		},
+	)
+	_, events := startTestDispatcher(t, cfg)
+	for i, taskID := range []string{"default", "put", "destinations"} {
+		events <- testEvent(taskID, int64(i+1))
+	}
+
+	want := map[string]string{
+		"default":   http.MethodPost,
+		"put":       http.MethodPut,
+		"inherited": http.MethodPut,
+		"patch":     http.MethodPatch,
+	}
+	waitFor(t, "all requests", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(methods) == len(want)
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for path, method := range want {
+		if methods[path] != method {
+			t.Fatalf("%s received %s, want %s", path, methods[path], method)
+		}
+	}
+}
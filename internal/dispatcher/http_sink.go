@@ -0,0 +1,268 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+	"pikachu/internal/utils"
+)
+
+// idempotencyKeyHeader 携带事件ID的请求头，同一事件的重试和重启后的重新投递保持相同的值
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	responseSnippetSize      = 1024    // 死信中记录的响应体最大字节数
+	maxValidatedResponseSize = 1 << 20 // 响应校验时最多读取的响应体字节数
+)
+
+// HTTPSink 以HTTP请求投递事件的输出端，默认使用POST方法
+type HTTPSink struct {
+	httpClient atomic.Pointer[http.Client] // 证书重新加载时整体替换
+	config     *types.DispatcherConfig
+	proxy      func(*http.Request) (*url.URL, error) // 代理选择函数，为nil时直连
+	dialer     *net.Dialer
+	timeout    time.Duration // 默认请求超时，可被任务级投递策略覆盖
+	classifier *statusClassifier
+	metrics    *metrics.Metrics
+
+	// 证书重新加载
+	tlsConfig  *types.TLSConfig
+	tlsVersion string        // 当前已加载的证书文件版本，见 tlsFilesVersion
+	stop       chan struct{} // 关闭时停止检查证书文件，未配置证书文件时为nil
+}
+
+// NewHTTPSink 创建HTTP输出端，tlsCfg 为 nil 时使用系统根证书和默认TLS设置，proxyCfg 为 nil 时直连
+// 配置了证书文件时定期检查文件是否修改，修改后重新加载
+func NewHTTPSink(cfg *types.DispatcherConfig, tlsCfg *types.TLSConfig, proxyCfg *types.ProxyConfig, m *metrics.Metrics) (*HTTPSink, error) {
+	s := &HTTPSink{
+		config:     cfg,
+		proxy:      proxyFunc(proxyCfg),
+		dialer:     newDialer(),
+		timeout:    cfg.Timeout,
+		classifier: newStatusClassifier(cfg.RetryableStatusCodes),
+		metrics:    m,
+		tlsConfig:  tlsCfg,
+	}
+
+	var tlsConfig *tls.Config
+	if tlsCfg != nil {
+		version, err := tlsFilesVersion(tlsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: %w", err)
+		}
+		tlsConfig, err = loadTLSConfig(tlsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: %w", err)
+		}
+		s.tlsVersion = version
+	}
+	s.httpClient.Store(s.newClient(tlsConfig))
+
+	if tlsCfg != nil && len(tlsFiles(tlsCfg)) > 0 {
+		interval := tlsCfg.ReloadInterval
+		if interval <= 0 {
+			interval = defaultTLSReloadInterval
+		}
+		s.stop = make(chan struct{})
+		go s.watchCertificates(interval)
+	}
+
+	return s, nil
+}
+
+// newClient 创建HTTP客户端，超时按请求通过 context 设置，以便任务覆盖
+func (s *HTTPSink) newClient(tlsConfig *tls.Config) *http.Client {
+	// 创建优化的HTTP传输配置
+	transport := &http.Transport{
+		MaxIdleConns:        s.config.MaxIdleConns,
+		MaxIdleConnsPerHost: s.config.MaxIdleConns / 2, // 分配一半给单个主机
+		IdleConnTimeout:     s.config.IdleConnTimeout,
+		DisableCompression:  false, // 启用压缩
+		MaxConnsPerHost:     s.config.MaxConnections,
+		TLSClientConfig:     tlsConfig,
+		Proxy:               s.proxy,
+		DialContext:         dialContext(s.dialer),
+		// 移除 ForceAttemptHTTP2: true，保持协议兼容性
+		// 让Go自动协商协议版本，确保与各种回调服务端兼容
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// watchCertificates 定期检查证书文件，直到输出端关闭
+func (s *HTTPSink) watchCertificates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.reloadCertificates()
+		}
+	}
+}
+
+// reloadCertificates 证书文件修改后重新加载并替换HTTP客户端
+// 加载失败时（如证书和私钥只更新了一个）继续使用原证书，下次检查时重试
+func (s *HTTPSink) reloadCertificates() {
+	version, err := tlsFilesVersion(s.tlsConfig)
+	if err != nil {
+		log.Warn("Failed to check TLS certificate files", zap.Error(err))
+		return
+	}
+	if version == s.tlsVersion {
+		return
+	}
+
+	tlsConfig, err := loadTLSConfig(s.tlsConfig)
+	if err != nil {
+		log.Error("Failed to reload TLS certificates, keeping previous ones", zap.Error(err))
+		return
+	}
+	s.tlsVersion = version
+
+	// 旧客户端上进行中的请求正常完成，完成后连接随之关闭
+	old := s.httpClient.Swap(s.newClient(tlsConfig))
+	old.CloseIdleConnections()
+	log.Info("TLS certificates reloaded", log.Any("files", tlsFiles(s.tlsConfig)))
+}
+
+// Deliver 发送单条webhook请求
+func (s *HTTPSink) Deliver(ctx context.Context, msg *Message) error {
+	startTime := time.Now()
+	taskID := msg.Event.TaskID
+
+	timeout := s.timeout
+	if msg.Timeout > 0 {
+		timeout = msg.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	method := msg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	body, contentEncoding, err := compressBody(msg.Compression, msg.Body)
+	if err != nil {
+		s.metrics.RecordError("request_creation", "dispatcher")
+		return err
+	}
+
+	// 创建HTTP请求，unix域套接字地址转换为虚拟主机上的请求
+	target, host := requestTarget(msg.URL)
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		s.metrics.RecordError("request_creation", "dispatcher")
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	if host != "" {
+		req.Host = host
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+
+	req.Header.Set("Content-Type", msg.ContentType)
+	req.Header.Set("User-Agent", utils.GetUserAgent())
+	req.Header.Set(idempotencyKeyHeader, msg.Event.ID())
+	for key, value := range msg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// 发送请求
+	resp, err := s.httpClient.Load().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	duration := time.Since(startTime).Seconds()
+	statusCode := fmt.Sprintf("%d", resp.StatusCode)
+
+	// 记录请求日志
+	log.Info("Webhook request sent",
+		log.String("task_id", taskID),
+		log.String("url", msg.URL),
+		log.Int("status_code", resp.StatusCode),
+		log.String("payload", string(msg.Body)))
+
+	// 记录请求指标
+	s.metrics.RecordWebhookRequest(taskID, statusCode)
+	s.metrics.RecordWebhookRequestDuration(taskID, statusCode, duration)
+
+	// 检查响应状态
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		s.metrics.RecordError("http_error", "dispatcher")
+		deliveryErr := s.classifier.responseError(resp)
+		deliveryErr.Response = responseSnippet(readResponseBody(resp.Body, responseSnippetSize))
+		return deliveryErr
+	}
+
+	// 校验响应体，接收方可能返回2xx但在响应体中表示处理失败
+	if msg.Validator != nil {
+		body := readResponseBody(resp.Body, maxValidatedResponseSize)
+		if retryable, err := msg.Validator.Check(body); err != nil {
+			s.metrics.RecordError("response_rejected", "dispatcher")
+			return &DeliveryError{
+				Err:        fmt.Errorf("webhook response rejected: %w", err),
+				StatusCode: resp.StatusCode,
+				Permanent:  !retryable,
+				RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+				Response:   responseSnippet(body),
+			}
+		}
+	}
+
+	log.Info("Webhook callback successful", log.String("task_id", taskID))
+	return nil
+}
+
+// readResponseBody 读取最多 limit 字节的响应体，读取失败时返回已读到的部分
+func readResponseBody(body io.Reader, limit int64) []byte {
+	data, _ := io.ReadAll(io.LimitReader(body, limit))
+	return data
+}
+
+// responseSnippet 截取响应体的开头部分记录到死信中
+func responseSnippet(body []byte) string {
+	if len(body) > responseSnippetSize {
+		body = body[:responseSnippetSize]
+	}
+	return strings.ToValidUTF8(string(body), "")
+}
+
+// DeliverBatch 逐条发送webhook请求，接收方的协议是一条事件一个请求
+func (s *HTTPSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	return deliverEach(ctx, s, msgs)
+}
+
+// Close 停止检查证书文件并关闭空闲连接
+func (s *HTTPSink) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.httpClient.Load().CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,206 @@
+package dispatcher
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestRejectedResponseWrittenToDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":false,"error":"customer 7 is archived"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: server.URL,
+		ResponseValidation: &types.ResponseValidationConfig{
+			JSONPath:  "ok",
+			OnFailure: types.ResponseOnFailurePermanent,
+		},
+	})
+	cfg.Dispatcher.DeadLetter.Path = filepath.Join(t.TempDir(), "dead_letter.ndjson")
+	_, events := startTestDispatcher(t, cfg)
+	events <- testEvent("users", 7)
+
+	var entries []deadLetterEntry
+	waitFor(t, "dead letter", func() bool {
+		entries = readDeadLetters(t, cfg.Dispatcher.DeadLetter.Path)
+		return len(entries) > 0
+	})
+	entry := entries[0]
+	if entry.Reason != deadLetterPermanent || entry.StatusCode != http.StatusOK || entry.RetryCount != 0 {
+		t.Fatalf("reason = %s, status = %d, retries = %d, want a permanent failure with status 200 and no retries",
+			entry.Reason, entry.StatusCode, entry.RetryCount)
+	}
+	if entry.Response != `{"ok":false,"error":"customer 7 is archived"}` {
+		t.Fatalf("response = %q, want the rejected response body", entry.Response)
+	}
+	if !strings.Contains(entry.Error, "response field ok is false") {
+		t.Fatalf("error = %q, want the validation failure", entry.Error)
+	}
+}
+
+// writeCertificate 生成自签名证书，写入 dir 下的 client.crt，writeKey 为true时同时写入私钥 client.key
+// 写入后将文件修改时间设置为 modTime，保证重新加载时能检测到修改
+func writeCertificate(t *testing.T, dir, commonName string, writeKey bool, modTime time.Time) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	files := map[string][]byte{certFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+	if writeKey {
+		files[keyFile] = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPSinkReloadsCertificates(t *testing.T) {
+	// 要求客户端证书的接收方，记录每个请求的客户端证书
+	clients := make(chan string, 4)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients <- r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	certFile, keyFile := writeCertificate(t, dir, "first", true, start)
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: server.URL,
+	})
+	// 检查间隔足够长，测试中直接调用 reloadCertificates
+	tlsCfg := &types.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour}
+	sink, err := NewHTTPSink(&cfg.Dispatcher, tlsCfg, nil, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	deliver := func() string {
+		t.Helper()
+		msg := &Message{Event: testEvent("users", 1), URL: server.URL, Body: []byte(`{}`), ContentType: "application/json"}
+		if err := sink.Deliver(context.Background(), msg); err != nil {
+			t.Fatalf("Deliver() error = %v", err)
+		}
+		return <-clients
+	}
+	if got := deliver(); got != "first" {
+		t.Fatalf("client certificate = %s, want first", got)
+	}
+	client := sink.httpClient.Load()
+
+	// 文件未修改时不替换客户端
+	sink.reloadCertificates()
+	if sink.httpClient.Load() != client {
+		t.Fatal("client replaced although the certificate files did not change")
+	}
+
+	// 只更新了证书，与原私钥不匹配，继续使用原证书
+	writeCertificate(t, dir, "second", false, start.Add(time.Second))
+	sink.reloadCertificates()
+	if sink.httpClient.Load() != client {
+		t.Fatal("client replaced with a certificate that does not match the key")
+	}
+	if got := deliver(); got != "first" {
+		t.Fatalf("client certificate = %s, want first until the key is updated", got)
+	}
+
+	// 证书和私钥都更新后替换客户端，新连接使用新证书
+	writeCertificate(t, dir, "third", true, start.Add(2*time.Second))
+	sink.reloadCertificates()
+	if sink.httpClient.Load() == client {
+		t.Fatal("client not replaced after the certificate and key were updated")
+	}
+	if got := deliver(); got != "third" {
+		t.Fatalf("client certificate = %s, want third", got)
+	}
+}
+
+func TestLoadTLSConfigMinVersion(t *testing.T) {
+	for version, want := range map[string]uint16{
+		"":    tls.VersionTLS12,
+		"1.0": tls.VersionTLS10,
+		"1.3": tls.VersionTLS13,
+	} {
+		tlsConfig, err := loadTLSConfig(&types.TLSConfig{MinVersion: version})
+		if err != nil {
+			t.Fatalf("loadTLSConfig(min_version %q) error = %v", version, err)
+		}
+		if tlsConfig.MinVersion != want {
+			t.Fatalf("min_version %q = %x, want %x", version, tlsConfig.MinVersion, want)
+		}
+	}
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: "http://127.0.0.1:1/webhook",
+	})
+	for _, version := range []string{"1.4", "TLS1.2", "1"} {
+		if _, err := loadTLSConfig(&types.TLSConfig{MinVersion: version}); err == nil {
+			t.Fatalf("loadTLSConfig(min_version %q) succeeded, want an error", version)
+		}
+		if _, err := NewHTTPSink(&cfg.Dispatcher, &types.TLSConfig{MinVersion: version}, nil, metrics.NewMetrics()); err == nil {
+			t.Fatalf("NewHTTPSink(min_version %q) succeeded, want an error", version)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// KafkaSink 将事件写入Kafka主题的输出端
+type KafkaSink struct {
+	client  *kgo.Client
+	topic   string // 主题模板
+	metrics *metrics.Metrics
+}
+
+// NewKafkaSink 创建Kafka输出端
+func NewKafkaSink(cfg *types.KafkaSinkConfig, m *metrics.Metrics) (*KafkaSink, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("kafka sink config is missing")
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "pikachu"
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(clientID),
+		kgo.ProduceRequestTimeout(timeout),
+		kgo.RecordDeliveryTimeout(timeout),
+		// 分区键取自主键，同一行的变更落在同一分区，保证顺序
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+	}
+
+	switch cfg.Acks {
+	case "", "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		// 幂等写入要求 acks=all，降低确认级别时需要关闭
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("invalid kafka acks: %s", cfg.Acks)
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+
+	return &KafkaSink{
+		client:  client,
+		topic:   cfg.Topic,
+		metrics: m,
+	}, nil
+}
+
+// Deliver 同步写入单条消息
+func (s *KafkaSink) Deliver(ctx context.Context, msg *Message) error {
+	return s.DeliverBatch(ctx, []*Message{msg})[0]
+}
+
+// DeliverBatch 批量写入消息，等待所有记录确认后返回
+func (s *KafkaSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	records := make([]*kgo.Record, len(msgs))
+	index := make(map[*kgo.Record]int, len(msgs))
+	for i, msg := range msgs {
+		records[i] = s.buildRecord(msg)
+		index[records[i]] = i
+	}
+
+	errs := make([]error, len(msgs))
+	// ProduceSync 返回的结果顺序与输入不一定一致，按记录指针回填
+	for _, result := range s.client.ProduceSync(ctx, records...) {
+		i := index[result.Record]
+		msg := msgs[i]
+		if result.Err != nil {
+			s.metrics.RecordError("kafka_produce", "dispatcher")
+			errs[i] = fmt.Errorf("kafka produce to topic %s failed: %w", result.Record.Topic, result.Err)
+			// 客户端已在超时内重试过可重试的错误，剩下的不可重试错误（如消息过大）重试也不会成功
+			var kafkaErr *kerr.Error
+			if errors.As(result.Err, &kafkaErr) && !kafkaErr.Retriable {
+				errs[i] = permanentError(errs[i])
+			}
+			continue
+		}
+
+		log.Info("Kafka message produced",
+			log.String("task_id", msg.Event.TaskID),
+			log.String("topic", result.Record.Topic),
+			log.Int32("partition", result.Record.Partition),
+			log.Int64("offset", result.Record.Offset))
+	}
+
+	return errs
+}
+
+// buildRecord 将消息转换为Kafka记录
+func (s *KafkaSink) buildRecord(msg *Message) *kgo.Record {
+	record := &kgo.Record{
+		Topic: expandTemplate(s.topic, msg.Event),
+		Value: msg.Body,
+	}
+	if key := formatPrimaryKey(msg.Event.PrimaryID); key != "" {
+		record.Key = []byte(key)
+	}
+
+	record.Headers = append(record.Headers, kgo.RecordHeader{Key: "content-type", Value: []byte(msg.ContentType)})
+	for key, value := range msg.Headers {
+		// CloudEvents 的 Kafka 协议绑定使用 ce_ 前缀，而不是HTTP绑定的 ce-，记录头的值也不做百分号编码
+		if strings.HasPrefix(key, "ce-") {
+			key = "ce_" + strings.TrimPrefix(key, "ce-")
+			value = decodeHeaderValue(value)
+		}
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+	}
+
+	return record
+}
+
+// Close 刷新未发送的记录并关闭客户端
+func (s *KafkaSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.client.Flush(ctx)
+	s.client.Close()
+	return err
+}
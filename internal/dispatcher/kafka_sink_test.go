@@ -0,0 +1,143 @@
+package dispatcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// startKafka 启动进程内的Kafka集群，预先创建4个分区的 cdc.users 主题
+func startKafka(t *testing.T) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(4, "cdc.users"))
+	if err != nil {
+		t.Fatalf("failed to start kafka: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// consumeKafka 从头读取主题，直到读到 n 条记录
+func consumeKafka(t *testing.T, cluster *kfake.Cluster, topic string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("got %d records before timeout, want %d", len(records), n)
+		}
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func TestKafkaSinkKeysAndHeaders(t *testing.T) {
+	cluster := startKafka(t)
+	sink, err := NewKafkaSink(&types.KafkaSinkConfig{
+		Brokers: cluster.ListenAddrs(),
+		Topic:   "cdc.{table}",
+	}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create kafka sink: %v", err)
+	}
+	defer sink.Close()
+
+	var msgs []*Message
+	for _, id := range []int64{7, 8, 7} {
+		msgs = append(msgs, &Message{
+			Event:       testEvent("users", id),
+			Body:        []byte(`{"id":1}`),
+			ContentType: "application/json",
+			Headers:     map[string]string{"ce-subject": encodeHeaderValue(`{"id":7}`), "x-trace": "abc"},
+		})
+	}
+	for i, err := range sink.DeliverBatch(context.Background(), msgs) {
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+
+	records := consumeKafka(t, cluster, "cdc.users", len(msgs))
+	partitions := map[string]int32{}
+	for _, record := range records {
+		key := string(record.Key)
+		if key != "7" && key != "8" {
+			t.Fatalf("record key = %q, want the primary key", key)
+		}
+		// 同一主键的记录必须落在同一分区
+		if p, ok := partitions[key]; ok && p != record.Partition {
+			t.Fatalf("key %s written to partitions %d and %d", key, p, record.Partition)
+		}
+		partitions[key] = record.Partition
+
+		headers := map[string]string{}
+		for _, h := range record.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		if headers["content-type"] != "application/json" {
+			t.Errorf("content-type header = %q", headers["content-type"])
+		}
+		if headers["ce_subject"] != `{"id":7}` {
+			t.Errorf("ce_subject header = %q, want the unencoded value", headers["ce_subject"])
+		}
+		if _, ok := headers["ce-subject"]; ok {
+			t.Error("ce- header should be renamed to ce_ for kafka")
+		}
+		if headers["x-trace"] != "abc" {
+			t.Errorf("x-trace header = %q", headers["x-trace"])
+		}
+	}
+}
+
+func TestKafkaSinkPerRecordErrors(t *testing.T) {
+	cluster := startKafka(t)
+	sink, err := NewKafkaSink(&types.KafkaSinkConfig{
+		Brokers: cluster.ListenAddrs(),
+		Topic:   "cdc.{table}",
+		Timeout: 2 * time.Second,
+	}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create kafka sink: %v", err)
+	}
+	defer sink.Close()
+
+	small := &Message{Event: testEvent("users", 1), Body: []byte(`{"id":1}`), ContentType: "application/json"}
+	huge := &Message{Event: testEvent("users", 2), Body: []byte(strings.Repeat("x", 2<<20)), ContentType: "application/json"}
+	other := &Message{Event: testEvent("users", 3), Body: []byte(`{"id":3}`), ContentType: "application/json"}
+
+	errs := sink.DeliverBatch(context.Background(), []*Message{small, huge, other})
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("small records failed: %v, %v", errs[0], errs[2])
+	}
+	if errs[1] == nil {
+		t.Fatal("oversized record succeeded, want error")
+	}
+	// 消息过大重试也不会成功，直接进入死信
+	if !isPermanent(errs[1]) {
+		t.Fatalf("oversized record error %v is not permanent", errs[1])
+	}
+
+	records := consumeKafka(t, cluster, "cdc.users", 2)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+}
@@ -0,0 +1,57 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"pikachu/internal/types"
+)
+
+// maxwellMessage Maxwell 的JSON输出格式
+type maxwellMessage struct {
+	Database   string                 `json:"database"`
+	Table      string                 `json:"table"`
+	Type       string                 `json:"type"`
+	Ts         int64                  `json:"ts"`
+	Position   string                 `json:"position,omitempty"`
+	GTID       string                 `json:"gtid,omitempty"`
+	PrimaryKey []interface{}          `json:"primary_key,omitempty"`
+	Data       map[string]interface{} `json:"data"`
+	Old        map[string]interface{} `json:"old,omitempty"`
+}
+
+// maxwellFormatter 输出 Maxwell 兼容的JSON
+type maxwellFormatter struct{}
+
+// Format 编码为 Maxwell JSON
+// UPDATE 的 old 只包含发生变化的列，与 Maxwell 行为一致
+func (f *maxwellFormatter) Format(event *types.ChangeEvent) (*Encoded, error) {
+	before, after := rowImages(event)
+
+	message := &maxwellMessage{
+		Database: event.Database,
+		Table:    event.Table,
+		Type:     string(event.Event),
+		Ts:       eventTimeOf(event).Unix(),
+		Data:     after,
+		GTID:     event.GTID,
+	}
+	if event.Event == types.EventDelete {
+		message.Data = before
+	}
+	if event.Event == types.EventUpdate {
+		message.Old = changedColumns(before, after)
+	}
+	if event.LogName != "" {
+		message.Position = fmt.Sprintf("%s:%d", event.LogName, event.LogPos)
+	}
+	for _, column := range event.PrimaryKeys {
+		message.PrimaryKey = append(message.PrimaryKey, message.Data[column])
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoded{Body: body, ContentType: "application/json"}, nil
+}
@@ -0,0 +1,202 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// NATSSink 将事件发布到NATS主题的输出端，可选使用JetStream确认
+type NATSSink struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream // 未启用JetStream时为nil
+	subject string              // 主题模板
+	stream  string
+	timeout time.Duration
+	metrics *metrics.Metrics
+}
+
+// NewNATSSink 创建NATS输出端
+func NewNATSSink(cfg *types.NATSSinkConfig, m *metrics.Metrics) (*NATSSink, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("nats sink config is missing")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	opts := []nats.Option{
+		nats.Name("pikachu"),
+		nats.Timeout(timeout),
+		nats.MaxReconnects(-1), // 一直重连，断线期间的发布失败交给重试处理
+	}
+	if cfg.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(cfg.Credentials))
+	}
+
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	sink := &NATSSink{
+		conn:    conn,
+		subject: cfg.Subject,
+		stream:  cfg.Stream,
+		timeout: timeout,
+		metrics: m,
+	}
+
+	if cfg.JetStream {
+		js, err := jetstream.New(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+		}
+		sink.js = js
+	}
+
+	return sink, nil
+}
+
+// Deliver 发布单条消息
+// JetStream模式下等待服务端确认，核心NATS模式下通过Flush确认服务端已收到
+func (s *NATSSink) Deliver(ctx context.Context, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	natsMsg := s.buildMsg(msg)
+
+	if s.js != nil {
+		ack, err := s.js.PublishMsg(ctx, natsMsg, s.publishOpts()...)
+		if err != nil {
+			s.metrics.RecordError("nats_publish", "dispatcher")
+			return fmt.Errorf("jetstream publish to subject %s failed: %w", natsMsg.Subject, err)
+		}
+		log.Info("JetStream message published",
+			log.String("task_id", msg.Event.TaskID),
+			log.String("subject", natsMsg.Subject),
+			log.String("stream", ack.Stream),
+			log.Uint64("sequence", ack.Sequence),
+			log.Bool("duplicate", ack.Duplicate))
+		return nil
+	}
+
+	if err := s.conn.PublishMsg(natsMsg); err != nil {
+		s.metrics.RecordError("nats_publish", "dispatcher")
+		return fmt.Errorf("nats publish to subject %s failed: %w", natsMsg.Subject, err)
+	}
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		s.metrics.RecordError("nats_publish", "dispatcher")
+		return fmt.Errorf("nats flush failed: %w", err)
+	}
+
+	log.Info("NATS message published",
+		log.String("task_id", msg.Event.TaskID),
+		log.String("subject", natsMsg.Subject))
+	return nil
+}
+
+// DeliverBatch 批量发布消息
+// JetStream模式下异步发布后统一等待确认，核心NATS模式下发布后统一Flush
+func (s *NATSSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	errs := make([]error, len(msgs))
+
+	if s.js == nil {
+		for i, msg := range msgs {
+			errs[i] = s.conn.PublishMsg(s.buildMsg(msg))
+		}
+		if err := s.conn.FlushWithContext(ctx); err != nil {
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = fmt.Errorf("nats flush failed: %w", err)
+				}
+			}
+		}
+		for _, err := range errs {
+			if err != nil {
+				s.metrics.RecordError("nats_publish", "dispatcher")
+			}
+		}
+		return errs
+	}
+
+	futures := make([]jetstream.PubAckFuture, len(msgs))
+	for i, msg := range msgs {
+		natsMsg := s.buildMsg(msg)
+		future, err := s.js.PublishMsgAsync(natsMsg, s.publishOpts()...)
+		if err != nil {
+			errs[i] = fmt.Errorf("jetstream publish to subject %s failed: %w", natsMsg.Subject, err)
+			continue
+		}
+		futures[i] = future
+	}
+
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs[i] = fmt.Errorf("jetstream publish to subject %s failed: %w", future.Msg().Subject, err)
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("jetstream publish ack timeout: %w", ctx.Err())
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			s.metrics.RecordError("nats_publish", "dispatcher")
+		}
+	}
+	return errs
+}
+
+// buildMsg 将消息转换为NATS消息，Nats-Msg-Id 用于JetStream去重
+// 多目标任务的消息ID附带目标名称，写入同一个流的不同目标不会被当作重复消息丢弃
+func (s *NATSSink) buildMsg(msg *Message) *nats.Msg {
+	natsMsg := nats.NewMsg(expandTemplate(s.subject, msg.Event))
+	natsMsg.Data = msg.Body
+	natsMsg.Header.Set("Content-Type", msg.ContentType)
+	natsMsg.Header.Set(jetstream.MsgIDHeader, natsMsgID(msg))
+	for key, value := range msg.Headers {
+		natsMsg.Header.Set(key, value)
+	}
+	return natsMsg
+}
+
+// natsMsgID 返回消息的 Nats-Msg-Id：事件ID，多目标任务为 事件ID/目标名称
+func natsMsgID(msg *Message) string {
+	if msg.Destination == "" {
+		return msg.Event.ID()
+	}
+	return msg.Event.ID() + "/" + msg.Destination
+}
+
+// publishOpts 构建JetStream发布选项
+func (s *NATSSink) publishOpts() []jetstream.PublishOpt {
+	if s.stream == "" {
+		return nil
+	}
+	return []jetstream.PublishOpt{jetstream.WithExpectStream(s.stream)}
+}
+
+// Close 刷新缓冲并关闭连接
+func (s *NATSSink) Close() error {
+	err := s.conn.FlushTimeout(s.timeout)
+	s.conn.Close()
+	return err
+}
@@ -0,0 +1,187 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// startNATS 启动内嵌的 nats-server，开启 JetStream
+func startNATS(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create nats server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+	return srv
+}
+
+func TestNATSSinkCorePublish(t *testing.T) {
+	srv := startNATS(t)
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("cdc.>")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	conn.Flush()
+
+	sink, err := NewNATSSink(&types.NATSSinkConfig{
+		URL:     srv.ClientURL(),
+		Subject: "cdc.{database}.{table}.{event}",
+	}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create nats sink: %v", err)
+	}
+	defer sink.Close()
+
+	event := testEvent("users", 1)
+	msg := &Message{Event: event, Body: []byte(`{"id":1}`), ContentType: "application/json",
+		Headers: map[string]string{"ce-type": "pikachu.users.insert"}}
+	if err := sink.Deliver(context.Background(), msg); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	batch := []*Message{
+		{Event: testEvent("users", 2), Body: []byte(`{"id":2}`), ContentType: "application/json"},
+		{Event: testEvent("users", 3), Body: []byte(`{"id":3}`), ContentType: "application/json"},
+	}
+	for i, err := range sink.DeliverBatch(context.Background(), batch) {
+		if err != nil {
+			t.Fatalf("batch message %d: %v", i, err)
+		}
+	}
+
+	received, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("no message received: %v", err)
+	}
+	if received.Subject != "cdc.app.users.insert" {
+		t.Errorf("subject = %q, want cdc.app.users.insert", received.Subject)
+	}
+	if string(received.Data) != `{"id":1}` {
+		t.Errorf("data = %q", received.Data)
+	}
+	if got := received.Header.Get(jetstream.MsgIDHeader); got != event.ID() {
+		t.Errorf("%s = %q, want %q", jetstream.MsgIDHeader, got, event.ID())
+	}
+	if got := received.Header.Get("ce-type"); got != "pikachu.users.insert" {
+		t.Errorf("ce-type = %q", got)
+	}
+	for i := range batch {
+		if _, err := sub.NextMsg(5 * time.Second); err != nil {
+			t.Fatalf("batch message %d not received: %v", i, err)
+		}
+	}
+}
+
+func TestNATSSinkJetStream(t *testing.T) {
+	srv := startNATS(t)
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "CDC", Subjects: []string{"cdc.>"}})
+	if err != nil {
+		t.Fatalf("failed to create stream: %v", err)
+	}
+
+	newSink := func(expectStream string) *NATSSink {
+		sink, err := NewNATSSink(&types.NATSSinkConfig{
+			URL:       srv.ClientURL(),
+			Subject:   "cdc.{table}",
+			JetStream: true,
+			Stream:    expectStream,
+			Timeout:   2 * time.Second,
+		}, metrics.NewMetrics())
+		if err != nil {
+			t.Fatalf("failed to create nats sink: %v", err)
+		}
+		t.Cleanup(func() { sink.Close() })
+		return sink
+	}
+	sink := newSink("CDC")
+
+	// 同一事件重试时 Nats-Msg-Id 相同，JetStream 在去重窗口内只保存一次
+	event := testEvent("users", 1)
+	msg := &Message{Event: event, Body: []byte(`{"id":1}`), ContentType: "application/json"}
+	for i := 0; i < 2; i++ {
+		if err := sink.Deliver(ctx, msg); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	batch := []*Message{
+		msg,
+		{Event: testEvent("users", 2), Body: []byte(`{"id":2}`), ContentType: "application/json"},
+	}
+	for i, err := range sink.DeliverBatch(ctx, batch) {
+		if err != nil {
+			t.Fatalf("batch message %d: %v", i, err)
+		}
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 {
+		t.Fatalf("stream has %d messages, want 2 after deduplication", info.State.Msgs)
+	}
+
+	// 多目标任务的其他目标写入同一个流时不被当作重复消息
+	archived := &Message{Event: event, Destination: "archive", Body: []byte(`{"id":1}`), ContentType: "application/json"}
+	for i := 0; i < 2; i++ {
+		if err := sink.Deliver(ctx, archived); err != nil {
+			t.Fatalf("destination attempt %d: %v", i, err)
+		}
+	}
+	if info, err = stream.Info(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 3 {
+		t.Fatalf("stream has %d messages, want 3 with a second destination", info.State.Msgs)
+	}
+	last, err := stream.GetLastMsgForSubject(ctx, "cdc.users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := last.Header.Get(jetstream.MsgIDHeader); id != event.ID()+"/archive" {
+		t.Fatalf("Nats-Msg-Id = %q, want the event ID with the destination name", id)
+	}
+
+	// 主题被其他流接收时，expect stream 校验失败
+	wrong := newSink("OTHER")
+	if err := wrong.Deliver(ctx, &Message{Event: testEvent("users", 3), Body: []byte(`{}`)}); err == nil {
+		t.Fatal("publish with a mismatched stream succeeded, want error")
+	}
+	if errs := wrong.DeliverBatch(ctx, []*Message{{Event: testEvent("users", 4), Body: []byte(`{}`)}}); errs[0] == nil {
+		t.Fatal("batch publish with a mismatched stream succeeded, want error")
+	}
+}
@@ -0,0 +1,308 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+var (
+	errOverflowFull   = errors.New("overflow queue is full")   // 溢出队列已满
+	errOverflowClosed = errors.New("overflow queue is closed") // 分发器已停止
+)
+
+// spillReadBatch 每次从溢出文件读回内存的记录数
+const spillReadBatch = 100
+
+// overflowQueue 溢出队列
+//
+// 工作队列满时事件按到达顺序进入溢出队列，由单独的协程在工作队列有空间时送回。
+// 内存中最多暂存 max_pending 个事件，超出部分写入溢出文件；溢出文件中有事件时新事件也写入文件，保证先进先出
+type overflowQueue struct {
+	maxPending int
+	spill      *spillFile                                    // 溢出文件，未配置时为nil
+	restore    func(record *spillRecord) *types.CallbackTask // 将溢出记录还原为回调任务
+	metrics    *metrics.Metrics
+
+	mu     sync.Mutex
+	memory []*types.CallbackTask
+	inHand int           // 已取出但尚未送回工作队列的事件数
+	notify chan struct{} // 有新事件时通知送回协程
+	space  chan struct{} // 取出事件时关闭并替换，唤醒等待空间的 block 模式生产者
+	closed bool
+}
+
+// newOverflowQueue 创建溢出队列，配置了溢出文件时打开文件并恢复上次残留的事件
+func newOverflowQueue(cfg *types.OverflowConfig, m *metrics.Metrics, restore func(*spillRecord) *types.CallbackTask) (*overflowQueue, error) {
+	q := &overflowQueue{
+		maxPending: cfg.MaxPending,
+		restore:    restore,
+		metrics:    m,
+		notify:     make(chan struct{}, 1),
+		space:      make(chan struct{}),
+	}
+
+	if cfg.SpillPath != "" {
+		spill, err := openSpillFile(cfg.SpillPath, cfg.SpillMaxSizeMB)
+		if err != nil {
+			return nil, err
+		}
+		q.spill = spill
+		if spill.count > 0 {
+			q.signal()
+		}
+	}
+	q.updateMetrics()
+	return q, nil
+}
+
+// pending 返回溢出队列中尚未送回工作队列的事件数
+func (q *overflowQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.memory) + q.inHand
+	if q.spill != nil {
+		n += q.spill.count
+	}
+	return n
+}
+
+// push 追加一个事件，spilled 表示事件已写入溢出文件，内存中的任务对象可以释放；
+// 内存和溢出文件都已满时返回错误
+func (q *overflowQueue) push(callbackTask *types.CallbackTask) (spilled bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false, errOverflowClosed
+	}
+	if q.spill != nil && (q.spill.count > 0 || len(q.memory) >= q.maxPending) {
+		if err := q.spill.write(callbackTask); err != nil {
+			return false, err
+		}
+		spilled = true
+	} else if len(q.memory) < q.maxPending {
+		q.memory = append(q.memory, callbackTask)
+	} else {
+		return false, errOverflowFull
+	}
+
+	q.updateMetrics()
+	q.signal()
+	return spilled, nil
+}
+
+// next 取出最早的事件，队列为空时返回nil；调用方送回工作队列后需调用 done
+func (q *overflowQueue) next() *types.CallbackTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	for len(q.memory) == 0 && q.spill != nil && q.spill.count > 0 {
+		records, err := q.spill.read(spillReadBatch)
+		if err != nil {
+			log.Error("Failed to read spill file", zap.Error(err))
+			return nil
+		}
+		for _, record := range records {
+			if callbackTask := q.restore(record); callbackTask != nil {
+				q.memory = append(q.memory, callbackTask)
+			}
+		}
+	}
+
+	if len(q.memory) == 0 {
+		return nil
+	}
+	callbackTask := q.memory[0]
+	q.memory[0] = nil
+	q.memory = q.memory[1:]
+	q.inHand++
+	q.updateMetrics()
+
+	close(q.space)
+	q.space = make(chan struct{})
+	return callbackTask
+}
+
+// pushWait 追加一个事件，队列已满时等待送回协程腾出空间，ctx 结束时返回错误
+func (q *overflowQueue) pushWait(ctx context.Context, callbackTask *types.CallbackTask) (spilled bool, err error) {
+	for {
+		q.mu.Lock()
+		space := q.space
+		q.mu.Unlock()
+
+		spilled, err := q.push(callbackTask)
+		if !errors.Is(err, errOverflowFull) && !errors.Is(err, errSpillFull) {
+			return spilled, err
+		}
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// done 标记 next 取出的事件已送回工作队列
+func (q *overflowQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inHand--
+}
+
+// signal 唤醒送回协程，调用方需持有锁
+func (q *overflowQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// updateMetrics 更新溢出队列指标，调用方需持有锁
+func (q *overflowQueue) updateMetrics() {
+	var spilled int64
+	if q.spill != nil {
+		spilled = int64(q.spill.count)
+	}
+	q.metrics.SetOverflowPending(int64(len(q.memory)), spilled)
+}
+
+// close 关闭溢出队列，将停止时尚未完成的投递与内存中尚未送回的事件一起写回溢出文件：
+// front 为早于溢出队列的投递，排在内存事件之前；back 为事件队列中剩余的新事件，排在最后。
+// 未配置溢出文件时这些事件无法保存，返回其数量
+func (q *overflowQueue) close(front, back []*types.CallbackTask) (lost int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	pending := append(append(front, q.memory...), back...)
+	q.memory = nil
+	if q.spill == nil {
+		return len(pending), nil
+	}
+	return 0, q.spill.close(pending)
+}
+
+// discard 关闭溢出队列，丢弃本次运行读取的事件尚未完成的投递和写入溢出文件的记录，
+// 只保留从启动时残留的溢出记录恢复的投递，参数含义与 close 相同；返回丢弃的数量
+func (q *overflowQueue) discard(front, back []*types.CallbackTask) (discarded int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	var carried []*types.CallbackTask
+	for _, callbackTask := range append(append(front, q.memory...), back...) {
+		if callbackTask.Carried {
+			carried = append(carried, callbackTask)
+		} else {
+			discarded++
+		}
+	}
+	q.memory = nil
+	if q.spill == nil {
+		return discarded, nil
+	}
+	dropped, err := q.spill.discard(carried)
+	return discarded + dropped, err
+}
+
+// drainOverflow 将溢出队列中的事件按顺序送回工作队列，工作队列满时等待
+func (d *Dispatcher) drainOverflow() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.overflow.notify:
+		case <-d.ctx.Done():
+			return
+		}
+
+		for {
+			callbackTask := d.overflow.next()
+			if callbackTask == nil {
+				break
+			}
+			d.requeue(callbackTask)
+			d.overflow.done()
+
+			if d.ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// enqueue 将回调任务放入工作队列，工作队列已满或溢出队列中还有更早的事件时进入溢出队列
+// block 背压模式下溢出队列也满时等待，事件不会因队列满被丢弃；返回false表示任务未被接收
+func (d *Dispatcher) enqueue(callbackTask *types.CallbackTask, targetQueue chan *types.CallbackTask) bool {
+	if d.overflow.pending() == 0 {
+		select {
+		case targetQueue <- callbackTask:
+			return true
+		default:
+		}
+	}
+
+	var spilled bool
+	var err error
+	if d.config.Monitor.Backpressure == types.BackpressureBlock {
+		spilled, err = d.overflow.pushWait(d.ctx, callbackTask)
+	} else {
+		spilled, err = d.overflow.push(callbackTask)
+	}
+	if err != nil {
+		return false
+	}
+	if spilled {
+		d.releaseCallbackTask(callbackTask)
+	}
+	return true
+}
+
+// restoreSpilled 将溢出文件中的记录还原为回调任务，任务或投递目标已不存在时丢弃
+func (d *Dispatcher) restoreSpilled(record *spillRecord) *types.CallbackTask {
+	policy, ok := d.policies[destinationKey(record.TaskID, record.Destination)]
+	if !ok {
+		log.Warn("Destination of spilled event no longer exists, dropping event",
+			log.String("task_id", record.TaskID),
+			log.String("destination", record.Destination))
+		d.metrics.IncrementEventsDropped()
+		return nil
+	}
+
+	event := record.event()
+	if schema, ok := d.schemas.Load(event.Database + "." + event.Table); ok {
+		event.Schema = schema.(*types.TableSchema)
+	}
+
+	callbackTask := d.callbackTaskPool.Get().(*types.CallbackTask)
+	*callbackTask = types.CallbackTask{
+		Event:       event,
+		Destination: record.Destination,
+		CallbackURL: record.CallbackURL,
+		RetryCount:  record.RetryCount,
+		MaxRetries:  policy.maxRetries,
+		Carried:     record.Carried,
+	}
+	return callbackTask
+}
+
+// rememberSchema 记录表的最新结构，供从溢出文件还原的事件使用
+func (d *Dispatcher) rememberSchema(event *types.ChangeEvent) {
+	if event.Schema == nil {
+		return
+	}
+	key := event.Database + "." + event.Table
+	if current, ok := d.schemas.Load(key); ok && current.(*types.TableSchema) == event.Schema {
+		return
+	}
+	d.schemas.Store(key, event.Schema)
+}
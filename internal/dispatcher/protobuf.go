@@ -0,0 +1,130 @@
+package dispatcher
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"pikachu/internal/types"
+)
+
+// protobufCodec Protobuf 二进制编码
+//
+// 每张表生成一个 .proto 定义，Row 的字段编号为列在表中的序号（从1开始）。
+// 删除或调整列顺序会改变字段编号，注册中心的兼容性检查会拒绝这类变更
+type protobufCodec struct{}
+
+func (protobufCodec) schemaType() string  { return "PROTOBUF" }
+func (protobufCodec) contentType() string { return "application/x-protobuf" }
+
+// protobufTypeNames 编码类型对应的 Protobuf 标量类型
+var protobufTypeNames = map[columnKind]string{
+	kindInt32:  "int32",
+	kindInt64:  "int64",
+	kindUint64: "uint64",
+	kindFloat:  "float",
+	kindDouble: "double",
+	kindString: "string",
+	kindBytes:  "bytes",
+}
+
+// define 生成 .proto 定义，ChangeEvent 必须是第一个消息，对应线格式中的消息索引0
+func (protobufCodec) define(event *types.ChangeEvent, columns []binaryColumn) (string, error) {
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&b, "package %s;\n\n", schemaNamespace(event))
+
+	b.WriteString("message ChangeEvent {\n")
+	b.WriteString("  string event = 1;\n")
+	b.WriteString("  string database = 2;\n")
+	b.WriteString("  string table = 3;\n")
+	b.WriteString("  int64 timestamp = 4;\n")
+	b.WriteString("  Row before = 5;\n")
+	b.WriteString("  Row after = 6;\n")
+	b.WriteString("}\n\n")
+
+	// 使用 optional 区分 NULL 和零值
+	b.WriteString("message Row {\n")
+	for i, column := range columns {
+		fmt.Fprintf(&b, "  optional %s %s = %d;\n", protobufTypeNames[column.kind], column.field, i+1)
+	}
+	b.WriteString("}\n")
+
+	return b.String(), nil
+}
+
+// encode 编码事件，schema ID 之后先写入消息索引（第一个消息简写为单个0）
+func (protobufCodec) encode(buf []byte, event *types.ChangeEvent, columns []binaryColumn) ([]byte, error) {
+	before, after := rowImages(event)
+
+	buf = append(buf, 0)
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	buf = protowire.AppendString(buf, string(event.Event))
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendString(buf, event.Database)
+	buf = protowire.AppendTag(buf, 3, protowire.BytesType)
+	buf = protowire.AppendString(buf, event.Table)
+	buf = protowire.AppendTag(buf, 4, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(eventTimeOf(event).UnixMilli()))
+
+	for i, row := range []map[string]interface{}{before, after} {
+		if row == nil {
+			continue
+		}
+		encoded, err := protobufAppendRow(nil, row, columns)
+		if err != nil {
+			return nil, err
+		}
+		buf = protowire.AppendTag(buf, protowire.Number(5+i), protowire.BytesType)
+		buf = protowire.AppendBytes(buf, encoded)
+	}
+	return buf, nil
+}
+
+// protobufAppendRow 编码一行数据，NULL 的列不写入
+func protobufAppendRow(buf []byte, row map[string]interface{}, columns []binaryColumn) ([]byte, error) {
+	for i, column := range columns {
+		value := row[column.name]
+		if value == nil {
+			continue
+		}
+		number := protowire.Number(i + 1)
+
+		switch column.kind {
+		case kindInt32, kindInt64:
+			n, err := columnInt64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = protowire.AppendTag(buf, number, protowire.VarintType)
+			buf = protowire.AppendVarint(buf, uint64(n))
+		case kindUint64:
+			n, err := columnUint64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = protowire.AppendTag(buf, number, protowire.VarintType)
+			buf = protowire.AppendVarint(buf, n)
+		case kindFloat:
+			f, err := columnFloat64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = protowire.AppendTag(buf, number, protowire.Fixed32Type)
+			buf = protowire.AppendFixed32(buf, math.Float32bits(float32(f)))
+		case kindDouble:
+			f, err := columnFloat64(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+			buf = protowire.AppendTag(buf, number, protowire.Fixed64Type)
+			buf = protowire.AppendFixed64(buf, math.Float64bits(f))
+		default:
+			buf = protowire.AppendTag(buf, number, protowire.BytesType)
+			buf = protowire.AppendBytes(buf, columnBytes(value))
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,150 @@
+package dispatcher
+
+import (
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// tokenBucket 令牌桶限流器
+// 令牌按固定速率补充，桶满时不再累积；没有令牌时投递进入等待队列，
+// 由计时器在令牌生成后按到达顺序放行，等待期间不占用工作协程，也不会预支令牌
+type tokenBucket struct {
+	rate  float64                     // 每秒生成的令牌数
+	burst float64                     // 桶容量
+	ready func([]*types.CallbackTask) // 放行等待的投递，在持有锁时调用，不能阻塞
+
+	mu      sync.Mutex
+	tokens  float64 // 当前令牌数，不会为负
+	last    time.Time
+	waiting []*types.CallbackTask // 等待令牌的投递，按到达顺序排列
+	timer   *time.Timer           // 下一个令牌生成时放行等待的投递，没有等待时为nil
+}
+
+// newTokenBucket 创建令牌桶，初始为满桶；ready 用于将取得令牌的等待投递重新入队
+func newTokenBucket(cfg *types.RateLimitConfig, ready func([]*types.CallbackTask)) *tokenBucket {
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(cfg.Rate))
+	}
+	return &tokenBucket{
+		rate:   cfg.Rate,
+		burst:  burst,
+		ready:  ready,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// take 取出一个令牌；没有令牌或已有投递在等待时将任务加入等待队列并返回false
+func (b *tokenBucket) take(callbackTask *types.CallbackTask) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if len(b.waiting) == 0 && b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	b.waiting = append(b.waiting, callbackTask)
+	b.schedule()
+	return false
+}
+
+// refill 按经过的时间补充令牌，调用方需持有锁
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// schedule 在下一个令牌生成时放行等待的投递，调用方需持有锁
+func (b *tokenBucket) schedule() {
+	if b.timer != nil || len(b.waiting) == 0 {
+		return
+	}
+	delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	b.timer = time.AfterFunc(delay, b.release)
+}
+
+// release 按到达顺序为等待的投递分配令牌并放行，令牌不足时等待下一次生成
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.timer = nil
+	b.refill(time.Now())
+	n := 0
+	for n < len(b.waiting) && b.tokens >= 1 {
+		b.tokens--
+		b.waiting[n].RateGates++
+		n++
+	}
+	if n > 0 {
+		released := make([]*types.CallbackTask, n)
+		copy(released, b.waiting[:n])
+		b.waiting = append(b.waiting[:0], b.waiting[n:]...)
+		b.ready(released)
+	}
+	b.schedule()
+}
+
+// takeWaiting 取出全部等待的投递并停止计时，分发器停止时调用
+func (b *tokenBucket) takeWaiting() []*types.CallbackTask {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	waiting := b.waiting
+	b.waiting = nil
+	return waiting
+}
+
+// waitingCount 返回等待令牌的投递数
+func (b *tokenBucket) waitingCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.waiting)
+}
+
+// admitRateLimit 依次获取投递目标和回调主机的令牌
+// 缺少令牌时任务在对应的限流器中等待，返回false，工作协程可以继续处理其它投递目标的任务
+func (d *Dispatcher) admitRateLimit(callbackTask *types.CallbackTask) bool {
+	buckets := d.rateLimitsOf(callbackTask)
+	for callbackTask.RateGates < len(buckets) {
+		if !buckets[callbackTask.RateGates].take(callbackTask) {
+			return false
+		}
+		callbackTask.RateGates++
+	}
+	return true
+}
+
+// rateLimitsOf 返回任务需要依次通过的限流器：投递目标的限流和回调主机的限流
+func (d *Dispatcher) rateLimitsOf(callbackTask *types.CallbackTask) []*tokenBucket {
+	var buckets []*tokenBucket
+	if bucket := d.policies[destinationKeyOf(callbackTask)].rateLimit; bucket != nil {
+		buckets = append(buckets, bucket)
+	}
+
+	if len(d.hostLimits) == 0 {
+		return buckets
+	}
+	u, err := url.Parse(callbackTask.CallbackURL)
+	if err != nil {
+		return buckets
+	}
+	bucket, ok := d.hostLimits[u.Host]
+	if !ok {
+		bucket, ok = d.hostLimits[u.Hostname()]
+	}
+	if ok {
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
@@ -0,0 +1,126 @@
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+func TestTokenBucketQueuesWithoutDebt(t *testing.T) {
+	released := make(chan *types.CallbackTask, 8)
+	bucket := newTokenBucket(&types.RateLimitConfig{Rate: 50, Burst: 1}, func(tasks []*types.CallbackTask) {
+		for _, callbackTask := range tasks {
+			released <- callbackTask
+		}
+	})
+
+	tasks := make([]*types.CallbackTask, 4)
+	for i := range tasks {
+		tasks[i] = &types.CallbackTask{RetryCount: i}
+	}
+	if !bucket.take(tasks[0]) {
+		t.Fatal("first take should use the initial token")
+	}
+	for _, callbackTask := range tasks[1:] {
+		if bucket.take(callbackTask) {
+			t.Fatal("take succeeded on an empty bucket")
+		}
+	}
+	bucket.mu.Lock()
+	tokens := bucket.tokens
+	bucket.mu.Unlock()
+	if tokens < 0 {
+		t.Fatalf("tokens = %v, queued deliveries must not borrow tokens", tokens)
+	}
+
+	// 等待的投递按到达顺序逐个放行，并记录已通过这个限流器
+	for i, want := range tasks[1:] {
+		select {
+		case got := <-released:
+			if got != want {
+				t.Fatalf("released #%d = task %d, want task %d", i, got.RetryCount, want.RetryCount)
+			}
+			if got.RateGates != 1 {
+				t.Fatalf("RateGates = %d, want 1", got.RateGates)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("task %d was not released", want.RetryCount)
+		}
+	}
+	if n := bucket.waitingCount(); n != 0 {
+		t.Fatalf("waitingCount = %d, want 0", n)
+	}
+}
+
+// recordingReceiver 记录收到的事件的任务ID
+type recordingReceiver struct {
+	*httptest.Server
+	mu    sync.Mutex
+	tasks []string
+}
+
+func newRecordingReceiver(t *testing.T, handler func(taskID string)) *recordingReceiver {
+	t.Helper()
+	receiver := &recordingReceiver{}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taskID := strings.TrimPrefix(r.URL.Path, "/")
+		if handler != nil {
+			handler(taskID)
+		}
+		receiver.mu.Lock()
+		receiver.tasks = append(receiver.tasks, taskID)
+		receiver.mu.Unlock()
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+// count 返回收到的指定任务的事件数
+func (r *recordingReceiver) count(taskID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, id := range r.tasks {
+		if id == taskID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRateLimitDoesNotBlockWorkers(t *testing.T) {
+	receiver := newRecordingReceiver(t, nil)
+	cfg := newTestConfig(t,
+		types.Task{
+			TaskID:      "limited",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: receiver.URL + "/limited",
+			Delivery:    &types.DeliveryConfig{RateLimit: &types.RateLimitConfig{Rate: 1, Burst: 1}},
+		},
+		types.Task{
+			TaskID:      "open",
+			TableName:   "users",
+			Events:      []types.EventType{types.EventInsert},
+			CallbackURL: receiver.URL + "/open",
+		},
+	)
+	cfg.Dispatcher.WorkerCount = 1
+	_, events := startTestDispatcher(t, cfg)
+
+	for i := int64(1); i <= 3; i++ {
+		events <- testEvent("limited", i)
+	}
+	events <- testEvent("open", 4)
+
+	// 唯一的工作协程不会等待 limited 的令牌，open 的投递立即完成
+	waitFor(t, "the unlimited delivery", func() bool { return receiver.count("open") == 1 })
+	if n := receiver.count("limited"); n != 1 {
+		t.Fatalf("limited deliveries = %d before the next token, want 1", n)
+	}
+}
@@ -0,0 +1,173 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+// Redis Streams 字段布局
+const (
+	RedisLayoutJSON    = "json"    // 整个载荷存放在 payload 字段中
+	RedisLayoutColumns = "columns" // 每一列展开为一个字段，当前行使用 row. 前缀，旧值使用 old. 前缀
+)
+
+// RedisSink 将事件XADD到Redis Streams的输出端
+type RedisSink struct {
+	client  *redis.Client
+	stream  string // 流名称模板
+	maxLen  int64
+	approx  bool
+	layout  string
+	timeout time.Duration
+	metrics *metrics.Metrics
+}
+
+// NewRedisSink 创建Redis Streams输出端
+func NewRedisSink(cfg *types.RedisSinkConfig, m *metrics.Metrics) (*RedisSink, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("redis sink config is missing")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	layout := cfg.FieldLayout
+	if layout == "" {
+		layout = RedisLayoutJSON
+	}
+	if layout != RedisLayoutJSON && layout != RedisLayoutColumns {
+		return nil, fmt.Errorf("invalid redis field layout: %s", layout)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+
+	return &RedisSink{
+		client:  client,
+		stream:  cfg.Stream,
+		maxLen:  cfg.MaxLen,
+		approx:  !cfg.ExactTrim,
+		layout:  layout,
+		timeout: timeout,
+		metrics: m,
+	}, nil
+}
+
+// Deliver 写入单条消息
+func (s *RedisSink) Deliver(ctx context.Context, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	args := s.buildArgs(msg)
+	id, err := s.client.XAdd(ctx, args).Result()
+	if err != nil {
+		s.metrics.RecordError("redis_xadd", "dispatcher")
+		return fmt.Errorf("redis XADD to stream %s failed: %w", args.Stream, err)
+	}
+
+	log.Info("Redis stream entry added",
+		log.String("task_id", msg.Event.TaskID),
+		log.String("stream", args.Stream),
+		log.String("entry_id", id))
+	return nil
+}
+
+// DeliverBatch 使用管道批量写入消息，减少网络往返
+func (s *RedisSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmds := make([]*redis.StringCmd, len(msgs))
+	pipe := s.client.Pipeline()
+	for i, msg := range msgs {
+		cmds[i] = pipe.XAdd(ctx, s.buildArgs(msg))
+	}
+	// 单条命令的错误记录在各自的 cmd 中，这里的错误不需要单独处理
+	pipe.Exec(ctx)
+
+	errs := make([]error, len(msgs))
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			s.metrics.RecordError("redis_xadd", "dispatcher")
+			errs[i] = fmt.Errorf("redis XADD failed: %w", err)
+		}
+	}
+	return errs
+}
+
+// buildArgs 构建XADD参数
+func (s *RedisSink) buildArgs(msg *Message) *redis.XAddArgs {
+	args := &redis.XAddArgs{
+		Stream: expandTemplate(s.stream, msg.Event),
+		MaxLen: s.maxLen,
+		Approx: s.approx && s.maxLen > 0,
+	}
+
+	if s.layout == RedisLayoutColumns {
+		args.Values = flattenColumns(msg.Event)
+	} else {
+		args.Values = []interface{}{
+			"event", string(msg.Event.Event),
+			"table", msg.Event.Table,
+			"content_type", msg.ContentType,
+			"payload", msg.Body,
+		}
+	}
+	return args
+}
+
+// flattenColumns 将事件展开为字段列表
+// 当前行（INSERT/UPDATE 为新数据，DELETE 为被删除的数据）使用 row. 前缀，UPDATE 的旧值使用 old. 前缀，
+// 名为 event、table 等的列不会覆盖元数据字段
+func flattenColumns(event *types.ChangeEvent) []interface{} {
+	values := make([]interface{}, 0, 8+2*(len(event.NewData)+len(event.OldData)))
+	values = append(values,
+		"event", string(event.Event),
+		"table", event.Table,
+		"primary_id", formatPrimaryKey(event.PrimaryID),
+		"timestamp", event.Timestamp.Format(time.RFC3339Nano),
+	)
+	for column, value := range event.NewData {
+		values = append(values, "row."+column, formatColumnValue(value))
+	}
+	for column, value := range event.OldData {
+		values = append(values, "old."+column, formatColumnValue(value))
+	}
+	return values
+}
+
+// formatColumnValue 将列值格式化为字符串，NULL 使用空字符串表示
+func formatColumnValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Close 关闭客户端连接
+func (s *RedisSink) Close() error {
+	return s.client.Close()
+}
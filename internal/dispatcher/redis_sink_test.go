@@ -0,0 +1,109 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestRedisSinkColumnsLayout(t *testing.T) {
+	server := miniredis.RunT(t)
+	sink, err := NewRedisSink(&types.RedisSinkConfig{
+		Addr:        server.Addr(),
+		Stream:      "cdc:{table}",
+		FieldLayout: RedisLayoutColumns,
+	}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create redis sink: %v", err)
+	}
+	defer sink.Close()
+
+	// 表中有与元数据同名的列
+	event := testEvent("users", 1)
+	event.Event = types.EventUpdate
+	event.OldData = map[string]interface{}{"id": int64(1), "event": "signup", "table": "A1"}
+	event.NewData = map[string]interface{}{"id": int64(1), "event": "login", "table": "B2", "note": nil}
+	msg := &Message{Event: event, Body: []byte(`{}`), ContentType: "application/json"}
+	if err := sink.Deliver(context.Background(), msg); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	entries, err := server.Stream("cdc:users")
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d stream entries, want 1", len(entries))
+	}
+	fields := map[string]string{}
+	for i := 0; i+1 < len(entries[0].Values); i += 2 {
+		if _, dup := fields[entries[0].Values[i]]; dup {
+			t.Fatalf("duplicate field %q in entry %v", entries[0].Values[i], entries[0].Values)
+		}
+		fields[entries[0].Values[i]] = entries[0].Values[i+1]
+	}
+
+	want := map[string]string{
+		"event":      "update",
+		"table":      "users",
+		"primary_id": "1",
+		"row.id":     "1",
+		"row.event":  "login",
+		"row.table":  "B2",
+		"row.note":   "",
+		"old.event":  "signup",
+		"old.table":  "A1",
+	}
+	for field, value := range want {
+		if got, ok := fields[field]; !ok || got != value {
+			t.Errorf("field %s = %q (present %v), want %q", field, got, ok, value)
+		}
+	}
+}
+
+func TestRedisSinkBatchTrimsStream(t *testing.T) {
+	server := miniredis.RunT(t)
+	sink, err := NewRedisSink(&types.RedisSinkConfig{
+		Addr:      server.Addr(),
+		Stream:    "cdc:{table}",
+		MaxLen:    2,
+		ExactTrim: true,
+	}, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("failed to create redis sink: %v", err)
+	}
+	defer sink.Close()
+
+	var msgs []*Message
+	for i := int64(1); i <= 3; i++ {
+		msgs = append(msgs, &Message{Event: testEvent("users", i), Body: []byte(`{"n":1}`), ContentType: "application/json"})
+	}
+	for i, err := range sink.DeliverBatch(context.Background(), msgs) {
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+
+	entries, err := server.Stream("cdc:users")
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d stream entries after trimming, want 2", len(entries))
+	}
+	if entries[0].Values[len(entries[0].Values)-1] != `{"n":1}` {
+		t.Fatalf("payload field = %v", entries[0].Values)
+	}
+
+	// 服务器不可用时每条消息都返回错误
+	server.Close()
+	for i, err := range sink.DeliverBatch(context.Background(), msgs[:2]) {
+		if err == nil {
+			t.Fatalf("message %d: expected error with the server down", i)
+		}
+	}
+}
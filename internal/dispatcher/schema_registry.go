@@ -0,0 +1,156 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// schemaRegistryContentType Confluent Schema Registry 的请求类型
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistry Confluent 兼容的 Schema Registry 客户端
+// 注册结果按主题和 schema 内容缓存，相同的 schema 只请求一次
+type SchemaRegistry struct {
+	baseURL      string
+	username     string
+	password     string
+	autoRegister bool
+	client       *http.Client
+
+	mu  sync.Mutex
+	ids map[string]int
+}
+
+// schemaRequest 注册和查找 schema 的请求体，AVRO 类型省略 schemaType
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// schemaResponse 注册中心返回的 schema ID
+type schemaResponse struct {
+	ID int `json:"id"`
+}
+
+// schemaRegistryError 注册中心返回的错误
+type schemaRegistryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// NewSchemaRegistry 创建 Schema Registry 客户端
+func NewSchemaRegistry(cfg *types.SchemaRegistryConfig) *SchemaRegistry {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &SchemaRegistry{
+		baseURL:      strings.TrimRight(cfg.URL, "/"),
+		username:     cfg.Username,
+		password:     cfg.Password,
+		autoRegister: cfg.AutoRegister == nil || *cfg.AutoRegister,
+		client:       &http.Client{Timeout: timeout},
+		ids:          make(map[string]int),
+	}
+}
+
+// SchemaID 返回 schema 在主题下的ID，开启自动注册时注册新版本，否则只查找已有版本
+// 注册中心不可用、主题或 schema 尚未注册、兼容性检查未通过等错误均为可重试的 DeliveryError，
+// 事件按重试策略等待注册中心恢复或 schema 被注册；只有注册中心判定 schema 本身不合法时为永久失败
+func (r *SchemaRegistry) SchemaID(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	cacheKey := subject + "\x00" + schema
+	r.mu.Lock()
+	id, ok := r.ids[cacheKey]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	// 注册已存在的 schema 时注册中心返回已有的ID，因此两种方式都是幂等的
+	path := "/subjects/" + url.PathEscape(subject)
+	if r.autoRegister {
+		path += "/versions"
+	}
+
+	id, err := r.post(ctx, path, &schemaRequest{Schema: schema, SchemaType: schemaType})
+	if err != nil {
+		var deliveryErr *DeliveryError
+		if !errors.As(err, &deliveryErr) {
+			deliveryErr = &DeliveryError{Err: err}
+		}
+		deliveryErr.Err = fmt.Errorf("schema registry subject %s: %w", subject, deliveryErr.Err)
+		return 0, deliveryErr
+	}
+
+	r.mu.Lock()
+	r.ids[cacheKey] = id
+	r.mu.Unlock()
+
+	log.Info("Schema resolved from registry",
+		log.String("subject", subject),
+		log.String("schema_type", schemaType),
+		log.Int("schema_id", id))
+	return id, nil
+}
+
+// post 发送请求并解析返回的 schema ID
+func (r *SchemaRegistry) post(ctx context.Context, path string, body *schemaRequest) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("status %d", resp.StatusCode)
+		var regErr schemaRegistryError
+		if json.Unmarshal(respBody, &regErr) == nil && regErr.Message != "" {
+			err = fmt.Errorf("status %d, error code %d: %s", resp.StatusCode, regErr.ErrorCode, regErr.Message)
+		}
+		// 422 表示 schema 不合法，重试也不会成功
+		return 0, &DeliveryError{
+			Err:        err,
+			Permanent:  resp.StatusCode == http.StatusUnprocessableEntity,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	var result schemaResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return result.ID, nil
+}
@@ -0,0 +1,205 @@
+package dispatcher
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// fakeRegistry 模拟 Schema Registry，reply 决定每个请求的响应
+type fakeRegistry struct {
+	*httptest.Server
+	requests atomic.Int32
+
+	mu    sync.Mutex
+	reply func(w http.ResponseWriter, r *http.Request)
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+	registry := &fakeRegistry{}
+	registry.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.requests.Add(1)
+		registry.mu.Lock()
+		reply := registry.reply
+		registry.mu.Unlock()
+		reply(w, r)
+	}))
+	t.Cleanup(registry.Close)
+	registry.respond(http.StatusOK, `{"id": 7}`)
+	return registry
+}
+
+// respond 设置固定的响应
+func (r *fakeRegistry) respond(status int, body string) {
+	r.setReply(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", schemaRegistryContentType)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	})
+}
+
+func (r *fakeRegistry) setReply(reply func(w http.ResponseWriter, r *http.Request)) {
+	r.mu.Lock()
+	r.reply = reply
+	r.mu.Unlock()
+}
+
+// schemaEvent 构造带表结构的事件，table 不同时使用不同的表结构
+func schemaEvent(t *testing.T, table string, id int64) *types.ChangeEvent {
+	event := testEvent(table, id)
+	event.Table = table
+	event.Schema = testTableSchema(t, "id BIGINT", "name VARCHAR(64)")
+	return event
+}
+
+func TestBinaryFormatterRegistryErrors(t *testing.T) {
+	registry := newFakeRegistry(t)
+	autoRegister := false
+	formatter, err := newBinaryFormatter(&types.Task{
+		Format:         types.FormatAvro,
+		SchemaRegistry: &types.SchemaRegistryConfig{URL: registry.URL, AutoRegister: &autoRegister},
+	}, avroCodec{})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	event := schemaEvent(t, "users", 1)
+
+	for _, tc := range []struct {
+		name      string
+		status    int
+		body      string
+		permanent bool
+	}{
+		{"registry unavailable", http.StatusServiceUnavailable, "", false},
+		{"subject not found", http.StatusNotFound, `{"error_code": 40401, "message": "Subject 'app.users-value' not found."}`, false},
+		{"incompatible schema", http.StatusConflict, `{"error_code": 409, "message": "Schema being registered is incompatible"}`, false},
+		{"invalid schema", http.StatusUnprocessableEntity, `{"error_code": 42201, "message": "Invalid schema"}`, true},
+	} {
+		registry.respond(tc.status, tc.body)
+		_, err := formatter.Format(event)
+		var deliveryErr *DeliveryError
+		if !errors.As(err, &deliveryErr) {
+			t.Fatalf("%s: error = %v, want a DeliveryError", tc.name, err)
+		}
+		if deliveryErr.Permanent != tc.permanent {
+			t.Fatalf("%s: permanent = %v, want %v (%v)", tc.name, deliveryErr.Permanent, tc.permanent, err)
+		}
+	}
+
+	// 注册中心恢复后得到带 schema ID 的 Confluent 线格式，之后的事件使用缓存
+	registry.respond(http.StatusOK, `{"id": 7}`)
+	encoded, err := formatter.Format(event)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	if encoded.Body[0] != 0 || binary.BigEndian.Uint32(encoded.Body[1:5]) != 7 {
+		t.Fatalf("wire header = %x, want magic byte 0 and schema id 7", encoded.Body[:5])
+	}
+	// 重新加载的表结构会重新推导，内容相同的 schema 命中注册中心客户端的缓存
+	requests := registry.requests.Load()
+	if _, err := formatter.Format(schemaEvent(t, "users", 2)); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	if got := registry.requests.Load(); got != requests {
+		t.Fatalf("registry requests = %d after an unchanged schema, want %d", got, requests)
+	}
+}
+
+func TestBinaryFormatterDoesNotBlockOnRegistry(t *testing.T) {
+	registry := newFakeRegistry(t)
+	formatter, err := newBinaryFormatter(&types.Task{
+		Format:         types.FormatProtobuf,
+		SchemaRegistry: &types.SchemaRegistryConfig{URL: registry.URL},
+	}, protobufCodec{})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	users := schemaEvent(t, "users", 1)
+	if _, err := formatter.Format(users); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	// orders 的注册请求挂起期间，已缓存 schema 的 users 仍可编码
+	release := make(chan struct{})
+	defer close(release)
+	registry.setReply(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"id": 8}`)
+	})
+	go formatter.Format(schemaEvent(t, "orders", 1))
+	waitFor(t, "the orders registration request", func() bool { return registry.requests.Load() == 2 })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := formatter.Format(users)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Format() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Format() blocked behind a pending registry request")
+	}
+}
+
+func TestRegistryOutageRetriesDelivery(t *testing.T) {
+	registry := newFakeRegistry(t)
+	var failures atomic.Int32
+	registry.setReply(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次请求时注册中心不可用
+		if failures.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id": 3}`)
+	})
+
+	var mu sync.Mutex
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:         "users",
+		TableName:      "users",
+		Events:         []types.EventType{types.EventInsert},
+		CallbackURL:    receiver.URL + "/webhook",
+		Format:         types.FormatAvro,
+		SchemaRegistry: &types.SchemaRegistryConfig{URL: registry.URL},
+	})
+	_, events := startTestDispatcher(t, cfg)
+
+	events <- schemaEvent(t, "users", 1)
+	// 编码失败进入死信时不会投递，因此收到消息即说明事件经过了重试
+	waitFor(t, "delivery after the registry recovers", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bodies) == 1
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if id := binary.BigEndian.Uint32(bodies[0][1:5]); id != 3 {
+		t.Fatalf("schema id = %d, want 3", id)
+	}
+	if got := registry.requests.Load(); got != 3 {
+		t.Fatalf("registry requests = %d, want 3", got)
+	}
+}
@@ -0,0 +1,156 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pikachu/internal/response"
+	"pikachu/internal/types"
+)
+
+// Message 待投递的消息，由分发器构建后交给输出端
+type Message struct {
+	Task        *types.Task              // 所属任务
+	Event       *types.ChangeEvent       // 原始变更事件
+	Destination string                   // 投递目标名称，单目标任务为空
+	URL         string                   // 回调地址，占位符已展开（仅HTTP输出端使用）
+	Method      string                   // HTTP请求方法，为空时使用POST（仅HTTP输出端使用）
+	Compression *types.CompressionConfig // 请求体压缩配置，为nil时不压缩（仅HTTP输出端使用）
+	Validator   *response.Validator      // 2xx响应的响应体校验，为nil时不校验（仅HTTP输出端使用）
+	Body        []byte                   // 已编码的消息体
+	ContentType string                   // 消息体类型
+	Headers     map[string]string        // 附加的消息头
+	Timeout     time.Duration            // 任务级请求超时，为0时使用输出端默认值（仅HTTP输出端使用）
+}
+
+// Sink 事件输出端接口
+// Deliver 投递单条消息，返回错误时由分发器负责重试；
+// DeliverBatch 批量投递，返回与 msgs 一一对应的错误列表（nil 表示成功）；
+// Close 释放输出端持有的连接等资源。
+type Sink interface {
+	Deliver(ctx context.Context, msg *Message) error
+	DeliverBatch(ctx context.Context, msgs []*Message) []error
+	Close() error
+}
+
+// httpClientKey HTTP输出端的客户端配置，TLS和代理配置都相同的投递目标共享同一个输出端
+type httpClientKey struct {
+	tls      types.TLSConfig
+	hasTLS   bool
+	proxy    types.ProxyConfig
+	hasProxy bool
+}
+
+// newSink 根据输出端配置创建输出端，tlsCfg 和 proxyCfg 为任务级或目标级的HTTP客户端配置，为nil时沿用全局配置
+// HTTP和标准输出输出端在所有任务间共享，客户端配置相同的HTTP输出端、写入同一路径的文件输出端也共享同一实例，
+// 其它输出端每个投递目标独立创建
+func (d *Dispatcher) newSink(cfg *types.SinkConfig, tlsCfg *types.TLSConfig, proxyCfg *types.ProxyConfig) (Sink, error) {
+	switch cfg.Type {
+	case "", types.SinkHTTP:
+		return d.httpSinkFor(tlsCfg, proxyCfg)
+	case types.SinkStdout:
+		return d.stdoutSink, nil
+	case types.SinkFile:
+		if cfg.File != nil {
+			if sink, ok := d.fileSinks[cfg.File.Path]; ok {
+				return sink, nil
+			}
+		}
+		sink, err := NewFileSink(cfg.File, d.metrics)
+		if err != nil {
+			return nil, err
+		}
+		d.fileSinks[cfg.File.Path] = sink
+		return sink, nil
+	case types.SinkKafka:
+		return NewKafkaSink(cfg.Kafka, d.metrics)
+	case types.SinkNATS:
+		return NewNATSSink(cfg.NATS, d.metrics)
+	case types.SinkRedis:
+		return NewRedisSink(cfg.Redis, d.metrics)
+	case types.SinkGRPC:
+		return NewGRPCSink(cfg.GRPC, d.metrics)
+	default:
+		return nil, fmt.Errorf("unsupported sink type: %s", cfg.Type)
+	}
+}
+
+// httpSinkFor 返回使用指定TLS和代理配置的HTTP输出端，都沿用全局配置时返回共享的默认输出端
+func (d *Dispatcher) httpSinkFor(tlsCfg *types.TLSConfig, proxyCfg *types.ProxyConfig) (*HTTPSink, error) {
+	global := &d.config.Dispatcher
+	if tlsCfg == nil {
+		tlsCfg = global.TLS
+	}
+	if proxyCfg == nil {
+		proxyCfg = global.Proxy
+	}
+	if tlsCfg == global.TLS && proxyCfg == global.Proxy {
+		return d.httpSink, nil
+	}
+
+	var key httpClientKey
+	if tlsCfg != nil {
+		key.tls, key.hasTLS = *tlsCfg, true
+	}
+	if proxyCfg != nil {
+		key.proxy, key.hasProxy = *proxyCfg, true
+	}
+	if sink, ok := d.httpSinks[key]; ok {
+		return sink, nil
+	}
+
+	sink, err := NewHTTPSink(global, tlsCfg, proxyCfg, d.metrics)
+	if err != nil {
+		return nil, err
+	}
+	d.httpSinks[key] = sink
+	return sink, nil
+}
+
+// deliverEach 逐条投递消息，供不支持原生批量投递的输出端使用
+func deliverEach(ctx context.Context, sink Sink, msgs []*Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = sink.Deliver(ctx, msg)
+	}
+	return errs
+}
+
+// expandTemplate 展开主题/流名称模板中的占位符
+// 支持 {database} {table} {event} {task_id}
+func expandTemplate(tpl string, event *types.ChangeEvent) string {
+	if !strings.Contains(tpl, "{") {
+		return tpl
+	}
+	replacer := strings.NewReplacer(
+		"{database}", event.Database,
+		"{table}", event.Table,
+		"{event}", string(event.Event),
+		"{task_id}", event.TaskID,
+	)
+	return replacer.Replace(tpl)
+}
+
+// formatPrimaryKey 将主键值格式化为字符串，用作分区键或消息键
+// 复合主键序列化为JSON（键按字母排序，保证稳定）
+func formatPrimaryKey(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,565 @@
+package dispatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// errSpillFull 溢出文件已达到大小上限
+var errSpillFull = errors.New("spill file is full")
+
+// spillFile 溢出文件，按写入顺序保存溢出的回调任务（每行一条JSON记录）
+// 所有记录读出后清空文件；关闭时尚未投递的事件保留在文件中，进程重启后继续投递
+type spillFile struct {
+	path    string
+	maxSize int64
+
+	writer  *os.File
+	reader  *bufio.Reader
+	rfile   *os.File
+	size    int64 // 已写入的字节数
+	count   int   // 尚未读出的记录数
+	carried int   // 打开时文件中已有、尚未读出的记录数
+}
+
+// spillRecord 溢出文件中的一条记录
+// 行数据中的值带有类型标记，读回后与原始类型一致；表结构不落盘，读回时关联当前的表结构
+type spillRecord struct {
+	TaskID      string                 `json:"task_id"`
+	Destination string                 `json:"destination,omitempty"`
+	CallbackURL string                 `json:"callback_url"`
+	RetryCount  int                    `json:"retry_count"`
+	Event       types.EventType        `json:"event"`
+	Database    string                 `json:"database"`
+	Table       string                 `json:"table"`
+	PrimaryID   interface{}            `json:"primary_id"`
+	OldData     map[string]interface{} `json:"old_data,omitempty"`
+	NewData     map[string]interface{} `json:"new_data,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	EventTime   time.Time              `json:"event_time"`
+	LogName     string                 `json:"log_name"`
+	LogPos      uint32                 `json:"log_pos"`
+	GTID        string                 `json:"gtid,omitempty"`
+	TxnOffset   uint32                 `json:"txn_offset,omitempty"`
+	RowIndex    int                    `json:"row_index"`
+	SubIndex    int                    `json:"sub_index"`
+	PrimaryKeys []string               `json:"primary_keys,omitempty"`
+	Carried     bool                   `json:"carried,omitempty"` // 从启动时残留的记录恢复后再次写入
+}
+
+// openSpillFile 打开溢出文件，文件已存在时统计其中残留的记录数
+func openSpillFile(path string, maxSizeMB int) (*spillFile, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create spill directory: %w", err)
+		}
+	}
+
+	f := &spillFile{path: path, maxSize: int64(maxSizeMB) * 1024 * 1024}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	info, err := f.rfile.Stat()
+	if err != nil {
+		f.close(nil)
+		return nil, fmt.Errorf("failed to stat spill file: %w", err)
+	}
+	f.size = info.Size()
+
+	if f.size > 0 {
+		scanner := bufio.NewScanner(f.rfile)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			f.count++
+		}
+		f.carried = f.count
+		if err := scanner.Err(); err != nil {
+			f.close(nil)
+			return nil, fmt.Errorf("failed to scan spill file: %w", err)
+		}
+		if _, err := f.rfile.Seek(0, io.SeekStart); err != nil {
+			f.close(nil)
+			return nil, fmt.Errorf("failed to rewind spill file: %w", err)
+		}
+		f.reader.Reset(f.rfile)
+		log.Info("Recovered spilled events", log.String("path", path), log.Int("count", f.count))
+	}
+	return f, nil
+}
+
+// open 打开写入和读取两个句柄
+func (f *spillFile) open() error {
+	writer, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	rfile, err := os.Open(f.path)
+	if err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	f.writer = writer
+	f.rfile = rfile
+	f.reader = bufio.NewReaderSize(rfile, 64*1024)
+	return nil
+}
+
+// write 追加一条记录
+func (f *spillFile) write(callbackTask *types.CallbackTask) error {
+	line, err := json.Marshal(newSpillRecord(callbackTask))
+	if err != nil {
+		return fmt.Errorf("failed to encode spill record: %w", err)
+	}
+	line = append(line, '\n')
+
+	if f.size+int64(len(line)) > f.maxSize {
+		return errSpillFull
+	}
+	if _, err := f.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	f.size += int64(len(line))
+	f.count++
+	return nil
+}
+
+// read 按写入顺序读出最多 n 条记录，全部读完后清空文件
+func (f *spillFile) read(n int) ([]*spillRecord, error) {
+	var records []*spillRecord
+	for len(records) < n && f.count > 0 {
+		line, err := f.reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 进程异常退出时最后一行可能不完整
+			log.Warn("Spill file ended with an incomplete record", log.String("path", f.path), log.Int("missing", f.count))
+			f.count = 0
+			f.carried = 0
+			break
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to read spill file: %w", err)
+		}
+		f.count--
+		carried := f.carried > 0
+		if carried {
+			f.carried--
+		}
+
+		record := &spillRecord{}
+		if err := decodeSpillRecord(line, record); err != nil {
+			log.Error("Skipping corrupted spill record", log.String("path", f.path), zap.Error(err))
+			continue
+		}
+		record.Carried = record.Carried || carried
+		records = append(records, record)
+	}
+
+	if f.count == 0 {
+		if err := f.reset(); err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+// reset 清空已读完的文件
+func (f *spillFile) reset() error {
+	if err := f.writer.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spill file: %w", err)
+	}
+	if _, err := f.rfile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spill file: %w", err)
+	}
+	f.reader.Reset(f.rfile)
+	f.size = 0
+	return nil
+}
+
+// close 关闭文件，pending 为已读入内存但尚未投递的任务，写回文件头部后与未读的记录一起保留，
+// 重启后按原顺序继续投递；文件中没有记录时删除文件
+func (f *spillFile) close(pending []*types.CallbackTask) error {
+	if len(pending) == 0 {
+		f.rfile.Close()
+		err := f.writer.Close()
+		if f.count == 0 {
+			os.Remove(f.path)
+		}
+		return err
+	}
+
+	defer f.rfile.Close()
+	defer f.writer.Close()
+
+	written, err := f.rewrite(pending, nil)
+	if err != nil {
+		return err
+	}
+	f.count = written
+	log.Info("Persisted pending overflow events", log.String("path", f.path), log.Int("count", f.count))
+	return nil
+}
+
+// discard 关闭文件，只保留启动时残留的记录：pending 为从中恢复但尚未投递的任务，写回文件头部，
+// 其后是尚未读出的残留记录；本次运行写入的其余记录被丢弃，返回丢弃的数量。没有保留的记录时删除文件
+func (f *spillFile) discard(pending []*types.CallbackTask) (dropped int, err error) {
+	defer f.rfile.Close()
+	defer f.writer.Close()
+
+	carried := f.carried
+	written, err := f.rewrite(pending, func(line []byte) bool {
+		if carried > 0 {
+			carried--
+			return true
+		}
+		var record struct {
+			Carried bool `json:"carried"`
+		}
+		if json.Unmarshal(line, &record) == nil && record.Carried {
+			return true
+		}
+		dropped++
+		return false
+	})
+	if err != nil {
+		return dropped, err
+	}
+	f.count = written
+	if written == 0 {
+		os.Remove(f.path)
+		return dropped, nil
+	}
+	log.Info("Kept carried-over overflow events", log.String("path", f.path), log.Int("count", written))
+	return dropped, nil
+}
+
+// rewrite 将 pending 写入新文件头部，其后是尚未读出的记录中 keep 返回true的行（keep 为nil时全部保留），
+// 然后替换原文件，返回新文件中的记录数
+func (f *spillFile) rewrite(pending []*types.CallbackTask, keep func(line []byte) bool) (int, error) {
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	w := bufio.NewWriter(tmp)
+	for _, callbackTask := range pending {
+		line, err := json.Marshal(newSpillRecord(callbackTask))
+		if err != nil {
+			tmp.Close()
+			return 0, fmt.Errorf("failed to encode spill record: %w", err)
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	written := len(pending)
+
+	if keep == nil {
+		if _, err := f.reader.WriteTo(w); err != nil {
+			tmp.Close()
+			return 0, fmt.Errorf("failed to copy spill file: %w", err)
+		}
+		written += f.count
+	} else {
+		for f.count > 0 {
+			line, err := f.reader.ReadBytes('\n')
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				tmp.Close()
+				return 0, fmt.Errorf("failed to copy spill file: %w", err)
+			}
+			f.count--
+			if keep(line) {
+				w.Write(line)
+				written++
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return 0, fmt.Errorf("failed to replace spill file: %w", err)
+	}
+	return written, nil
+}
+
+// newSpillRecord 将回调任务转换为溢出记录
+func newSpillRecord(callbackTask *types.CallbackTask) *spillRecord {
+	event := callbackTask.Event
+	return &spillRecord{
+		TaskID:      event.TaskID,
+		Destination: callbackTask.Destination,
+		CallbackURL: callbackTask.CallbackURL,
+		RetryCount:  callbackTask.RetryCount,
+		Event:       event.Event,
+		Database:    event.Database,
+		Table:       event.Table,
+		PrimaryID:   encodeSpillValue(event.PrimaryID),
+		OldData:     encodeSpillRow(event.OldData),
+		NewData:     encodeSpillRow(event.NewData),
+		Timestamp:   event.Timestamp,
+		EventTime:   event.EventTime,
+		LogName:     event.LogName,
+		LogPos:      event.LogPos,
+		GTID:        event.GTID,
+		TxnOffset:   event.TxnOffset,
+		RowIndex:    event.RowIndex,
+		SubIndex:    event.SubIndex,
+		PrimaryKeys: event.PrimaryKeys,
+		Carried:     callbackTask.Carried,
+	}
+}
+
+// event 将溢出记录还原为变更事件
+func (r *spillRecord) event() *types.ChangeEvent {
+	return &types.ChangeEvent{
+		TaskID:      r.TaskID,
+		Event:       r.Event,
+		Database:    r.Database,
+		Table:       r.Table,
+		PrimaryID:   r.PrimaryID,
+		OldData:     rowOf(r.OldData),
+		NewData:     rowOf(r.NewData),
+		Timestamp:   r.Timestamp,
+		EventTime:   r.EventTime,
+		LogName:     r.LogName,
+		LogPos:      r.LogPos,
+		GTID:        r.GTID,
+		TxnOffset:   r.TxnOffset,
+		RowIndex:    r.RowIndex,
+		SubIndex:    r.SubIndex,
+		PrimaryKeys: r.PrimaryKeys,
+	}
+}
+
+// rowOf 空行数据还原为nil，与原事件保持一致
+func rowOf(row map[string]interface{}) map[string]interface{} {
+	if len(row) == 0 {
+		return nil
+	}
+	return row
+}
+
+// decodeSpillRecord 解码一行溢出记录并还原带类型标记的值
+func decodeSpillRecord(line []byte, record *spillRecord) error {
+	var raw struct {
+		spillRecord
+		PrimaryID json.RawMessage            `json:"primary_id"`
+		OldData   map[string]json.RawMessage `json:"old_data"`
+		NewData   map[string]json.RawMessage `json:"new_data"`
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return err
+	}
+	*record = raw.spillRecord
+
+	var err error
+	if record.PrimaryID, err = decodeSpillValue(raw.PrimaryID); err != nil {
+		return fmt.Errorf("primary_id: %w", err)
+	}
+	if record.OldData, err = decodeSpillRow(raw.OldData); err != nil {
+		return fmt.Errorf("old_data: %w", err)
+	}
+	if record.NewData, err = decodeSpillRow(raw.NewData); err != nil {
+		return fmt.Errorf("new_data: %w", err)
+	}
+	return nil
+}
+
+// encodeSpillRow 为行数据中的每个值加上类型标记
+func encodeSpillRow(row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	encoded := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		encoded[column] = encodeSpillValue(value)
+	}
+	return encoded
+}
+
+// decodeSpillRow 还原行数据
+func decodeSpillRow(raw map[string]json.RawMessage) (map[string]interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	row := make(map[string]interface{}, len(raw))
+	for column, value := range raw {
+		decoded, err := decodeSpillValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column, err)
+		}
+		row[column] = decoded
+	}
+	return row, nil
+}
+
+// encodeSpillValue 将值编码为 [类型, 值] 的形式，JSON 无法区分的类型（整数宽度、字节串、时间）读回后保持不变
+func encodeSpillValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		return []interface{}{"bool", v}
+	case int:
+		return []interface{}{"int", strconv.FormatInt(int64(v), 10)}
+	case int8:
+		return []interface{}{"int8", strconv.FormatInt(int64(v), 10)}
+	case int16:
+		return []interface{}{"int16", strconv.FormatInt(int64(v), 10)}
+	case int32:
+		return []interface{}{"int32", strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return []interface{}{"int64", strconv.FormatInt(v, 10)}
+	case uint:
+		return []interface{}{"uint", strconv.FormatUint(uint64(v), 10)}
+	case uint8:
+		return []interface{}{"uint8", strconv.FormatUint(uint64(v), 10)}
+	case uint16:
+		return []interface{}{"uint16", strconv.FormatUint(uint64(v), 10)}
+	case uint32:
+		return []interface{}{"uint32", strconv.FormatUint(uint64(v), 10)}
+	case uint64:
+		return []interface{}{"uint64", strconv.FormatUint(v, 10)}
+	case float32:
+		return []interface{}{"float32", strconv.FormatFloat(float64(v), 'g', -1, 32)}
+	case float64:
+		return []interface{}{"float64", strconv.FormatFloat(v, 'g', -1, 64)}
+	case string:
+		return []interface{}{"string", v}
+	case []byte:
+		return []interface{}{"bytes", base64.StdEncoding.EncodeToString(v)}
+	case json.Number:
+		return []interface{}{"number", v.String()}
+	case time.Time:
+		return []interface{}{"time", v.Format(time.RFC3339Nano)}
+	case map[string]interface{}:
+		return []interface{}{"map", encodeSpillRow(v)}
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = encodeSpillValue(item)
+		}
+		return []interface{}{"array", items}
+	default:
+		return []interface{}{"string", fmt.Sprint(v)}
+	}
+}
+
+// decodeSpillValue 还原 encodeSpillValue 编码的值
+func decodeSpillValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var tagged []json.RawMessage
+	if err := json.Unmarshal(raw, &tagged); err != nil {
+		return nil, err
+	}
+	if len(tagged) != 2 {
+		return nil, fmt.Errorf("invalid tagged value: %s", raw)
+	}
+	var kind string
+	if err := json.Unmarshal(tagged[0], &kind); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "bool":
+		var v bool
+		err := json.Unmarshal(tagged[1], &v)
+		return v, err
+	case "map":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(tagged[1], &fields); err != nil {
+			return nil, err
+		}
+		return decodeSpillRow(fields)
+	case "array":
+		var items []json.RawMessage
+		if err := json.Unmarshal(tagged[1], &items); err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := decodeSpillValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(tagged[1], &s); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "int":
+		n, err := strconv.ParseInt(s, 10, 0)
+		return int(n), err
+	case "int8":
+		n, err := strconv.ParseInt(s, 10, 8)
+		return int8(n), err
+	case "int16":
+		n, err := strconv.ParseInt(s, 10, 16)
+		return int16(n), err
+	case "int32":
+		n, err := strconv.ParseInt(s, 10, 32)
+		return int32(n), err
+	case "int64":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint":
+		n, err := strconv.ParseUint(s, 10, 0)
+		return uint(n), err
+	case "uint8":
+		n, err := strconv.ParseUint(s, 10, 8)
+		return uint8(n), err
+	case "uint16":
+		n, err := strconv.ParseUint(s, 10, 16)
+		return uint16(n), err
+	case "uint32":
+		n, err := strconv.ParseUint(s, 10, 32)
+		return uint32(n), err
+	case "uint64":
+		return strconv.ParseUint(s, 10, 64)
+	case "float32":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case "float64":
+		return strconv.ParseFloat(s, 64)
+	case "string":
+		return s, nil
+	case "bytes":
+		return base64.StdEncoding.DecodeString(s)
+	case "number":
+		return json.Number(s), nil
+	case "time":
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return nil, fmt.Errorf("unknown value type: %s", kind)
+	}
+}
@@ -0,0 +1,64 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"pikachu/internal/metrics"
+)
+
+// StdoutSink 将事件以NDJSON格式写到标准输出的输出端，便于接入 jq、Vector、Fluent Bit 等管道
+type StdoutSink struct {
+	mu      sync.Mutex
+	out     io.Writer
+	metrics *metrics.Metrics
+}
+
+// NewStdoutSink 创建标准输出输出端
+func NewStdoutSink(m *metrics.Metrics) *StdoutSink {
+	return &StdoutSink{
+		out:     os.Stdout,
+		metrics: m,
+	}
+}
+
+// Deliver 写出单条事件
+func (s *StdoutSink) Deliver(ctx context.Context, msg *Message) error {
+	return s.write(appendNDJSON(nil, msg.Body))
+}
+
+// DeliverBatch 将整批事件合并为一次写出
+func (s *StdoutSink) DeliverBatch(ctx context.Context, msgs []*Message) []error {
+	var buf []byte
+	for _, msg := range msgs {
+		buf = appendNDJSON(buf, msg.Body)
+	}
+
+	errs := make([]error, len(msgs))
+	if err := s.write(buf); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// write 加锁写出，保证多个工作协程的输出行不会交错
+func (s *StdoutSink) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.out.Write(data); err != nil {
+		s.metrics.RecordError("stdout_write", "dispatcher")
+		return fmt.Errorf("failed to write to stdout: %w", err)
+	}
+	return nil
+}
+
+// Close 标准输出无需关闭
+func (s *StdoutSink) Close() error {
+	return nil
+}
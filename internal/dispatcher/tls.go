@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// defaultTLSReloadInterval 检查证书文件是否修改的默认间隔
+const defaultTLSReloadInterval = 30 * time.Second
+
+// tlsVersions 配置中 min_version 对应的TLS版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// loadTLSConfig 读取证书文件并构建客户端TLS配置
+func loadTLSConfig(cfg *types.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported min_version: %s", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no valid certificates found in ca_file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsFiles 返回TLS配置引用的证书文件
+func tlsFiles(cfg *types.TLSConfig) []string {
+	var files []string
+	for _, path := range []string{cfg.CAFile, cfg.CertFile, cfg.KeyFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// tlsFilesVersion 根据证书文件的修改时间和大小生成版本标识，用于判断文件是否被修改
+func tlsFilesVersion(cfg *types.TLSConfig) (string, error) {
+	var b strings.Builder
+	for _, path := range tlsFiles(cfg) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,52 @@
+package dispatcher
+
+import (
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// handleEvent 执行任务的转换脚本，再将结果事件交给 processEvent
+func (d *Dispatcher) handleEvent(event *types.ChangeEvent) {
+	script, exists := d.transforms[event.TaskID]
+	if !exists {
+		d.processEvent(event)
+		return
+	}
+
+	events, err := script.Apply(event)
+	if err != nil {
+		d.metrics.IncrementScriptErrors(event.TaskID)
+		d.metrics.RecordError("transform_script", "dispatcher")
+
+		if d.taskMap[event.TaskID].Transform.OnError == types.TransformOnErrorDrop {
+			log.Error("Transform script failed, dropping event",
+				log.String("task_id", event.TaskID),
+				log.Any("primary_id", event.PrimaryID),
+				zap.Error(err))
+			d.metrics.IncrementEventsDropped()
+			d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "dropped")
+			return
+		}
+
+		log.Error("Transform script failed, delivering original event",
+			log.String("task_id", event.TaskID),
+			log.Any("primary_id", event.PrimaryID),
+			zap.Error(err))
+		d.processEvent(event)
+		return
+	}
+
+	if len(events) == 0 {
+		log.Debug("Event filtered by transform script",
+			log.String("task_id", event.TaskID),
+			log.Any("primary_id", event.PrimaryID))
+		d.metrics.RecordEventProcessed(event.TaskID, event.Table, string(event.Event), "filtered")
+		return
+	}
+
+	for _, transformed := range events {
+		d.processEvent(transformed)
+	}
+}
@@ -0,0 +1,42 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"pikachu/internal/types"
+)
+
+func TestTransformOnError(t *testing.T) {
+	for _, tc := range []struct {
+		onError string
+		want    int
+	}{
+		{types.TransformOnErrorPass, 1},
+		{types.TransformOnErrorDrop, 0},
+	} {
+		t.Run(tc.onError, func(t *testing.T) {
+			d, queue := newInlineDispatcher(t, types.Task{
+				TaskID:      "users",
+				TableName:   "users",
+				Events:      []types.EventType{types.EventInsert},
+				CallbackURL: "http://127.0.0.1:1/webhook",
+				Transform: &types.TransformConfig{
+					Script:  "function transform(event) { throw new Error('boom'); }",
+					OnError: tc.onError,
+				},
+			})
+
+			d.handleEvent(testEvent("users", 1))
+			events := emitted(queue)
+			if len(events) != tc.want {
+				t.Fatalf("delivered %d events, want %d", len(events), tc.want)
+			}
+			if tc.want > 0 && events[0].NewData["name"] != "alice" {
+				t.Fatalf("delivered %v, want the original event", events[0].NewData)
+			}
+			if errs := d.metrics.GetScriptErrors(); errs["users"] != 1 || len(errs) != 1 {
+				t.Fatalf("script errors = %v, want 1 for users", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"pikachu/internal/types"
+	"pikachu/internal/utils"
+)
+
+// unixSocketHostSuffix unix域套接字请求使用的虚拟主机名后缀
+// 套接字路径编码在主机名中，使连接池按套接字区分连接，拨号时再解码为套接字路径
+const unixSocketHostSuffix = ".unix-socket"
+
+// unixSocketHost 将套接字路径编码为虚拟主机名
+func unixSocketHost(socketPath string) string {
+	return hex.EncodeToString([]byte(socketPath)) + unixSocketHostSuffix
+}
+
+// unixSocketPath 从虚拟主机名解码套接字路径，不是unix域套接字主机时 ok 为false
+func unixSocketPath(host string) (string, bool) {
+	if !strings.HasSuffix(host, unixSocketHostSuffix) {
+		return "", false
+	}
+	path, err := hex.DecodeString(strings.TrimSuffix(host, unixSocketHostSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// requestTarget 返回实际请求的URL和 Host 请求头
+// unix:///path.sock:/webhook 格式的回调地址转换为虚拟主机上的HTTP请求，Host 请求头为 localhost
+func requestTarget(callbackURL string) (target, host string) {
+	socketPath, requestPath, ok := utils.ParseUnixSocketURL(callbackURL)
+	if !ok {
+		return callbackURL, ""
+	}
+	return "http://" + unixSocketHost(socketPath) + requestPath, "localhost"
+}
+
+// dialContext 建立连接，unix域套接字虚拟主机改为连接对应的套接字文件
+func dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			if socketPath, ok := unixSocketPath(host); ok {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// newDialer 创建拨号器，超时和保活设置与 http.DefaultTransport 相同
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+// proxyFunc 根据代理配置生成 http.Transport 的代理选择函数，未配置代理时返回nil
+// no_proxy 为空时读取 NO_PROXY 环境变量；localhost、回环地址和unix域套接字始终直连
+func proxyFunc(cfg *types.ProxyConfig) func(*http.Request) (*url.URL, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil
+	}
+
+	noProxy := cfg.NoProxy
+	if noProxy == "" {
+		noProxy = httpproxy.FromEnvironment().NoProxy
+	}
+	proxyForURL := (&httpproxy.Config{
+		HTTPProxy:  cfg.URL,
+		HTTPSProxy: cfg.URL,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		if _, ok := unixSocketPath(req.URL.Hostname()); ok {
+			return nil, nil
+		}
+		return proxyForURL(req.URL)
+	}
+}
@@ -0,0 +1,140 @@
+package dispatcher
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// startUnixServer 在临时目录的unix域套接字上启动HTTP服务
+func startUnixServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	// 套接字路径长度有限制，不使用较长的 t.TempDir()
+	dir, err := os.MkdirTemp("", "pikachu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "receiver.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on unix socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return socketPath
+}
+
+func TestUnixSocketCallbackHost(t *testing.T) {
+	type request struct{ host, uri string }
+	requests := make(chan request, 1)
+	socketPath := startUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- request{r.Host, r.RequestURI}
+	}))
+
+	cfg := newTestConfig(t, types.Task{
+		TaskID:      "users",
+		TableName:   "users",
+		Events:      []types.EventType{types.EventInsert},
+		CallbackURL: "/users/{id}?name={name}",
+	})
+	cfg.CallbackHost = "unix://" + socketPath
+	// 配置了代理时unix域套接字请求仍然直连
+	cfg.Dispatcher.Proxy = &types.ProxyConfig{URL: "http://127.0.0.1:1"}
+	_, events := startTestDispatcher(t, cfg)
+	events <- testEvent("users", 1)
+
+	var got request
+	select {
+	case got = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the request on the unix socket")
+	}
+	if got.host != "localhost" {
+		t.Fatalf("Host = %q, want localhost", got.host)
+	}
+	if got.uri != "/users/1?name=alice" {
+		t.Fatalf("request URI = %q, want /users/1?name=alice", got.uri)
+	}
+}
+
+func TestProxyFuncBypass(t *testing.T) {
+	t.Setenv("NO_PROXY", "env.example.com")
+	proxyURL := "http://proxy.example.com:3128"
+
+	for _, tc := range []struct {
+		name    string
+		noProxy string
+		target  string
+		proxied bool
+	}{
+		{name: "proxied", target: "http://api.example.com/hook", proxied: true},
+		{name: "https proxied", target: "https://api.example.com/hook", proxied: true},
+		{name: "NO_PROXY from environment", target: "http://env.example.com/hook"},
+		{name: "localhost", target: "http://localhost:8080/hook"},
+		{name: "loopback", target: "http://127.0.0.1:8080/hook"},
+		{name: "unix socket", target: "unix:///var/run/receiver.sock:/hook"},
+		{name: "no_proxy host", noProxy: "internal.example.com,.svc", target: "http://internal.example.com/hook"},
+		{name: "no_proxy domain suffix", noProxy: "internal.example.com,.svc", target: "http://receiver.default.svc/hook"},
+		{name: "no_proxy replaces environment", noProxy: "internal.example.com", target: "http://env.example.com/hook", proxied: true},
+		{name: "unix socket with no_proxy", noProxy: "internal.example.com", target: "unix:///var/run/receiver.sock:/hook"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy := proxyFunc(&types.ProxyConfig{URL: proxyURL, NoProxy: tc.noProxy})
+			target, host := requestTarget(tc.target)
+			req, err := http.NewRequest(http.MethodPost, target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host != "" {
+				req.Host = host
+			}
+			got, err := proxy(req)
+			if err != nil {
+				t.Fatalf("proxy() error = %v", err)
+			}
+			if tc.proxied {
+				if got == nil || got.String() != proxyURL {
+					t.Fatalf("proxy = %v, want %s", got, proxyURL)
+				}
+			} else if got != nil {
+				t.Fatalf("proxy = %v, want a direct connection", got)
+			}
+		})
+	}
+
+	if proxyFunc(nil) != nil || proxyFunc(&types.ProxyConfig{}) != nil {
+		t.Fatal("proxyFunc without a proxy URL should return nil")
+	}
+}
+
+func TestUnixSocketHostRoundTrip(t *testing.T) {
+	socketPath := "/var/run/app.sock"
+	target, host := requestTarget("unix://" + socketPath + ":/hook?a=1")
+	if host != "localhost" {
+		t.Fatalf("host = %q, want localhost", host)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := unixSocketPath(u.Hostname()); !ok || got != socketPath {
+		t.Fatalf("unixSocketPath(%q) = %q, %v, want %s", u.Hostname(), got, ok, socketPath)
+	}
+	if u.RequestURI() != "/hook?a=1" {
+		t.Fatalf("request URI = %q", u.RequestURI())
+	}
+	if _, ok := unixSocketPath("example.com"); ok {
+		t.Fatal("regular host decoded as a unix socket")
+	}
+}
@@ -0,0 +1,78 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"pikachu/internal/types"
+)
+
+// 实例角色
+const (
+	RoleLeader  = "leader"  // 主节点：读取 binlog 并投递
+	RoleStandby = "standby" // 备节点：等待主节点失效后接管
+)
+
+// Elector 选主实现
+//
+// 同一时刻最多只有一个实例持有主节点身份。实现需要在持有者失效（进程退出、连接断开、租约过期）后
+// 允许其他实例接管，并在本实例失去身份时及时通知调用方停止读取 binlog 和投递
+type Elector interface {
+	// Campaign 阻塞直到成为主节点或 ctx 结束；成为主节点后返回的通道在失去主节点身份时关闭
+	Campaign(ctx context.Context) (<-chan struct{}, error)
+	// Resign 放弃主节点身份，其他实例可以立即接管；未持有身份时不做任何事
+	Resign() error
+	// Close 释放资源
+	Close() error
+}
+
+// Factory 根据配置创建选主实现
+type Factory func(cfg *types.Config) (Elector, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{
+		types.ElectionMySQL: newMySQLElector,
+		types.ElectionFile:  newFileElector,
+	}
+)
+
+// Register 注册选主实现，用于接入 Kubernetes Lease 等外部实现；需在加载配置之前调用，同名实现会被替换
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// Registered 判断选主实现是否已注册
+func Registered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names 返回已注册的选主实现名称
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 按 election.type 创建选主实现
+func New(cfg *types.Config) (Elector, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[cfg.Election.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown election type: %s", cfg.Election.Type)
+	}
+	return factory(cfg)
+}
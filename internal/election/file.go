@@ -0,0 +1,274 @@
+package election
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// errLeaseLost 租约已被其他实例接管
+var errLeaseLost = errors.New("lease is held by another instance")
+
+// errLeaseBusy 其他实例正在修改租约文件
+var errLeaseBusy = errors.New("lease file is being updated by another instance")
+
+// lease 租约文件内容
+type lease struct {
+	Holder    string    `json:"holder"`     // 持有者的实例标识
+	ExpiresAt time.Time `json:"expires_at"` // 租约到期时间，到期后其他实例可以接管
+	RenewedAt time.Time `json:"renewed_at"`
+}
+
+// fileElector 基于共享存储上租约文件的选主实现
+//
+// 主节点按 renew_interval 延长租约，租约过期后其他实例即可接管；修改租约文件前先以 O_EXCL 创建锁文件，
+// 避免多个实例同时接管。各实例的时钟偏差需要远小于 lease_duration
+type fileElector struct {
+	path          string
+	id            string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{} // 关闭时停止续约，未持有时为nil
+	done chan struct{} // 续约协程退出时关闭
+}
+
+// newFileElector 创建基于租约文件的选主实现
+func newFileElector(cfg *types.Config) (Elector, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Election.LeasePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	return &fileElector{
+		path:          cfg.Election.LeasePath,
+		id:            cfg.Election.ID,
+		leaseDuration: cfg.Election.LeaseDuration,
+		renewInterval: cfg.Election.RenewInterval,
+	}, nil
+}
+
+// Campaign 每隔 renew_interval 尝试获得租约，直到成功或 ctx 结束
+func (e *fileElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	waiting := false
+	for {
+		holder, err := e.tryAcquire()
+		if err == nil && holder == e.id {
+			log.Info("Acquired leader lease", log.String("path", e.path), log.String("id", e.id))
+			return e.hold(), nil
+		}
+
+		switch {
+		case err != nil && !errors.Is(err, errLeaseBusy):
+			log.Warn("Failed to acquire leader lease", log.String("path", e.path), zap.Error(err))
+		case holder != "" && !waiting:
+			log.Info("Leader lease is held by another instance, waiting",
+				log.String("path", e.path), log.String("holder", holder), log.String("id", e.id))
+			waiting = true
+		}
+
+		select {
+		case <-time.After(e.renewInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire 租约不存在、已过期或属于本实例时写入新租约，返回当前持有者
+func (e *fileElector) tryAcquire() (string, error) {
+	unlock, err := e.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	current, err := e.read()
+	if err != nil {
+		return "", err
+	}
+	if current != nil && current.Holder != e.id && time.Now().Before(current.ExpiresAt) {
+		return current.Holder, nil
+	}
+	if err := e.write(); err != nil {
+		return "", err
+	}
+	return e.id, nil
+}
+
+// hold 开始续约，返回失去身份时关闭的通道
+func (e *fileElector) hold() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	lost := make(chan struct{})
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.renewLoop(e.stop, e.done, lost)
+	return lost
+}
+
+// renewLoop 定期续约；租约被接管，或续约持续失败到租约即将过期时视为失去身份
+func (e *fileElector) renewLoop(stop, done, lost chan struct{}) {
+	defer close(done)
+
+	renewed := time.Now()
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := e.renew()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if errors.Is(err, errLeaseLost) {
+			log.Error("Leader lease was taken over by another instance", log.String("path", e.path))
+			close(lost)
+			return
+		}
+
+		// 在租约到期前留出一个续约间隔，保证其他实例接管时本实例已经停止
+		if time.Since(renewed) >= e.leaseDuration-e.renewInterval {
+			log.Error("Failed to renew leader lease before expiry, giving up leadership",
+				log.String("path", e.path), zap.Error(err))
+			close(lost)
+			return
+		}
+		log.Warn("Failed to renew leader lease", log.String("path", e.path), zap.Error(err))
+	}
+}
+
+// renew 延长本实例持有的租约
+func (e *fileElector) renew() error {
+	unlock, err := e.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := e.read()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Holder != e.id {
+		return errLeaseLost
+	}
+	return e.write()
+}
+
+// Resign 停止续约并删除本实例持有的租约
+func (e *fileElector) Resign() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop == nil {
+		return nil
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+
+	unlock, err := e.lock()
+	if err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	defer unlock()
+
+	current, err := e.read()
+	if err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	if current == nil || current.Holder != e.id {
+		return nil
+	}
+	if err := os.Remove(e.path); err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	log.Info("Released leader lease", log.String("path", e.path))
+	return nil
+}
+
+// Close 释放租约
+func (e *fileElector) Close() error {
+	return e.Resign()
+}
+
+// lock 创建锁文件，返回删除锁文件的函数；锁文件存在超过 lease_duration 时视为持有者已退出，予以清除
+func (e *fileElector) lock() (func(), error) {
+	lockPath := e.path + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.WriteString(e.id)
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lease lock: %w", err)
+		}
+
+		info, err := os.Stat(lockPath)
+		if err != nil || time.Since(info.ModTime()) < e.leaseDuration {
+			return nil, errLeaseBusy
+		}
+		log.Warn("Removing stale lease lock", log.String("path", lockPath))
+		os.Remove(lockPath)
+	}
+	return nil, errLeaseBusy
+}
+
+// read 读取租约文件，文件不存在时返回nil
+func (e *fileElector) read() (*lease, error) {
+	data, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease: %w", err)
+	}
+
+	var current lease
+	if err := json.Unmarshal(data, &current); err != nil {
+		// 写入中途退出留下的损坏文件按无人持有处理
+		log.Warn("Ignoring corrupted lease file", log.String("path", e.path), zap.Error(err))
+		return nil, nil
+	}
+	return &current, nil
+}
+
+// write 写入本实例持有的租约，先写临时文件再重命名
+func (e *fileElector) write() error {
+	now := time.Now()
+	data, err := json.MarshalIndent(lease{
+		Holder:    e.id,
+		ExpiresAt: now.Add(e.leaseDuration),
+		RenewedAt: now,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lease: %w", err)
+	}
+
+	tmpPath := e.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	if err := os.Rename(tmpPath, e.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace lease: %w", err)
+	}
+	return nil
+}
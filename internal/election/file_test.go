@@ -0,0 +1,193 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.Init(&types.LogConfig{Level: types.LogLevelError, Format: "text"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+const (
+	testLeaseDuration = 200 * time.Millisecond
+	testRenewInterval = 20 * time.Millisecond
+)
+
+// newTestFileElector 创建使用 path 作为租约文件的选主实现，测试结束时放弃身份
+func newTestFileElector(t *testing.T, path, id string) *fileElector {
+	t.Helper()
+	cfg := &types.Config{}
+	cfg.Election.LeasePath = path
+	cfg.Election.ID = id
+	cfg.Election.LeaseDuration = testLeaseDuration
+	cfg.Election.RenewInterval = testRenewInterval
+	elector, err := newFileElector(cfg)
+	if err != nil {
+		t.Fatalf("failed to create elector: %v", err)
+	}
+	t.Cleanup(func() { elector.Close() })
+	return elector.(*fileElector)
+}
+
+// campaign 在 timeout 内参与选举
+func campaign(e *fileElector, timeout time.Duration) (<-chan struct{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return e.Campaign(ctx)
+}
+
+// holderOf 返回租约文件中的持有者，文件不存在时返回空字符串
+func holderOf(t *testing.T, e *fileElector) string {
+	t.Helper()
+	current, err := e.read()
+	if err != nil {
+		t.Fatalf("failed to read lease: %v", err)
+	}
+	if current == nil {
+		return ""
+	}
+	return current.Holder
+}
+
+// crash 停止续约但不删除租约文件，模拟持有者异常退出
+func crash(e *fileElector) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+}
+
+func TestFileElectorAcquiresFreeLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	a := newTestFileElector(t, path, "a")
+
+	if _, err := campaign(a, time.Second); err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	if holder := holderOf(t, a); holder != "a" {
+		t.Fatalf("holder = %q, want a", holder)
+	}
+}
+
+func TestFileElectorStandbyWaitsAndTakesOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	a := newTestFileElector(t, path, "a")
+	b := newTestFileElector(t, path, "b")
+	if _, err := campaign(a, time.Second); err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+
+	// a 持续续约时 b 一直等待
+	if _, err := campaign(b, 2*testLeaseDuration); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Campaign() while the lease is held error = %v, want deadline exceeded", err)
+	}
+
+	// a 停止续约后，b 在租约过期后接管
+	crash(a)
+	crashed := time.Now()
+	if _, err := campaign(b, 5*testLeaseDuration); err != nil {
+		t.Fatalf("Campaign() after the holder stopped error = %v", err)
+	}
+	if elapsed := time.Since(crashed); elapsed < testLeaseDuration-2*testRenewInterval {
+		t.Fatalf("took over after %v, before the lease of %v expired", elapsed, testLeaseDuration)
+	}
+	if holder := holderOf(t, b); holder != "b" {
+		t.Fatalf("holder = %q, want b", holder)
+	}
+}
+
+func TestFileElectorRemovesStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	a := newTestFileElector(t, path, "a")
+	lockPath := path + ".lock"
+
+	// 刚创建的锁文件属于正在修改租约的实例
+	if err := os.WriteFile(lockPath, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.lock(); !errors.Is(err, errLeaseBusy) {
+		t.Fatalf("lock() with a fresh lock file error = %v, want errLeaseBusy", err)
+	}
+
+	// 超过 lease_duration 的锁文件是退出的实例留下的
+	old := time.Now().Add(-2 * testLeaseDuration)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := a.lock()
+	if err != nil {
+		t.Fatalf("lock() with a stale lock file error = %v", err)
+	}
+	if data, _ := os.ReadFile(lockPath); string(data) != "a" {
+		t.Fatalf("lock file content = %q, want a", data)
+	}
+	unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("lock file still exists after unlock: %v", err)
+	}
+}
+
+func TestFileElectorDetectsTakeover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	a := newTestFileElector(t, path, "a")
+	b := newTestFileElector(t, path, "b")
+	lost, err := campaign(a, time.Second)
+	if err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+
+	// 其他实例改写了租约的持有者
+	if err := b.write(); err != nil {
+		t.Fatalf("failed to write lease: %v", err)
+	}
+	if err := a.renew(); !errors.Is(err, errLeaseLost) {
+		t.Fatalf("renew() error = %v, want errLeaseLost", err)
+	}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("lost channel was not closed after the lease was taken over")
+	}
+}
+
+func TestFileElectorResignRemovesOwnLeaseOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	a := newTestFileElector(t, path, "a")
+	b := newTestFileElector(t, path, "b")
+
+	if _, err := campaign(a, time.Second); err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	if err := a.Resign(); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lease file still exists after the holder resigned: %v", err)
+	}
+
+	// 租约已被 b 接管时，a 放弃身份不能删除 b 的租约
+	if _, err := campaign(a, time.Second); err != nil {
+		t.Fatalf("Campaign() error = %v", err)
+	}
+	if err := b.write(); err != nil {
+		t.Fatalf("failed to write lease: %v", err)
+	}
+	if err := a.Resign(); err != nil {
+		t.Fatalf("Resign() error = %v", err)
+	}
+	if holder := holderOf(t, a); holder != "b" {
+		t.Fatalf("holder after resign = %q, want b", holder)
+	}
+}
@@ -0,0 +1,181 @@
+package election
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// mysqlElector 基于 MySQL GET_LOCK 的选主实现
+//
+// 主节点在一个专用连接上持有命名锁，锁随连接断开自动释放，备节点随后即可获得锁。
+// 主节点按 renew_interval 检查锁是否仍由自己的连接持有，检查失败（连接断开、锁被释放）即视为失去身份
+type mysqlElector struct {
+	db            *sql.DB
+	id            string
+	lockName      string
+	renewInterval time.Duration
+
+	mu   sync.Mutex
+	conn *sql.Conn     // 持有锁的连接，未持有时为nil
+	stop chan struct{} // 关闭时停止检查
+	done chan struct{} // 检查协程退出时关闭
+}
+
+// newMySQLElector 创建基于 GET_LOCK 的选主实现，使用 database 配置连接
+func newMySQLElector(cfg *types.Config) (Elector, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s",
+		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port,
+		cfg.Database.Database, cfg.Database.Charset)
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	// 不保留空闲连接：释放锁失败的连接关闭后会话结束，锁随之释放
+	db.SetMaxIdleConns(0)
+
+	return &mysqlElector{
+		db:            db,
+		id:            cfg.Election.ID,
+		lockName:      cfg.Election.LockName,
+		renewInterval: cfg.Election.RenewInterval,
+	}, nil
+}
+
+// Campaign 阻塞等待获得锁，每次最多等待 renew_interval，数据库不可用时稍后重试
+func (e *mysqlElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	wait := int(e.renewInterval / time.Second)
+	if wait < 1 {
+		wait = 1
+	}
+
+	waiting := false
+	for {
+		conn, err := e.tryLock(ctx, wait)
+		if conn != nil {
+			log.Info("Acquired leader lock", log.String("lock_name", e.lockName), log.String("id", e.id))
+			return e.hold(conn), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			log.Warn("Failed to acquire leader lock", log.String("lock_name", e.lockName), zap.Error(err))
+			select {
+			case <-time.After(e.renewInterval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else if !waiting {
+			log.Info("Leader lock is held by another instance, waiting",
+				log.String("lock_name", e.lockName), log.String("id", e.id))
+			waiting = true
+		}
+	}
+}
+
+// tryLock 在新连接上尝试获得锁，最多等待 wait 秒；未获得时返回nil连接
+func (e *mysqlElector) tryLock(ctx context.Context, wait int) (*sql.Conn, error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", e.lockName, wait).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// hold 记录持有锁的连接并开始检查，返回失去身份时关闭的通道
+func (e *mysqlElector) hold(conn *sql.Conn) <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	lost := make(chan struct{})
+	e.conn = conn
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.watch(conn, e.stop, e.done, lost)
+	return lost
+}
+
+// watch 定期检查锁是否仍由本连接持有
+func (e *mysqlElector) watch(conn *sql.Conn, stop, done, lost chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.renewInterval)
+		var held sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", e.lockName).Scan(&held)
+		cancel()
+		if err == nil && held.Valid && held.Int64 == 1 {
+			continue
+		}
+
+		if err != nil {
+			log.Error("Failed to check leader lock, giving up leadership",
+				log.String("lock_name", e.lockName), zap.Error(err))
+		} else {
+			log.Error("Leader lock is no longer held by this instance", log.String("lock_name", e.lockName))
+		}
+		close(lost)
+		return
+	}
+}
+
+// Resign 停止检查并释放锁；释放失败时关闭连接，会话结束后锁同样会被释放
+func (e *mysqlElector) Resign() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+
+	close(e.stop)
+	<-e.done
+	conn := e.conn
+	e.conn = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.renewInterval)
+	defer cancel()
+	var released sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", e.lockName).Scan(&released)
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to release leader lock: %w", err)
+	}
+	log.Info("Released leader lock", log.String("lock_name", e.lockName))
+	return nil
+}
+
+// Close 释放锁并关闭数据库连接
+func (e *mysqlElector) Close() error {
+	err := e.Resign()
+	e.db.Close()
+	return err
+}
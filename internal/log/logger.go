@@ -80,7 +80,7 @@ func Init(config *types.LogConfig) error {
 			Development:      false,
 			Encoding:         "console",
 			EncoderConfig:    encoderConfig,
-			OutputPaths:      []string{"stdout"},
+			OutputPaths:      []string{textOutput(config)},
 			ErrorOutputPaths: []string{"stderr"},
 		}
 	} else {
@@ -110,6 +110,15 @@ func Init(config *types.LogConfig) error {
 
 	return nil
 }
+
+// textOutput 返回 text 格式日志的输出位置
+func textOutput(config *types.LogConfig) string {
+	if config.Output == "" {
+		return "stdout"
+	}
+	return config.Output
+}
+
 func Close() {
 	logger.logger.Sync()
 }
@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Metrics 指标收集器
@@ -10,6 +12,26 @@ type Metrics struct {
 	eventsQueued  int64
 	eventsDropped int64
 	cacheSize     int64
+	circuitOpens  int64
+	deadLettered  int64
+	coalesced     int64 // 被合并掉的事件数
+
+	overflowPending int64 // 溢出队列中内存暂存的事件数
+	spilledPending  int64 // 溢出文件中等待投递的事件数
+
+	binlogLag          int64 // binlog 事件时间与读取时间的差值（纳秒）
+	backpressurePaused int32 // 是否因背压暂停读取 binlog
+	backpressurePauses int64 // 背压暂停次数
+	backpressureTime   int64 // 背压暂停的累计时长（纳秒）
+
+	circuitMu     sync.RWMutex
+	circuitStates map[string]string // 熔断器状态，按熔断器键索引
+
+	concurrencyMu     sync.RWMutex
+	concurrencyLimits map[string]int // 自适应并发上限，按任务ID索引
+
+	scriptErrorsMu sync.Mutex
+	scriptErrors   map[string]int64 // 转换脚本错误数，按任务ID索引
 }
 
 // NewMetrics 创建新的指标收集器
@@ -77,6 +99,16 @@ func (m *Metrics) IncrementEventsDropped() {
 	atomic.AddInt64(&m.eventsDropped, 1)
 }
 
+// IncrementScriptErrors 增加任务的转换脚本错误数
+func (m *Metrics) IncrementScriptErrors(taskID string) {
+	m.scriptErrorsMu.Lock()
+	defer m.scriptErrorsMu.Unlock()
+	if m.scriptErrors == nil {
+		m.scriptErrors = make(map[string]int64)
+	}
+	m.scriptErrors[taskID]++
+}
+
 // UpdateCacheSize 更新缓存大小
 func (m *Metrics) UpdateCacheSize(size int64) {
 	atomic.StoreInt64(&m.cacheSize, size)
@@ -96,3 +128,142 @@ func (m *Metrics) GetEventsDropped() int64 {
 func (m *Metrics) GetCacheSize() int64 {
 	return atomic.LoadInt64(&m.cacheSize)
 }
+
+// IncrementEventsCoalesced 增加被合并掉的事件数
+func (m *Metrics) IncrementEventsCoalesced() {
+	atomic.AddInt64(&m.coalesced, 1)
+}
+
+// GetEventsCoalesced 获取被合并掉的事件数
+func (m *Metrics) GetEventsCoalesced() int64 {
+	return atomic.LoadInt64(&m.coalesced)
+}
+
+// GetScriptErrors 获取所有任务转换脚本错误数的副本
+func (m *Metrics) GetScriptErrors() map[string]int64 {
+	m.scriptErrorsMu.Lock()
+	defer m.scriptErrorsMu.Unlock()
+	errors := make(map[string]int64, len(m.scriptErrors))
+	for taskID, count := range m.scriptErrors {
+		errors[taskID] = count
+	}
+	return errors
+}
+
+// SetCircuitState 更新熔断器状态
+func (m *Metrics) SetCircuitState(key, state string) {
+	m.circuitMu.Lock()
+	defer m.circuitMu.Unlock()
+	if m.circuitStates == nil {
+		m.circuitStates = make(map[string]string)
+	}
+	m.circuitStates[key] = state
+}
+
+// GetCircuitStates 获取所有熔断器状态的副本
+func (m *Metrics) GetCircuitStates() map[string]string {
+	m.circuitMu.RLock()
+	defer m.circuitMu.RUnlock()
+	states := make(map[string]string, len(m.circuitStates))
+	for key, state := range m.circuitStates {
+		states[key] = state
+	}
+	return states
+}
+
+// IncrementCircuitOpens 增加熔断次数
+func (m *Metrics) IncrementCircuitOpens() {
+	atomic.AddInt64(&m.circuitOpens, 1)
+}
+
+// GetCircuitOpens 获取熔断次数
+func (m *Metrics) GetCircuitOpens() int64 {
+	return atomic.LoadInt64(&m.circuitOpens)
+}
+
+// IncrementDeadLettered 增加死信数
+func (m *Metrics) IncrementDeadLettered() {
+	atomic.AddInt64(&m.deadLettered, 1)
+}
+
+// GetDeadLettered 获取死信数
+func (m *Metrics) GetDeadLettered() int64 {
+	return atomic.LoadInt64(&m.deadLettered)
+}
+
+// SetOverflowPending 更新溢出队列中等待投递的事件数
+func (m *Metrics) SetOverflowPending(inMemory, spilled int64) {
+	atomic.StoreInt64(&m.overflowPending, inMemory)
+	atomic.StoreInt64(&m.spilledPending, spilled)
+}
+
+// GetOverflowPending 获取溢出队列内存中暂存的事件数
+func (m *Metrics) GetOverflowPending() int64 {
+	return atomic.LoadInt64(&m.overflowPending)
+}
+
+// GetSpilledPending 获取溢出文件中等待投递的事件数
+func (m *Metrics) GetSpilledPending() int64 {
+	return atomic.LoadInt64(&m.spilledPending)
+}
+
+// SetConcurrencyLimit 更新任务当前的自适应并发上限
+func (m *Metrics) SetConcurrencyLimit(taskID string, limit int) {
+	m.concurrencyMu.Lock()
+	defer m.concurrencyMu.Unlock()
+	if m.concurrencyLimits == nil {
+		m.concurrencyLimits = make(map[string]int)
+	}
+	m.concurrencyLimits[taskID] = limit
+}
+
+// GetConcurrencyLimits 获取所有任务自适应并发上限的副本
+func (m *Metrics) GetConcurrencyLimits() map[string]int {
+	m.concurrencyMu.RLock()
+	defer m.concurrencyMu.RUnlock()
+	limits := make(map[string]int, len(m.concurrencyLimits))
+	for taskID, limit := range m.concurrencyLimits {
+		limits[taskID] = limit
+	}
+	return limits
+}
+
+// SetBinlogLag 更新 binlog 延迟
+func (m *Metrics) SetBinlogLag(lag time.Duration) {
+	if lag < 0 {
+		lag = 0
+	}
+	atomic.StoreInt64(&m.binlogLag, int64(lag))
+}
+
+// GetBinlogLag 获取 binlog 延迟
+func (m *Metrics) GetBinlogLag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.binlogLag))
+}
+
+// BackpressurePaused 记录因背压暂停读取 binlog
+func (m *Metrics) BackpressurePaused() {
+	atomic.StoreInt32(&m.backpressurePaused, 1)
+	atomic.AddInt64(&m.backpressurePauses, 1)
+}
+
+// BackpressureResumed 记录恢复读取 binlog 及本次暂停时长
+func (m *Metrics) BackpressureResumed(paused time.Duration) {
+	atomic.StoreInt32(&m.backpressurePaused, 0)
+	atomic.AddInt64(&m.backpressureTime, int64(paused))
+}
+
+// IsBackpressurePaused 是否正因背压暂停读取 binlog
+func (m *Metrics) IsBackpressurePaused() bool {
+	return atomic.LoadInt32(&m.backpressurePaused) == 1
+}
+
+// GetBackpressurePauses 获取背压暂停次数
+func (m *Metrics) GetBackpressurePauses() int64 {
+	return atomic.LoadInt64(&m.backpressurePauses)
+}
+
+// GetBackpressureTime 获取背压暂停的累计时长
+func (m *Metrics) GetBackpressureTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.backpressureTime))
+}
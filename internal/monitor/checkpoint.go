@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// checkpoint binlog 位点文件内容
+type checkpoint struct {
+	Name      string    `json:"name"`               // binlog 文件名
+	Pos       uint32    `json:"pos"`                // binlog 位置
+	GTIDSet   string    `json:"gtid_set,omitempty"` // 已同步的GTID集合，仅用于排查
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointStore 按任务保存位点的存储，集群模式下由协调表实现
+// 设置后代替 checkpoint_path 指定的位点文件
+type CheckpointStore interface {
+	// LoadCheckpoints 读取任务已保存的位点，没有保存过位点的任务不在结果中
+	LoadCheckpoints(taskIDs []string) (map[string]mysql.Position, error)
+	// SaveCheckpoint 将位点保存为各任务的位点，任务已不归本实例所有时不覆盖并返回错误
+	SaveCheckpoint(taskIDs []string, pos mysql.Position, gtidSet string) error
+}
+
+// SetCheckpointStore 设置按任务保存位点的存储，需在 Start 之前调用
+func (m *Monitor) SetCheckpointStore(store CheckpointStore) {
+	m.checkpoints = store
+}
+
+// loadTaskCheckpoints 从位点存储读取各任务的位点，返回其中最早的位点；没有任务保存过位点时返回nil
+// 任务的位点晚于开始位点时，记录下来并跳过该任务已经投递过的事件
+func (m *Monitor) loadTaskCheckpoints() (*mysql.Position, error) {
+	taskIDs := make([]string, 0, len(m.config.Tasks))
+	for _, task := range m.config.Tasks {
+		taskIDs = append(taskIDs, task.TaskID)
+	}
+	positions, err := m.checkpoints.LoadCheckpoints(taskIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var start *mysql.Position
+	for _, pos := range positions {
+		if start == nil || pos.Compare(*start) < 0 {
+			start = &pos
+		}
+	}
+	for taskID, pos := range positions {
+		if pos.Compare(*start) > 0 {
+			m.taskCheckpoints[taskID] = pos
+		}
+	}
+	return start, nil
+}
+
+// delivered 判断事件是否不晚于所属任务已保存的位点，即已经投递过
+func (m *Monitor) delivered(event *types.ChangeEvent) bool {
+	saved, ok := m.taskCheckpoints[event.TaskID]
+	return ok && mysql.Position{Name: event.LogName, Pos: event.LogPos}.Compare(saved) <= 0
+}
+
+// checkpointEnabled 判断是否配置了位点存储或位点文件
+func (m *Monitor) checkpointEnabled() bool {
+	return m.checkpoints != nil || m.config.Monitor.CheckpointPath != ""
+}
+
+// loadCheckpoint 读取位点文件，文件不存在时返回nil
+func loadCheckpoint(path string) (*mysql.Position, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if cp.Name == "" {
+		return nil, fmt.Errorf("invalid checkpoint %s: missing binlog name", path)
+	}
+	return &mysql.Position{Name: cp.Name, Pos: cp.Pos}, nil
+}
+
+// SaveCheckpoint 将已同步的 binlog 位点写入位点文件或位点存储，都未配置时不做任何事
+// 应在分发器排空或保存了全部未完成的投递之后调用，否则重启后会跳过尚未投递的事件
+func (m *Monitor) SaveCheckpoint() error {
+	if !m.checkpointEnabled() {
+		return nil
+	}
+	return m.saveCheckpoint(m.canal.SyncedPosition())
+}
+
+// SaveCheckpointIfIdle 在运行期间保存位点：先取已同步的位点，再由 idle 确认此前入队的事件都已投递完成，
+// 确认失败时跳过本次保存；位点没有变化时不重复写入
+func (m *Monitor) SaveCheckpointIfIdle(idle func() bool) error {
+	if !m.checkpointEnabled() {
+		return nil
+	}
+	pos := m.canal.SyncedPosition()
+	if pos == m.lastCheckpoint || !idle() {
+		return nil
+	}
+	return m.saveCheckpoint(pos)
+}
+
+// saveCheckpoint 将位点写入位点存储或位点文件
+func (m *Monitor) saveCheckpoint(pos mysql.Position) error {
+	if pos.Name == "" {
+		return nil
+	}
+	cp := checkpoint{
+		Name:      pos.Name,
+		Pos:       pos.Pos,
+		UpdatedAt: time.Now(),
+	}
+	if set := m.canal.SyncedGTIDSet(); set != nil {
+		cp.GTIDSet = set.String()
+	}
+
+	if m.checkpoints != nil {
+		// 尚未追上自己位点的任务保留原来的位点
+		taskIDs := make([]string, 0, len(m.config.Tasks))
+		for _, task := range m.config.Tasks {
+			if saved, ok := m.taskCheckpoints[task.TaskID]; ok && pos.Compare(saved) < 0 {
+				continue
+			}
+			taskIDs = append(taskIDs, task.TaskID)
+		}
+		if err := m.checkpoints.SaveCheckpoint(taskIDs, pos, cp.GTIDSet); err != nil {
+			return err
+		}
+		m.lastCheckpoint = pos
+		log.Info("Task checkpoints saved", log.Int("tasks", len(taskIDs)), log.Any("position", pos))
+		return nil
+	}
+	path := m.config.Monitor.CheckpointPath
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中途退出留下损坏的位点文件
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+	m.lastCheckpoint = pos
+
+	log.Info("Checkpoint saved", log.String("path", path), log.Any("position", pos))
+	return nil
+}
@@ -15,10 +15,15 @@ import (
 	"go.uber.org/zap"
 
 	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/payload"
 	"pikachu/internal/types"
 	"pikachu/internal/utils"
 )
 
+// stopTimeout 停止时等待 binlog 读取退出的最长时间
+const stopTimeout = 10 * time.Second
+
 // EventCallback 事件回调函数类型
 type EventCallback func()
 
@@ -30,9 +35,18 @@ type Monitor struct {
 	tasksByTable  map[string][]*types.Task // 按表名分组的任务
 	eventTaskMap  map[string][]*types.Task // 按事件类型分组的任务
 	schemaCache   map[string]*types.TableSchema
+	logName       string // 当前binlog文件名，由 OnRotate 更新
+	gtid          string // 当前事务的GTID，由 OnGTID 设置，事务结束时清空
+	gtidPos       uint32 // 当前事务GTID事件的结束位置
 	ctx           context.Context
 	cancel        context.CancelFunc
 	eventCallback EventCallback
+	metrics       *metrics.Metrics
+	stopped       chan struct{} // Start 返回时关闭
+
+	lastCheckpoint  mysql.Position            // 最近一次保存的位点
+	checkpoints     CheckpointStore           // 按任务保存位点的存储，为nil时使用位点文件
+	taskCheckpoints map[string]mysql.Position // 位点晚于开始位点的任务，跳过其中已投递的事件
 }
 
 // GetPrimaryKey 获取主键值，支持复合主键
@@ -80,8 +94,21 @@ func GetPrimaryKey(table *schema.Table, newData, oldData map[string]interface{})
 	return nil
 }
 
-// New 创建新的监控器
-func New(config *types.Config, eventQueue chan *types.ChangeEvent, eventCallback EventCallback) (*Monitor, error) {
+// PrimaryKeyColumns 获取主键列名，没有主键时返回nil
+func PrimaryKeyColumns(table *schema.Table) []string {
+	for _, index := range table.Indexes {
+		if index.Name == "PRIMARY" {
+			return index.Columns
+		}
+	}
+	return nil
+}
+
+// New 创建新的监控器，m 为 nil 时使用独立的指标收集器
+func New(config *types.Config, eventQueue chan *types.ChangeEvent, eventCallback EventCallback, m *metrics.Metrics) (*Monitor, error) {
+	if m == nil {
+		m = metrics.NewMetrics()
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	monitor := &Monitor{
@@ -93,6 +120,10 @@ func New(config *types.Config, eventQueue chan *types.ChangeEvent, eventCallback
 		ctx:           ctx,
 		cancel:        cancel,
 		eventCallback: eventCallback,
+		metrics:       m,
+		stopped:       make(chan struct{}),
+
+		taskCheckpoints: make(map[string]mysql.Position),
 	}
 
 	// 建立任务映射 - 优化后的版本
@@ -168,6 +199,7 @@ func (m *Monitor) buildTableRegex() []string {
 
 // Start 启动监控
 func (m *Monitor) Start() error {
+	defer close(m.stopped)
 	log.Info("Starting MySQL monitor")
 
 	// 加载表结构
@@ -175,13 +207,12 @@ func (m *Monitor) Start() error {
 		return fmt.Errorf("failed to load table schemas: %w", err)
 	}
 
-	// 启动canal
-	pos, err := m.canal.GetMasterPos()
+	// 启动canal，有保存的位点时从位点继续，否则从当前主库位点开始
+	pos, err := m.startPosition()
 	if err != nil {
-		return fmt.Errorf("failed to get master position: %w", err)
+		return err
 	}
-
-	log.Info("Starting from master position", log.Any("position", pos))
+	m.logName = pos.Name
 
 	// 记录任务启动日志
 	for _, task := range m.config.Tasks {
@@ -194,7 +225,40 @@ func (m *Monitor) Start() error {
 	return m.canal.RunFrom(pos)
 }
 
-// Stop 停止监控
+// startPosition 返回开始读取的 binlog 位点
+func (m *Monitor) startPosition() (mysql.Position, error) {
+	if m.checkpoints != nil {
+		saved, err := m.loadTaskCheckpoints()
+		if err != nil {
+			return mysql.Position{}, err
+		}
+		if saved != nil {
+			log.Info("Resuming from task checkpoints", log.Any("position", *saved),
+				log.Int("tasks_ahead", len(m.taskCheckpoints)))
+			return *saved, nil
+		}
+	} else if path := m.config.Monitor.CheckpointPath; path != "" {
+		saved, err := loadCheckpoint(path)
+		if err != nil {
+			return mysql.Position{}, err
+		}
+		if saved != nil {
+			log.Info("Resuming from checkpoint", log.String("path", path), log.Any("position", *saved))
+			m.lastCheckpoint = *saved
+			return *saved, nil
+		}
+	}
+
+	pos, err := m.canal.GetMasterPos()
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to get master position: %w", err)
+	}
+	log.Info("Starting from master position", log.Any("position", pos))
+	return pos, nil
+}
+
+// Stop 停止读取 binlog，等待正在处理的事件返回后退出
+// 先取消上下文，让阻塞在事件队列上的事件处理立即返回，已同步的位点不会越过未入队的事件
 func (m *Monitor) Stop() {
 	log.Info("Stopping MySQL monitor")
 
@@ -202,10 +266,16 @@ func (m *Monitor) Stop() {
 		log.Info("Task stopped", log.String("task_id", task.TaskID))
 	}
 
+	m.cancel()
 	if m.canal != nil {
 		m.canal.Close()
 	}
-	m.cancel()
+
+	select {
+	case <-m.stopped:
+	case <-time.After(stopTimeout):
+		log.Warn("Timed out waiting for binlog reading to stop", log.Duration("timeout", stopTimeout))
+	}
 }
 
 // loadTableSchemas 加载表结构
@@ -234,9 +304,29 @@ func (m *Monitor) loadTableSchemas() error {
 		m.schemaCache[task.TableName] = schema_
 	}
 
+	// 按表的实际列试渲染载荷模板，引用了不存在的列的模板在启动和表结构变更时暴露出来
+	for i := range m.config.Tasks {
+		task := &m.config.Tasks[i]
+		if err := validatePayloadTemplate(task, m.schemaCache[task.TableName]); err != nil {
+			return fmt.Errorf("task %s: invalid payload_template: %w", task.TaskID, err)
+		}
+	}
+
 	return nil
 }
 
+// validatePayloadTemplate 使用按表结构构造的示例事件试渲染任务的载荷模板
+func validatePayloadTemplate(task *types.Task, schema *types.TableSchema) error {
+	if task.PayloadTemplate == "" {
+		return nil
+	}
+	tpl, err := payload.Parse(task.TaskID, task.PayloadTemplate, task.PayloadContentType)
+	if err != nil {
+		return err
+	}
+	return tpl.Validate(task.TaskID, task.TableName, task.Events, schema)
+}
+
 // getTableSchema 获取表结构
 func (m *Monitor) getTableSchema(db *sql.DB, tableName string) (*types.TableSchema, error) {
 	// 使用简化的引用函数处理表名，确保被反引号包围
@@ -265,6 +355,7 @@ func (m *Monitor) getTableSchema(db *sql.DB, tableName string) (*types.TableSche
 
 	for _, ct := range columnTypes {
 		schema_.Columns[ct.Name()] = ct
+		schema_.ColumnNames = append(schema_.ColumnNames, ct.Name())
 	}
 
 	return schema_, nil
@@ -304,16 +395,26 @@ func (m *Monitor) OnRow(e *canal.RowsEvent) error {
 
 // handleInsert 处理插入事件
 func (m *Monitor) handleInsert(e *canal.RowsEvent, task *types.Task) error {
-	for _, row := range e.Rows {
+	for i, row := range e.Rows {
 		data := m.buildRowData(e.Table, row)
 		primaryID := GetPrimaryKey(e.Table, data, map[string]interface{}{})
 		event := &types.ChangeEvent{
 			TaskID:    task.TaskID,
 			PrimaryID: primaryID,
 			Event:     types.EventInsert,
+			Database:  e.Table.Schema,
 			Table:     e.Table.Name,
 			NewData:   data,
 			Timestamp: time.Now(),
+			EventTime: binlogTime(e),
+			LogName:   m.logName,
+			LogPos:    logPos(e),
+			GTID:      m.gtid,
+			TxnOffset: m.txnOffset(e),
+			RowIndex:  i,
+
+			PrimaryKeys: PrimaryKeyColumns(e.Table),
+			Schema:      m.schemaCache[e.Table.Name],
 		}
 
 		log.Info("Change event detected",
@@ -322,20 +423,8 @@ func (m *Monitor) handleInsert(e *canal.RowsEvent, task *types.Task) error {
 			log.String("table", event.Table),
 			log.Any("primary_id", event.PrimaryID))
 
-		select {
-		case m.eventQueue <- event:
-			// 如果有事件回调函数，则调用它
-			if m.eventCallback != nil {
-				m.eventCallback()
-			}
-		case <-m.ctx.Done():
-			return m.ctx.Err()
-		case <-time.After(m.config.Monitor.EventQueueTimeout):
-			log.Error("Event queue timeout, event dropped",
-				log.String("task_id", task.TaskID),
-				log.String("event_type", string(event.Event)),
-				log.String("table", event.Table))
-			return fmt.Errorf("event queue timeout")
+		if err := m.enqueue(event); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -354,10 +443,20 @@ func (m *Monitor) handleUpdate(e *canal.RowsEvent, task *types.Task) error {
 			TaskID:    task.TaskID,
 			Event:     types.EventUpdate,
 			PrimaryID: primaryID,
+			Database:  e.Table.Schema,
 			Table:     e.Table.Name,
 			OldData:   oldData,
 			NewData:   newData,
 			Timestamp: time.Now(),
+			EventTime: binlogTime(e),
+			LogName:   m.logName,
+			LogPos:    logPos(e),
+			GTID:      m.gtid,
+			TxnOffset: m.txnOffset(e),
+			RowIndex:  i / 2,
+
+			PrimaryKeys: PrimaryKeyColumns(e.Table),
+			Schema:      m.schemaCache[e.Table.Name],
 		}
 
 		log.Info("Change event detected",
@@ -366,20 +465,8 @@ func (m *Monitor) handleUpdate(e *canal.RowsEvent, task *types.Task) error {
 			log.String("table", event.Table),
 			log.Any("primary_id", event.PrimaryID))
 
-		select {
-		case m.eventQueue <- event:
-			// 如果有事件回调函数，则调用它
-			if m.eventCallback != nil {
-				m.eventCallback()
-			}
-		case <-m.ctx.Done():
-			return m.ctx.Err()
-		case <-time.After(m.config.Monitor.EventQueueTimeout):
-			log.Error("Event queue timeout, event dropped",
-				log.String("task_id", task.TaskID),
-				log.String("event_type", string(event.Event)),
-				log.String("table", event.Table))
-			return fmt.Errorf("event queue timeout")
+		if err := m.enqueue(event); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -387,16 +474,26 @@ func (m *Monitor) handleUpdate(e *canal.RowsEvent, task *types.Task) error {
 
 // handleDelete 处理删除事件
 func (m *Monitor) handleDelete(e *canal.RowsEvent, task *types.Task) error {
-	for _, row := range e.Rows {
+	for i, row := range e.Rows {
 		data := m.buildRowData(e.Table, row)
 		primaryID := GetPrimaryKey(e.Table, data, map[string]interface{}{})
 		event := &types.ChangeEvent{
 			TaskID:    task.TaskID,
 			PrimaryID: primaryID,
 			Event:     types.EventDelete,
+			Database:  e.Table.Schema,
 			Table:     e.Table.Name,
 			NewData:   data,
 			Timestamp: time.Now(),
+			EventTime: binlogTime(e),
+			LogName:   m.logName,
+			LogPos:    logPos(e),
+			GTID:      m.gtid,
+			TxnOffset: m.txnOffset(e),
+			RowIndex:  i,
+
+			PrimaryKeys: PrimaryKeyColumns(e.Table),
+			Schema:      m.schemaCache[e.Table.Name],
 		}
 
 		log.Info("Change event detected",
@@ -405,23 +502,108 @@ func (m *Monitor) handleDelete(e *canal.RowsEvent, task *types.Task) error {
 			log.String("table", event.Table),
 			log.Any("primary_id", event.PrimaryID))
 
+		if err := m.enqueue(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backpressureLogInterval 背压暂停期间重复输出告警日志的间隔
+const backpressureLogInterval = 30 * time.Second
+
+// enqueue 将事件放入事件队列
+// drop 模式下等待超过 event_queue_timeout 返回错误；block 模式下一直等待，
+// 期间 canal 的事件处理协程被阻塞，binlog 读取随之暂停，直到分发器腾出空间
+func (m *Monitor) enqueue(event *types.ChangeEvent) error {
+	if m.delivered(event) {
+		return nil
+	}
+	m.metrics.SetBinlogLag(time.Since(event.EventTime))
+
+	select {
+	case m.eventQueue <- event:
+		m.eventQueued()
+		return nil
+	default:
+	}
+
+	if m.config.Monitor.Backpressure == types.BackpressureBlock {
+		return m.waitForQueue(event)
+	}
+
+	select {
+	case m.eventQueue <- event:
+		m.eventQueued()
+		return nil
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	case <-time.After(m.config.Monitor.EventQueueTimeout):
+		log.Error("Event queue timeout, event dropped",
+			log.String("task_id", event.TaskID),
+			log.String("event_type", string(event.Event)),
+			log.String("table", event.Table))
+		return fmt.Errorf("event queue timeout")
+	}
+}
+
+// waitForQueue 事件队列满时暂停读取 binlog，等待队列出现空间，期间定期报告延迟
+func (m *Monitor) waitForQueue(event *types.ChangeEvent) error {
+	pausedAt := time.Now()
+	m.metrics.BackpressurePaused()
+	log.Warn("Event queue full, pausing binlog reading",
+		log.String("task_id", event.TaskID),
+		log.String("table", event.Table),
+		log.Int("queue_size", len(m.eventQueue)),
+		log.Duration("lag", m.metrics.GetBinlogLag()))
+
+	defer func() {
+		paused := time.Since(pausedAt)
+		m.metrics.BackpressureResumed(paused)
+		log.Info("Binlog reading resumed", log.Duration("paused", paused))
+	}()
+
+	ticker := time.NewTicker(backpressureLogInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case m.eventQueue <- event:
-			// 如果有事件回调函数，则调用它
-			if m.eventCallback != nil {
-				m.eventCallback()
-			}
+			m.eventQueued()
+			return nil
 		case <-m.ctx.Done():
 			return m.ctx.Err()
-		case <-time.After(m.config.Monitor.EventQueueTimeout):
-			log.Error("Event queue timeout, event dropped",
-				log.String("task_id", task.TaskID),
-				log.String("event_type", string(event.Event)),
-				log.String("table", event.Table))
-			return fmt.Errorf("event queue timeout")
+		case <-ticker.C:
+			lag := time.Since(event.EventTime)
+			m.metrics.SetBinlogLag(lag)
+			log.Warn("Binlog reading still paused by backpressure",
+				log.Duration("paused", time.Since(pausedAt)),
+				log.Duration("lag", lag))
 		}
 	}
-	return nil
+}
+
+// eventQueued 事件入队后调用事件回调函数
+func (m *Monitor) eventQueued() {
+	if m.eventCallback != nil {
+		m.eventCallback()
+	}
+}
+
+// logPos 获取行事件在binlog中的结束位置
+func logPos(e *canal.RowsEvent) uint32 {
+	if e.Header == nil {
+		return 0
+	}
+	return e.Header.LogPos
+}
+
+// binlogTime 获取binlog事件头中记录的时间，缺失时使用当前时间
+func binlogTime(e *canal.RowsEvent) time.Time {
+	if e.Header == nil || e.Header.Timestamp == 0 {
+		return time.Now()
+	}
+	return time.Unix(int64(e.Header.Timestamp), 0)
 }
 
 // buildRowData 构建行数据
@@ -440,6 +622,7 @@ func (m *Monitor) buildRowData(table *schema.Table, row []interface{}) map[strin
 // OnRotate 处理日志轮转事件 - 实现canal.EventHandler接口
 func (m *Monitor) OnRotate(header *replication.EventHeader, rotateEvent *replication.RotateEvent) error {
 	log.Info("Binary log rotated", log.String("next_log_name", string(rotateEvent.NextLogName)))
+	m.logName = string(rotateEvent.NextLogName)
 	return nil
 }
 
@@ -462,21 +645,41 @@ func (m *Monitor) OnTableChanged(header *replication.EventHeader, schema string,
 // OnDDL 处理DDL事件 - 实现canal.EventHandler接口
 func (m *Monitor) OnDDL(rh *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
 	log.Info("DDL executed", log.String("query", string(queryEvent.Query)))
+	m.gtid = ""
 	return nil
 }
 
 // OnXID 处理事务提交事件 - 实现canal.EventHandler接口
 func (m *Monitor) OnXID(eventHeader *replication.EventHeader, nextPos mysql.Position) error {
-	// 通常不需要处理
+	m.gtid = ""
 	return nil
 }
 
-// OnGTID 处理GTID事件 - 实现canal.EventHandler接口
-func (m *Monitor) OnGTID(eventHeader *replication.EventHeader, nextPos mysql.BinlogGTIDEvent) error {
-	// 通常不需要处理
+// OnGTID 记录事务的GTID，用于生成事件ID - 实现canal.EventHandler接口
+func (m *Monitor) OnGTID(eventHeader *replication.EventHeader, gtidEvent mysql.BinlogGTIDEvent) error {
+	m.gtid = ""
+	// 未启用GTID时 MySQL 写入匿名GTID事件，GNO为0
+	if e, ok := gtidEvent.(*replication.GTIDEvent); ok && e.GNO == 0 {
+		return nil
+	}
+	next, err := gtidEvent.GTIDNext()
+	if err != nil {
+		log.Warn("Failed to parse GTID event", zap.Error(err))
+		return nil
+	}
+	m.gtid = next.String()
+	m.gtidPos = eventHeader.LogPos
 	return nil
 }
 
+// txnOffset 返回行事件相对当前事务GTID事件的偏移，没有GTID时返回0
+func (m *Monitor) txnOffset(e *canal.RowsEvent) uint32 {
+	if m.gtid == "" || e.Header == nil {
+		return 0
+	}
+	return e.Header.LogPos - m.gtidPos
+}
+
 func (m *Monitor) OnRowsQueryEvent(e *replication.RowsQueryEvent) error {
 	return nil
 }
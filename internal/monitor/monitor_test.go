@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+
+	"pikachu/internal/log"
+	"pikachu/internal/metrics"
+	"pikachu/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.Init(&types.LogConfig{Level: types.LogLevelError, Format: "text"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+const testQueueTimeout = 20 * time.Millisecond
+
+// newTestMonitor 创建只用于入队的监控器，事件队列容量为1且已被占满
+func newTestMonitor(t *testing.T, backpressure string) (*Monitor, chan *types.ChangeEvent, *atomic.Int32) {
+	t.Helper()
+	cfg := &types.Config{}
+	cfg.Monitor.Backpressure = backpressure
+	cfg.Monitor.EventQueueTimeout = testQueueTimeout
+
+	queue := make(chan *types.ChangeEvent, 1)
+	queue <- testEvent(1)
+	var queued atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m := &Monitor{
+		config:          cfg,
+		eventQueue:      queue,
+		ctx:             ctx,
+		cancel:          cancel,
+		eventCallback:   func() { queued.Add(1) },
+		metrics:         metrics.NewMetrics(),
+		taskCheckpoints: make(map[string]mysql.Position),
+	}
+	return m, queue, &queued
+}
+
+// testEvent 构造一个插入事件
+func testEvent(id int64) *types.ChangeEvent {
+	return &types.ChangeEvent{
+		TaskID:    "users",
+		Event:     types.EventInsert,
+		Database:  "app",
+		Table:     "users",
+		PrimaryID: id,
+		EventTime: time.Now(),
+		LogName:   "mysql-bin.000001",
+		LogPos:    uint32(1000 + id),
+	}
+}
+
+func TestEnqueueBlocksUntilQueueHasSpace(t *testing.T) {
+	m, queue, queued := newTestMonitor(t, types.BackpressureBlock)
+
+	done := make(chan error, 1)
+	go func() { done <- m.enqueue(testEvent(2)) }()
+
+	// 等待远超 event_queue_timeout，仍然阻塞而不是超时
+	select {
+	case err := <-done:
+		t.Fatalf("enqueue returned %v while the queue was full, want it to block", err)
+	case <-time.After(10 * testQueueTimeout):
+	}
+	if !m.metrics.IsBackpressurePaused() {
+		t.Fatal("backpressure is not reported while enqueue is blocked")
+	}
+	if queued.Load() != 0 {
+		t.Fatal("event callback called before the event was queued")
+	}
+
+	// 分发器取走事件后，阻塞的事件入队
+	if first := <-queue; first.PrimaryID != int64(1) {
+		t.Fatalf("first event = %v, want 1", first.PrimaryID)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("enqueue error = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue still blocked after the queue had space")
+	}
+	if second := <-queue; second.PrimaryID != int64(2) {
+		t.Fatalf("queued event = %v, want 2", second.PrimaryID)
+	}
+	if len(queue) != 0 || queued.Load() != 1 {
+		t.Fatalf("queue length = %d, callbacks = %d, want the event queued once", len(queue), queued.Load())
+	}
+	if m.metrics.IsBackpressurePaused() || m.metrics.GetBackpressurePauses() != 1 || m.metrics.GetBackpressureTime() < 10*testQueueTimeout {
+		t.Fatalf("paused = %v, pauses = %d, paused time = %v after resuming", m.metrics.IsBackpressurePaused(),
+			m.metrics.GetBackpressurePauses(), m.metrics.GetBackpressureTime())
+	}
+}
+
+func TestEnqueueBlockStopsOnShutdown(t *testing.T) {
+	m, _, queued := newTestMonitor(t, types.BackpressureBlock)
+
+	done := make(chan error, 1)
+	go func() { done <- m.enqueue(testEvent(2)) }()
+	time.Sleep(2 * testQueueTimeout)
+	m.cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("enqueue error = %v, want context canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue still blocked after the monitor stopped")
+	}
+	if queued.Load() != 0 || m.metrics.IsBackpressurePaused() {
+		t.Fatalf("callbacks = %d, paused = %v after shutdown", queued.Load(), m.metrics.IsBackpressurePaused())
+	}
+}
+
+func TestEnqueueDropTimesOut(t *testing.T) {
+	m, queue, queued := newTestMonitor(t, types.BackpressureDrop)
+
+	start := time.Now()
+	if err := m.enqueue(testEvent(2)); err == nil || err.Error() != "event queue timeout" {
+		t.Fatalf("enqueue error = %v, want event queue timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < testQueueTimeout {
+		t.Fatalf("enqueue returned after %v, before event_queue_timeout", elapsed)
+	}
+	if len(queue) != 1 || queued.Load() != 0 || m.metrics.GetBackpressurePauses() != 0 {
+		t.Fatalf("queue length = %d, callbacks = %d, pauses = %d", len(queue), queued.Load(), m.metrics.GetBackpressurePauses())
+	}
+}
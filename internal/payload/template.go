@@ -0,0 +1,230 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"text/template"
+	"time"
+
+	"pikachu/internal/types"
+)
+
+// DefaultContentType 自定义载荷的默认类型
+const DefaultContentType = "application/json"
+
+// Template 用户自定义的载荷模板
+type Template struct {
+	tpl         *template.Template
+	contentType string
+	isJSON      bool // 输出为JSON时校验渲染结果
+}
+
+// Data 模板渲染时可访问的数据
+type Data struct {
+	EventID   string // 事件ID，重试和重启后保持不变
+	TaskID    string
+	Event     string // insert, update, delete
+	Database  string
+	Table     string
+	PrimaryID interface{}
+	Row       map[string]interface{} // 当前行：INSERT/UPDATE 为新数据，DELETE 为被删除的数据
+	Old       map[string]interface{} // UPDATE 的旧数据，其他事件为nil
+	New       map[string]interface{} // INSERT/UPDATE 的新数据，DELETE 为nil
+	Timestamp time.Time              // 检测到变更的时间
+	EventTime time.Time              // binlog 中记录的事件时间
+}
+
+// funcs 模板可用的辅助函数
+var funcs = template.FuncMap{
+	"json":       toJSON,
+	"default":    defaultValue,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"join":       strings.Join,
+	"now":        time.Now,
+	"unix":       func(t time.Time) int64 { return t.Unix() },
+	"unixMilli":  func(t time.Time) int64 { return t.UnixMilli() },
+	"formatTime": func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// Parse 解析载荷模板，contentType 为空时使用 application/json
+func Parse(name, text, contentType string) (*Template, error) {
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	// 引用不存在的列时报错，而不是输出 <no value>
+	tpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse payload template: %w", err)
+	}
+
+	return &Template{
+		tpl:         tpl,
+		contentType: contentType,
+		isJSON:      mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"),
+	}, nil
+}
+
+// ContentType 返回渲染结果的类型
+func (t *Template) ContentType() string {
+	return t.contentType
+}
+
+// Render 使用变更事件渲染模板
+func (t *Template) Render(event *types.ChangeEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.tpl.Execute(&buf, newData(event)); err != nil {
+		return nil, fmt.Errorf("failed to render payload template: %w", err)
+	}
+
+	body := buf.Bytes()
+	if t.isJSON && !json.Valid(body) {
+		return nil, fmt.Errorf("payload template rendered invalid JSON: %s", truncate(body, 200))
+	}
+	return body, nil
+}
+
+// Validate 使用按表结构构造的示例事件试渲染模板，让引用了不存在的列的模板在加载表结构时就暴露出来
+func (t *Template) Validate(taskID, table string, events []types.EventType, schema *types.TableSchema) error {
+	for _, eventType := range events {
+		if _, err := t.Render(SampleEvent(taskID, table, eventType, schema)); err != nil {
+			return fmt.Errorf("%s event: %w", eventType, err)
+		}
+	}
+	return nil
+}
+
+// SampleEvent 构造用于校验模板的示例事件，行数据包含表的全部列
+func SampleEvent(taskID, table string, eventType types.EventType, schema *types.TableSchema) *types.ChangeEvent {
+	now := time.Now()
+	event := &types.ChangeEvent{
+		TaskID:    taskID,
+		Event:     eventType,
+		Database:  "sample",
+		Table:     table,
+		PrimaryID: int64(1),
+		NewData:   sampleRow(schema),
+		Timestamp: now,
+		EventTime: now,
+		Schema:    schema,
+	}
+	if eventType == types.EventUpdate {
+		event.OldData = sampleRow(schema)
+	}
+	return event
+}
+
+// sampleRow 按表结构构造示例行，每列取与 binlog 中同类型的示例值
+func sampleRow(schema *types.TableSchema) map[string]interface{} {
+	if schema == nil {
+		return map[string]interface{}{}
+	}
+	row := make(map[string]interface{}, len(schema.ColumnNames))
+	for _, name := range schema.ColumnNames {
+		var typeName string
+		if columnType := schema.Columns[name]; columnType != nil {
+			typeName = columnType.DatabaseTypeName()
+		}
+		row[name] = sampleValue(typeName)
+	}
+	return row
+}
+
+// sampleValue 返回列类型的示例值
+func sampleValue(typeName string) interface{} {
+	unsigned := strings.HasPrefix(typeName, "UNSIGNED ")
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if unsigned {
+			return uint64(1)
+		}
+		return int64(1)
+	case "FLOAT", "DOUBLE":
+		return float64(1.5)
+	case "DECIMAL":
+		return "1.00"
+	case "BIT":
+		return int64(1)
+	case "DATE":
+		return "2006-01-02"
+	case "DATETIME", "TIMESTAMP":
+		return "2006-01-02 15:04:05"
+	case "TIME":
+		return "15:04:05"
+	case "JSON":
+		return "{}"
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return []byte("sample")
+	default:
+		return "sample"
+	}
+}
+
+// newData 将变更事件转换为模板数据
+func newData(event *types.ChangeEvent) *Data {
+	data := &Data{
+		EventID:   event.ID(),
+		TaskID:    event.TaskID,
+		Event:     string(event.Event),
+		Database:  event.Database,
+		Table:     event.Table,
+		PrimaryID: event.PrimaryID,
+		Row:       event.NewData,
+		Timestamp: event.Timestamp,
+		EventTime: event.EventTime,
+	}
+
+	switch event.Event {
+	case types.EventInsert:
+		data.New = event.NewData
+	case types.EventUpdate:
+		data.Old = event.OldData
+		data.New = event.NewData
+	}
+
+	if data.EventTime.IsZero() {
+		data.EventTime = event.Timestamp
+	}
+	return data
+}
+
+// toJSON 将值编码为JSON，用于在模板中安全地输出字符串和嵌套结构
+// binlog 中的文本列常以 []byte 出现，按字符串编码
+func toJSON(value interface{}) (string, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// defaultValue 值为空时返回默认值，用法：{{ .Row.name | default "unknown" }}
+func defaultValue(def, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return def
+	}
+	return value
+}
+
+// truncate 截断过长的内容，用于错误信息
+func truncate(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+	return string(body[:n]) + "..."
+}
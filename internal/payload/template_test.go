@@ -0,0 +1,65 @@
+package payload
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"pikachu/internal/types"
+)
+
+// testSchema 返回只有列名的表结构
+func testSchema(columns ...string) *types.TableSchema {
+	return &types.TableSchema{Columns: map[string]*sql.ColumnType{}, ColumnNames: columns}
+}
+
+func TestValidateUsesTableColumns(t *testing.T) {
+	events := []types.EventType{types.EventInsert, types.EventUpdate, types.EventDelete}
+	tpl, err := Parse("users", `{"id": {{ json .Row.id }}, "email": {{ json .Row.email }}}`, "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if err := tpl.Validate("users", "users", events, testSchema("id", "email", "name")); err != nil {
+		t.Fatalf("template referencing existing columns: %v", err)
+	}
+	err = tpl.Validate("users", "users", events, testSchema("id", "name"))
+	if err == nil || !strings.Contains(err.Error(), "email") {
+		t.Fatalf("Validate error = %v, want missing column email", err)
+	}
+}
+
+func TestValidateRejectsOldOnInsert(t *testing.T) {
+	tpl, err := Parse("users", `{"before": {{ json .Old.name }}}`, "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	schema := testSchema("id", "name")
+
+	if err := tpl.Validate("users", "users", []types.EventType{types.EventUpdate}, schema); err != nil {
+		t.Fatalf("update event: %v", err)
+	}
+	if err := tpl.Validate("users", "users", []types.EventType{types.EventInsert}, schema); err == nil {
+		t.Fatal("insert event has no .Old, want error")
+	}
+
+	guarded, err := Parse("users", `{"before": {{ with .Old }}{{ json .name }}{{ else }}null{{ end }}}`, "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := guarded.Validate("users", "users", []types.EventType{types.EventInsert, types.EventUpdate}, schema); err != nil {
+		t.Fatalf("guarded template: %v", err)
+	}
+}
+
+func TestSampleEventCoversAllColumns(t *testing.T) {
+	event := SampleEvent("users", "users", types.EventUpdate, testSchema("id", "email", "created_at"))
+	for _, column := range []string{"id", "email", "created_at"} {
+		if _, ok := event.NewData[column]; !ok {
+			t.Errorf("NewData is missing column %s", column)
+		}
+		if _, ok := event.OldData[column]; !ok {
+			t.Errorf("OldData is missing column %s", column)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"pikachu/internal/types"
+)
+
+// DefaultEquals json_path 字段的默认期望值
+const DefaultEquals = "true"
+
+// Validator 接收方响应校验器，可以并发使用
+type Validator struct {
+	pathExpr  string
+	path      []pathStep
+	equals    string
+	regex     *regexp.Regexp
+	retryPath []pathStep // 为nil时不从响应中读取是否重试
+	permanent bool       // 校验失败且响应未指明是否重试时按永久失败处理
+}
+
+// pathStep JSON路径的一级：对象字段或数组下标
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// Compile 解析响应校验配置
+func Compile(cfg *types.ResponseValidationConfig) (*Validator, error) {
+	if (cfg.JSONPath == "") == (cfg.Regex == "") {
+		return nil, fmt.Errorf("exactly one of json_path and regex must be set")
+	}
+
+	v := &Validator{pathExpr: cfg.JSONPath, equals: cfg.Equals}
+	switch cfg.OnFailure {
+	case "", types.ResponseOnFailureRetry:
+	case types.ResponseOnFailurePermanent:
+		v.permanent = true
+	default:
+		return nil, fmt.Errorf("on_failure must be retry or permanent, got: %s", cfg.OnFailure)
+	}
+
+	if cfg.JSONPath != "" {
+		path, err := parsePath(cfg.JSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json_path: %w", err)
+		}
+		v.path = path
+		if v.equals == "" {
+			v.equals = DefaultEquals
+		}
+	} else {
+		if cfg.Equals != "" {
+			return nil, fmt.Errorf("equals can only be used with json_path")
+		}
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		v.regex = regex
+	}
+
+	if cfg.RetryJSONPath != "" {
+		path, err := parsePath(cfg.RetryJSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_json_path: %w", err)
+		}
+		v.retryPath = path
+	}
+	return v, nil
+}
+
+// Check 校验响应体，通过时返回nil；未通过时返回原因，retryable 表示是否应当重试
+func (v *Validator) Check(body []byte) (retryable bool, err error) {
+	if v.regex != nil {
+		if v.regex.Match(body) {
+			return false, nil
+		}
+		return v.failure(body, nil, fmt.Errorf("response body does not match %s", v.regex))
+	}
+
+	doc, err := decode(body)
+	if err != nil {
+		return v.failure(body, nil, fmt.Errorf("response body is not valid JSON: %w", err))
+	}
+	value, ok := lookup(doc, v.path)
+	if !ok {
+		return v.failure(body, doc, fmt.Errorf("response field %s not found", v.pathExpr))
+	}
+	if got := valueString(value); got != v.equals {
+		return v.failure(body, doc, fmt.Errorf("response field %s is %s, expected %s", v.pathExpr, got, v.equals))
+	}
+	return false, nil
+}
+
+// failure 判断校验失败是否可重试：retry_json_path 指向的字段为布尔值时以其为准，否则按 on_failure
+func (v *Validator) failure(body []byte, doc interface{}, err error) (bool, error) {
+	if v.retryPath != nil {
+		if doc == nil {
+			doc, _ = decode(body)
+		}
+		if value, ok := lookup(doc, v.retryPath); ok {
+			if retry, ok := value.(bool); ok {
+				return retry, err
+			}
+		}
+	}
+	return !v.permanent, err
+}
+
+// decode 解码JSON响应体，数字保留原始文本以便精确比较
+func decode(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parsePath 解析JSON路径，支持可选的 $ 前缀、以 . 分隔的字段名和 [n] 数组下标，如 $.data.items[0].ok
+func parsePath(expr string) ([]pathStep, error) {
+	expr = strings.TrimPrefix(expr, "$")
+	expr = strings.TrimPrefix(expr, ".")
+	if expr == "" {
+		return []pathStep{}, nil
+	}
+
+	var steps []pathStep
+	for _, part := range strings.Split(expr, ".") {
+		name, rest := part, ""
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name, rest = part[:i], part[i:]
+		}
+		if name == "" && rest == "" {
+			return nil, fmt.Errorf("empty field name in %q", expr)
+		}
+		if name != "" {
+			steps = append(steps, pathStep{key: name})
+		}
+
+		for rest != "" {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid array index in %q", expr)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index %q in %q", rest[1:end], expr)
+			}
+			steps = append(steps, pathStep{index: index, isIndex: true})
+			rest = rest[end+1:]
+		}
+	}
+	return steps, nil
+}
+
+// lookup 按路径取值，路径不存在时 ok 为false
+func lookup(doc interface{}, path []pathStep) (interface{}, bool) {
+	value := doc
+	for _, step := range path {
+		if step.isIndex {
+			items, ok := value.([]interface{})
+			if !ok || step.index >= len(items) {
+				return nil, false
+			}
+			value = items[step.index]
+			continue
+		}
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = fields[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// valueString 将JSON值转换为用于比较的文本：字符串为原值，其他类型为JSON文本
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
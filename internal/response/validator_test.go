@@ -0,0 +1,111 @@
+package response
+
+import (
+	"reflect"
+	"testing"
+
+	"pikachu/internal/types"
+)
+
+func TestParsePath(t *testing.T) {
+	for _, tc := range []struct {
+		expr    string
+		want    []pathStep
+		wantErr bool
+	}{
+		{expr: "ok", want: []pathStep{{key: "ok"}}},
+		{expr: "$", want: []pathStep{}},
+		{expr: "$.data.items[0].ok", want: []pathStep{{key: "data"}, {key: "items"}, {index: 0, isIndex: true}, {key: "ok"}}},
+		{expr: "$[1][2]", want: []pathStep{{index: 1, isIndex: true}, {index: 2, isIndex: true}}},
+		{expr: "a..b", wantErr: true},
+		{expr: "a.", wantErr: true},
+		{expr: "a[-1]", wantErr: true},
+		{expr: "a[x]", wantErr: true},
+		{expr: "a[0", wantErr: true},
+		{expr: "a[0]b", wantErr: true},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			got, err := parsePath(tc.expr)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parsePath() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePath() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("parsePath() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for name, cfg := range map[string]types.ResponseValidationConfig{
+		"neither json_path nor regex": {},
+		"both json_path and regex":    {JSONPath: "ok", Regex: "ok"},
+		"regex with equals":           {Regex: "ok", Equals: "true"},
+		"invalid regex":               {Regex: "("},
+		"invalid json_path":           {JSONPath: "a..b"},
+		"invalid retry_json_path":     {JSONPath: "ok", RetryJSONPath: "retry[-1]"},
+		"unknown on_failure":          {JSONPath: "ok", OnFailure: "ignore"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Compile(&cfg); err == nil {
+				t.Fatal("Compile() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		cfg       types.ResponseValidationConfig
+		body      string
+		wantErr   bool
+		retryable bool
+	}{
+		{name: "nested field", cfg: types.ResponseValidationConfig{JSONPath: "$.data.items[0].ok"}, body: `{"data":{"items":[{"ok":true}]}}`},
+		{name: "nested field false", cfg: types.ResponseValidationConfig{JSONPath: "$.data.items[0].ok"}, body: `{"data":{"items":[{"ok":false}]}}`, wantErr: true, retryable: true},
+		{name: "index out of range", cfg: types.ResponseValidationConfig{JSONPath: "$.data.items[1].ok"}, body: `{"data":{"items":[{"ok":true}]}}`, wantErr: true, retryable: true},
+		{name: "missing field", cfg: types.ResponseValidationConfig{JSONPath: "ok"}, body: `{"status":"done"}`, wantErr: true, retryable: true},
+		{name: "not json", cfg: types.ResponseValidationConfig{JSONPath: "ok"}, body: `ok`, wantErr: true, retryable: true},
+		{name: "permanent on failure", cfg: types.ResponseValidationConfig{JSONPath: "ok", OnFailure: types.ResponseOnFailurePermanent}, body: `{"ok":false}`, wantErr: true},
+
+		// 字符串按原值比较，其他类型按JSON文本比较，因此数字和同样文本的字符串都能匹配
+		{name: "number equals", cfg: types.ResponseValidationConfig{JSONPath: "code", Equals: "0"}, body: `{"code":0}`},
+		{name: "string equals number text", cfg: types.ResponseValidationConfig{JSONPath: "code", Equals: "0"}, body: `{"code":"0"}`},
+		{name: "number text kept exactly", cfg: types.ResponseValidationConfig{JSONPath: "code", Equals: "0"}, body: `{"code":0.0}`, wantErr: true, retryable: true},
+		{name: "big number kept exactly", cfg: types.ResponseValidationConfig{JSONPath: "id", Equals: "12345678901234567890"}, body: `{"id":12345678901234567890}`},
+		{name: "string is not quoted", cfg: types.ResponseValidationConfig{JSONPath: "status", Equals: `"done"`}, body: `{"status":"done"}`, wantErr: true, retryable: true},
+		{name: "bool is not a string", cfg: types.ResponseValidationConfig{JSONPath: "ok"}, body: `{"ok":"yes"}`, wantErr: true, retryable: true},
+		{name: "null", cfg: types.ResponseValidationConfig{JSONPath: "error", Equals: "null"}, body: `{"error":null}`},
+
+		// retry_json_path 为布尔值时覆盖 on_failure，不存在或不是布尔值时按 on_failure
+		{name: "retry path true overrides permanent", cfg: types.ResponseValidationConfig{JSONPath: "ok", OnFailure: types.ResponseOnFailurePermanent, RetryJSONPath: "$.error.retry"}, body: `{"ok":false,"error":{"retry":true}}`, wantErr: true, retryable: true},
+		{name: "retry path false overrides retry", cfg: types.ResponseValidationConfig{JSONPath: "ok", RetryJSONPath: "$.error.retry"}, body: `{"ok":false,"error":{"retry":false}}`, wantErr: true},
+		{name: "retry path missing", cfg: types.ResponseValidationConfig{JSONPath: "ok", OnFailure: types.ResponseOnFailurePermanent, RetryJSONPath: "retry"}, body: `{"ok":false}`, wantErr: true},
+		{name: "retry path not bool", cfg: types.ResponseValidationConfig{JSONPath: "ok", RetryJSONPath: "retry"}, body: `{"ok":false,"retry":"false"}`, wantErr: true, retryable: true},
+		{name: "retry path with regex", cfg: types.ResponseValidationConfig{Regex: `"ok":\s*true`, RetryJSONPath: "retry"}, body: `{"ok":false,"retry":false}`, wantErr: true},
+
+		{name: "regex match", cfg: types.ResponseValidationConfig{Regex: `^OK\b`}, body: "OK accepted"},
+		{name: "regex mismatch", cfg: types.ResponseValidationConfig{Regex: `^OK\b`}, body: "ERROR", wantErr: true, retryable: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := Compile(&tc.cfg)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			retryable, err := v.Check([]byte(tc.body))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Check() error = %v, want error %v", err, tc.wantErr)
+			}
+			if retryable != tc.retryable {
+				t.Fatalf("Check() retryable = %v, want %v", retryable, tc.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"go.uber.org/zap"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+// DefaultTimeout 单次执行的默认超时
+const DefaultTimeout = 100 * time.Millisecond
+
+// entryFunction 脚本必须定义的入口函数名
+const entryFunction = "transform"
+
+// ErrTimeout 脚本执行超时
+var ErrTimeout = errors.New("transform script timed out")
+
+// Script 编译后的转换脚本
+//
+// 脚本需要定义 transform(event) 函数，返回值决定事件的去向：
+//   - 对象：替换原事件
+//   - 数组：拆分为多个事件
+//   - null/undefined/false：丢弃事件，便于写成 return cond && event 的过滤形式
+//
+// goja 运行时不是并发安全的，每个运行时同一时间只被一个调用使用，通过对象池复用
+type Script struct {
+	taskID  string
+	program *goja.Program
+	timeout time.Duration
+	vms     sync.Pool
+}
+
+// vm 加载了脚本的运行时
+type vm struct {
+	rt *goja.Runtime
+	fn goja.Callable
+}
+
+// Compile 编译任务的转换脚本，并检查入口函数是否存在
+func Compile(taskID string, cfg *types.TransformConfig) (*Script, error) {
+	source := cfg.Script
+	name := taskID + ".js"
+	if cfg.File != "" {
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transform script: %w", err)
+		}
+		source = string(data)
+		name = cfg.File
+	}
+
+	program, err := goja.Compile(name, source, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile transform script: %w", err)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	script := &Script{
+		taskID:  taskID,
+		program: program,
+		timeout: timeout,
+	}
+
+	// 预先创建一个运行时，顶层代码出错或缺少入口函数时尽早失败
+	v, err := script.newVM()
+	if err != nil {
+		return nil, err
+	}
+	script.vms.Put(v)
+
+	return script, nil
+}
+
+// newVM 创建沙箱运行时并执行脚本顶层代码
+// 运行时只暴露 console，没有文件、网络和进程访问能力
+func (s *Script) newVM() (*vm, error) {
+	rt := goja.New()
+
+	console := rt.NewObject()
+	console.Set("log", s.consoleFunc(log.Info))
+	console.Set("info", s.consoleFunc(log.Info))
+	console.Set("warn", s.consoleFunc(log.Warn))
+	console.Set("error", s.consoleFunc(log.Error))
+	rt.Set("console", console)
+
+	if _, err := s.run(rt, func() (goja.Value, error) { return rt.RunProgram(s.program) }); err != nil {
+		return nil, fmt.Errorf("failed to run transform script: %w", err)
+	}
+
+	fn, ok := goja.AssertFunction(rt.Get(entryFunction))
+	if !ok {
+		return nil, fmt.Errorf("transform script must define function %s(event)", entryFunction)
+	}
+
+	return &vm{rt: rt, fn: fn}, nil
+}
+
+// consoleFunc 将 console 输出转发到日志
+func (s *Script) consoleFunc(logf func(msg string, fields ...zap.Field)) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		args := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = arg.String()
+		}
+		logf("Transform script output",
+			log.String("task_id", s.taskID),
+			log.String("message", strings.Join(args, " ")))
+		return goja.Undefined()
+	}
+}
+
+// run 在超时限制内执行函数，超时后中断运行时
+func (s *Script) run(rt *goja.Runtime, fn func() (goja.Value, error)) (goja.Value, error) {
+	fired := make(chan struct{})
+	timer := time.AfterFunc(s.timeout, func() {
+		rt.Interrupt(ErrTimeout)
+		close(fired)
+	})
+
+	result, err := fn()
+
+	// 确保中断不会在清除之后才到达，影响下一次调用
+	if !timer.Stop() {
+		<-fired
+	}
+	rt.ClearInterrupt()
+
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return nil, fmt.Errorf("%w after %v", ErrTimeout, s.timeout)
+	}
+	return result, err
+}
+
+// Apply 对事件执行转换脚本，返回转换后的事件列表，空列表表示事件被丢弃
+func (s *Script) Apply(event *types.ChangeEvent) ([]*types.ChangeEvent, error) {
+	v, ok := s.vms.Get().(*vm)
+	if !ok {
+		var err error
+		if v, err = s.newVM(); err != nil {
+			return nil, err
+		}
+	}
+	defer s.vms.Put(v)
+
+	result, err := s.run(v.rt, func() (goja.Value, error) {
+		return v.fn(goja.Undefined(), v.rt.ToValue(toJS(event)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fromJS(event, result)
+}
+
+// toJS 将变更事件转换为脚本中的对象，字段与webhook载荷保持一致
+func toJS(event *types.ChangeEvent) map[string]interface{} {
+	eventTime := event.EventTime
+	if eventTime.IsZero() {
+		eventTime = event.Timestamp
+	}
+
+	obj := map[string]interface{}{
+		"task_id":    event.TaskID,
+		"event":      string(event.Event),
+		"database":   event.Database,
+		"table":      event.Table,
+		"primary_id": toJSValue(event.PrimaryID),
+		"timestamp":  event.Timestamp.UnixMilli(),
+		"event_time": eventTime.UnixMilli(),
+	}
+
+	switch event.Event {
+	case types.EventUpdate:
+		obj["old_data"] = toJSRow(event.OldData)
+		obj["new_data"] = toJSRow(event.NewData)
+	default:
+		obj["data"] = toJSRow(event.NewData)
+	}
+	return obj
+}
+
+// toJSRow 转换行数据
+func toJSRow(row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	converted := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		converted[column] = toJSValue(value)
+	}
+	return converted
+}
+
+// toJSValue 转换列值：binlog 中的文本列常以 []byte 出现，转为字符串；时间转为RFC3339字符串
+func toJSValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = toJSValue(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// fromJS 将脚本返回值转换为事件列表
+func fromJS(original *types.ChangeEvent, result goja.Value) ([]*types.ChangeEvent, error) {
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, nil
+	}
+
+	switch exported := result.Export().(type) {
+	case bool:
+		if !exported {
+			return nil, nil
+		}
+		return nil, errors.New("transform must return an object, an array, null or false, got true")
+	case map[string]interface{}:
+		event, err := toEvent(original, exported)
+		if err != nil {
+			return nil, err
+		}
+		return []*types.ChangeEvent{event}, nil
+	case []interface{}:
+		events := make([]*types.ChangeEvent, 0, len(exported))
+		for i, item := range exported {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("transform result[%d] must be an object, got %T", i, item)
+			}
+			event, err := toEvent(original, obj)
+			if err != nil {
+				return nil, fmt.Errorf("transform result[%d]: %w", i, err)
+			}
+			event.SubIndex = i
+			events = append(events, event)
+		}
+		return events, nil
+	default:
+		return nil, fmt.Errorf("transform must return an object, an array, null or false, got %T", exported)
+	}
+}
+
+// toEvent 以原事件为基础，用脚本返回的字段构造新事件，binlog 位置等元数据保持不变
+func toEvent(original *types.ChangeEvent, obj map[string]interface{}) (*types.ChangeEvent, error) {
+	event := *original
+	event.OldData = nil
+	event.NewData = nil
+
+	if value, ok := obj["event"]; ok {
+		eventType := types.EventType(fmt.Sprint(value))
+		switch eventType {
+		case types.EventInsert, types.EventUpdate, types.EventDelete:
+			event.Event = eventType
+		default:
+			return nil, fmt.Errorf("invalid event type: %v", value)
+		}
+	}
+	if value, ok := obj["database"].(string); ok {
+		event.Database = value
+	}
+	if value, ok := obj["table"].(string); ok {
+		event.Table = value
+	}
+	if value, ok := obj["primary_id"]; ok {
+		event.PrimaryID = value
+	}
+
+	var err error
+	if event.Event == types.EventUpdate {
+		if event.OldData, err = rowOf(obj, "old_data"); err != nil {
+			return nil, err
+		}
+		if event.NewData, err = rowOf(obj, "new_data"); err != nil {
+			return nil, err
+		}
+		if event.NewData == nil {
+			event.NewData, err = rowOf(obj, "data")
+		}
+	} else {
+		// INSERT 和 DELETE 的行数据都保存在 NewData 中
+		if event.NewData, err = rowOf(obj, "data"); err != nil {
+			return nil, err
+		}
+		if event.NewData == nil {
+			event.NewData, err = rowOf(obj, "new_data")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// rowOf 读取对象中的行数据字段
+func rowOf(obj map[string]interface{}, key string) (map[string]interface{}, error) {
+	value, ok := obj[key]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	row, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object, got %T", key, value)
+	}
+	return row, nil
+}
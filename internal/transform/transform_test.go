@@ -0,0 +1,182 @@
+package transform
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"pikachu/internal/log"
+	"pikachu/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := log.Init(&types.LogConfig{Level: types.LogLevelError, Format: "text"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// compile 编译内联脚本
+func compile(t *testing.T, script string, timeout time.Duration) *Script {
+	t.Helper()
+	s, err := Compile("users", &types.TransformConfig{Script: script, Timeout: timeout})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	return s
+}
+
+// testEvent 构造一个带 binlog 位置的插入事件
+func testEvent() *types.ChangeEvent {
+	return &types.ChangeEvent{
+		TaskID:    "users",
+		Event:     types.EventInsert,
+		Database:  "app",
+		Table:     "users",
+		PrimaryID: int64(1),
+		NewData:   map[string]interface{}{"id": int64(1), "first": "Ada", "last": []byte("Lovelace")},
+		Timestamp: time.Now(),
+		LogName:   "mysql-bin.000001",
+		LogPos:    1000,
+	}
+}
+
+func TestApplyDerivedField(t *testing.T) {
+	s := compile(t, `
+function transform(event) {
+	event.data.full_name = event.data.first + " " + event.data.last;
+	return event;
+}`, 0)
+
+	events, err := s.Apply(testEvent())
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Apply() returned %d events, want 1", len(events))
+	}
+	if got := events[0].NewData["full_name"]; got != "Ada Lovelace" {
+		t.Fatalf("full_name = %v, want Ada Lovelace", got)
+	}
+	if events[0].LogPos != 1000 || events[0].Event != types.EventInsert {
+		t.Fatalf("metadata changed: event = %s, log_pos = %d", events[0].Event, events[0].LogPos)
+	}
+}
+
+func TestApplySplitsArray(t *testing.T) {
+	s := compile(t, `
+function transform(event) {
+	return [
+		{event: "insert", table: "first_names", data: {name: event.data.first}},
+		{event: "insert", table: "last_names", data: {name: event.data.last}},
+	];
+}`, 0)
+
+	original := testEvent()
+	events, err := s.Apply(original)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Apply() returned %d events, want 2", len(events))
+	}
+	for i, event := range events {
+		if event.SubIndex != i {
+			t.Fatalf("events[%d].SubIndex = %d", i, event.SubIndex)
+		}
+	}
+	if events[0].Table != "first_names" || events[1].NewData["name"] != "Lovelace" {
+		t.Fatalf("unexpected events: %+v, %+v", events[0], events[1])
+	}
+	// 拆分出的事件共享 binlog 位置，ID 仍然互不相同
+	if events[0].ID() == events[1].ID() {
+		t.Fatal("split events share the same ID")
+	}
+	if events[0].ID() != original.ID() {
+		t.Fatal("the first split event should keep the original ID")
+	}
+}
+
+func TestApplyDropsEvent(t *testing.T) {
+	for _, result := range []string{"null", "undefined", "false", "event.data.first === 'Grace' && event"} {
+		t.Run(result, func(t *testing.T) {
+			s := compile(t, "function transform(event) { return "+result+"; }", 0)
+			events, err := s.Apply(testEvent())
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if len(events) != 0 {
+				t.Fatalf("Apply() returned %d events, want the event dropped", len(events))
+			}
+		})
+	}
+}
+
+func TestApplyRejectsInvalidResult(t *testing.T) {
+	for _, result := range []string{"true", "42", `"event"`, "[1]", `{event: "upsert"}`} {
+		t.Run(result, func(t *testing.T) {
+			s := compile(t, "function transform(event) { return "+result+"; }", 0)
+			if _, err := s.Apply(testEvent()); err == nil {
+				t.Fatal("Apply() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	s := compile(t, `
+function transform(event) {
+	if (event.data.first === "loop") {
+		while (true) {}
+	}
+	return event;
+}`, 50*time.Millisecond)
+
+	event := testEvent()
+	event.NewData["first"] = "loop"
+	start := time.Now()
+	if _, err := s.Apply(event); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Apply() error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("interrupted after %v", elapsed)
+	}
+
+	// 被中断的运行时放回对象池后仍然可用
+	if events, err := s.Apply(testEvent()); err != nil || len(events) != 1 {
+		t.Fatalf("Apply() after timeout = %d events, error = %v", len(events), err)
+	}
+}
+
+func TestSandboxHasNoHostAccess(t *testing.T) {
+	s := compile(t, `
+function transform(event) {
+	event.data.globals = [typeof require, typeof process, typeof module, typeof setTimeout, typeof console.log].join(",");
+	return event;
+}`, 0)
+
+	events, err := s.Apply(testEvent())
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := "undefined,undefined,undefined,undefined,function"
+	if got := events[0].NewData["globals"]; got != want {
+		t.Fatalf("globals = %v, want %s", got, want)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for name, script := range map[string]string{
+		"syntax error":       "function transform(event) {",
+		"missing entry":      "function convert(event) { return event; }",
+		"top level throws":   "throw new Error('boom'); function transform(event) { return event; }",
+		"entry not function": "var transform = 1;",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Compile("users", &types.TransformConfig{Script: script}); err == nil {
+				t.Fatal("Compile() succeeded, want an error")
+			}
+		})
+	}
+}
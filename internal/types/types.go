@@ -1,7 +1,10 @@
 package types
 
 import (
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"time"
 )
 
@@ -16,12 +19,203 @@ const (
 
 // Task 任务配置结构
 type Task struct {
-	TaskID              string      `yaml:"task_id"`
-	Name                string      `yaml:"name"`
-	TableName           string      `yaml:"table_name"`
-	Events              []EventType `yaml:"events"`
-	CallbackURL         string      `yaml:"callback_url"`
-	PrebuiltCallbackURL string      `yaml:"-"` // 预构建的完整回调URL，不序列化到YAML
+	TaskID              string                    `yaml:"task_id"`
+	Name                string                    `yaml:"name"`
+	TableName           string                    `yaml:"table_name"`
+	Events              []EventType               `yaml:"events"`
+	CallbackURL         string                    `yaml:"callback_url"`
+	Sink                SinkConfig                `yaml:"sink"`                 // 输出端配置，默认为HTTP回调
+	Format              PayloadFormat             `yaml:"format"`               // 载荷格式，默认为webhook
+	CloudEvents         *CloudEventsConfig        `yaml:"cloudevents"`          // CloudEvents格式配置
+	PayloadTemplate     string                    `yaml:"payload_template"`     // 自定义载荷模板（Go text/template），替代默认的webhook载荷
+	PayloadContentType  string                    `yaml:"payload_content_type"` // 自定义载荷的Content-Type，默认为 application/json
+	Transform           *TransformConfig          `yaml:"transform"`            // 事件转换脚本配置
+	SchemaRegistry      *SchemaRegistryConfig     `yaml:"schema_registry"`      // Schema Registry 配置，avro 和 protobuf 格式必填
+	Delivery            *DeliveryConfig           `yaml:"delivery"`             // 任务级投递策略，覆盖分发器的全局配置
+	Coalesce            *CoalesceConfig           `yaml:"coalesce"`             // 同一主键的变更合并配置
+	Destinations        []DestinationConfig       `yaml:"destinations"`         // 多个投递目标，设置后替代 callback_url 和 sink
+	TLS                 *TLSConfig                `yaml:"tls"`                  // 任务级HTTP客户端TLS配置，整体替代全局配置
+	Proxy               *ProxyConfig              `yaml:"proxy"`                // 任务级出站代理配置，整体替代全局配置
+	Method              string                    `yaml:"method"`               // HTTP请求方法：POST, PUT, PATCH (默认: POST)
+	Compression         *CompressionConfig        `yaml:"compression"`          // 请求体压缩配置
+	ResponseValidation  *ResponseValidationConfig `yaml:"response_validation"`  // 接收方响应校验配置
+	PrebuiltCallbackURL string                    `yaml:"-"`                    // 预构建的完整回调URL，不序列化到YAML
+}
+
+// DestinationConfig 任务的一个投递目标
+// 每个目标独立投递、重试和进入死信，一个目标失败或变慢不会导致其他目标重复投递
+type DestinationConfig struct {
+	Name                string                    `yaml:"name"`                // 目标名称，任务内唯一
+	CallbackURL         string                    `yaml:"callback_url"`        // webhook 回调地址，HTTP输出端必填
+	Sink                SinkConfig                `yaml:"sink"`                // 输出端配置，默认为HTTP回调
+	Delivery            *DeliveryConfig           `yaml:"delivery"`            // 目标级投递策略，覆盖任务级和全局配置
+	TLS                 *TLSConfig                `yaml:"tls"`                 // 目标级HTTP客户端TLS配置，整体替代任务级和全局配置
+	Proxy               *ProxyConfig              `yaml:"proxy"`               // 目标级出站代理配置，整体替代任务级和全局配置
+	Method              string                    `yaml:"method"`              // HTTP请求方法，为空时使用任务级配置
+	Compression         *CompressionConfig        `yaml:"compression"`         // 请求体压缩配置，为空时使用任务级配置
+	ResponseValidation  *ResponseValidationConfig `yaml:"response_validation"` // 响应校验配置，为空时使用任务级配置
+	PrebuiltCallbackURL string                    `yaml:"-"`                   // 预构建的完整回调URL
+}
+
+// TLSConfig HTTP客户端的TLS配置
+// 证书文件修改后自动重新加载，新建的连接使用新证书，进行中的请求不受影响
+type TLSConfig struct {
+	CAFile             string        `yaml:"ca_file"`              // CA证书（PEM，可包含多个），设置后只信任这些CA，为空时使用系统根证书
+	CertFile           string        `yaml:"cert_file"`            // 客户端证书（PEM），用于mTLS，需与 key_file 同时设置
+	KeyFile            string        `yaml:"key_file"`             // 客户端私钥（PEM）
+	ServerName         string        `yaml:"server_name"`          // 校验服务端证书时使用的主机名，为空时使用回调URL中的主机名
+	MinVersion         string        `yaml:"min_version"`          // 最低TLS版本：1.0, 1.1, 1.2, 1.3 (默认: 1.2)
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"` // 跳过服务端证书校验，仅用于开发环境
+	ReloadInterval     time.Duration `yaml:"reload_interval"`      // 检查证书文件是否修改的间隔 (默认: 30s)
+}
+
+// 请求体压缩算法
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// CompressionConfig HTTP回调请求体压缩配置，压缩后的请求带有 Content-Encoding 请求头
+type CompressionConfig struct {
+	Algorithm string `yaml:"algorithm"` // 压缩算法：gzip, zstd
+	MinSize   int    `yaml:"min_size"`  // 请求体达到该字节数才压缩 (默认: 1024)
+}
+
+// 响应校验失败时的处理方式
+const (
+	ResponseOnFailureRetry     = "retry"     // 按可重试失败处理
+	ResponseOnFailurePermanent = "permanent" // 按永久失败处理，直接进入死信
+)
+
+// ResponseValidationConfig 接收方响应校验配置
+// 接收方返回2xx后，响应体还需要满足校验条件才视为投递成功，json_path 和 regex 二选一
+type ResponseValidationConfig struct {
+	JSONPath      string `yaml:"json_path"`       // 响应体JSON中需要检查的字段，如 ok、$.result.status、items[0].ok
+	Equals        string `yaml:"equals"`          // json_path 字段的期望值，字符串按原值、其他类型按JSON文本比较 (默认: true)
+	Regex         string `yaml:"regex"`           // 响应体需匹配的正则表达式
+	OnFailure     string `yaml:"on_failure"`      // 校验失败时的处理：retry, permanent (默认: retry)
+	RetryJSONPath string `yaml:"retry_json_path"` // 校验失败时读取的布尔字段，true 重试、false 直接进入死信，覆盖 on_failure
+}
+
+// ProxyConfig HTTP客户端的出站代理配置
+// 发往 localhost、回环地址和unix域套接字的请求不经过代理
+type ProxyConfig struct {
+	URL     string `yaml:"url"`      // 代理地址，支持 http, https, socks5, socks5h，可包含用户名和密码；为空表示直连
+	NoProxy string `yaml:"no_proxy"` // 不经过代理的主机，逗号分隔，格式同 NO_PROXY 环境变量；为空时读取 NO_PROXY 环境变量
+}
+
+// DeliveryConfig 任务级投递策略，未设置的字段沿用 dispatcher 的全局配置
+type DeliveryConfig struct {
+	Timeout        time.Duration    `yaml:"timeout"`          // HTTP请求超时
+	MaxRetries     *int             `yaml:"max_retries"`      // 最大重试次数，设为0表示失败后不重试
+	RetryBaseDelay time.Duration    `yaml:"retry_base_delay"` // 重试基础延迟
+	RetryMaxDelay  time.Duration    `yaml:"retry_max_delay"`  // 最大重试延迟
+	MaxInFlight    int              `yaml:"max_in_flight"`    // 同时进行中的最大投递数，0表示不限制
+	RateLimit      *RateLimitConfig `yaml:"rate_limit"`       // 任务级限流
+}
+
+// Merge 返回以 c 为基础、用 override 中设置了的字段覆盖后的投递策略，两者都可以为nil
+func (c *DeliveryConfig) Merge(override *DeliveryConfig) *DeliveryConfig {
+	if override == nil {
+		return c
+	}
+	if c == nil {
+		return override
+	}
+
+	merged := *c
+	if override.Timeout > 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.MaxRetries != nil {
+		merged.MaxRetries = override.MaxRetries
+	}
+	if override.RetryBaseDelay > 0 {
+		merged.RetryBaseDelay = override.RetryBaseDelay
+	}
+	if override.RetryMaxDelay > 0 {
+		merged.RetryMaxDelay = override.RetryMaxDelay
+	}
+	if override.MaxInFlight > 0 {
+		merged.MaxInFlight = override.MaxInFlight
+	}
+	if override.RateLimit != nil {
+		merged.RateLimit = override.RateLimit
+	}
+	return &merged
+}
+
+// RateLimitConfig 令牌桶限流配置
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`  // 每秒允许的投递数
+	Burst int     `yaml:"burst"` // 允许的突发投递数 (默认: rate 向上取整)
+}
+
+// PayloadFormat 载荷格式
+type PayloadFormat string
+
+const (
+	FormatWebhook     PayloadFormat = "webhook"
+	FormatCloudEvents PayloadFormat = "cloudevents"
+	FormatDebezium    PayloadFormat = "debezium"
+	FormatMaxwell     PayloadFormat = "maxwell"
+	FormatCanal       PayloadFormat = "canal"
+	FormatAvro        PayloadFormat = "avro"
+	FormatProtobuf    PayloadFormat = "protobuf"
+)
+
+// SchemaRegistryConfig Confluent 兼容的 Schema Registry 配置，avro 和 protobuf 格式使用
+type SchemaRegistryConfig struct {
+	URL          string        `yaml:"url"`           // 注册中心地址，如 http://localhost:8081
+	Username     string        `yaml:"username"`      // Basic 认证用户名
+	Password     string        `yaml:"password"`      // Basic 认证密码
+	Subject      string        `yaml:"subject"`       // 主题模板，支持 {database} {table} {task_id} 占位符 (默认: {database}.{table}-value)
+	AutoRegister *bool         `yaml:"auto_register"` // 是否自动注册新 schema，关闭时只查找已注册的版本 (默认: true)
+	Timeout      time.Duration `yaml:"timeout"`       // 请求超时 (默认: 5s)
+}
+
+// CloudEvents 编码模式
+const (
+	CloudEventsStructured = "structured" // 事件属性和数据一起编码在消息体中
+	CloudEventsBinary     = "binary"     // 事件属性放在 ce- 消息头中，消息体只包含数据
+)
+
+// CloudEventsConfig CloudEvents格式配置
+type CloudEventsConfig struct {
+	Mode   string `yaml:"mode"`   // 编码模式：structured, binary (默认: structured)
+	Source string `yaml:"source"` // 事件来源，默认为 mysql://{host}:{port}/{database}
+}
+
+// SinkType 输出端类型
+type SinkType string
+
+const (
+	SinkHTTP   SinkType = "http"
+	SinkKafka  SinkType = "kafka"
+	SinkNATS   SinkType = "nats"
+	SinkRedis  SinkType = "redis"
+	SinkFile   SinkType = "file"
+	SinkStdout SinkType = "stdout"
+	SinkGRPC   SinkType = "grpc"
+)
+
+// SinkConfig 任务输出端配置
+type SinkConfig struct {
+	Type  SinkType         `yaml:"type"`  // 输出端类型，为空时使用http
+	Kafka *KafkaSinkConfig `yaml:"kafka"` // Kafka输出端配置
+	NATS  *NATSSinkConfig  `yaml:"nats"`  // NATS输出端配置
+	Redis *RedisSinkConfig `yaml:"redis"` // Redis Streams输出端配置
+	File  *FileSinkConfig  `yaml:"file"`  // 本地文件输出端配置
+	GRPC  *GRPCSinkConfig  `yaml:"grpc"`  // gRPC流式输出端配置
+}
+
+// KafkaSinkConfig Kafka输出端配置
+type KafkaSinkConfig struct {
+	Brokers  []string      `yaml:"brokers"`   // broker地址列表
+	Topic    string        `yaml:"topic"`     // 主题模板，支持 {database} {table} {event} {task_id} 占位符
+	Acks     string        `yaml:"acks"`      // 确认级别：all, leader, none (默认: all)
+	ClientID string        `yaml:"client_id"` // 客户端ID (默认: pikachu)
+	Timeout  time.Duration `yaml:"timeout"`   // 生产请求超时 (默认: 10s)
 }
 type EventTask struct {
 	TableName string
@@ -61,17 +255,84 @@ type DispatcherConfig struct {
 	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"` // 空闲连接超时
 	BatchSize       int           `yaml:"batch_size"`        // 批处理大小
 	BatchTimeout    time.Duration `yaml:"batch_timeout"`     // 批处理超时
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"` // 熔断器配置
+
+	RetryableStatusCodes []int            `yaml:"retryable_status_codes"` // 可重试的HTTP状态码，其他非2xx状态码视为永久失败 (默认: 408, 425, 429 和除 501、505 外的 5xx)
+	MaxRetryAfter        time.Duration    `yaml:"max_retry_after"`        // Retry-After 响应头允许的最长等待时间 (默认: 10m)
+	DeadLetter           DeadLetterConfig `yaml:"dead_letter"`            // 死信配置
+
+	HostRateLimits      map[string]RateLimitConfig `yaml:"host_rate_limits"`     // 按回调主机限流，键为 host 或 host:port
+	AdaptiveConcurrency AdaptiveConcurrencyConfig  `yaml:"adaptive_concurrency"` // 自适应并发限制
+	Overflow            OverflowConfig             `yaml:"overflow"`             // 工作队列满时的溢出队列配置
+
+	DrainTimeout time.Duration `yaml:"drain_timeout"` // 停止时等待队列中和进行中的投递完成的最长时间，超时后未完成的投递写入溢出文件 (默认: 30s)
+
+	TLS   *TLSConfig   `yaml:"tls"`   // HTTP客户端TLS配置，为空时使用系统根证书和默认设置
+	Proxy *ProxyConfig `yaml:"proxy"` // 出站代理配置，为空时直连
+}
+
+// AdaptiveConcurrencyConfig 自适应并发限制配置（AIMD）
+// 每个任务的并发上限在投递成功且延迟正常时逐步增加，出现失败或延迟超过阈值时按比例减小
+type AdaptiveConcurrencyConfig struct {
+	Enabled          bool          `yaml:"enabled"`           // 是否启用
+	MinLimit         int           `yaml:"min_limit"`         // 并发下限 (默认: 1)
+	MaxLimit         int           `yaml:"max_limit"`         // 并发上限，任务设置了 max_in_flight 时取较小值 (默认: worker_count)
+	LatencyThreshold time.Duration `yaml:"latency_threshold"` // 投递耗时超过该值视为接收方过载 (默认: 1s)
+	DecreaseFactor   float64       `yaml:"decrease_factor"`   // 过载时并发上限的缩减比例 (默认: 0.5)
+}
+
+// OverflowConfig 溢出队列配置
+// 工作队列满时事件进入溢出队列等待，而不是被丢弃；内存中的事件超过上限后写入磁盘
+type OverflowConfig struct {
+	MaxPending     int    `yaml:"max_pending"`       // 内存中最多暂存的事件数 (默认: 100000)
+	SpillPath      string `yaml:"spill_path"`        // 溢出文件路径，为空时不写入磁盘，超过内存上限的事件被丢弃
+	SpillMaxSizeMB int    `yaml:"spill_max_size_mb"` // 溢出文件的最大大小 (默认: 1024)
+}
+
+// DeadLetterConfig 死信配置，永久失败和超过重试次数的投递以NDJSON格式写入本地文件
+type DeadLetterConfig struct {
+	Path       string `yaml:"path"`        // 死信文件路径，为空时不记录死信
+	MaxSizeMB  int    `yaml:"max_size_mb"` // 单个文件的最大大小，超过后轮转
+	MaxBackups int    `yaml:"max_backups"` // 保留的历史文件数量
+	Compress   bool   `yaml:"compress"`    // 是否gzip压缩历史文件
+}
+
+// 熔断器的隔离范围
+const (
+	CircuitBreakerScopeHost = "host" // 按回调主机隔离，同一主机的任务共享熔断器
+	CircuitBreakerScopeTask = "task" // 按任务隔离
+)
+
+// CircuitBreakerConfig 熔断器配置
+// 连续失败达到阈值后熔断，熔断期间的投递被暂存，冷却后放行探测请求，成功则恢复
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`            // 是否启用熔断器
+	Scope            string        `yaml:"scope"`              // 隔离范围：host, task (默认: host)
+	FailureThreshold int           `yaml:"failure_threshold"`  // 触发熔断的连续失败次数 (默认: 5)
+	OpenTimeout      time.Duration `yaml:"open_timeout"`       // 熔断后进入半开状态前的冷却时间 (默认: 30s)
+	HalfOpenRequests int           `yaml:"half_open_requests"` // 半开状态允许的探测请求数 (默认: 1)
+	MaxParked        int           `yaml:"max_parked"`         // 每个熔断器最多暂存的投递数，超出后丢弃 (默认: 10000)
 }
 
 // MonitorConfig 监控器配置
 type MonitorConfig struct {
-	EventQueueSize    int           `yaml:"event_queue_size"`    // 事件队列大小
-	EventQueueTimeout time.Duration `yaml:"event_queue_timeout"` // 事件队列超时时间
-	BatchSize         int           `yaml:"batch_size"`          // 批处理大小
-	BatchTimeout      time.Duration `yaml:"batch_timeout"`       // 批处理超时
-	FlushInterval     time.Duration `yaml:"flush_interval"`      // 刷新间隔
+	EventQueueSize     int           `yaml:"event_queue_size"`    // 事件队列大小
+	EventQueueTimeout  time.Duration `yaml:"event_queue_timeout"` // 事件队列超时时间
+	BatchSize          int           `yaml:"batch_size"`          // 批处理大小
+	BatchTimeout       time.Duration `yaml:"batch_timeout"`       // 批处理超时
+	FlushInterval      time.Duration `yaml:"flush_interval"`      // 刷新间隔
+	Backpressure       string        `yaml:"backpressure"`        // 队列满时的处理方式：drop, block (默认: drop)
+	CheckpointPath     string        `yaml:"checkpoint_path"`     // binlog 位点文件路径，启动时从保存的位点继续；为空时每次从当前主库位点开始
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"` // 定期保存位点的间隔，仅在所有事件都已投递完成时保存；为0时只在停止时保存（启用选主时默认: 10s）
 }
 
+// 队列满时的处理方式
+const (
+	BackpressureDrop  = "drop"  // 事件队列等待超过 event_queue_timeout 后报错，溢出队列也满时丢弃事件
+	BackpressureBlock = "block" // 无损模式：分发器阻塞监控器，暂停读取 binlog，直到队列有空间
+)
+
 // Config 配置文件结构
 type Config struct {
 	Database     DatabaseConfig   `yaml:"database"`
@@ -80,13 +341,44 @@ type Config struct {
 	Server       ServerConfig     `yaml:"server"`
 	Dispatcher   DispatcherConfig `yaml:"dispatcher"`
 	Monitor      MonitorConfig    `yaml:"monitor"`
+	Election     ElectionConfig   `yaml:"election"`
+	Cluster      ClusterConfig    `yaml:"cluster"`
 	CallbackHost string           `yaml:"callback_host"` // 回调主机地址，用于不同环境配置
 }
 
+// ElectionConfig 主备选举配置，部署多个实例时只有主节点读取 binlog 并投递
+type ElectionConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Type          string        `yaml:"type"`           // 选举方式：mysql（默认，使用 GET_LOCK）、file（租约文件），也可以是注册的其他实现
+	ID            string        `yaml:"id"`             // 实例标识（默认: 主机名-进程号）
+	LockName      string        `yaml:"lock_name"`      // mysql 方式的锁名称（默认: pikachu-leader）
+	LeasePath     string        `yaml:"lease_path"`     // file 方式的租约文件路径，所有实例必须指向同一文件
+	LeaseDuration time.Duration `yaml:"lease_duration"` // file 方式的租约有效期，超过该时间未续约其他实例即可接管（默认: 15s）
+	RenewInterval time.Duration `yaml:"renew_interval"` // 续约或检查锁的间隔，也是备节点尝试接管的间隔（默认: 5s）
+}
+
+// 选举方式
+const (
+	ElectionMySQL = "mysql" // MySQL GET_LOCK，锁随持有连接断开自动释放
+	ElectionFile  = "file"  // 共享存储上的租约文件
+)
+
+// ClusterConfig 集群模式配置，任务按 task_id 的一致性哈希分配到各实例，成员关系通过 MySQL 协调表维护
+type ClusterConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	ID                string        `yaml:"id"`                 // 实例标识（默认: 主机名-进程号）
+	Table             string        `yaml:"table"`              // 成员表名称，任务位点保存在 <table>_checkpoints 表中（默认: pikachu_cluster）
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"` // 心跳和检查成员变化的间隔（默认: 5s）
+	MemberTimeout     time.Duration `yaml:"member_timeout"`     // 超过该时间没有心跳的实例被移出集群（默认: 30s）
+	VirtualNodes      int           `yaml:"virtual_nodes"`      // 每个实例在哈希环上的虚拟节点数（默认: 64）
+	MaxInstances      int           `yaml:"max_instances"`      // 最大实例数，实例的 server_id 为 database.server_id 加上 0 到 max_instances-1 的序号（默认: 16）
+}
+
 // LogConfig 日志配置
 type LogConfig struct {
 	Level  LogLevel `yaml:"level"`
 	Format string   `yaml:"format"` // text, json
+	Output string   `yaml:"output"` // text 格式日志的输出位置：stdout, stderr (默认: stdout，配置了标准输出输出端时为 stderr)
 }
 
 // DatabaseConfig 数据库配置
@@ -100,19 +392,120 @@ type DatabaseConfig struct {
 	Charset  string `yaml:"charset"` // 数据库字符集，可选，默认为utf8mb4
 }
 
+// NATSSinkConfig NATS输出端配置
+type NATSSinkConfig struct {
+	URL         string        `yaml:"url"`         // 服务器地址，多个地址用逗号分隔
+	Subject     string        `yaml:"subject"`     // 主题模板，支持 {database} {table} {event} {task_id} 占位符
+	JetStream   bool          `yaml:"jetstream"`   // 是否使用JetStream发布并等待确认
+	Stream      string        `yaml:"stream"`      // 期望写入的JetStream流名称，可选
+	Credentials string        `yaml:"credentials"` // 凭证文件路径，可选
+	Timeout     time.Duration `yaml:"timeout"`     // 发布超时 (默认: 5s)
+}
+
+// RedisSinkConfig Redis Streams输出端配置
+type RedisSinkConfig struct {
+	Addr        string        `yaml:"addr"`         // 服务器地址，如 localhost:6379
+	Username    string        `yaml:"username"`     // 用户名，可选
+	Password    string        `yaml:"password"`     // 密码，可选
+	DB          int           `yaml:"db"`           // 数据库编号
+	Stream      string        `yaml:"stream"`       // 流名称模板，支持 {database} {table} {event} {task_id} 占位符
+	MaxLen      int64         `yaml:"max_len"`      // 流的最大长度，0表示不裁剪
+	ExactTrim   bool          `yaml:"exact_trim"`   // 是否精确裁剪，默认使用近似裁剪(~)以提升性能
+	FieldLayout string        `yaml:"field_layout"` // 字段布局：json 单字段JSON, columns 按列展开 (默认: json)
+	Timeout     time.Duration `yaml:"timeout"`      // 命令超时 (默认: 5s)
+}
+
+// FileSinkConfig 本地文件输出端配置，事件以NDJSON格式追加写入
+type FileSinkConfig struct {
+	Path           string        `yaml:"path"`            // 文件路径，轮转后的文件在同一目录下
+	MaxSizeMB      int           `yaml:"max_size_mb"`     // 单个文件最大大小(MB)，0表示不按大小轮转
+	RotateInterval time.Duration `yaml:"rotate_interval"` // 按时间轮转的间隔，0表示不按时间轮转
+	MaxBackups     int           `yaml:"max_backups"`     // 保留的历史文件数量，0表示全部保留
+	Compress       bool          `yaml:"compress"`        // 是否gzip压缩轮转后的文件
+}
+
+// GRPCSinkConfig gRPC流式输出端配置
+type GRPCSinkConfig struct {
+	Target      string        `yaml:"target"`        // 服务端地址，如 localhost:9090 或 dns:///events.internal:443
+	TLS         bool          `yaml:"tls"`           // 是否使用TLS（系统根证书）
+	MaxInFlight int           `yaml:"max_in_flight"` // 未确认事件的最大数量，用于流量控制 (默认: 100)
+	AckTimeout  time.Duration `yaml:"ack_timeout"`   // 等待单条事件确认的超时 (默认: 10s)
+}
+
+// 转换脚本出错时的处理方式
+const (
+	TransformOnErrorPass = "pass" // 原样投递原始事件
+	TransformOnErrorDrop = "drop" // 丢弃事件
+)
+
+// CoalesceConfig 变更合并配置
+// 同一主键在窗口内的多次变更合并为一个事件：UPDATE 合并为第一次的旧数据和最后一次的新数据，
+// INSERT 后的 UPDATE 合并为 INSERT，UPDATE 后的 DELETE 合并为 DELETE
+type CoalesceConfig struct {
+	Window             time.Duration `yaml:"window"`               // 合并窗口，从主键的第一个事件开始计时
+	CancelInsertDelete bool          `yaml:"cancel_insert_delete"` // 窗口内先插入后删除的行不发送任何事件
+	MaxKeys            int           `yaml:"max_keys"`             // 最多同时合并的主键数，超出时提前发送最早的事件 (默认: 10000)
+}
+
+// TransformConfig 事件转换脚本配置，脚本在内嵌的JavaScript引擎中执行
+type TransformConfig struct {
+	Script  string        `yaml:"script"`   // 内联脚本
+	File    string        `yaml:"file"`     // 脚本文件路径，与 script 二选一
+	Timeout time.Duration `yaml:"timeout"`  // 单次执行超时 (默认: 100ms)
+	OnError string        `yaml:"on_error"` // 脚本出错时的处理方式：pass, drop (默认: pass)
+}
+
 // ChangeEvent 数据变更事件
 type ChangeEvent struct {
 	TaskID    string
 	Event     EventType
+	Database  string
 	Table     string
 	PrimaryID interface{}
 	OldData   map[string]interface{}
 	NewData   map[string]interface{}
-	Timestamp time.Time
+	Timestamp time.Time // 检测到变更的时间
+	EventTime time.Time // binlog中记录的事件时间
+
+	// binlog 位置信息
+	LogName   string // binlog 文件名
+	LogPos    uint32 // 行事件在 binlog 中的结束位置
+	GTID      string // 所在事务的GTID，未启用GTID时为空
+	TxnOffset uint32 // 行事件相对所在事务GTID事件的偏移，未启用GTID时为0
+	RowIndex  int    // 在行事件中的行序号，从0开始
+	SubIndex  int    // 转换脚本将一行拆分为多个事件时的序号，从0开始
+
+	PrimaryKeys []string     // 主键列名
+	Schema      *TableSchema // 表结构，可能为nil
+}
+
+// ID 返回事件ID，用作幂等键和消息去重ID
+//
+// ID由任务和事件在 binlog 中的位置决定：启用GTID时使用事务的GTID、行事件在事务中的偏移和行序号，
+// 切换到拥有相同 binlog 的从库后保持不变；否则使用 binlog 文件名、位置和行序号。
+// 同一事件的重试、重启后从位点重新读取产生的事件都得到相同的ID，接收方可据此去重
+func (e *ChangeEvent) ID() string {
+	hasher := sha1.New()
+	switch {
+	case e.GTID != "":
+		fmt.Fprintf(hasher, "%s\x00gtid\x00%s\x00%d\x00%d", e.TaskID, e.GTID, e.TxnOffset, e.RowIndex)
+	case e.LogName != "":
+		fmt.Fprintf(hasher, "%s\x00pos\x00%s\x00%d\x00%d", e.TaskID, e.LogName, e.LogPos, e.RowIndex)
+	default:
+		// 没有 binlog 位置的事件（如示例事件）只能按内容生成
+		fmt.Fprintf(hasher, "%s\x00%s\x00%s\x00%s\x00%v\x00%d",
+			e.TaskID, e.Database, e.Table, e.Event, e.PrimaryID, e.Timestamp.UnixNano())
+	}
+	if e.SubIndex > 0 {
+		// 转换脚本拆分出的事件共享位置，用序号区分
+		fmt.Fprintf(hasher, "\x00%d", e.SubIndex)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
 }
 
 // WebhookPayload webhook载荷结构
 type WebhookPayload struct {
+	EventID   string                 `json:"event_id"` // 事件ID，重试和重启后保持不变，用于幂等处理
 	Event     EventType              `json:"event"`
 	Table     string                 `json:"table"`
 	PrimaryID interface{}            `json:"primary_id"`
@@ -125,12 +518,19 @@ type WebhookPayload struct {
 // CallbackTask 回调任务
 type CallbackTask struct {
 	Event       *ChangeEvent
+	Destination string // 投递目标名称，单目标任务为空
 	CallbackURL string
 	RetryCount  int
 	MaxRetries  int
+	Carried     bool // 从启动时残留的溢出文件恢复，早于已保存的位点，中止时仍需保留
+
+	// 分发器内部的限流状态，不写入溢出文件
+	RateGates int  // 已取得令牌的限流器数量（依次为投递目标、回调主机），重新入队后从下一个限流器继续
+	Unparked  bool // 刚被并发限制器唤醒，再次受限时排在暂存队列的最前面
 }
 
 // TableSchema 表结构信息
 type TableSchema struct {
-	Columns map[string]*sql.ColumnType
+	Columns     map[string]*sql.ColumnType
+	ColumnNames []string // 按表中定义顺序排列的列名
 }
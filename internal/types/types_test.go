@@ -0,0 +1,115 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+// rowEvent 构造一个位于 binlog 指定位置的行事件
+func rowEvent(logPos uint32, rowIndex int) *ChangeEvent {
+	return &ChangeEvent{
+		TaskID:    "users",
+		Event:     EventUpdate,
+		Database:  "app",
+		Table:     "users",
+		PrimaryID: int64(42),
+		OldData:   map[string]interface{}{"id": int64(42), "name": "old"},
+		NewData:   map[string]interface{}{"id": int64(42), "name": "new"},
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		EventTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		LogName:   "mysql-bin.000007",
+		LogPos:    logPos,
+		RowIndex:  rowIndex,
+	}
+}
+
+func TestChangeEventIDStableAcrossRetries(t *testing.T) {
+	event := rowEvent(1200, 0)
+	id := event.ID()
+	for i := 0; i < 3; i++ {
+		if got := event.ID(); got != id {
+			t.Fatalf("attempt %d: ID changed from %s to %s", i, id, got)
+		}
+	}
+}
+
+func TestChangeEventIDStableAcrossRestarts(t *testing.T) {
+	first := rowEvent(1200, 1)
+
+	// 重启后从位点重新读取：接收时间不同，行数据按新读取的结果重建，但 binlog 位置相同
+	reread := rowEvent(1200, 1)
+	reread.Timestamp = first.Timestamp.Add(time.Hour)
+	reread.NewData = map[string]interface{}{"id": int64(42), "name": "new"}
+	if first.ID() != reread.ID() {
+		t.Fatalf("ID changed after re-reading the same row: %s != %s", first.ID(), reread.ID())
+	}
+
+	// 启用GTID时切换到拥有相同 binlog 的从库，文件名和位置不同但ID不变
+	gtid := rowEvent(1200, 1)
+	gtid.GTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562:23"
+	gtid.TxnOffset = 310
+	failover := rowEvent(98765, 1)
+	failover.LogName = "replica-bin.000002"
+	failover.GTID = gtid.GTID
+	failover.TxnOffset = gtid.TxnOffset
+	if gtid.ID() != failover.ID() {
+		t.Fatalf("ID changed after failover with the same GTID: %s != %s", gtid.ID(), failover.ID())
+	}
+}
+
+func TestChangeEventIDDistinguishesEvents(t *testing.T) {
+	base := rowEvent(1200, 0)
+	otherRow := rowEvent(1200, 1)
+	otherPos := rowEvent(1500, 0)
+	split := rowEvent(1200, 0)
+	split.SubIndex = 1
+	otherTask := rowEvent(1200, 0)
+	otherTask.TaskID = "orders"
+
+	ids := map[string]string{"base": base.ID()}
+	for name, event := range map[string]*ChangeEvent{
+		"other row":  otherRow,
+		"other pos":  otherPos,
+		"split":      split,
+		"other task": otherTask,
+	} {
+		id := event.ID()
+		for seen, seenID := range ids {
+			if id == seenID {
+				t.Fatalf("%s has the same ID as %s: %s", name, seen, id)
+			}
+		}
+		ids[name] = id
+	}
+}
+
+func TestDeliveryConfigMerge(t *testing.T) {
+	zero, five := 0, 5
+	task := &DeliveryConfig{MaxRetries: &five, RetryBaseDelay: 2 * time.Second, MaxInFlight: 4}
+
+	if got := (*DeliveryConfig)(nil).Merge(nil); got != nil {
+		t.Fatalf("nil.Merge(nil) = %+v, want nil", got)
+	}
+	if got := (*DeliveryConfig)(nil).Merge(task); got != task {
+		t.Fatal("nil.Merge(override) should return the override")
+	}
+	if got := task.Merge(nil); got != task {
+		t.Fatal("Merge(nil) should return the base config")
+	}
+
+	// 指针为0的 max_retries 覆盖任务级配置，nil 沿用任务级配置
+	merged := task.Merge(&DeliveryConfig{MaxRetries: &zero, RetryMaxDelay: time.Minute})
+	if merged.MaxRetries == nil || *merged.MaxRetries != 0 {
+		t.Fatalf("max_retries = %v, want 0", merged.MaxRetries)
+	}
+	if merged.RetryBaseDelay != 2*time.Second || merged.RetryMaxDelay != time.Minute || merged.MaxInFlight != 4 {
+		t.Fatalf("merged = %+v, want base delay and max_in_flight from the task", merged)
+	}
+	merged = task.Merge(&DeliveryConfig{MaxInFlight: 2})
+	if *merged.MaxRetries != 5 || merged.MaxInFlight != 2 {
+		t.Fatalf("merged = %+v, want max_retries 5 and max_in_flight 2", merged)
+	}
+	if *task.MaxRetries != 5 || task.MaxInFlight != 4 || task.RetryMaxDelay != 0 {
+		t.Fatalf("Merge modified the base config: %+v", task)
+	}
+}
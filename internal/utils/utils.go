@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 )
@@ -52,10 +53,42 @@ func GetUserAgent() string {
 	return fmt.Sprintf("pikachu/%s", Version)
 }
 
+// DefaultInstanceID 返回默认的实例标识：主机名-进程号，用于主备选举和集群模式
+func DefaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "pikachu"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// UnixSocketURLPrefix unix域套接字回调地址的前缀，完整格式为 unix:///path/to/app.sock:/webhook
+const UnixSocketURLPrefix = "unix://"
+
+// ParseUnixSocketURL 解析 unix:///path/to/app.sock:/webhook 格式的回调地址，返回套接字路径和请求路径
+// 以第一个 : 分隔套接字路径和请求路径，因此不支持包含 : 的套接字路径；
+// 省略请求路径时为 /，不是unix域套接字地址时 ok 为false
+func ParseUnixSocketURL(callbackURL string) (socketPath, requestPath string, ok bool) {
+	if !strings.HasPrefix(callbackURL, UnixSocketURLPrefix) {
+		return "", "", false
+	}
+
+	socketPath = strings.TrimPrefix(callbackURL, UnixSocketURLPrefix)
+	requestPath = "/"
+	if i := strings.Index(socketPath, ":"); i >= 0 {
+		if socketPath[i+1:] != "" {
+			requestPath = socketPath[i+1:]
+		}
+		socketPath = socketPath[:i]
+	}
+	return socketPath, requestPath, true
+}
+
 // BuildCallbackURL 构建完整的回调URL
 func BuildCallbackURL(callbackHost, callbackURL string) string {
-	// 如果callbackURL已经是绝对URL，直接返回
-	if strings.HasPrefix(callbackURL, "http://") || strings.HasPrefix(callbackURL, "https://") {
+	// 如果callbackURL已经是绝对URL或unix域套接字地址，直接返回
+	if strings.HasPrefix(callbackURL, "http://") || strings.HasPrefix(callbackURL, "https://") ||
+		strings.HasPrefix(callbackURL, UnixSocketURLPrefix) {
 		return callbackURL
 	}
 
@@ -64,13 +97,19 @@ func BuildCallbackURL(callbackHost, callbackURL string) string {
 		return callbackURL
 	}
 
-	// 确保callbackHost以/结尾，callbackURL以/开头
-	if !strings.HasSuffix(callbackHost, "/") {
-		callbackHost += "/"
-	}
 	if !strings.HasPrefix(callbackURL, "/") {
 		callbackURL = "/" + callbackURL
 	}
 
+	// callbackHost为unix域套接字时，以 : 分隔套接字路径和请求路径
+	if strings.HasPrefix(callbackHost, UnixSocketURLPrefix) {
+		return strings.TrimSuffix(callbackHost, ":") + ":" + callbackURL
+	}
+
+	// 确保callbackHost以/结尾
+	if !strings.HasSuffix(callbackHost, "/") {
+		callbackHost += "/"
+	}
+
 	return callbackHost + strings.TrimPrefix(callbackURL, "/")
 }
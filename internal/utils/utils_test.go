@@ -0,0 +1,42 @@
+package utils
+
+import "testing"
+
+func TestBuildCallbackURL(t *testing.T) {
+	for _, tc := range []struct {
+		host, url, want string
+	}{
+		{"", "/webhook", "/webhook"},
+		{"http://receiver:8080", "/webhook", "http://receiver:8080/webhook"},
+		{"http://receiver:8080/", "webhook", "http://receiver:8080/webhook"},
+		{"http://receiver:8080", "https://other/webhook", "https://other/webhook"},
+		{"unix:///var/run/receiver.sock", "/webhook", "unix:///var/run/receiver.sock:/webhook"},
+		{"unix:///var/run/receiver.sock:", "webhook", "unix:///var/run/receiver.sock:/webhook"},
+		{"unix:///var/run/receiver.sock", "/users/{id}?q={name}", "unix:///var/run/receiver.sock:/users/{id}?q={name}"},
+		{"http://receiver:8080", "unix:///var/run/app.sock:/hook", "unix:///var/run/app.sock:/hook"},
+	} {
+		if got := BuildCallbackURL(tc.host, tc.url); got != tc.want {
+			t.Errorf("BuildCallbackURL(%q, %q) = %q, want %q", tc.host, tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestParseUnixSocketURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, socketPath, requestPath string
+		ok                           bool
+	}{
+		{"unix:///var/run/app.sock:/webhook?a=b:c", "/var/run/app.sock", "/webhook?a=b:c", true},
+		{"unix:///var/run/app.sock", "/var/run/app.sock", "/", true},
+		{"unix:///var/run/app.sock:", "/var/run/app.sock", "/", true},
+		// 以第一个 : 分隔，套接字路径中的 : 无法表示
+		{"unix:///var/run/app:1.sock:/webhook", "/var/run/app", "1.sock:/webhook", true},
+		{"http://receiver/webhook", "", "", false},
+	} {
+		socketPath, requestPath, ok := ParseUnixSocketURL(tc.url)
+		if socketPath != tc.socketPath || requestPath != tc.requestPath || ok != tc.ok {
+			t.Errorf("ParseUnixSocketURL(%q) = %q, %q, %v, want %q, %q, %v",
+				tc.url, socketPath, requestPath, ok, tc.socketPath, tc.requestPath, tc.ok)
+		}
+	}
+}
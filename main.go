@@ -10,13 +10,16 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
+	"pikachu/internal/cluster"
 	"pikachu/internal/config"
 	"pikachu/internal/dispatcher"
+	"pikachu/internal/election"
 	"pikachu/internal/log"
 	"pikachu/internal/metrics"
 	"pikachu/internal/monitor"
@@ -30,6 +33,7 @@ var eventQueue chan *types.ChangeEvent
 // 系统状态信息
 var systemStatus = struct {
 	mutex             sync.RWMutex
+	Role              string // 主备角色，未启用选主时为 leader
 	MonitorRunning    bool
 	DispatcherRunning bool
 	EventQueueSize    int
@@ -39,6 +43,9 @@ var systemStatus = struct {
 // 全局指标收集器
 var globalMetrics *metrics.Metrics
 
+// 集群协调器，仅集群模式下设置
+var clusterCoordinator atomic.Pointer[cluster.Coordinator]
+
 func main() {
 	// 解析命令行参数
 	configFile := flag.String("config", "config.yaml", "配置文件路径")
@@ -76,6 +83,9 @@ func main() {
 	log.Info("LoadConfig success")
 	log.Info("ValidateConfig success")
 
+	// 初始化全局指标收集器，分发器和健康检查共用
+	globalMetrics = metrics.NewMetrics()
+
 	// 如果启用了HTTP服务器，则启动健康检查
 	if cfg.Server.Enabled {
 		go startHealthCheckServer(cfg)
@@ -89,6 +99,130 @@ func main() {
 	// 创建事件队列 (使用配置的缓冲大小)
 	eventQueue = make(chan *types.ChangeEvent, cfg.Monitor.EventQueueSize)
 
+	// 等待中断信号
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch {
+	case cfg.Election.Enabled:
+		runElection(ctx, cfg)
+	case cfg.Cluster.Enabled:
+		runCluster(ctx, cfg)
+	default:
+		setRole(election.RoleLeader)
+		lead(ctx, cfg, nil)
+	}
+
+	log.Info("Pikachu stopped")
+	// 关闭日志器，确保所有日志都被刷新
+	log.Close()
+}
+
+// runElection 参与主备选举：作为备节点等待，成为主节点后开始工作，失去主节点身份后回到备节点，直到收到停止信号
+func runElection(ctx context.Context, cfg *types.Config) {
+	elector, err := election.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to create elector", zap.Error(err))
+	}
+	defer elector.Close()
+
+	for {
+		setRole(election.RoleStandby)
+		log.Info("Running as standby, waiting for leadership",
+			zap.String("type", cfg.Election.Type), zap.String("id", cfg.Election.ID))
+
+		lost, err := elector.Campaign(ctx)
+		if err != nil {
+			log.Info("Received shutdown signal")
+			return
+		}
+		setRole(election.RoleLeader)
+		log.Info("Became leader", zap.String("id", cfg.Election.ID))
+
+		lostLeadership := lead(ctx, cfg, lost)
+		// 正常停止时位点已保存，主动释放身份让备节点立即接管
+		if err := elector.Resign(); err != nil {
+			log.Warn("Failed to resign leadership", zap.Error(err))
+		}
+		if !lostLeadership {
+			return
+		}
+	}
+}
+
+// lead 读取 binlog 并投递，直到收到停止信号或 lost 关闭（失去主节点身份），失去身份时返回true
+func lead(ctx context.Context, cfg *types.Config, lost <-chan struct{}) bool {
+	p := startPipeline(cfg, nil)
+	if !p.wait(ctx, lost) {
+		p.stop()
+		return false
+	}
+
+	log.Error("Lost leadership, stopping binlog reading and deliveries")
+	p.abort()
+	return true
+}
+
+// runCluster 以集群模式运行：按分到的任务读取 binlog 并投递，成员变化导致分配改变时停止原来的任务后按新的分配重启，
+// 直到收到停止信号；停止后离开集群，其他实例随即接管本实例的任务
+func runCluster(ctx context.Context, cfg *types.Config) {
+	coordinator, err := cluster.Join(ctx, cfg)
+	if err != nil {
+		log.Fatal("Failed to join cluster", zap.Error(err))
+	}
+	clusterCoordinator.Store(coordinator)
+	defer coordinator.Leave()
+
+	for {
+		assignment := coordinator.Assignment()
+		if len(assignment.Tasks) == 0 {
+			log.Info("No tasks assigned to this instance, waiting for rebalance")
+			select {
+			case <-ctx.Done():
+				log.Info("Received shutdown signal")
+				return
+			case <-assignment.Changed():
+				continue
+			}
+		}
+
+		// 等待原所有者交出任务，避免两个实例同时投递同一任务、互相覆盖位点
+		if !coordinator.Claim(ctx, assignment) {
+			releaseTasks(coordinator, assignment)
+			if ctx.Err() != nil {
+				log.Info("Received shutdown signal")
+				return
+			}
+			continue
+		}
+
+		p := startPipeline(assignment.Config(cfg), coordinator)
+		interrupted := p.wait(ctx, assignment.Changed())
+		p.handOver()
+		releaseTasks(coordinator, assignment)
+		if !interrupted {
+			return
+		}
+		log.Info("Cluster assignment changed, restarting with the new tasks")
+	}
+}
+
+// releaseTasks 释放分配中本实例拥有的任务，一直无法释放时其他实例在本实例心跳过期后取得
+func releaseTasks(coordinator *cluster.Coordinator, assignment *cluster.Assignment) {
+	if err := coordinator.Release(assignment.Tasks); err != nil {
+		log.Warn("Failed to release tasks", zap.Error(err))
+	}
+}
+
+// pipeline 一组任务的 binlog 读取和投递
+type pipeline struct {
+	cfg      *types.Config
+	mon      *monitor.Monitor
+	dispatch *dispatcher.Dispatcher
+}
+
+// startPipeline 创建并启动监控器和分发器，store 不为nil时按任务在其中保存位点
+func startPipeline(cfg *types.Config, store monitor.CheckpointStore) *pipeline {
 	// 创建事件回调函数，用于更新系统状态
 	eventCallback := func() {
 		systemStatus.mutex.Lock()
@@ -97,16 +231,19 @@ func main() {
 	}
 
 	// 创建监控器
-	mon, err := monitor.New(cfg, eventQueue, eventCallback)
+	mon, err := monitor.New(cfg, eventQueue, eventCallback, globalMetrics)
 	if err != nil {
 		log.Fatal("Failed to create monitor", zap.Error(err))
 	}
+	if store != nil {
+		mon.SetCheckpointStore(store)
+	}
 	log.Info("Create monitor success")
-	// 初始化全局指标收集器
-	globalMetrics = metrics.NewMetrics()
-
 	// 创建分发器
-	dispatch := dispatcher.New(cfg, eventQueue)
+	dispatch, err := dispatcher.New(cfg, eventQueue, globalMetrics)
+	if err != nil {
+		log.Fatal("Failed to create dispatcher", zap.Error(err))
+	}
 
 	// 启动分发器
 	dispatch.Start()
@@ -128,12 +265,36 @@ func main() {
 	time.Sleep(2 * time.Second)
 	log.Info("Pikachu started successfully")
 
-	// 等待中断信号
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	return &pipeline{cfg: cfg, mon: mon, dispatch: dispatch}
+}
 
-	<-sigChan
-	log.Info("Received shutdown signal")
+// wait 运行直到收到停止信号或 interrupt 关闭，期间定期保存位点；interrupt 关闭时返回true
+// 返回前停止读取 binlog，调用方随后选择 stop、abort 或 handOver 停止分发器
+func (p *pipeline) wait(ctx context.Context, interrupt <-chan struct{}) bool {
+	// 定期在所有事件都已投递完成时保存位点，进程异常退出后从较新的位点继续
+	var checkpointC <-chan time.Time
+	if p.cfg.Monitor.CheckpointInterval > 0 {
+		ticker := time.NewTicker(p.cfg.Monitor.CheckpointInterval)
+		defer ticker.Stop()
+		checkpointC = ticker.C
+	}
+
+	interrupted := false
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Received shutdown signal")
+			break wait
+		case <-interrupt:
+			interrupted = true
+			break wait
+		case <-checkpointC:
+			if err := p.mon.SaveCheckpointIfIdle(p.dispatch.Idle); err != nil {
+				log.Error("Failed to save checkpoint", zap.Error(err))
+			}
+		}
+	}
 
 	// 更新系统状态
 	systemStatus.mutex.Lock()
@@ -141,13 +302,62 @@ func main() {
 	systemStatus.DispatcherRunning = false
 	systemStatus.mutex.Unlock()
 
-	// 优雅关闭
-	mon.Stop()
-	dispatch.Stop()
+	p.mon.Stop()
+	return interrupted
+}
 
-	log.Info("Pikachu stopped")
-	// 关闭日志器，确保所有日志都被刷新
-	log.Close()
+// stop 优雅关闭：binlog 读取已停止，排空分发器，所有事件都已投递或写入溢出文件后才保存位点
+func (p *pipeline) stop() {
+	if err := p.dispatch.Drain(p.cfg.Dispatcher.DrainTimeout); err != nil {
+		log.Error("Dispatcher drain incomplete, checkpoint not saved", zap.Error(err))
+	} else if err := p.mon.SaveCheckpoint(); err != nil {
+		log.Error("Failed to save checkpoint", zap.Error(err))
+	}
+}
+
+// abort 失去主节点身份后停止：新的主节点可能已经从共享位点开始投递，立即中断并丢弃本次读取的事件的投递，不保存位点，
+// 这些事件由新的主节点从上次保存的位点重新读取；写入溢出文件会在再次成为主节点时重放过期的变更
+func (p *pipeline) abort() {
+	if err := p.dispatch.Abort(); err != nil {
+		log.Error("Failed to stop dispatcher", zap.Error(err))
+	}
+	log.Warn("Checkpoint not saved after losing leadership")
+}
+
+// handOver 集群模式下停止：任务可能分给其他实例，写入本实例溢出文件的投递不会被接管的实例读取，
+// 因此只有在 drain_timeout 内全部投递完成时才保存任务位点，否则丢弃未完成的投递，由接管的实例从上次保存的位点重新投递。
+// 位点只写入本实例仍拥有的任务，已被其他实例取得的任务保持新所有者的位点
+func (p *pipeline) handOver() {
+	if !p.dispatch.WaitIdle(p.cfg.Dispatcher.DrainTimeout) {
+		if err := p.dispatch.Abort(); err != nil {
+			log.Error("Failed to stop dispatcher", zap.Error(err))
+		}
+		log.Warn("Deliveries not finished within drain timeout, task checkpoints not saved")
+		return
+	}
+	if err := p.dispatch.Drain(0); err != nil {
+		log.Error("Dispatcher drain incomplete", zap.Error(err))
+	}
+	if err := p.mon.SaveCheckpoint(); err != nil {
+		log.Error("Failed to save checkpoint", zap.Error(err))
+	}
+}
+
+// setRole 更新实例在主备选举中的角色
+func setRole(role string) {
+	systemStatus.mutex.Lock()
+	systemStatus.Role = role
+	systemStatus.mutex.Unlock()
+}
+
+// clusterStatusOf 返回集群状态，未启用集群模式时返回nil
+func clusterStatusOf() *cluster.Status {
+	coordinator := clusterCoordinator.Load()
+	if coordinator == nil {
+		return nil
+	}
+	clusterStatus := coordinator.Status()
+	return &clusterStatus
 }
 
 // startHealthCheckServer 启动健康检查HTTP服务器
@@ -167,6 +377,7 @@ func startHealthCheckServer(cfg *types.Config) {
 	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		systemStatus.mutex.RLock()
 		queueSize := len(eventQueue)
+		role := systemStatus.Role
 		monitorRunning := systemStatus.MonitorRunning
 		dispatcherRunning := systemStatus.DispatcherRunning
 		lastEventTime := systemStatus.LastEventTime
@@ -180,8 +391,31 @@ func startHealthCheckServer(cfg *types.Config) {
 			"last_event_time":    lastEventTime,
 		}
 
-		// 检查是否所有关键组件都正常运行
-		healthy := monitorRunning && dispatcherRunning
+		// 主备角色，集群模式下各实例都在工作，没有主备之分
+		if role != "" {
+			status["role"] = role
+		}
+		// 集群模式下本实例的 server_id、分到的任务和当前成员
+		idleMember := false
+		if clusterStatus := clusterStatusOf(); clusterStatus != nil {
+			status["cluster"] = clusterStatus
+			idleMember = len(clusterStatus.Tasks) == 0
+		}
+
+		// 熔断器状态，熔断不影响整体健康状态，但需要暴露出来便于排查
+		if circuits := globalMetrics.GetCircuitStates(); len(circuits) > 0 {
+			status["circuit_breakers"] = circuits
+		}
+
+		// 背压状态，暂停读取 binlog 时延迟会持续增加
+		status["backpressure"] = map[string]interface{}{
+			"mode":               cfg.Monitor.Backpressure,
+			"paused":             globalMetrics.IsBackpressurePaused(),
+			"binlog_lag_seconds": globalMetrics.GetBinlogLag().Seconds(),
+		}
+
+		// 检查是否所有关键组件都正常运行，备节点和没有分到任务的集群成员不读取 binlog，等待接管即为正常
+		healthy := role == election.RoleStandby || idleMember || (monitorRunning && dispatcherRunning)
 		if !healthy {
 			status["status"] = "DOWN"
 			w.WriteHeader(http.StatusServiceUnavailable)
@@ -201,14 +435,28 @@ func startHealthCheckServer(cfg *types.Config) {
 
 		// 返回基本的metrics信息
 		metricsData := map[string]interface{}{
-			"task_count":         len(cfg.Tasks),
-			"monitor_running":    systemStatus.MonitorRunning,
-			"dispatcher_running": systemStatus.DispatcherRunning,
-			"event_queue_size":   len(eventQueue),
-			"last_event_time":    systemStatus.LastEventTime,
-			"events_queued":      globalMetrics.GetEventsQueued(),
-			"events_dropped":     globalMetrics.GetEventsDropped(),
-			"cache_size":         globalMetrics.GetCacheSize(),
+			"task_count":                  len(cfg.Tasks),
+			"role":                        systemStatus.Role,
+			"cluster":                     clusterStatusOf(),
+			"monitor_running":             systemStatus.MonitorRunning,
+			"dispatcher_running":          systemStatus.DispatcherRunning,
+			"event_queue_size":            len(eventQueue),
+			"last_event_time":             systemStatus.LastEventTime,
+			"events_queued":               globalMetrics.GetEventsQueued(),
+			"events_dropped":              globalMetrics.GetEventsDropped(),
+			"cache_size":                  globalMetrics.GetCacheSize(),
+			"script_errors":               globalMetrics.GetScriptErrors(),
+			"events_coalesced":            globalMetrics.GetEventsCoalesced(),
+			"dead_lettered":               globalMetrics.GetDeadLettered(),
+			"circuit_opens":               globalMetrics.GetCircuitOpens(),
+			"circuit_breakers":            globalMetrics.GetCircuitStates(),
+			"overflow_pending":            globalMetrics.GetOverflowPending(),
+			"spilled_pending":             globalMetrics.GetSpilledPending(),
+			"concurrency_limits":          globalMetrics.GetConcurrencyLimits(),
+			"binlog_lag_seconds":          globalMetrics.GetBinlogLag().Seconds(),
+			"backpressure_paused":         globalMetrics.IsBackpressurePaused(),
+			"backpressure_pauses":         globalMetrics.GetBackpressurePauses(),
+			"backpressure_paused_seconds": globalMetrics.GetBackpressureTime().Seconds(),
 		}
 
 		w.Header().Set("Content-Type", "application/json")